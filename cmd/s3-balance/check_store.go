@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/storage/storetest"
+)
+
+// runCheckStore 执行 check-store 子命令：对元数据存储实现运行一致性测试
+// 用法: s3-balance check-store [-store all|sql|bolt] [-cached] [-db-type sqlite|mysql|postgres] [-dsn dsn] [-dir path] [-json]
+// -cached 同时检查带查询缓存的包装（sql+cache、bolt+cache）
+// sqlite 与 bolt 使用临时文件；mysql/postgres 会清空并重建 DSN 指向的数据库中的元数据表，只能指向测试库
+func runCheckStore(args []string) {
+	fs := flag.NewFlagSet("check-store", flag.ExitOnError)
+	store := fs.String("store", "all", "Store implementation to check: all, sql, bolt")
+	dbType := fs.String("db-type", "sqlite", "SQL database type: sqlite, mysql, postgres")
+	dsn := fs.String("dsn", "", "SQL DSN (required for mysql/postgres; the metadata tables are DROPPED)")
+	dir := fs.String("dir", "", "Directory for temporary bolt files (default system temp dir)")
+	cached := fs.Bool("cached", false, "Also check each store wrapped with the lookup cache")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+	fs.Parse(args)
+
+	if *dbType != "sqlite" && *dsn == "" {
+		fatal("-dsn is required", "type", *dbType)
+	}
+
+	factories := make(map[string]storetest.Factory)
+	var names []string
+	if *store == "all" || *store == config.MetadataStoreSQL {
+		factories[config.MetadataStoreSQL] = storetest.NewSQLFactory(config.DatabaseConfig{
+			Type:         *dbType,
+			DSN:          *dsn,
+			MaxOpenConns: 1,
+			MaxIdleConns: 1,
+		})
+		names = append(names, config.MetadataStoreSQL)
+	}
+	if *store == "all" || *store == config.MetadataStoreBolt {
+		factories[config.MetadataStoreBolt] = storetest.NewBoltFactory(*dir)
+		names = append(names, config.MetadataStoreBolt)
+	}
+	if len(names) == 0 {
+		fatal("Invalid store, must be one of: all, sql, bolt", "store", *store)
+	}
+	if *cached {
+		for _, name := range names {
+			factories[name+"+cache"] = storetest.WithLookupCache(factories[name])
+			names = append(names, name+"+cache")
+		}
+	}
+
+	results := make(map[string][]storetest.Result)
+	failed := 0
+	for _, name := range names {
+		results[name] = storetest.Run(factories[name])
+		for _, r := range results[name] {
+			if !r.Passed() {
+				failed++
+			}
+			if !*asJSON {
+				status := "PASS"
+				if !r.Passed() {
+					status = "FAIL"
+				}
+				line := fmt.Sprintf("%s %-10s %-22s %s", status, name, r.Name, r.Duration.Round(time.Millisecond))
+				if r.Error != "" {
+					line += ": " + r.Error
+				}
+				fmt.Println(line)
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d check(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
@@ -4,22 +4,27 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/accesslog"
 	"github.com/DullJZ/s3-balance/internal/api"
 	"github.com/DullJZ/s3-balance/internal/balancer"
 	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/cache"
 	"github.com/DullJZ/s3-balance/internal/config"
 	"github.com/DullJZ/s3-balance/internal/database"
+	"github.com/DullJZ/s3-balance/internal/gc"
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/DullJZ/s3-balance/internal/metrics"
 	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/reconcile"
 	"github.com/DullJZ/s3-balance/internal/scheduler"
 	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/DullJZ/s3-balance/internal/tracing"
 	"github.com/DullJZ/s3-balance/internal/web"
 	"github.com/DullJZ/s3-balance/internal/webui"
 	"github.com/DullJZ/s3-balance/pkg/presigner"
@@ -27,7 +32,33 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var (
+	logger        = logging.Logger(logging.SubsystemServer)
+	requestLogger = logging.Logger(logging.SubsystemAPI)
+)
+
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile":
+			runReconcile(os.Args[2:])
+			return
+		case "check-store":
+			runCheckStore(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "recover":
+			runRecover(os.Args[2:])
+			return
+		}
+	}
+
 	// 解析命令行参数
 	var configFile string
 	var onlyWeb bool
@@ -44,29 +75,50 @@ func main() {
 	// 创建配置管理器
 	configManager, err := config.NewManager(configFile)
 	if err != nil {
-		log.Fatalf("Failed to create config manager: %v", err)
+		fatal("Failed to create config manager", "error", err)
 	}
 	defer configManager.Close()
 
 	// 获取初始配置
 	cfg := configManager.GetConfig()
 
+	// 按配置设置日志格式与各子系统级别（之前的日志使用默认的 JSON 格式与 info 级别）
+	if err := logging.Configure(cfg.Logging.Options()); err != nil {
+		fatal("Failed to configure logging", "error", err)
+	}
+
+	// 初始化链路追踪（未启用时各处埋点为空实现）
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
+	}
+	if cfg.Tracing.Enabled {
+		logger.Info("Tracing enabled", "exporter", cfg.Tracing.Exporter)
+	}
+
 	// 初始化数据库
 	if err := database.Initialize(&cfg.Database); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to initialize database", "error", err)
 	}
 	defer database.Close()
 
-	// 创建存储服务
+	// 创建存储服务（令牌、审计、健康事件始终保存在 SQL 数据库中）
 	storageService := storage.NewService(database.GetDB())
 
+	// 打开元数据存储（对象记录、映射、会话、统计、访问日志）
+	metadataStore, closeMetadata, err := openMetadataStore(&cfg.Database, storageService)
+	if err != nil {
+		fatal("Failed to open metadata store", "error", err)
+	}
+	defer closeMetadata()
+
 	// 创建指标服务
 	metricsService := metrics.New()
 
 	// 创建存储桶管理器
-	bucketManager, err := bucket.NewManager(cfg, metricsService, storageService)
+	bucketManager, err := bucket.NewManager(cfg, metricsService, metadataStore, storageService)
 	if err != nil {
-		log.Fatalf("Failed to create bucket manager: %v", err)
+		fatal("Failed to create bucket manager", "error", err)
 	}
 
 	// 启动存储桶管理器（健康检查和统计更新）
@@ -74,10 +126,16 @@ func main() {
 	defer cancel()
 	bucketManager.Start(ctx)
 
+	// 轮询其他实例发布的元数据变更通知，失效本进程的查询缓存
+	if cachedStore, ok := metadataStore.(*storage.CachedStore); ok {
+		cachedStore.Start(ctx)
+		defer cachedStore.Stop()
+	}
+
 	// 创建负载均衡器
 	lb, err := balancer.NewBalancer(bucketManager, &cfg.Balancer)
 	if err != nil {
-		log.Fatalf("Failed to create balancer: %v", err)
+		fatal("Failed to create balancer", "error", err)
 	}
 
 	// 设置指标服务
@@ -90,19 +148,34 @@ func main() {
 	)
 
 	// 启动定期清理过期上传会话的任务
-	startSessionCleaner(ctx, storageService)
+	startSessionCleaner(ctx, metadataStore)
 
 	// 启动月度统计归档任务（每小时检查一次）
-	monthlyArchiver := scheduler.NewMonthlyArchiver(storageService, 1*time.Hour)
+	monthlyArchiver := scheduler.NewMonthlyArchiver(metadataStore, 1*time.Hour)
 	monthlyArchiver.Start()
 	defer monthlyArchiver.Stop()
 
+	// 启动访问日志汇总与过期清理任务（每5分钟执行一次）
+	accessLogMaintainer := scheduler.NewAccessLogMaintainer(metadataStore, cfg.AccessLog, 5*time.Minute)
+	accessLogMaintainer.Start()
+	defer accessLogMaintainer.Stop()
+
+	// 启动垃圾回收：重试待删除的真实对象，中止过期的分片上传
+	garbageCollector := gc.NewCollector(bucketManager, metadataStore, metricsService, configManager.GetConfig)
+	garbageCollector.Start(ctx)
+	defer garbageCollector.Stop()
+
+	// 启动元数据与后端内容对账任务（未启用时只响应手动触发）
+	reconcileJob := reconcile.NewJob(reconcile.NewReconciler(bucketManager, metadataStore), configManager.GetConfig)
+	reconcileJob.Start(ctx)
+	defer reconcileJob.Stop()
+
 	// 创建S3兼容API处理器
 	s3Handler := api.NewS3Handler(
 		bucketManager,
 		lb,
 		signer,
-		storageService,
+		metadataStore,
 		cfg.S3API.AccessKey,
 		cfg.S3API.SecretKey,
 		metricsService,
@@ -110,26 +183,81 @@ func main() {
 		cfg.S3API.AuthRequired,
 		cfg.S3API.VirtualHost,
 		cfg.S3API.Host,
+		cfg.S3API.SpoolDir,
+		cfg.S3API.MaxSpoolSizeBytes,
+		cfg.S3API.AutoMultipart,
 	)
 
+	// 启用代理模式下载的磁盘缓存（修改缓存配置需要重启）
+	if cfg.Cache.Enabled {
+		objectCache, err := cache.New(cache.Config{
+			Dir:           cfg.Cache.Dir,
+			MaxSize:       cfg.Cache.MaxSizeBytes,
+			ChunkSize:     cfg.Cache.ChunkSizeBytes,
+			MaxObjectSize: cfg.Cache.MaxObjectSizeBytes,
+		}, metricsService)
+		if err != nil {
+			fatal("Failed to initialize object cache", "error", err)
+		}
+		s3Handler.SetObjectCache(objectCache)
+		logger.Info("Object cache enabled", "dir", cfg.Cache.Dir, "max_size", cfg.Cache.MaxSize)
+	}
+
+	// 可选把访问日志导出为轮转文件，配置了存储桶时上传到该虚拟存储桶
+	var accessLogSinks []accesslog.Sink
+	if cfg.AccessLog.Sink.Enabled {
+		var uploader accesslog.Uploader
+		if cfg.AccessLog.Sink.Bucket != "" {
+			uploader = s3Handler
+		}
+		fileSink, err := accesslog.NewFileSink(cfg.AccessLog.Sink, uploader)
+		if err != nil {
+			fatal("Failed to initialize access log sink", "error", err)
+		}
+		accessLogSinks = append(accessLogSinks, fileSink)
+		logger.Info("Access log sink enabled", "dir", cfg.AccessLog.Sink.Dir, "format", cfg.AccessLog.Sink.Format)
+	}
+
+	// 访问日志由后台协程批量写入，避免每个请求单独写数据库
+	accessLogWriter := accesslog.NewWriter(metadataStore, metricsService, accesslog.Options{
+		QueueSize:     cfg.Database.AsyncWrite.QueueSize,
+		BatchSize:     cfg.Database.AsyncWrite.BatchSize,
+		FlushInterval: cfg.Database.AsyncWrite.FlushInterval,
+		Sinks:         accessLogSinks,
+	})
+	s3Handler.SetAccessLogWriter(accessLogWriter)
+
 	// 注册配置热更新回调
 	configManager.OnConfigChange(func(newConfig *config.Config) {
-		log.Println("Configuration changed, updating components...")
+		logger.Info("Configuration changed, updating components")
+
+		// 更新日志格式与级别
+		if err := logging.Configure(newConfig.Logging.Options()); err != nil {
+			logger.Error("Failed to update logging config", "error", err)
+		}
 
 		// 更新bucket manager配置
 		if err := bucketManager.UpdateConfig(newConfig); err != nil {
-			log.Printf("Failed to update bucket manager config: %v", err)
+			logger.Error("Failed to update bucket manager config", "error", err)
 		}
 
 		// 更新负载均衡器配置
 		if err := lb.UpdateStrategy(newConfig.Balancer.Strategy); err != nil {
-			log.Printf("Failed to update load balancer strategy: %v", err)
+			logger.Error("Failed to update load balancer strategy", "error", err)
 		}
 
 		// 更新S3 API设置
 		s3Handler.UpdateS3APIConfig(&newConfig.S3API)
 
-		log.Println("Components updated successfully")
+		logger.Info("Components updated")
+	})
+
+	// 配置文件被外部修改时没有HTTP调用方，单独写入审计记录
+	// 通过管理API的修改由处理器按调用方记录
+	configManager.OnConfigTransition(func(oldConfig, newConfig *config.Config, source string) {
+		if source == config.ChangeSourceFile {
+			api.RecordConfigReload(storageService, oldConfig, newConfig)
+		}
 	})
 
 	// 设置路由
@@ -138,49 +266,60 @@ func main() {
 	// 添加指标端点
 	if cfg.Metrics.Enabled {
 		router.Path(cfg.Metrics.Path).Handler(promhttp.Handler())
-		log.Printf("Metrics server enabled at %s", cfg.Metrics.Path)
+		logger.Info("Metrics endpoint enabled", "path", cfg.Metrics.Path)
 	}
 
 	// 注册管理API路由（如果启用）
 	// 必须在S3路由之前注册，因为S3路由使用 /{bucket} 通配符会匹配所有路径
 	if cfg.API.Enabled {
-		log.Println("Management API enabled")
-		adminHandler := api.NewAdminHandler(bucketManager, lb, cfg, configManager)
-		statsHandler := api.NewStatsHandler(storageService)
+		logger.Info("Management API enabled", "path", "/api")
+		adminHandler := api.NewAdminHandler(bucketManager, lb, cfg, configManager, storageService, metadataStore)
+		statsHandler := api.NewStatsHandler(metadataStore)
+		tokenHandler := api.NewTokenHandler(storageService)
+		auditHandler := api.NewAuditHandler(storageService)
+		accessLogHandler := api.NewAccessLogHandler(metadataStore)
+		reconcileHandler := api.NewReconcileHandler(ctx, reconcileJob, storageService)
 
 		// 创建子路由器并应用中间件
+		// 配置文件中的令牌拥有 admin 权限，命名令牌按角色授权
 		apiRouter := router.PathPrefix("/api").Subrouter()
 		apiRouter.Use(corsMiddleware) // 先应用 CORS 中间件，处理 OPTIONS 预检请求
-		apiRouter.Use(middleware.TokenAuthMiddleware(cfg.API.Token))
+		apiRouter.Use(middleware.TokenAuthMiddleware(cfg.API.Token, tokenHandler.Lookup))
 		adminHandler.RegisterRoutes(apiRouter)
 		statsHandler.RegisterRoutes(apiRouter)
-
-		log.Printf("Management API endpoints available at /api/*")
+		tokenHandler.RegisterRoutes(apiRouter)
+		auditHandler.RegisterRoutes(apiRouter)
+		accessLogHandler.RegisterRoutes(apiRouter)
+		reconcileHandler.RegisterRoutes(apiRouter)
 	}
 
 	// 注册Web管理界面
 	distSubFS, err := webui.GetDistFS()
 	if err != nil {
-		log.Fatalf("Failed to load embedded web UI: %v", err)
+		fatal("Failed to load embedded web UI", "error", err)
 	}
 	webHandler := web.NewHandler(distSubFS)
 	router.PathPrefix("/web").Handler(http.StripPrefix("/web", webHandler))
-	log.Println("Web UI available at /web")
+	logger.Info("Web UI enabled", "path", "/web")
 
 	// 运行在S3兼容模式
-	log.Println("Running in S3-compatible mode")
 	s3Handler.RegisterS3Routes(router)
 
+	// 解析客户端地址（访问日志与审计使用），只有可信代理的转发头会被采用
+	router.Use(middleware.ClientIP(func() []string {
+		return configManager.GetConfig().Server.TrustedProxies
+	}))
+
 	// 添加CORS中间件
 	router.Use(corsMiddleware)
 
 	// 添加日志中间件
 	router.Use(loggingMiddleware)
 
-	// 创建HTTP服务器
+	// 创建HTTP服务器（最外层创建请求 span 并写入 x-amz-request-id）
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
-		Handler:      router,
+		Handler:      tracing.Middleware(router, cfg.Metrics.Path, "/web"),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
@@ -188,12 +327,11 @@ func main() {
 
 	// 启动服务器
 	go func() {
-		log.Printf("Starting S3 Balance Service on %s", srv.Addr)
-		log.Printf("Load balancing strategy: %s", cfg.Balancer.Strategy)
-		log.Printf("Managed buckets: %d", len(cfg.Buckets))
+		logger.Info("Starting S3 Balance Service", "addr", srv.Addr,
+			"strategy", cfg.Balancer.Strategy, "buckets", len(cfg.Buckets))
 
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			fatal("Failed to start server", "error", err)
 		}
 	}()
 
@@ -203,27 +341,41 @@ func main() {
 	<-sigChan
 
 	// 优雅关闭
-	log.Println("Shutting down server...")
+	logger.Info("Shutting down server")
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+		logger.Error("Server shutdown error", "error", err)
 	}
 
-	// 停止存储桶管理器
+	// 写入队列中剩余的访问日志
+	accessLogWriter.Close()
+
+	// 停止存储桶管理器（同时写入尚未持久化的操作计数）
 	bucketManager.Stop()
 	cancel()
 
-	log.Println("Server stopped")
+	// 写出尚未导出的 span
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Tracing shutdown error", "error", err)
+	}
+
+	logger.Info("Server stopped")
+}
+
+// fatal 记录错误日志后退出进程
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
 }
 
 // CORS中间件
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
@@ -235,7 +387,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// 日志中间件
+// 日志中间件：每个请求记录一条 api 子系统的日志，请求 ID 与 trace ID 由上下文带入，URI 中的签名参数会被脱敏
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -248,13 +400,13 @@ func loggingMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(wrapped, r)
 
-		log.Printf(
-			"[%s] %s %s %d %v",
-			r.RemoteAddr,
-			r.Method,
-			r.RequestURI,
-			wrapped.statusCode,
-			time.Since(start),
+		requestLogger.InfoContext(r.Context(), "HTTP request",
+			"remote_addr", r.RemoteAddr,
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"status", wrapped.statusCode,
+			"elapsed_ms", time.Since(start).Milliseconds(),
+			"user_agent", r.UserAgent(),
 		)
 	})
 }
@@ -271,7 +423,7 @@ func (rw *responseWriter) WriteHeader(code int) {
 }
 
 // startSessionCleaner 启动定期清理过期会话的任务
-func startSessionCleaner(ctx context.Context, storageService *storage.Service) {
+func startSessionCleaner(ctx context.Context, storageService storage.MetadataStore) {
 	go func() {
 		// 初始延迟，避免启动时立即执行
 		time.Sleep(1 * time.Minute)
@@ -283,53 +435,35 @@ func startSessionCleaner(ctx context.Context, storageService *storage.Service) {
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("Stopping session cleaner")
+				logger.Info("Stopping session cleaner")
 				return
 			case <-ticker.C:
-				log.Println("Cleaning expired upload sessions...")
+				logger.Info("Cleaning expired upload sessions")
 				if err := storageService.CleanExpiredSessions(); err != nil {
-					log.Printf("Failed to clean expired sessions: %v", err)
+					logger.Error("Failed to clean expired sessions", "error", err)
 				} else {
-					log.Println("Successfully cleaned expired upload sessions")
+					logger.Info("Cleaned expired upload sessions")
 				}
-
-				// 同时中止在S3存储桶中过期的分片上传
-				cleanupS3MultipartUploads(ctx, storageService)
 			}
 		}
 	}()
 }
 
-// cleanupS3MultipartUploads 清理S3存储桶中过期的分片上传
-func cleanupS3MultipartUploads(_ context.Context, storageService *storage.Service) {
-	// 获取所有过期的会话
-	sessions, err := storageService.GetPendingUploadSessions("", "", "", 0)
-	if err != nil {
-		log.Printf("Failed to get pending sessions for cleanup: %v", err)
-		return
-	}
-
-	for _, session := range sessions {
-		if session.IsExpired() {
-			log.Printf("Found expired session: uploadID=%s, key=%s", session.UploadID, session.Key)
-			// 此处可以添加调用S3 AbortMultipartUpload的逻辑
-			// 但需要知道对应的真实存储桶信息
-		}
-	}
-}
-
 // startWebOnlyMode 只启动Web前端服务，不启动后端服务
 func startWebOnlyMode(configFile string) {
-	log.Println("Starting in web-only mode (no backend services)")
+	logger.Info("Starting in web-only mode (no backend services)")
 
 	// 加载配置文件以获取端口等信息
 	configManager, err := config.NewManager(configFile)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to load config", "error", err)
 	}
 	defer configManager.Close()
 
 	cfg := configManager.GetConfig()
+	if err := logging.Configure(cfg.Logging.Options()); err != nil {
+		fatal("Failed to configure logging", "error", err)
+	}
 
 	// 创建路由器
 	router := mux.NewRouter()
@@ -337,7 +471,7 @@ func startWebOnlyMode(configFile string) {
 	// 加载嵌入的前端资源
 	distSubFS, err := webui.GetDistFS()
 	if err != nil {
-		log.Fatalf("Failed to load embedded web UI: %v", err)
+		fatal("Failed to load embedded web UI", "error", err)
 	}
 
 	// 注册Web前端路由
@@ -365,13 +499,12 @@ func startWebOnlyMode(configFile string) {
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
-	log.Println("Web UI available at /web")
-	log.Printf("Starting web server on %s", srv.Addr)
+	logger.Info("Starting web server", "addr", srv.Addr, "path", "/web")
 
 	// 启动服务器
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			fatal("Failed to start server", "error", err)
 		}
 	}()
 
@@ -381,13 +514,13 @@ func startWebOnlyMode(configFile string) {
 	<-sigChan
 
 	// 优雅关闭
-	log.Println("Shutting down web server...")
+	logger.Info("Shutting down web server")
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+		logger.Error("Server shutdown error", "error", err)
 	}
 
-	log.Println("Web server stopped")
+	logger.Info("Web server stopped")
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// openMetadataStore 按 database.metadata_store 打开元数据存储
+// sql 时直接复用 SQL 存储服务；bolt 时打开内嵌的 bbolt 文件，返回的 close 函数负责关闭
+// 启用 lookup_cache 时包装为带查询缓存的存储，子命令的写入同样会发布变更通知
+func openMetadataStore(cfg *config.DatabaseConfig, sqlStore *storage.Service) (storage.MetadataStore, func(), error) {
+	var store storage.MetadataStore = sqlStore
+	closeStore := func() {}
+	if cfg.MetadataStore == config.MetadataStoreBolt {
+		boltStore, err := storage.OpenBoltStore(cfg.MetadataPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open bolt metadata store: %w", err)
+		}
+		logger.Info("Using bolt metadata store", "path", cfg.MetadataPath)
+		store = boltStore
+		closeStore = func() {
+			if err := boltStore.Close(); err != nil {
+				logger.Error("Failed to close bolt metadata store", "error", err)
+			}
+		}
+	}
+
+	if !cfg.LookupCache.IsEnabled() {
+		return store, closeStore, nil
+	}
+	opts := storage.LookupCacheOptions{
+		MaxEntries:   cfg.LookupCache.MaxEntries,
+		TTL:          cfg.LookupCache.TTL,
+		NegativeTTL:  cfg.LookupCache.NegativeTTL,
+		PollInterval: cfg.LookupCache.PollInterval,
+	}
+	if cfg.ChangeFeedEnabled() {
+		opts.Changes = sqlStore
+	}
+	return storage.NewCachedStore(store, opts), closeStore, nil
+}
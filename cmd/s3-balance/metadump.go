@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/database"
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"github.com/DullJZ/s3-balance/internal/metadump"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// openConfiguredMetadataStore 按配置文件打开数据库与元数据存储，返回的 close 函数负责全部清理
+func openConfiguredMetadataStore(configFile string) (*config.Config, storage.MetadataStore, func()) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fatal("Failed to load config", "error", err)
+	}
+	if err := logging.Configure(cfg.Logging.Options()); err != nil {
+		fatal("Failed to configure logging", "error", err)
+	}
+	if err := database.Initialize(&cfg.Database); err != nil {
+		fatal("Failed to initialize database", "error", err)
+	}
+	store, closeMetadata, err := openMetadataStore(&cfg.Database, storage.NewService(database.GetDB()))
+	if err != nil {
+		database.Close()
+		fatal("Failed to open metadata store", "error", err)
+	}
+	return cfg, store, func() {
+		closeMetadata()
+		database.Close()
+	}
+}
+
+// runExport 执行 export 子命令：把元数据导出为驱动无关的 JSON Lines 文件
+// 用法: s3-balance export [-config path] [-out dump.jsonl]（-out 为 - 时写到标准输出）
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configFile := fs.String("config", "config/config.yaml", "Path to configuration file")
+	out := fs.String("out", "-", "Output file (- for stdout)")
+	fs.Parse(args)
+
+	cfg, store, closeStore := openConfiguredMetadataStore(*configFile)
+	defer closeStore()
+
+	var w io.Writer = os.Stdout
+	var tmpPath string
+	var file *os.File
+	if *out != "-" {
+		// 先写临时文件，完成后再改名，避免留下不完整的导出文件
+		tmpPath = *out + ".tmp"
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			fatal("Failed to create output file", "error", err)
+		}
+		file = f
+		w = f
+	}
+
+	summary, err := metadump.Export(store, w, cfg.Database.MetadataStore)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmpPath, *out)
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}
+	if err != nil {
+		fatal("Export failed", "error", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d objects, %d mappings, %d upload sessions, %d bucket stats, %d monthly stats in %s\n",
+		summary.Counts.Objects, summary.Counts.Mappings, summary.Counts.UploadSessions,
+		summary.Counts.BucketStats, summary.Counts.MonthlyStats, summary.Duration.Round(1e6))
+}
+
+// runImport 执行 import 子命令：把导出文件写入配置的元数据存储
+// 用法: s3-balance import [-config path] [-in dump.jsonl] [-force] [-batch-size n]（-in 为 - 时从标准输入读取）
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configFile := fs.String("config", "config/config.yaml", "Path to configuration file")
+	in := fs.String("in", "-", "Input file (- for stdin)")
+	force := fs.Bool("force", false, "Merge into a non-empty store (records with the same key are overwritten)")
+	batchSize := fs.Int("batch-size", 500, "Records written per transaction")
+	fs.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fatal("Failed to open input file", "error", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	_, store, closeStore := openConfiguredMetadataStore(*configFile)
+	defer closeStore()
+
+	summary, err := metadump.Import(store, r, metadump.ImportOptions{Force: *force, BatchSize: *batchSize})
+	if summary != nil {
+		fmt.Fprintf(os.Stderr, "Imported %d objects, %d mappings, %d upload sessions, %d bucket stats, %d monthly stats",
+			summary.Counts.Objects, summary.Counts.Mappings, summary.Counts.UploadSessions,
+			summary.Counts.BucketStats, summary.Counts.MonthlyStats)
+		if summary.Header.Source != "" {
+			fmt.Fprintf(os.Stderr, " (exported from %s at %s)", summary.Header.Source, summary.Header.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		closeStore()
+		fatal("Import failed", "error", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/database"
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"github.com/DullJZ/s3-balance/internal/reconcile"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// runReconcile 执行 reconcile 子命令：对账一次并输出报告
+// 用法: s3-balance reconcile [-config path] [-mode report|adopt|delete-orphans|purge-dangling] [-adopt-into vbucket] [-bucket a,b] [-json]
+func runReconcile(args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	configFile := fs.String("config", "config/config.yaml", "Path to configuration file")
+	mode := fs.String("mode", "", "Fix mode: report, adopt, delete-orphans, purge-dangling (default from config)")
+	adoptInto := fs.String("adopt-into", "", "Virtual bucket to adopt orphans into (adopt mode)")
+	buckets := fs.String("bucket", "", "Comma-separated real buckets to reconcile (default all)")
+	minAge := fs.Duration("min-age", -1, "Only treat backend objects older than this as orphans (default from config)")
+	pageInterval := fs.Duration("page-interval", -1, "Minimum delay between list requests (default from config)")
+	asJSON := fs.Bool("json", false, "Print the full report as JSON")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fatal("Failed to load config", "error", err)
+	}
+	if err := logging.Configure(cfg.Logging.Options()); err != nil {
+		fatal("Failed to configure logging", "error", err)
+	}
+
+	if err := database.Initialize(&cfg.Database); err != nil {
+		fatal("Failed to initialize database", "error", err)
+	}
+	defer database.Close()
+
+	storageService := storage.NewService(database.GetDB())
+	metadataStore, closeMetadata, err := openMetadataStore(&cfg.Database, storageService)
+	if err != nil {
+		fatal("Failed to open metadata store", "error", err)
+	}
+	defer closeMetadata()
+
+	// 只需要存储桶客户端，不启动健康检查与统计任务
+	bucketManager, err := bucket.NewManager(cfg, nil, metadataStore, storageService)
+	if err != nil {
+		fatal("Failed to create bucket manager", "error", err)
+	}
+
+	opts := reconcile.OptionsFromConfig(cfg.Reconcile)
+	if *mode != "" {
+		opts.Mode = *mode
+	}
+	if *adoptInto != "" {
+		opts.AdoptInto = *adoptInto
+	}
+	if *buckets != "" {
+		opts.Buckets = strings.Split(*buckets, ",")
+	}
+	if *minAge >= 0 {
+		opts.MinAge = *minAge
+	}
+	if *pageInterval >= 0 {
+		opts.PageInterval = *pageInterval
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	reconciler := reconcile.NewReconciler(bucketManager, metadataStore)
+	report, err := reconciler.Run(ctx, opts)
+	if err != nil && report == nil {
+		fatal("Reconcile failed", "error", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printReconcileReport(report)
+	}
+
+	if err != nil {
+		fatal("Reconcile interrupted", "error", err)
+	}
+}
+
+// printReconcileReport 以文本形式输出对账报告
+func printReconcileReport(report *reconcile.Report) {
+	fmt.Printf("Mode: %s\n", report.Mode)
+	fmt.Printf("Buckets: %s\n", strings.Join(report.Buckets, ", "))
+	fmt.Printf("Backend objects: %d\n", report.BackendObjects)
+	fmt.Printf("Duration: %s\n", report.FinishedAt.Sub(report.StartedAt).Round(1e6))
+
+	for _, f := range report.Findings {
+		line := fmt.Sprintf("%-18s %s/%s", f.Kind, f.Bucket, f.Key)
+		if f.VirtualBucket != "" {
+			line += " (virtual " + f.VirtualBucket + ")"
+		}
+		switch f.Kind {
+		case reconcile.KindSizeMismatch:
+			line += fmt.Sprintf(" db=%d backend=%d", f.DBSize, f.BackendSize)
+		case reconcile.KindETagMismatch:
+			line += fmt.Sprintf(" db=%s backend=%s", f.DBETag, f.BackendETag)
+		}
+		if f.Action != "" {
+			line += " -> " + f.Action
+		}
+		if f.Error != "" {
+			line += " -> error: " + f.Error
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Printf("Summary: %d missing on backend, %d orphans, %d size mismatches, %d etag mismatches\n",
+		report.Counts[reconcile.KindMissingOnBackend], report.Counts[reconcile.KindOrphan],
+		report.Counts[reconcile.KindSizeMismatch], report.Counts[reconcile.KindETagMismatch])
+	for _, e := range report.Errors {
+		fmt.Printf("Error: %s\n", e)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/recovery"
+)
+
+// runRecover 执行 recover 子命令：扫描真实存储桶，按放置标记重建对象记录与虚拟映射
+// 用法: s3-balance recover [-config path] [-bucket a,b] [-state file] [-reset] [-dry-run] [-adopt-unmarked vbucket] [-concurrency n] [-json]
+func runRecover(args []string) {
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	configFile := fs.String("config", "config/config.yaml", "Path to configuration file")
+	buckets := fs.String("bucket", "", "Comma-separated real buckets to scan (default all)")
+	statePath := fs.String("state", "recover-state.json", "Progress file; an interrupted run resumes from it (empty to disable)")
+	reset := fs.Bool("reset", false, "Discard the progress file and scan from the beginning")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be restored")
+	adoptUnmarked := fs.String("adopt-unmarked", "", "Virtual bucket to adopt objects without placement markers into (by their backend key)")
+	concurrency := fs.Int("concurrency", 8, "Concurrent HeadObject requests per bucket")
+	pageInterval := fs.Duration("page-interval", 0, "Minimum delay between list requests")
+	asJSON := fs.Bool("json", false, "Print the full report as JSON")
+	fs.Parse(args)
+
+	if *reset && *statePath != "" {
+		if err := os.Remove(*statePath); err != nil && !os.IsNotExist(err) {
+			fatal("Failed to remove recovery state", "error", err)
+		}
+	}
+
+	cfg, store, closeStore := openConfiguredMetadataStore(*configFile)
+	defer closeStore()
+
+	// 只需要存储桶客户端，不启动健康检查与统计任务
+	bucketManager, err := bucket.NewManager(cfg, nil, store, nil)
+	if err != nil {
+		fatal("Failed to create bucket manager", "error", err)
+	}
+
+	opts := recovery.Options{
+		DryRun:        *dryRun,
+		AdoptUnmarked: *adoptUnmarked,
+		Concurrency:   *concurrency,
+		PageInterval:  *pageInterval,
+		StatePath:     *statePath,
+	}
+	if *buckets != "" {
+		opts.Buckets = strings.Split(*buckets, ",")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := recovery.NewRecoverer(bucketManager, store).Run(ctx, opts)
+	if err != nil && report == nil {
+		closeStore()
+		fatal("Recover failed", "error", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printRecoverReport(report)
+	}
+
+	if err != nil {
+		closeStore()
+		fatal("Recover interrupted, run again to resume", "state", *statePath, "error", err)
+	}
+}
+
+// printRecoverReport 以文本形式输出恢复报告
+func printRecoverReport(report *recovery.Report) {
+	if report.DryRun {
+		fmt.Println("Dry run: no metadata was written")
+	}
+	fmt.Printf("Buckets: %s\n", strings.Join(report.Buckets, ", "))
+	if len(report.Skipped) > 0 {
+		fmt.Printf("Already completed: %s\n", strings.Join(report.Skipped, ", "))
+	}
+	fmt.Printf("Scanned: %d, restored: %d\n", report.Scanned, report.Restored)
+	fmt.Printf("Duration: %s\n", report.FinishedAt.Sub(report.StartedAt).Round(1e6))
+
+	for _, f := range report.Findings {
+		line := fmt.Sprintf("%-22s %s/%s", f.Kind, f.Bucket, f.Key)
+		if f.VirtualBucket != "" {
+			line += " (virtual " + f.VirtualBucket
+			if f.VirtualKey != "" {
+				line += "/" + f.VirtualKey
+			}
+			line += ")"
+		}
+		if f.Existing != "" {
+			line += " vs " + f.Existing
+		}
+		if f.Action != "" {
+			line += " -> " + f.Action
+		}
+		if f.Error != "" {
+			line += " -> error: " + f.Error
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Printf("Summary: %d unmarked, %d conflicts, %d key collisions, %d unknown virtual buckets, %d head failures, %d write failures\n",
+		report.Counts[recovery.KindUnmarked], report.Counts[recovery.KindConflict],
+		report.Counts[recovery.KindKeyCollision], report.Counts[recovery.KindUnknownVirtualBucket],
+		report.Counts[recovery.KindHeadFailed], report.Counts[recovery.KindWriteFailed])
+	for _, e := range report.Errors {
+		fmt.Printf("Error: %s\n", e)
+	}
+}
@@ -0,0 +1,118 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// s3Operations 访问日志动作对应的 S3 服务器访问日志操作名与 HTTP 方法
+var s3Operations = map[string]struct{ operation, method string }{
+	"list_buckets":              {"REST.GET.SERVICE", "GET"},
+	"list_objects":              {"REST.GET.BUCKET", "GET"},
+	"head_bucket":               {"REST.HEAD.BUCKET", "HEAD"},
+	"create_bucket":             {"REST.PUT.BUCKET", "PUT"},
+	"delete_bucket":             {"REST.DELETE.BUCKET", "DELETE"},
+	"list_multipart_uploads":    {"REST.GET.UPLOADS", "GET"},
+	"list_multipart_parts":      {"REST.GET.UPLOAD", "GET"},
+	"download_object":           {"REST.GET.OBJECT", "GET"},
+	"head_object":               {"REST.HEAD.OBJECT", "HEAD"},
+	"upload_object":             {"REST.PUT.OBJECT", "PUT"},
+	"upload_part":               {"REST.PUT.PART", "PUT"},
+	"delete_object":             {"REST.DELETE.OBJECT", "DELETE"},
+	"abort_multipart_upload":    {"REST.DELETE.UPLOAD", "DELETE"},
+	"initiate_multipart_upload": {"REST.POST.UPLOADS", "POST"},
+	"complete_multipart_upload": {"REST.POST.UPLOAD", "POST"},
+}
+
+// formatJSON 把访问日志格式化为一行 JSON
+func formatJSON(entry *storage.AccessLog) ([]byte, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// formatS3 把访问日志格式化为 AWS S3 服务器访问日志格式的一行
+// 代理没有记录的字段（请求者、请求 ID、TLS 信息等）输出为 "-"
+func formatS3(entry *storage.AccessLog) ([]byte, error) {
+	op, ok := s3Operations[entry.Action]
+	if !ok {
+		op.operation = "REST." + strings.ToUpper(entry.Action)
+		op.method = strings.ToUpper(entry.Action)
+	}
+
+	path := "/"
+	if entry.BucketName != "" {
+		path += entry.BucketName
+		if entry.Key != "" {
+			path += "/" + entry.Key
+		}
+	}
+	requestURI := fmt.Sprintf("%s %s HTTP/1.1", op.method, (&url.URL{Path: path}).EscapedPath())
+
+	status := "-"
+	if entry.StatusCode > 0 {
+		status = strconv.Itoa(entry.StatusCode)
+	}
+	errorCode := "-"
+	if !entry.Success && entry.ErrorMsg != "" {
+		errorCode = strings.ReplaceAll(entry.ErrorMsg, " ", "")
+	}
+	// 下载类请求的 Size 为返回的字节数，上传类请求为对象大小
+	bytesSent, objectSize := "-", "-"
+	if op.method == "PUT" || op.method == "POST" {
+		objectSize = strconv.FormatInt(entry.Size, 10)
+	} else {
+		bytesSent = strconv.FormatInt(entry.Size, 10)
+	}
+
+	fields := []string{
+		"-", // bucket owner
+		orDash(entry.BucketName),
+		"[" + entry.CreatedAt.UTC().Format("02/Jan/2006:15:04:05 -0700") + "]",
+		orDash(entry.ClientIP),
+		"-", // requester
+		"-", // request ID
+		op.operation,
+		orDash(url.PathEscape(entry.Key)),
+		quote(requestURI),
+		status,
+		errorCode,
+		bytesSent,
+		objectSize,
+		strconv.FormatInt(entry.ResponseTime, 10),
+		"-",   // turn-around time
+		`"-"`, // referer
+		quote(entry.UserAgent),
+		"-", // version ID
+		"-", // host ID
+		"-", // signature version
+		"-", // cipher suite
+		"-", // authentication type
+		orDash(entry.Host),
+		"-", // TLS version
+		"-", // access point ARN
+		"-", // ACL required
+	}
+	return []byte(strings.Join(fields, " ") + "\n"), nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func quote(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
@@ -0,0 +1,259 @@
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// 日志文件名前缀，目录中只处理以此开头的文件
+const sinkFilePrefix = "access-"
+
+// uploadTimeout 上传单个日志文件的超时
+const uploadTimeout = 5 * time.Minute
+
+// Sink 访问日志的额外输出，由写入协程在写入元数据存储后调用
+type Sink interface {
+	// Write 写入一批日志
+	Write(entries []*storage.AccessLog) error
+	// Flush 把缓冲的数据写出，并检查是否需要按时间轮转
+	Flush() error
+	// Close 写出剩余数据并释放资源
+	Close() error
+}
+
+// Uploader 把文件写入虚拟存储桶（由 S3 处理器实现，与客户端 PUT 使用相同的放置流程）
+type Uploader interface {
+	PutObject(ctx context.Context, bucketName, key string, body io.Reader, size int64, contentType string) error
+}
+
+// FileSink 把访问日志写入按大小和时间轮转的文件
+// 配置了存储桶时，轮转后的文件上传到该虚拟存储桶并从本地删除；上传失败的文件留在目录中，下次轮转时重试
+type FileSink struct {
+	cfg      config.AccessLogSinkConfig
+	uploader Uploader
+	format   func(*storage.AccessLog) ([]byte, error)
+	ext      string
+
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+	opened  time.Time
+	uploads sync.WaitGroup
+	mu      sync.Mutex // 串行化后台的上传与清理
+}
+
+// NewFileSink 创建文件输出，uploader 在 cfg.Bucket 为空时可为 nil
+func NewFileSink(cfg config.AccessLogSinkConfig, uploader Uploader) (*FileSink, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create access log directory: %w", err)
+	}
+	if cfg.Bucket != "" && uploader == nil {
+		return nil, fmt.Errorf("access log bucket %s configured without an uploader", cfg.Bucket)
+	}
+
+	s := &FileSink{cfg: cfg, uploader: uploader, format: formatJSON, ext: ".jsonl"}
+	if cfg.Format == config.AccessLogFormatS3 {
+		s.format, s.ext = formatS3, ".log"
+	}
+
+	// 上传上次运行遗留的文件
+	s.afterRotate()
+	return s, nil
+}
+
+// Write 写入一批日志，文件超过大小上限时轮转
+func (s *FileSink) Write(entries []*storage.AccessLog) error {
+	for _, entry := range entries {
+		line, err := s.format(entry)
+		if err != nil {
+			return fmt.Errorf("failed to format access log: %w", err)
+		}
+		if s.file == nil {
+			if err := s.open(); err != nil {
+				return err
+			}
+		}
+		n, err := s.buf.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to write access log file: %w", err)
+		}
+		if s.cfg.RotateSizeBytes > 0 && s.size >= s.cfg.RotateSizeBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush 把缓冲的数据写入文件，文件打开时间超过轮转间隔时轮转
+func (s *FileSink) Flush() error {
+	if s.file == nil {
+		return nil
+	}
+	if s.cfg.RotateInterval > 0 && time.Since(s.opened) >= s.cfg.RotateInterval {
+		return s.rotate()
+	}
+	if err := s.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write access log file: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭当前文件，等待进行中的上传完成后上传剩余的文件
+func (s *FileSink) Close() error {
+	err := s.closeFile()
+	s.uploads.Wait()
+	if files, listErr := s.finishedFiles(); listErr != nil {
+		logger.Error("Failed to list access log files", "dir", s.cfg.Dir, "error", listErr)
+	} else {
+		s.processFinished(files)
+	}
+	return err
+}
+
+// open 创建新的日志文件，文件名与 S3 服务器访问日志相同：时间加随机串，多个实例写入同一存储桶时不会冲突
+func (s *FileSink) open() error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate access log file name: %w", err)
+	}
+	now := time.Now()
+	name := sinkFilePrefix + now.UTC().Format("2006-01-02-15-04-05") + "-" + hex.EncodeToString(suffix) + s.ext
+
+	f, err := os.OpenFile(filepath.Join(s.cfg.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create access log file: %w", err)
+	}
+	s.file, s.buf, s.size, s.opened = f, bufio.NewWriter(f), 0, now
+	return nil
+}
+
+// rotate 关闭当前文件，之后的日志写入新文件
+func (s *FileSink) rotate() error {
+	err := s.closeFile()
+	s.afterRotate()
+	return err
+}
+
+func (s *FileSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	flushErr := s.buf.Flush()
+	closeErr := s.file.Close()
+	s.file, s.buf = nil, nil
+	if flushErr != nil {
+		return fmt.Errorf("failed to write access log file: %w", flushErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close access log file: %w", closeErr)
+	}
+	return nil
+}
+
+// afterRotate 在后台上传或清理已完成的文件，不阻塞写入协程
+// 调用时没有正在写入的文件，目录中的日志文件都已完成；文件列表在写入协程中取得，不会包含之后新建的文件
+func (s *FileSink) afterRotate() {
+	if s.cfg.Bucket == "" && s.cfg.MaxFiles <= 0 {
+		return
+	}
+	files, err := s.finishedFiles()
+	if err != nil {
+		logger.Error("Failed to list access log files", "dir", s.cfg.Dir, "error", err)
+		return
+	}
+	s.uploads.Add(1)
+	go func() {
+		defer s.uploads.Done()
+		s.processFinished(files)
+	}()
+}
+
+// processFinished 上传已完成的文件（配置了存储桶时），或删除超出 max_files 的旧文件
+func (s *FileSink) processFinished(files []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.Bucket != "" {
+		for _, name := range files {
+			if err := s.upload(name); err != nil {
+				logger.Error("Failed to upload access log file", "file", name, "bucket", s.cfg.Bucket, "error", err)
+				return
+			}
+		}
+		return
+	}
+
+	if s.cfg.MaxFiles > 0 && len(files) > s.cfg.MaxFiles {
+		for _, name := range files[:len(files)-s.cfg.MaxFiles] {
+			if err := os.Remove(filepath.Join(s.cfg.Dir, name)); err != nil && !os.IsNotExist(err) {
+				logger.Warn("Failed to remove old access log file", "file", name, "error", err)
+			}
+		}
+	}
+}
+
+// finishedFiles 按时间顺序返回目录中的日志文件，只在没有正在写入的文件时调用
+func (s *FileSink) finishedFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, sinkFilePrefix) {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// upload 上传一个已完成的文件，成功后从本地删除
+func (s *FileSink) upload(name string) error {
+	path := filepath.Join(s.cfg.Dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	contentType := "application/x-ndjson"
+	if s.cfg.Format == config.AccessLogFormatS3 {
+		contentType = "text/plain"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	if err := s.uploader.PutObject(ctx, s.cfg.Bucket, s.cfg.Prefix+name, f, info.Size(), contentType); err != nil {
+		return err
+	}
+	f.Close()
+	if err := os.Remove(path); err != nil {
+		logger.Warn("Failed to remove uploaded access log file", "file", name, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package accesslog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"github.com/DullJZ/s3-balance/internal/metrics"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+var logger = logging.Logger(logging.SubsystemAccessLog)
+
+// 丢弃原因（s3_balance_access_log_dropped_total 的 reason 标签）
+const (
+	DropQueueFull  = "queue_full"
+	DropWriteError = "write_error"
+	DropClosed     = "closed"
+)
+
+// Options 后台写入参数
+type Options struct {
+	QueueSize     int           // 队列长度，队列已满时丢弃新的日志
+	BatchSize     int           // 单次写入的最大条数
+	FlushInterval time.Duration // 未攒满一批时的写入间隔
+	Sinks         []Sink        // 写入元数据存储之后的额外输出（如日志文件）
+}
+
+// Writer 访问日志的后台批量写入器
+// 请求路径只把日志放入有界队列，由一个后台协程按批写入元数据存储；
+// 队列已满或写入失败时丢弃日志并计入指标，不会阻塞请求
+type Writer struct {
+	store   storage.MetadataStore
+	metrics *metrics.Metrics
+	opts    Options
+
+	queue   chan *storage.AccessLog
+	stop    chan struct{}
+	done    chan struct{}
+	closed  atomic.Bool
+	once    sync.Once
+	dropped atomic.Int64 // 上次输出日志以来因队列已满丢弃的条数
+}
+
+// NewWriter 创建访问日志写入器并启动后台写入协程，metrics 可为 nil
+func NewWriter(store storage.MetadataStore, m *metrics.Metrics, opts Options) *Writer {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	w := &Writer{
+		store:   store,
+		metrics: m,
+		opts:    opts,
+		queue:   make(chan *storage.AccessLog, opts.QueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Record 把一条访问日志放入队列，队列已满或写入器已关闭时丢弃并返回 false
+func (w *Writer) Record(entry *storage.AccessLog) bool {
+	if entry.CreatedAt.IsZero() {
+		// 以请求完成的时间为准，而不是写入数据库的时间；
+		// 去掉单调时钟读数，SQLite 驱动按字符串保存时间，需与 GORM 自动填充的格式一致才能按时间过滤
+		entry.CreatedAt = time.Now().Round(0)
+	}
+	if w.closed.Load() {
+		w.drop(DropClosed, 1)
+		return false
+	}
+	select {
+	case w.queue <- entry:
+		return true
+	default:
+		w.dropped.Add(1)
+		w.drop(DropQueueFull, 1)
+		return false
+	}
+}
+
+// Close 停止接收新的日志，写入队列中剩余的日志后返回
+func (w *Writer) Close() {
+	w.once.Do(func() {
+		w.closed.Store(true)
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*storage.AccessLog, 0, w.opts.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			w.write(batch)
+			batch = make([]*storage.AccessLog, 0, w.opts.BatchSize)
+		}
+		w.reportQueue()
+	}
+	defer w.closeSinks()
+
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) >= w.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			w.flushSinks()
+		case <-w.stop:
+			// 关闭时写完队列中已有的日志
+			for {
+				select {
+				case entry := <-w.queue:
+					batch = append(batch, entry)
+					if len(batch) >= w.opts.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// write 写入一批日志，失败时整批丢弃（重试会让队列在数据库故障期间持续积压）
+// 额外输出与元数据存储相互独立，数据库写入失败的日志仍会写入文件
+func (w *Writer) write(batch []*storage.AccessLog) {
+	if err := w.store.RecordAccessLogs(batch); err != nil {
+		logger.Error("Failed to record access logs", "count", len(batch), "error", err)
+		w.drop(DropWriteError, len(batch))
+	}
+	for _, sink := range w.opts.Sinks {
+		if err := sink.Write(batch); err != nil {
+			logger.Error("Failed to write access logs to sink", "count", len(batch), "error", err)
+		}
+	}
+}
+
+func (w *Writer) flushSinks() {
+	for _, sink := range w.opts.Sinks {
+		if err := sink.Flush(); err != nil {
+			logger.Error("Failed to flush access log sink", "error", err)
+		}
+	}
+}
+
+func (w *Writer) closeSinks() {
+	for _, sink := range w.opts.Sinks {
+		if err := sink.Close(); err != nil {
+			logger.Error("Failed to close access log sink", "error", err)
+		}
+	}
+}
+
+// reportQueue 更新队列长度指标，并汇总输出因队列已满丢弃的日志数
+func (w *Writer) reportQueue() {
+	if w.metrics != nil {
+		w.metrics.SetAccessLogQueueLength(len(w.queue))
+	}
+	if dropped := w.dropped.Swap(0); dropped > 0 {
+		logger.Warn("Access log queue is full, entries dropped", "dropped", dropped)
+	}
+}
+
+func (w *Writer) drop(reason string, count int) {
+	if w.metrics != nil {
+		w.metrics.RecordAccessLogDropped(reason, count)
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"context"
 	"errors"
-	"log"
 	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/accesslog"
+	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -19,6 +21,11 @@ const (
 	errorCodeKey accessLogContextKey = "errorCode"
 )
 
+// SetAccessLogWriter 设置访问日志的后台批量写入器，nil 表示每个请求单独写入
+func (h *S3Handler) SetAccessLogWriter(w *accesslog.Writer) {
+	h.accessLogs = w
+}
+
 func (h *S3Handler) accessLogMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if h.storage == nil {
@@ -53,18 +60,35 @@ func (h *S3Handler) accessLogMiddleware(next http.Handler) http.Handler {
 
 		size := calculateLogSize(r, lrw)
 		duration := time.Since(start)
-		h.recordAccessLog(r, action, bucket, key, size, success, errMsg, duration)
+		h.recordAccessLog(r, action, bucket, key, size, lrw.statusCode, errMsg, duration)
 	})
 }
 
-func (h *S3Handler) recordAccessLog(r *http.Request, action, bucket, key string, size int64, success bool, errMsg string, duration time.Duration) {
+func (h *S3Handler) recordAccessLog(r *http.Request, action, bucket, key string, size int64, statusCode int, errMsg string, duration time.Duration) {
+	success := statusCode < 400
 	clientIP := extractClientIP(r)
 	userAgent := r.UserAgent()
 	host := r.Host
+	if h.accessLogs != nil {
+		h.accessLogs.Record(&storage.AccessLog{
+			Action:       action,
+			Key:          key,
+			BucketName:   bucket,
+			ClientIP:     clientIP,
+			UserAgent:    userAgent,
+			Host:         host,
+			Size:         size,
+			Success:      success,
+			ErrorMsg:     errMsg,
+			StatusCode:   statusCode,
+			ResponseTime: duration.Milliseconds(),
+		})
+		return
+	}
 	// 异步记录日志，避免阻塞请求响应
 	go func() {
 		if err := h.storage.RecordAccessLog(action, key, bucket, clientIP, userAgent, host, size, success, errMsg, duration.Milliseconds()); err != nil {
-			log.Printf("failed to record access log: %v", err)
+			logger.Error("Failed to record access log", "action", action, "bucket", bucket, "key", key, "error", err)
 		}
 	}()
 }
@@ -198,19 +222,15 @@ func calculateLogSize(r *http.Request, lrw *loggingResponseWriter) int64 {
 	return lrw.bytesWritten
 }
 
+// extractClientIP 返回 ClientIP 中间件解析的客户端地址，未经过中间件时为直连对端地址
+// 转发头只在对端属于 server.trusted_proxies 时采用，避免任意调用方伪造来源
 func extractClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
-		}
-	}
-	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		return strings.TrimSpace(xrip)
-	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+	return clientAddr(r).IP
+}
+
+func clientAddr(r *http.Request) middleware.ClientAddr {
+	if addr, ok := middleware.ClientAddrFromContext(r.Context()); ok {
+		return addr
 	}
-	return host
+	return middleware.ResolveClientAddr(r, nil)
 }
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAccessLogLimit = 100
+	maxAccessLogLimit     = 1000
+)
+
+// AccessLogHandler 访问日志查询与导出处理器
+type AccessLogHandler struct {
+	storage storage.MetadataStore
+}
+
+// NewAccessLogHandler 创建访问日志处理器
+func NewAccessLogHandler(storage storage.MetadataStore) *AccessLogHandler {
+	return &AccessLogHandler{
+		storage: storage,
+	}
+}
+
+// AccessLogsResponse 访问日志查询响应
+type AccessLogsResponse struct {
+	Total  int64                `json:"total"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
+	Logs   []*storage.AccessLog `json:"logs"`
+}
+
+// AccessLogRollupsResponse 访问日志汇总查询响应
+type AccessLogRollupsResponse struct {
+	Granularity string                     `json:"granularity"`
+	Rollups     []*storage.AccessLogRollup `json:"rollups"`
+}
+
+// RegisterRoutes 注册访问日志路由
+// 注意: router 参数应该是已经带有 /api 前缀的子路由器
+func (h *AccessLogHandler) RegisterRoutes(router *mux.Router) {
+	handleWithRole(router, "/access-logs", middleware.RoleOperator, h.ListAccessLogs, http.MethodGet)
+	handleWithRole(router, "/access-logs/rollups", middleware.RoleViewer, h.ListAccessLogRollups, http.MethodGet)
+}
+
+// ListAccessLogs 查询访问日志，按时间倒序分页
+// 支持的过滤参数: action, key, bucket, client_ip, success, start_time, end_time (RFC3339), limit, offset
+// format=csv 时以 CSV 文件返回当前页
+func (h *AccessLogHandler) ListAccessLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &storage.AccessLogFilter{
+		Action:     query.Get("action"),
+		Key:        query.Get("key"),
+		BucketName: query.Get("bucket"),
+		ClientIP:   query.Get("client_ip"),
+		Limit:      defaultAccessLogLimit,
+	}
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, `{"error": "invalid format, expected json or csv"}`, http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid success, expected true or false"}`, http.StatusBadRequest)
+			return
+		}
+		filter.Success = &success
+	}
+	if v := query.Get("start_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid start_time, expected RFC3339"}`, http.StatusBadRequest)
+			return
+		}
+		filter.StartTime = t
+	}
+	if v := query.Get("end_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid end_time, expected RFC3339"}`, http.StatusBadRequest)
+			return
+		}
+		filter.EndTime = t
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, `{"error": "invalid limit"}`, http.StatusBadRequest)
+			return
+		}
+		if limit > maxAccessLogLimit {
+			limit = maxAccessLogLimit
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			http.Error(w, `{"error": "invalid offset"}`, http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	total, err := h.storage.CountAccessLogs(filter)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to count access logs", "error", err)
+		http.Error(w, `{"error": "failed to query access logs"}`, http.StatusInternalServerError)
+		return
+	}
+	logs, err := h.storage.GetAccessLogs(filter)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to query access logs", "error", err)
+		http.Error(w, `{"error": "failed to query access logs"}`, http.StatusInternalServerError)
+		return
+	}
+	if logs == nil {
+		logs = make([]*storage.AccessLog, 0)
+	}
+
+	if format == "csv" {
+		writeAccessLogsCSV(w, total, logs)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AccessLogsResponse{
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+		Logs:   logs,
+	})
+}
+
+// writeAccessLogsCSV 以 CSV 返回访问日志，总数放在 X-Total-Count 响应头中供分页导出
+func writeAccessLogsCSV(w http.ResponseWriter, total int64, logs []*storage.AccessLog) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="access-logs.csv"`)
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"id", "created_at", "action", "bucket_name", "key", "client_ip", "user_agent", "host",
+		"size", "status_code", "success", "error_msg", "response_time",
+	})
+	for _, entry := range logs {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.Format(time.RFC3339),
+			entry.Action,
+			entry.BucketName,
+			entry.Key,
+			entry.ClientIP,
+			entry.UserAgent,
+			entry.Host,
+			strconv.FormatInt(entry.Size, 10),
+			strconv.Itoa(entry.StatusCode),
+			strconv.FormatBool(entry.Success),
+			entry.ErrorMsg,
+			strconv.FormatInt(entry.ResponseTime, 10),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logger.Warn("Failed to write access log CSV", "error", err)
+	}
+}
+
+// ListAccessLogRollups 查询按小时或按天汇总的请求数、字节数与错误数
+// 支持的过滤参数: granularity (hour/day，默认 hour), bucket, action, start_time, end_time (RFC3339)
+func (h *AccessLogHandler) ListAccessLogRollups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &storage.AccessLogRollupFilter{
+		Granularity: query.Get("granularity"),
+		BucketName:  query.Get("bucket"),
+		Action:      query.Get("action"),
+	}
+	if filter.Granularity == "" {
+		filter.Granularity = storage.RollupHour
+	}
+	if storage.RollupDuration(filter.Granularity) == 0 {
+		http.Error(w, `{"error": "invalid granularity, expected hour or day"}`, http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("start_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid start_time, expected RFC3339"}`, http.StatusBadRequest)
+			return
+		}
+		filter.StartTime = t
+	}
+	if v := query.Get("end_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid end_time, expected RFC3339"}`, http.StatusBadRequest)
+			return
+		}
+		filter.EndTime = t
+	}
+
+	rollups, err := h.storage.GetAccessLogRollups(filter)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to query access log rollups", "error", err)
+		http.Error(w, `{"error": "failed to query access log rollups"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AccessLogRollupsResponse{
+		Granularity: filter.Granularity,
+		Rollups:     rollups,
+	})
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/DullJZ/s3-balance/internal/balancer"
 	"github.com/DullJZ/s3-balance/internal/bucket"
 	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -17,6 +19,8 @@ type AdminHandler struct {
 	balancer      *balancer.Balancer
 	config        *config.Config
 	configManager *config.Manager
+	storage       *storage.Service
+	metadata      storage.MetadataStore
 }
 
 // NewAdminHandler 创建新的管理API处理器
@@ -25,12 +29,16 @@ func NewAdminHandler(
 	balancer *balancer.Balancer,
 	cfg *config.Config,
 	configManager *config.Manager,
+	storage *storage.Service,
+	metadata storage.MetadataStore,
 ) *AdminHandler {
 	return &AdminHandler{
 		bucketManager: bucketManager,
 		balancer:      balancer,
 		config:        cfg,
 		configManager: configManager,
+		storage:       storage,
+		metadata:      metadata,
 	}
 }
 
@@ -47,10 +55,13 @@ type BucketResponse struct {
 	Weight          int       `json:"weight"`
 	Enabled         bool      `json:"enabled"`
 	Available       bool      `json:"available"`
+	Degraded        bool      `json:"degraded"`
+	HealthMessage   string    `json:"health_message"`
 	Virtual         bool      `json:"virtual"`
 	LastChecked     time.Time `json:"last_checked"`
 	OperationCountA int64     `json:"operation_count_a"`
 	OperationCountB int64     `json:"operation_count_b"`
+	CircuitState    string    `json:"circuit_state"`
 	OperationLimits struct {
 		TypeA int `json:"type_a"`
 		TypeB int `json:"type_b"`
@@ -59,29 +70,44 @@ type BucketResponse struct {
 
 // BucketsListResponse 存储桶列表响应结构
 type BucketsListResponse struct {
-	Total   int                `json:"total"`
-	Buckets []BucketResponse   `json:"buckets"`
+	Total   int              `json:"total"`
+	Buckets []BucketResponse `json:"buckets"`
 }
 
 // HealthResponse 健康状态响应结构
 type HealthResponse struct {
-	Status          string    `json:"status"`
-	Timestamp       time.Time `json:"timestamp"`
-	LoadBalancer    string    `json:"load_balancer_strategy"`
-	TotalBuckets    int       `json:"total_buckets"`
-	AvailableBuckets int      `json:"available_buckets"`
-	Database        string    `json:"database_type"`
+	Status           string            `json:"status"`
+	Timestamp        time.Time         `json:"timestamp"`
+	LoadBalancer     string            `json:"load_balancer_strategy"`
+	TotalBuckets     int               `json:"total_buckets"`
+	AvailableBuckets int               `json:"available_buckets"`
+	DegradedBuckets  int               `json:"degraded_buckets"`
+	Database         string            `json:"database_type"`
+	CircuitStates    map[string]string `json:"circuit_states"` // 各真实存储桶的熔断状态
 }
 
 // RegisterRoutes 注册管理API路由
 // 注意: router 参数应该是已经带有 /api 前缀的子路由器
+// 每个路由声明所需的最低角色，只读令牌可用于仪表盘
 func (h *AdminHandler) RegisterRoutes(router *mux.Router) {
-	// 注册路由，同时支持 OPTIONS 方法用于 CORS 预检
-	router.HandleFunc("/buckets", h.ListBuckets).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/buckets/{name}", h.GetBucketDetail).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/health", h.GetHealth).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/config", h.GetConfig).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/config", h.UpdateConfig).Methods(http.MethodPost, http.MethodOptions)
+	handleWithRole(router, "/buckets", middleware.RoleViewer, h.ListBuckets, http.MethodGet)
+	handleWithRole(router, "/buckets/{name}", middleware.RoleViewer, h.GetBucketDetail, http.MethodGet)
+	handleWithRole(router, "/buckets/{name}/health/history", middleware.RoleViewer, h.GetBucketHealthHistory, http.MethodGet)
+	// 增删改后端会写回配置文件（含凭据），需要管理员权限
+	handleWithRole(router, "/buckets", middleware.RoleAdmin, h.CreateBucket, http.MethodPost)
+	handleWithRole(router, "/buckets/{name}", middleware.RoleAdmin, h.UpdateBucket, http.MethodPatch)
+	handleWithRole(router, "/buckets/{name}", middleware.RoleAdmin, h.DeleteBucket, http.MethodDelete)
+	handleWithRole(router, "/health", middleware.RoleViewer, h.GetHealth, http.MethodGet)
+	// 配置中包含后端凭据，读取和修改都需要管理员权限
+	handleWithRole(router, "/config", middleware.RoleAdmin, h.GetConfig, http.MethodGet)
+	handleWithRole(router, "/config", middleware.RoleAdmin, h.UpdateConfig, http.MethodPost)
+	handleWithRole(router, "/config/validate", middleware.RoleAdmin, h.ValidateConfig, http.MethodPost)
+	// 修订差异已脱敏，运维人员可以查看；回滚需要管理员权限
+	handleWithRole(router, "/config/revisions", middleware.RoleOperator, h.ListConfigRevisions, http.MethodGet)
+	handleWithRole(router, "/config/revisions/{id:[0-9]+}/diff", middleware.RoleOperator, h.GetConfigRevisionDiff, http.MethodGet)
+	handleWithRole(router, "/config/revisions/{id:[0-9]+}/rollback", middleware.RoleAdmin, h.RollbackConfigRevision, http.MethodPost)
+	// 备份包含全部对象映射，需要管理员权限
+	handleWithRole(router, "/admin/backup", middleware.RoleAdmin, h.GetBackup, http.MethodGet)
 }
 
 // ListBuckets 获取存储桶列表
@@ -124,10 +150,17 @@ func (h *AdminHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
 	buckets := h.bucketManager.GetAllBuckets()
 	availableBuckets := h.bucketManager.GetAvailableBuckets()
 
+	degradedBuckets := 0
+	for _, b := range availableBuckets {
+		if b.IsDegraded() {
+			degradedBuckets++
+		}
+	}
+
 	status := "healthy"
 	if len(availableBuckets) == 0 {
 		status = "unhealthy"
-	} else if len(availableBuckets) < len(buckets)/2 {
+	} else if len(availableBuckets) < len(buckets)/2 || degradedBuckets > 0 {
 		status = "degraded"
 	}
 
@@ -137,7 +170,14 @@ func (h *AdminHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
 		LoadBalancer:     h.config.Balancer.Strategy,
 		TotalBuckets:     len(buckets),
 		AvailableBuckets: len(availableBuckets),
+		DegradedBuckets:  degradedBuckets,
 		Database:         h.config.Database.Type,
+		CircuitStates:    make(map[string]string),
+	}
+	for _, b := range buckets {
+		if !b.IsVirtual() {
+			response.CircuitStates[b.Config.Name] = b.CircuitState().String()
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -164,18 +204,24 @@ func (h *AdminHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 解析请求体
-	var newConfig config.Config
-	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
+	// 解析请求体并设置默认值
+	newConfig, err := decodeConfigRequest(r)
+	if err != nil {
 		http.Error(w, `{"error": "invalid JSON format: `+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
 
-	// 设置默认值
-	newConfig.SetDefaults()
+	// dry_run 只返回预检报告，不写入配置
+	if r.URL.Query().Get("dry_run") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.previewConfig(r.Context(), newConfig))
+		return
+	}
 
-	// 更新配置
-	if err := h.configManager.UpdateConfig(&newConfig); err != nil {
+	// 更新配置（无论成功与否都写入审计记录）
+	oldConfig := h.configManager.GetConfig()
+	if err := h.configManager.UpdateConfig(newConfig); err != nil {
+		recordAudit(h.storage, r, AuditActionConfigUpdate, "config", oldConfig, newConfig, err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -185,11 +231,13 @@ func (h *AdminHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(h.storage, r, AuditActionConfigUpdate, "config", oldConfig, newConfig, nil)
+
 	// 返回成功响应
 	response := map[string]interface{}{
 		"success": true,
 		"message": "Configuration updated successfully. Changes will take effect automatically.",
-		"config":  &newConfig,
+		"config":  newConfig,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -208,10 +256,13 @@ func (h *AdminHandler) convertBucketInfo(b *bucket.BucketInfo) BucketResponse {
 		Weight:          b.Config.Weight,
 		Enabled:         b.Config.Enabled,
 		Available:       b.Available,
+		Degraded:        b.Degraded,
+		HealthMessage:   b.HealthMessage,
 		Virtual:         b.Config.Virtual,
 		LastChecked:     b.LastChecked,
 		OperationCountA: b.GetOperationCount(bucket.OperationTypeA),
 		OperationCountB: b.GetOperationCount(bucket.OperationTypeB),
+		CircuitState:    b.CircuitState().String(),
 	}
 
 	resp.OperationLimits.TypeA = b.Config.OperationLimits.TypeA
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/audit"
+	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// 审计动作名称
+const (
+	AuditActionConfigUpdate   = "config.update"
+	AuditActionConfigReload   = "config.reload"
+	AuditActionTokenCreate    = "token.create"
+	AuditActionTokenRevoke    = "token.revoke"
+	AuditActionMetadataBackup = "metadata.backup"
+)
+
+// AuditActorConfigFile 配置文件被外部修改时使用的审计操作者
+const AuditActorConfigFile = "config-file"
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// AuditHandler 审计日志查询处理器
+type AuditHandler struct {
+	storage *storage.Service
+}
+
+// NewAuditHandler 创建审计日志处理器
+func NewAuditHandler(storage *storage.Service) *AuditHandler {
+	return &AuditHandler{
+		storage: storage,
+	}
+}
+
+// AuditLogsResponse 审计日志查询响应
+type AuditLogsResponse struct {
+	Total  int64               `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+	Logs   []*storage.AuditLog `json:"logs"`
+}
+
+// RegisterRoutes 注册审计日志路由
+// 注意: router 参数应该是已经带有 /api 前缀的子路由器
+func (h *AuditHandler) RegisterRoutes(router *mux.Router) {
+	handleWithRole(router, "/audit-logs", middleware.RoleAdmin, h.ListAuditLogs, http.MethodGet)
+}
+
+// ListAuditLogs 查询审计日志
+// 支持的过滤参数: actor, action, resource, result, start_time, end_time (RFC3339), limit, offset
+func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &storage.AuditLogFilter{
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Resource: query.Get("resource"),
+		Result:   query.Get("result"),
+		Limit:    defaultAuditLogLimit,
+	}
+
+	if v := query.Get("start_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid start_time, expected RFC3339"}`, http.StatusBadRequest)
+			return
+		}
+		filter.StartTime = t
+	}
+	if v := query.Get("end_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid end_time, expected RFC3339"}`, http.StatusBadRequest)
+			return
+		}
+		filter.EndTime = t
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, `{"error": "invalid limit"}`, http.StatusBadRequest)
+			return
+		}
+		if limit > maxAuditLogLimit {
+			limit = maxAuditLogLimit
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			http.Error(w, `{"error": "invalid offset"}`, http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	logs, total, err := h.storage.GetAuditLogs(filter)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to query audit logs", "error", err)
+		http.Error(w, `{"error": "failed to query audit logs"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditLogsResponse{
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+		Logs:   logs,
+	})
+}
+
+// recordAudit 为一次管理操作写入审计记录，操作者取自认证中间件放入上下文的调用方
+// 审计写入失败只记录日志，不影响已经完成的操作
+func recordAudit(store *storage.Service, r *http.Request, action, resource string, before, after interface{}, opErr error) {
+	if store == nil {
+		return
+	}
+
+	// 客户端地址为直连对端（可信代理除外），原始转发头单独保存，仅供参考
+	addr := clientAddr(r)
+	entry := &storage.AuditLog{
+		Actor:        "unknown",
+		ClientIP:     addr.IP,
+		ForwardedFor: addr.ForwardedFor,
+		Action:       action,
+		Resource:     resource,
+		Result:       storage.AuditResultSuccess,
+	}
+	if len(entry.ForwardedFor) > 255 {
+		entry.ForwardedFor = entry.ForwardedFor[:255]
+	}
+	if principal, ok := middleware.PrincipalFromContext(r.Context()); ok {
+		entry.Actor = principal.Name
+		entry.TokenID = principal.TokenID
+	}
+	if opErr != nil {
+		entry.Result = storage.AuditResultFailure
+		entry.ErrorMsg = opErr.Error()
+	}
+
+	writeAuditEntry(store, entry, before, after)
+}
+
+// RecordConfigReload 记录配置文件热加载产生的变更（没有HTTP调用方）
+func RecordConfigReload(store *storage.Service, before, after interface{}) {
+	if store == nil {
+		return
+	}
+
+	writeAuditEntry(store, &storage.AuditLog{
+		Actor:    AuditActorConfigFile,
+		Action:   AuditActionConfigReload,
+		Resource: "config",
+		Result:   storage.AuditResultSuccess,
+	}, before, after)
+}
+
+func writeAuditEntry(store *storage.Service, entry *storage.AuditLog, before, after interface{}) {
+	if before != nil || after != nil {
+		changes, err := audit.Diff(before, after)
+		if err != nil {
+			logger.Error("Failed to compute audit diff", "action", entry.Action, "error", err)
+		} else if data, err := json.Marshal(changes); err == nil {
+			entry.Changes = string(data)
+		}
+	}
+
+	if err := store.RecordAuditLog(entry); err != nil {
+		logger.Error("Failed to record audit log", "action", entry.Action, "actor", entry.Actor, "error", err)
+	}
+}
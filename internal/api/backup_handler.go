@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/metadump"
+)
+
+// GetBackup 以 JSON Lines 流式导出元数据快照（格式与 export 子命令相同，可用 import 子命令恢复）
+// 响应开始后出错只能中断连接，导入时会因缺少结束标记而报错
+func (h *AdminHandler) GetBackup(w http.ResponseWriter, r *http.Request) {
+	if h.metadata == nil {
+		http.Error(w, `{"error": "storage not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	source := ""
+	if h.configManager != nil {
+		source = h.configManager.GetConfig().Database.MetadataStore
+	}
+
+	filename := "s3-balance-metadata-" + time.Now().UTC().Format("20060102T150405Z") + ".jsonl"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	summary, err := metadump.Export(h.metadata, w, source)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Metadata backup failed", "error", err)
+	} else {
+		logger.InfoContext(r.Context(), "Metadata backup streamed", "objects", summary.Counts.Objects,
+			"mappings", summary.Counts.Mappings, "elapsed_ms", summary.Duration.Milliseconds())
+	}
+
+	var after interface{}
+	if summary != nil {
+		after = summary.Counts
+	}
+	recordAudit(h.storage, r, AuditActionMetadataBackup, "metadata", nil, after, err)
+}
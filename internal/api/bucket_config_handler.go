@@ -0,0 +1,389 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/audit"
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/gorilla/mux"
+)
+
+// 存储桶管理的审计动作
+const (
+	AuditActionBucketCreate = "bucket.create"
+	AuditActionBucketUpdate = "bucket.update"
+	AuditActionBucketDelete = "bucket.delete"
+)
+
+// BucketConfigRequest 新增或修改单个存储桶的请求体
+// PATCH 时只修改出现的字段
+type BucketConfigRequest struct {
+	Name            *string `json:"name"`
+	Endpoint        *string `json:"endpoint"`
+	Region          *string `json:"region"`
+	AccessKeyID     *string `json:"access_key_id"`
+	SecretAccessKey *string `json:"secret_access_key"`
+	MaxSize         *string `json:"max_size"`
+	Weight          *int    `json:"weight"`
+	Enabled         *bool   `json:"enabled"`
+	PathStyle       *bool   `json:"path_style"`
+	Virtual         *bool   `json:"virtual"`
+	OperationLimits *struct {
+		TypeA *int `json:"type_a"`
+		TypeB *int `json:"type_b"`
+	} `json:"operation_limits"`
+	Transport   *BucketTransportRequest   `json:"transport"`
+	HealthCheck *BucketHealthCheckRequest `json:"health_check"`
+}
+
+// BucketTransportRequest 存储桶 transport 字段，时长使用 Go duration 字符串（如 "30s"）
+type BucketTransportRequest struct {
+	MaxIdleConnsPerHost   *int    `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost       *int    `json:"max_conns_per_host"`
+	IdleConnTimeout       *string `json:"idle_conn_timeout"`
+	DialTimeout           *string `json:"dial_timeout"`
+	TLSHandshakeTimeout   *string `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout *string `json:"response_header_timeout"`
+	HTTP2                 *bool   `json:"http2"`
+	ProxyURL              *string `json:"proxy_url"`
+	TLS                   *struct {
+		CAFile             *string `json:"ca_file"`
+		ServerName         *string `json:"server_name"`
+		MinVersion         *string `json:"min_version"`
+		InsecureSkipVerify *bool   `json:"insecure_skip_verify"`
+	} `json:"tls"`
+}
+
+// BucketHealthCheckRequest 存储桶 health_check 字段，覆盖全局健康检查配置
+type BucketHealthCheckRequest struct {
+	Strategy   *string `json:"strategy"`
+	Timeout    *string `json:"timeout"`
+	Retries    *int    `json:"retries"`
+	LatencySLO *string `json:"latency_slo"`
+	Rise       *int    `json:"rise"`
+	Fall       *int    `json:"fall"`
+}
+
+// applyTo 将请求中出现的字段写入存储桶配置
+func (req *BucketConfigRequest) applyTo(bc *config.BucketConfig) error {
+	if req.Name != nil {
+		bc.Name = *req.Name
+	}
+	if req.Endpoint != nil {
+		bc.Endpoint = *req.Endpoint
+	}
+	if req.Region != nil {
+		bc.Region = *req.Region
+	}
+	if req.AccessKeyID != nil {
+		bc.AccessKeyID = *req.AccessKeyID
+	}
+	if req.SecretAccessKey != nil {
+		bc.SecretAccessKey = *req.SecretAccessKey
+	}
+	if req.MaxSize != nil {
+		bc.MaxSize = *req.MaxSize
+	}
+	if req.Weight != nil {
+		bc.Weight = *req.Weight
+	}
+	if req.Enabled != nil {
+		bc.Enabled = *req.Enabled
+	}
+	if req.PathStyle != nil {
+		bc.PathStyle = *req.PathStyle
+	}
+	if req.Virtual != nil {
+		bc.Virtual = *req.Virtual
+	}
+	if req.OperationLimits != nil {
+		if req.OperationLimits.TypeA != nil {
+			bc.OperationLimits.TypeA = *req.OperationLimits.TypeA
+		}
+		if req.OperationLimits.TypeB != nil {
+			bc.OperationLimits.TypeB = *req.OperationLimits.TypeB
+		}
+	}
+	if req.Transport != nil {
+		if err := req.Transport.applyTo(&bc.Transport); err != nil {
+			return fmt.Errorf("transport.%w", err)
+		}
+	}
+	if req.HealthCheck != nil {
+		if err := req.HealthCheck.applyTo(&bc.HealthCheck); err != nil {
+			return fmt.Errorf("health_check.%w", err)
+		}
+	}
+	return nil
+}
+
+func (req *BucketTransportRequest) applyTo(tc *config.TransportConfig) error {
+	if req.MaxIdleConnsPerHost != nil {
+		tc.MaxIdleConnsPerHost = *req.MaxIdleConnsPerHost
+	}
+	if req.MaxConnsPerHost != nil {
+		tc.MaxConnsPerHost = *req.MaxConnsPerHost
+	}
+	if err := applyDuration(&tc.IdleConnTimeout, req.IdleConnTimeout, "idle_conn_timeout"); err != nil {
+		return err
+	}
+	if err := applyDuration(&tc.DialTimeout, req.DialTimeout, "dial_timeout"); err != nil {
+		return err
+	}
+	if err := applyDuration(&tc.TLSHandshakeTimeout, req.TLSHandshakeTimeout, "tls_handshake_timeout"); err != nil {
+		return err
+	}
+	if err := applyDuration(&tc.ResponseHeaderTimeout, req.ResponseHeaderTimeout, "response_header_timeout"); err != nil {
+		return err
+	}
+	if req.HTTP2 != nil {
+		tc.HTTP2 = *req.HTTP2
+	}
+	if req.ProxyURL != nil {
+		tc.ProxyURL = *req.ProxyURL
+	}
+	if req.TLS != nil {
+		if req.TLS.CAFile != nil {
+			tc.TLS.CAFile = *req.TLS.CAFile
+		}
+		if req.TLS.ServerName != nil {
+			tc.TLS.ServerName = *req.TLS.ServerName
+		}
+		if req.TLS.MinVersion != nil {
+			tc.TLS.MinVersion = *req.TLS.MinVersion
+		}
+		if req.TLS.InsecureSkipVerify != nil {
+			tc.TLS.InsecureSkipVerify = *req.TLS.InsecureSkipVerify
+		}
+	}
+	return nil
+}
+
+func (req *BucketHealthCheckRequest) applyTo(hc *config.HealthCheckConfig) error {
+	if req.Strategy != nil {
+		hc.Strategy = *req.Strategy
+	}
+	if err := applyDuration(&hc.Timeout, req.Timeout, "timeout"); err != nil {
+		return err
+	}
+	if req.Retries != nil {
+		hc.Retries = *req.Retries
+	}
+	if err := applyDuration(&hc.LatencySLO, req.LatencySLO, "latency_slo"); err != nil {
+		return err
+	}
+	if req.Rise != nil {
+		hc.Rise = *req.Rise
+	}
+	if req.Fall != nil {
+		hc.Fall = *req.Fall
+	}
+	return nil
+}
+
+// applyDuration 解析请求中的时长字段，空字符串表示恢复默认值（0）
+func applyDuration(dst *time.Duration, value *string, field string) error {
+	if value == nil {
+		return nil
+	}
+	if *value == "" {
+		*dst = 0
+		return nil
+	}
+	d, err := time.ParseDuration(*value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%s: invalid duration %s", field, *value)
+	}
+	*dst = d
+	return nil
+}
+
+// CreateBucket 新增一个后端存储桶并写回配置文件
+// 默认会先探测后端，?skip_probe=true 可跳过
+func (h *AdminHandler) CreateBucket(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		http.Error(w, `{"error": "config manager not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var req BucketConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid JSON format: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Name == nil || *req.Name == "" {
+		http.Error(w, `{"error": "name is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	// 新增的存储桶默认启用，权重默认为1
+	bucketCfg := config.BucketConfig{Enabled: true, Weight: 1}
+	if err := req.applyTo(&bucketCfg); err != nil {
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	newConfig, checksum := h.configManager.Snapshot()
+	if _, ok := findBucketConfig(newConfig, bucketCfg.Name); ok {
+		http.Error(w, `{"error": "bucket already exists"}`, http.StatusConflict)
+		return
+	}
+	newConfig.Buckets = append(newConfig.Buckets, bucketCfg)
+
+	h.applyBucketChange(w, r, AuditActionBucketCreate, bucketCfg.Name, nil, &bucketCfg, newConfig, checksum, http.StatusCreated)
+}
+
+// UpdateBucket 修改单个后端存储桶的配置
+func (h *AdminHandler) UpdateBucket(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		http.Error(w, `{"error": "config manager not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	var req BucketConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid JSON format: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil && *req.Name != name {
+		http.Error(w, `{"error": "bucket name cannot be changed"}`, http.StatusBadRequest)
+		return
+	}
+
+	newConfig, checksum := h.configManager.Snapshot()
+	idx, ok := findBucketConfig(newConfig, name)
+	if !ok {
+		http.Error(w, `{"error": "bucket not found"}`, http.StatusNotFound)
+		return
+	}
+
+	before := newConfig.Buckets[idx]
+	if err := req.applyTo(&newConfig.Buckets[idx]); err != nil {
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	after := newConfig.Buckets[idx]
+
+	h.applyBucketChange(w, r, AuditActionBucketUpdate, name, &before, &after, newConfig, checksum, http.StatusOK)
+}
+
+// DeleteBucket 删除单个后端存储桶
+// 仍有虚拟映射引用该存储桶时拒绝删除，?force=true 可强制删除
+func (h *AdminHandler) DeleteBucket(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		http.Error(w, `{"error": "config manager not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	newConfig, checksum := h.configManager.Snapshot()
+	idx, ok := findBucketConfig(newConfig, name)
+	if !ok {
+		http.Error(w, `{"error": "bucket not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if h.metadata != nil && r.URL.Query().Get("force") != "true" {
+		asReal, asVirtual, err := h.metadata.CountMappingsForBucket(name)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "Failed to count mappings", "bucket", name, "error", err)
+			http.Error(w, `{"error": "failed to check bucket mappings"}`, http.StatusInternalServerError)
+			return
+		}
+		if asReal > 0 || asVirtual > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":             "bucket is still referenced by virtual bucket mappings",
+				"as_real_bucket":    asReal,
+				"as_virtual_bucket": asVirtual,
+			})
+			return
+		}
+	}
+
+	before := newConfig.Buckets[idx]
+	newConfig.Buckets = append(newConfig.Buckets[:idx], newConfig.Buckets[idx+1:]...)
+
+	h.applyBucketChange(w, r, AuditActionBucketDelete, name, &before, nil, newConfig, checksum, http.StatusOK)
+}
+
+// applyBucketChange 探测变更后的后端、通过配置管理器持久化并记录审计
+// checksum 为修改所基于的配置版本，期间配置被其他请求修改时返回 409，避免覆盖对方的变更
+func (h *AdminHandler) applyBucketChange(w http.ResponseWriter, r *http.Request, action, name string, before, after *config.BucketConfig, newConfig *config.Config, checksum string, successStatus int) {
+	resource := "bucket/" + name
+
+	if after != nil {
+		if err := after.ParseMaxSize(); err != nil {
+			http.Error(w, `{"error": "invalid max_size: `+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if after != nil && after.Enabled && !after.Virtual && r.URL.Query().Get("skip_probe") != "true" {
+		if before == nil || !before.Enabled || bucket.BucketKeyFieldsChanged(*before, *after) {
+			probe := bucket.ProbeBucket(r.Context(), *after, configProbeTimeout)
+			if !probe.OK {
+				err := fmt.Errorf("backend probe failed: %s", probe.Error)
+				recordAudit(h.storage, r, action, resource, before, after, err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error": "backend probe failed",
+					"probe": probe,
+				})
+				return
+			}
+		}
+	}
+
+	if err := h.configManager.UpdateConfigIfUnchanged(newConfig, checksum); err != nil {
+		recordAudit(h.storage, r, action, resource, before, after, err)
+		if errors.Is(err, config.ErrConfigChanged) {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "validation failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	recordAudit(h.storage, r, action, resource, before, after, nil)
+
+	response := map[string]interface{}{
+		"success": true,
+		"name":    name,
+	}
+	if after != nil {
+		// 返回的配置中凭据已脱敏
+		if redacted, err := audit.Redact(after); err == nil {
+			response["bucket"] = redacted
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(successStatus)
+	json.NewEncoder(w).Encode(response)
+}
+
+// findBucketConfig 在配置中查找存储桶，返回其下标
+func findBucketConfig(cfg *config.Config, name string) (int, bool) {
+	for i, b := range cfg.Buckets {
+		if b.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -17,7 +16,7 @@ func (h *S3Handler) handleListBuckets(w http.ResponseWriter, r *http.Request) {
 		if h.storage == nil {
 			return
 		}
-		h.recordAccessLog(r, "list_buckets", "", "", 0, true, "", time.Since(start))
+		h.recordAccessLog(r, "list_buckets", "", "", 0, http.StatusOK, "", time.Since(start))
 	}()
 
 	buckets := h.bucketManager.GetAllBuckets()
@@ -110,7 +109,7 @@ func (h *S3Handler) handleListObjectsForVirtualBucket(w http.ResponseWriter, r *
 	}
 
 	// 从存储服务获取虚拟存储桶中的对象
-	objects, err := h.storage.GetVirtualBucketObjects(bucketName)
+	objects, err := h.store(r.Context()).GetVirtualBucketObjects(bucketName)
 	if err != nil {
 		h.sendS3Error(w, "InternalError", "Failed to list virtual bucket objects", bucketName)
 		return
@@ -170,7 +169,7 @@ func (h *S3Handler) handleListObjectsForVirtualBucket(w http.ResponseWriter, r *
 		result.Contents = append(result.Contents, ObjectInfo{
 			Key:          obj.Key,
 			LastModified: obj.UpdatedAt,
-			ETag:         fmt.Sprintf("\"%x\"", obj.ID),
+			ETag:         objectETag(obj),
 			Size:         obj.Size,
 		})
 	}
@@ -237,7 +236,7 @@ func (h *S3Handler) handleCreateBucket(w http.ResponseWriter, r *http.Request, b
 		targetBucket := realBuckets[0]
 
 		// 创建虚拟存储桶到真实存储桶的映射
-		if err := h.storage.CreateVirtualBucketMapping(bucketName, "", targetBucket.Config.Name, ""); err != nil {
+		if err := h.store(r.Context()).CreateVirtualBucketMapping(bucketName, "", targetBucket.Config.Name, ""); err != nil {
 			h.sendS3Error(w, "InternalError", "Failed to create virtual bucket mapping", bucketName)
 			return
 		}
@@ -262,7 +261,7 @@ func (h *S3Handler) handleDeleteBucket(w http.ResponseWriter, r *http.Request, b
 	// 虚拟存储桶需要删除映射关系
 	if bucket.IsVirtual() {
 		// 删除虚拟存储桶映射
-		if err := h.storage.DeleteVirtualBucketMapping(bucketName); err != nil {
+		if err := h.store(r.Context()).DeleteVirtualBucketMapping(bucketName); err != nil {
 			h.sendS3Error(w, "InternalError", "Failed to delete virtual bucket mapping", bucketName)
 			return
 		}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/DullJZ/s3-balance/internal/audit"
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/gorilla/mux"
+)
+
+// AuditActionConfigRollback 配置回滚的审计动作
+const AuditActionConfigRollback = "config.rollback"
+
+// ConfigRevisionsResponse 配置修订列表响应
+type ConfigRevisionsResponse struct {
+	Total     int               `json:"total"`
+	Revisions []config.Revision `json:"revisions"`
+}
+
+// ConfigRevisionDiffResponse 配置修订差异响应
+type ConfigRevisionDiffResponse struct {
+	Revision *config.Revision `json:"revision"`
+	Against  *config.Revision `json:"against,omitempty"` // 为空表示与空配置比较（第一个修订）
+	Changes  []audit.Change   `json:"changes"`
+}
+
+// ListConfigRevisions 列出配置修订
+func (h *AdminHandler) ListConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		http.Error(w, `{"error": "config manager not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	revisions := h.configManager.ListRevisions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigRevisionsResponse{
+		Total:     len(revisions),
+		Revisions: revisions,
+	})
+}
+
+// GetConfigRevisionDiff 获取修订与上一修订（或 ?against= 指定修订）之间的差异，敏感字段已脱敏
+func (h *AdminHandler) GetConfigRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		http.Error(w, `{"error": "config manager not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"error": "invalid revision id"}`, http.StatusBadRequest)
+		return
+	}
+
+	rev, cfg, err := h.configManager.GetRevision(id)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+
+	againstID := h.configManager.PreviousRevision(id)
+	if v := r.URL.Query().Get("against"); v != "" {
+		againstID, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, `{"error": "invalid against revision id"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := ConfigRevisionDiffResponse{Revision: rev}
+	var againstCfg *config.Config
+	if againstID > 0 {
+		response.Against, againstCfg, err = h.configManager.GetRevision(againstID)
+		if err != nil {
+			writeRevisionError(w, err)
+			return
+		}
+	}
+
+	response.Changes, err = audit.Diff(againstCfg, cfg)
+	if err != nil {
+		http.Error(w, `{"error": "failed to compute diff"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RollbackConfigRevision 回滚到指定修订
+func (h *AdminHandler) RollbackConfigRevision(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		http.Error(w, `{"error": "config manager not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, `{"error": "invalid revision id"}`, http.StatusBadRequest)
+		return
+	}
+
+	resource := "config/revisions/" + strconv.Itoa(id)
+	oldConfig := h.configManager.GetConfig()
+	rev, newConfig, err := h.configManager.Rollback(id)
+	if err != nil {
+		recordAudit(h.storage, r, AuditActionConfigRollback, resource, nil, nil, err)
+		writeRevisionError(w, err)
+		return
+	}
+
+	recordAudit(h.storage, r, AuditActionConfigRollback, resource, oldConfig, newConfig, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message":     "Configuration rolled back successfully. Changes will take effect automatically.",
+		"rolled_back": id,
+		"revision":    rev,
+	})
+}
+
+// writeRevisionError 将修订相关错误转换为HTTP响应
+func writeRevisionError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, config.ErrRevisionNotFound) {
+		status = http.StatusNotFound
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
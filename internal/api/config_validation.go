@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/config"
+)
+
+// configProbeTimeout 预检时单个后端探测的超时时间
+const configProbeTimeout = 10 * time.Second
+
+// OrphanedMappingReport 将被删除的存储桶上仍然存在的映射
+type OrphanedMappingReport struct {
+	Bucket          string `json:"bucket"`
+	AsRealBucket    int64  `json:"as_real_bucket"`    // real_bucket_name 指向该桶的映射数量
+	AsVirtualBucket int64  `json:"as_virtual_bucket"` // virtual_bucket_name 为该桶的映射数量
+}
+
+// ConfigValidationResponse 配置预检结果
+type ConfigValidationResponse struct {
+	Valid            bool                    `json:"valid"`
+	DryRun           bool                    `json:"dry_run"`
+	Errors           []string                `json:"errors"`
+	Warnings         []string                `json:"warnings"`
+	Plan             *bucket.UpdatePlan      `json:"plan,omitempty"`
+	Probes           []bucket.ProbeResult    `json:"probes"`
+	OrphanedMappings []OrphanedMappingReport `json:"orphaned_mappings"`
+}
+
+// ValidateConfig 预检配置：校验、探测新增或变更的后端、报告应用后的影响，不写入任何内容
+func (h *AdminHandler) ValidateConfig(w http.ResponseWriter, r *http.Request) {
+	newConfig, err := decodeConfigRequest(r)
+	if err != nil {
+		http.Error(w, `{"error": "invalid JSON format: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	response := h.previewConfig(r.Context(), newConfig)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// previewConfig 生成配置预检报告
+func (h *AdminHandler) previewConfig(ctx context.Context, newConfig *config.Config) *ConfigValidationResponse {
+	response := &ConfigValidationResponse{
+		Valid:            true,
+		DryRun:           true,
+		Errors:           []string{},
+		Warnings:         []string{},
+		Probes:           []bucket.ProbeResult{},
+		OrphanedMappings: []OrphanedMappingReport{},
+	}
+
+	if err := newConfig.Validate(); err != nil {
+		response.Valid = false
+		response.Errors = append(response.Errors, err.Error())
+		// 配置本身无效时不再探测后端
+		return response
+	}
+
+	if h.bucketManager == nil {
+		response.Warnings = append(response.Warnings, "bucket manager not available, impact preview skipped")
+		return response
+	}
+
+	response.Plan = h.bucketManager.PlanUpdate(newConfig)
+
+	response.Probes = h.bucketManager.ProbeBackends(ctx, newConfig, configProbeTimeout)
+	for _, probe := range response.Probes {
+		if !probe.OK {
+			response.Valid = false
+			response.Errors = append(response.Errors, "bucket "+probe.Bucket+": probe failed: "+probe.Error)
+		}
+	}
+
+	if h.metadata == nil {
+		response.Warnings = append(response.Warnings, "storage not available, mapping check skipped")
+		return response
+	}
+
+	for _, name := range response.Plan.Removed {
+		asReal, asVirtual, err := h.metadata.CountMappingsForBucket(name)
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to count mappings", "bucket", name, "error", err)
+			response.Warnings = append(response.Warnings, "failed to count mappings for bucket "+name)
+			continue
+		}
+		if asReal == 0 && asVirtual == 0 {
+			continue
+		}
+		response.OrphanedMappings = append(response.OrphanedMappings, OrphanedMappingReport{
+			Bucket:          name,
+			AsRealBucket:    asReal,
+			AsVirtualBucket: asVirtual,
+		})
+		response.Warnings = append(response.Warnings, "bucket "+name+" is removed but still referenced by virtual bucket mappings")
+	}
+
+	return response
+}
+
+// decodeConfigRequest 解析请求体中的配置并补全默认值
+func decodeConfigRequest(r *http.Request) (*config.Config, error) {
+	var newConfig config.Config
+	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
+		return nil, err
+	}
+
+	newConfig.SetDefaults()
+	return &newConfig, nil
+}
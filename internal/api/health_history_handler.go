@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// 健康历史查询的分页限制
+const (
+	defaultHealthHistoryLimit = 100
+	maxHealthHistoryLimit     = 1000
+)
+
+// HealthHistoryResponse 存储桶健康状态变化历史响应
+type HealthHistoryResponse struct {
+	Bucket string                 `json:"bucket"`
+	Total  int64                  `json:"total"`
+	Limit  int                    `json:"limit"`
+	Offset int                    `json:"offset"`
+	Events []*storage.HealthEvent `json:"events"`
+}
+
+// GetBucketHealthHistory 查询存储桶的健康状态变化历史（最新的在前）
+// 支持的参数: limit, offset；已删除的存储桶仍可查询历史
+func (h *AdminHandler) GetBucketHealthHistory(w http.ResponseWriter, r *http.Request) {
+	if h.storage == nil {
+		http.Error(w, `{"error": "storage not available"}`, http.StatusInternalServerError)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	query := r.URL.Query()
+
+	limit := defaultHealthHistoryLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, `{"error": "invalid limit"}`, http.StatusBadRequest)
+			return
+		}
+		if n > maxHealthHistoryLimit {
+			n = maxHealthHistoryLimit
+		}
+		limit = n
+	}
+	offset := 0
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, `{"error": "invalid offset"}`, http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	events, total, err := h.storage.GetHealthEvents(name, limit, offset)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to query health events", "bucket", name, "error", err)
+		http.Error(w, `{"error": "failed to query health history"}`, http.StatusInternalServerError)
+		return
+	}
+	if total == 0 {
+		if _, ok := h.bucketManager.GetBucket(name); !ok {
+			http.Error(w, `{"error": "bucket not found"}`, http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthHistoryResponse{
+		Bucket: name,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+		Events: events,
+	})
+}
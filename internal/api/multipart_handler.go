@@ -3,20 +3,20 @@ package api
 import (
 	"context"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strconv"
-	"time"
 
 	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/recovery"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/DullJZ/s3-balance/pkg/datapath"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/aws/smithy-go"
 	"github.com/gorilla/mux"
 )
 
@@ -35,40 +35,43 @@ func (h *S3Handler) handleUploadPart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取内容长度
-	contentLength := r.ContentLength
-	if contentLength < 0 {
-		h.sendS3Error(w, "MissingContentLength", "Content-Length header is required", key)
+	// 解码 aws-chunked 请求体，长度未知时先暂存以获得分片长度
+	body, code, message := h.openUploadBody(r)
+	if body == nil {
+		h.sendS3Error(w, code, message, key)
 		return
 	}
+	defer body.Close()
+	contentLength := body.ContentLength
 
 	var targetBucket *bucket.BucketInfo
 
 	// 如果是虚拟存储桶，需要通过映射查找真实存储桶
 	if requestedBucket.IsVirtual() {
-		// 获取虚拟存储桶映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		// 获取虚拟存储桶映射（上传完成前为 pending 状态）
+		mapping, err := h.store(r.Context()).GetUploadMapping(bucketName, key)
 		if err != nil {
 			// 对于分片上传，映射应该在初始化分片上传时已经创建
 			// 如果没有找到映射，使用负载均衡器选择一个新的存储桶
-			targetBucket, err = h.balancer.SelectBucket(key, contentLength)
+			targetBucket, err = h.balancer.SelectBucket(r.Context(), key, contentLength)
 			if err != nil {
 				h.sendS3Error(w, "InternalError", "Failed to select bucket for multipart upload", key)
 				return
 			}
 
-			// 创建虚拟存储桶文件级映射（对于Multipart，虚拟key和真实key相同）
-			if err := h.storage.CreateVirtualBucketMapping(bucketName, key, targetBucket.Config.Name, key); err != nil {
+			// 以 pending 状态创建虚拟存储桶文件级映射（对于Multipart，虚拟key和真实key相同）
+			mapping, err = h.store(r.Context()).BeginUpload(bucketName, key, targetBucket.Config.Name, key)
+			if err != nil {
 				h.sendS3Error(w, "InternalError", "Failed to create virtual bucket file mapping", key)
 				return
 			}
-		} else {
-			// 映射已存在，获取对应的真实存储桶
-			targetBucket, ok = h.bucketManager.GetBucket(mapping.RealBucketName)
-			if !ok {
-				h.sendS3Error(w, "InternalError", "Mapped real bucket not found", key)
-				return
-			}
+		}
+
+		// 获取映射对应的真实存储桶
+		targetBucket, ok = h.bucketManager.GetBucket(mapping.RealBucketName)
+		if !ok {
+			h.sendS3Error(w, "InternalError", "Mapped real bucket not found", key)
+			return
 		}
 	} else {
 		// 如果不是虚拟存储桶，拒绝客户端对真实存储桶的直接操作
@@ -79,9 +82,9 @@ func (h *S3Handler) handleUploadPart(w http.ResponseWriter, r *http.Request) {
 	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
 
 	// 检查当前已上传大小 + 本次分片大小是否超过bucket剩余空间
-	currentSize, err := h.storage.GetUploadSessionSize(uploadID)
+	currentSize, err := h.store(r.Context()).GetUploadSessionSize(uploadID)
 	if err != nil {
-		log.Printf("Warning: failed to get upload session size for uploadID %s: %v", uploadID, err)
+		logger.WarnContext(r.Context(), "Failed to get upload session size", "upload_id", uploadID, "error", err)
 		// 继续处理，不阻止上传
 		currentSize = 0
 	}
@@ -90,9 +93,11 @@ func (h *S3Handler) handleUploadPart(w http.ResponseWriter, r *http.Request) {
 	availableSpace := targetBucket.GetAvailableSpace()
 	if projectedSize > availableSpace {
 		// 空间不足，自动中止后端分片上传
-		log.Printf("Upload would exceed bucket capacity for key %s, aborting multipart upload. Current: %d bytes, Part: %d bytes, Available: %d bytes",
-			key, currentSize, contentLength, availableSpace)
-		h.abortMultipartUploadInternal(targetBucket, key, uploadID)
+		logger.WarnContext(r.Context(), "Upload would exceed bucket capacity, aborting multipart upload",
+			"bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID,
+			"current_bytes", currentSize, "part_bytes", contentLength, "available_bytes", availableSpace)
+		h.abortMultipartUploadInternal(r.Context(), targetBucket, key, uploadID)
+		h.failUpload(r.Context(), bucketName, key, "")
 
 		h.sendS3Error(w, "EntityTooLarge",
 			fmt.Sprintf("Upload would exceed bucket capacity. Current: %d bytes, Part: %d bytes, Available: %d bytes",
@@ -107,76 +112,52 @@ func (h *S3Handler) handleUploadPart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 生成预签名上传分片URL
-	presignClient := s3.NewPresignClient(targetBucket.Client)
-	uploadPartInput := &s3.UploadPartInput{
-		Bucket:     aws.String(targetBucket.Config.Name),
-		Key:        aws.String(key),
-		UploadId:   aws.String(uploadID),
-		PartNumber: aws.Int32(int32(partNum)),
-	}
-
-	presignRequest, err := presignClient.PresignUploadPart(context.Background(), uploadPartInput, func(opts *s3.PresignOptions) {
-		opts.Expires = 15 * time.Minute
+	// 通过 SDK 客户端流式上传分片
+	ctx, cancel := context.WithTimeout(r.Context(), backendUploadTimeout)
+	defer cancel()
+	etag, err := datapath.UploadPart(ctx, targetBucket, &datapath.PartInput{
+		Key:           key,
+		UploadID:      uploadID,
+		PartNumber:    int32(partNum),
+		Body:          body.Body,
+		ContentLength: contentLength,
+		ContentMD5:    r.Header.Get("Content-MD5"),
 	})
 	if err != nil {
-		log.Printf("Failed to generate upload part URL for key %s, part %s: %v", key, partNumber, err)
-		h.sendS3Error(w, "InternalError", "Failed to generate upload part URL", key)
-		return
-	}
-
-	// 使用反向代理上传分片到真实预签名URL
-	req, err := http.NewRequest("PUT", presignRequest.URL, r.Body)
-	if err != nil {
-		h.sendS3Error(w, "InternalError", "Failed to create upload part request", key)
+		logger.ErrorContext(r.Context(), "Failed to upload part", "bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID, "part_number", partNumber, "error", err)
+		// 客户端请求体解码失败不是后端故障，不计入熔断器
+		if decodeErr := body.decodeError(); decodeErr != nil {
+			code, message := streamingError(decodeErr)
+			h.sendS3Error(w, code, message, key)
+			return
+		}
+		h.reportBackendResult(targetBucket, err)
+		h.sendBackendError(w, err, "Failed to upload part", key)
 		return
 	}
+	h.reportBackendResult(targetBucket, nil)
 
-	// 设置必要的头
-	req.ContentLength = contentLength
-	if ct := r.Header.Get("Content-Type"); ct != "" {
-		req.Header.Set("Content-Type", ct)
+	// 返回后端生成的分片ETag
+	if etag != "" {
+		w.Header().Set("ETag", etag)
 	}
 
-	// 执行上传
-	client := &http.Client{Timeout: 30 * time.Minute}
-	resp, err := client.Do(req)
+	// 更新上传会话的分片数和累积大小
+	session, err := h.store(r.Context()).GetUploadSession(uploadID)
 	if err != nil {
-		log.Printf("Failed to upload part %s for key %s: %v", partNumber, key, err)
-		h.sendS3Error(w, "InternalError", "Failed to upload part", key)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		// 从响应中获取ETag并返回给客户端
-		etag := resp.Header.Get("ETag")
-		if etag != "" {
-			w.Header().Set("ETag", etag)
+		logger.ErrorContext(r.Context(), "Failed to get upload session", "upload_id", uploadID, "error", err)
+	} else {
+		// 更新已完成的分片数
+		if err := h.store(r.Context()).UpdateUploadSession(uploadID, session.CompletedParts+1, "pending"); err != nil {
+			logger.ErrorContext(r.Context(), "Failed to update upload session", "upload_id", uploadID, "error", err)
 		}
-
-		// 更新上传会话的分片数和累积大小
-		session, err := h.storage.GetUploadSession(uploadID)
-		if err != nil {
-			log.Printf("Failed to get upload session for uploadID %s: %v", uploadID, err)
-		} else {
-			// 更新已完成的分片数
-			if err := h.storage.UpdateUploadSession(uploadID, session.CompletedParts+1, "pending"); err != nil {
-				log.Printf("Failed to update upload session for uploadID %s: %v", uploadID, err)
-			}
-			// 累加分片大小
-			if err := h.storage.IncrementUploadSessionSize(uploadID, contentLength); err != nil {
-				log.Printf("Failed to increment upload session size for uploadID %s: %v", uploadID, err)
-			}
+		// 累加分片大小
+		if err := h.store(r.Context()).IncrementUploadSessionSize(uploadID, contentLength); err != nil {
+			logger.ErrorContext(r.Context(), "Failed to increment upload session size", "upload_id", uploadID, "error", err)
 		}
-
-		w.WriteHeader(http.StatusOK)
-	} else {
-		// 读取错误响应体以获取详细信息
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Upload part failed with status %d: %s", resp.StatusCode, string(body))
-		h.sendS3Error(w, "InternalError", fmt.Sprintf("Upload part failed with status %d", resp.StatusCode), key)
 	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
 // handleMultipartUpload 初始化分片上传
@@ -198,17 +179,27 @@ func (h *S3Handler) handleMultipartUpload(w http.ResponseWriter, r *http.Request
 	// 如果是虚拟存储桶，需要选择真实存储桶并创建映射
 	if requestedBucket.IsVirtual() {
 		// 选择目标存储桶
-		targetBucket, err = h.balancer.SelectBucket(key, 0) // 分片上传时不检查空间
+		targetBucket, err = h.balancer.SelectBucket(r.Context(), key, 0) // 分片上传时不检查空间
 		if err != nil {
 			h.sendS3Error(w, "InternalError", "Failed to select bucket for upload", key)
 			return
 		}
 
-		// 创建虚拟存储桶文件级映射（对于Multipart，虚拟key和真实key相同）
-		if err := h.storage.CreateVirtualBucketMapping(bucketName, key, targetBucket.Config.Name, key); err != nil {
+		// 以 pending 状态创建虚拟存储桶文件级映射（对于Multipart，虚拟key和真实key相同），完成上传时提交
+		// 已存在映射（覆盖写或并发上传）时沿用其真实存储桶
+		mapping, err := h.store(r.Context()).BeginUpload(bucketName, key, targetBucket.Config.Name, key)
+		if err != nil {
 			h.sendS3Error(w, "InternalError", "Failed to create virtual bucket file mapping", key)
 			return
 		}
+		if mapping.RealBucketName != targetBucket.Config.Name {
+			mappedBucket, ok := h.bucketManager.GetBucket(mapping.RealBucketName)
+			if !ok {
+				h.sendS3Error(w, "InternalError", "Mapped real bucket not found", key)
+				return
+			}
+			targetBucket = mappedBucket
+		}
 	} else {
 		// 如果不是虚拟存储桶，拒绝客户端对真实存储桶的直接操作
 		h.sendS3Error(w, "NoSuchBucket", "The specified bucket does not exist", bucketName)
@@ -217,12 +208,14 @@ func (h *S3Handler) handleMultipartUpload(w http.ResponseWriter, r *http.Request
 
 	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
 
-	// 初始化分片上传
-	ctx := context.Background()
+	// 初始化分片上传，写入放置标记以便元数据丢失时从后端恢复映射
+	ctx := r.Context()
 	createResp, err := targetBucket.Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket: aws.String(targetBucket.Config.Name),
-		Key:    aws.String(key),
+		Bucket:   aws.String(targetBucket.Config.Name),
+		Key:      aws.String(key),
+		Metadata: recovery.PlacementMetadata(bucketName, key),
 	})
+	h.reportBackendResult(targetBucket, err)
 	if err != nil {
 		h.sendS3Error(w, "InternalError", "Failed to initiate multipart upload", key)
 		return
@@ -231,8 +224,8 @@ func (h *S3Handler) handleMultipartUpload(w http.ResponseWriter, r *http.Request
 	uploadID := *createResp.UploadId
 
 	// 记录上传会话到数据库
-	if err := h.storage.RecordUploadSession(uploadID, key, targetBucket.Config.Name, 0); err != nil {
-		log.Printf("Failed to record upload session for uploadID %s: %v", uploadID, err)
+	if err := h.store(r.Context()).RecordUploadSession(uploadID, key, targetBucket.Config.Name, 0); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to record upload session", "upload_id", uploadID, "error", err)
 		// 不影响主流程，继续处理
 	}
 
@@ -278,11 +271,11 @@ func (h *S3Handler) handleListMultipartUploads(w http.ResponseWriter, r *http.Re
 	// 如果是虚拟存储桶，从数据库查询上传会话
 	if requestedBucket.IsVirtual() {
 		// 从数据库获取待处理的上传会话
-		sessions, err := h.storage.GetPendingUploadSessions(prefix, keyMarker, uploadIdMarker, maxUploads)
+		sessions, err := h.store(r.Context()).GetPendingUploadSessions(prefix, keyMarker, uploadIdMarker, maxUploads)
 		if err != nil {
-			log.Printf("Failed to get pending upload sessions: %v", err)
+			logger.ErrorContext(r.Context(), "Failed to get pending upload sessions", "error", err)
 			// 降级到遍历所有存储桶的方式
-			ctx := context.Background()
+			ctx := r.Context()
 			allBuckets := h.bucketManager.GetAllBuckets()
 			for _, realBucket := range allBuckets {
 				if realBucket.IsVirtual() {
@@ -301,7 +294,7 @@ func (h *S3Handler) handleListMultipartUploads(w http.ResponseWriter, r *http.Re
 					MaxUploads:     aws.Int32(int32(maxUploads)),
 				})
 				if err != nil {
-					log.Printf("Failed to list multipart uploads for bucket %s: %v", realBucket.Config.Name, err)
+					logger.ErrorContext(r.Context(), "Failed to list multipart uploads", "bucket", realBucket.Config.Name, "error", err)
 					continue
 				}
 
@@ -410,8 +403,8 @@ func (h *S3Handler) handleListMultipartParts(w http.ResponseWriter, r *http.Requ
 
 	// 如果是虚拟存储桶，需要通过映射查找真实存储桶
 	if requestedBucket.IsVirtual() {
-		// 获取虚拟存储桶映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		// 获取虚拟存储桶映射（上传完成前为 pending 状态）
+		mapping, err := h.store(r.Context()).GetUploadMapping(bucketName, key)
 		if err != nil {
 			// 如果没有找到映射，尝试查询所有真实存储桶
 			allBuckets := h.bucketManager.GetAllBuckets()
@@ -420,7 +413,7 @@ func (h *S3Handler) handleListMultipartParts(w http.ResponseWriter, r *http.Requ
 					continue
 				}
 				// 尝试列出分片，如果成功则说明上传在这个桶中
-				ctx := context.Background()
+				ctx := r.Context()
 				h.recordBackendOperation(realBucket, bucket.OperationTypeB)
 				_, err := realBucket.Client.ListParts(ctx, &s3.ListPartsInput{
 					Bucket:           aws.String(realBucket.Config.Name),
@@ -454,7 +447,7 @@ func (h *S3Handler) handleListMultipartParts(w http.ResponseWriter, r *http.Requ
 
 	// 列出分片
 	h.recordBackendOperation(targetBucket, bucket.OperationTypeB)
-	ctx := context.Background()
+	ctx := r.Context()
 	listResp, err := targetBucket.Client.ListParts(ctx, &s3.ListPartsInput{
 		Bucket:           aws.String(targetBucket.Config.Name),
 		Key:              aws.String(key),
@@ -462,6 +455,7 @@ func (h *S3Handler) handleListMultipartParts(w http.ResponseWriter, r *http.Requ
 		PartNumberMarker: aws.String(strconv.Itoa(partNumberMarker)),
 		MaxParts:         aws.Int32(int32(maxParts)),
 	})
+	h.reportBackendResult(targetBucket, err)
 	if err != nil {
 		h.sendS3Error(w, "NoSuchUpload", "The specified multipart upload does not exist", uploadID)
 		return
@@ -518,8 +512,8 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 
 	// 如果是虚拟存储桶，需要通过映射查找真实存储桶
 	if requestedBucket.IsVirtual() {
-		// 获取虚拟存储桶映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		// 获取虚拟存储桶映射（上传完成前为 pending 状态）
+		mapping, err := h.store(r.Context()).GetUploadMapping(bucketName, key)
 		if err != nil {
 			h.sendS3Error(w, "NoSuchKey", "The specified key does not exist", key)
 			return
@@ -542,21 +536,25 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 	body, _ := io.ReadAll(r.Body)
 	err := xml.Unmarshal(body, &completeReq)
 	if err != nil {
-		log.Printf("Failed to parse CompleteMultipartUpload request body: %v, body: %s", err, string(body))
+		logger.WarnContext(r.Context(), "Failed to parse CompleteMultipartUpload request body",
+			"key", key, "upload_id", uploadID, "body_bytes", len(body), "error", err)
 		h.sendS3Error(w, "MalformedXML", "The XML you provided was not well-formed", key)
 		return
 	}
 
-	log.Printf("CompleteMultipartUpload request - Bucket: %s, Key: %s, UploadID: %s, Parts: %d",
-		bucketName, key, uploadID, len(completeReq.Parts))
-	for i, part := range completeReq.Parts {
-		log.Printf("  Part %d: PartNumber=%d, ETag=%s", i+1, part.PartNumber, part.ETag)
+	if logger.Enabled(r.Context(), slog.LevelDebug) {
+		etags := make([]string, len(completeReq.Parts))
+		for i, part := range completeReq.Parts {
+			etags[i] = fmt.Sprintf("%d:%s", part.PartNumber, part.ETag)
+		}
+		logger.DebugContext(r.Context(), "CompleteMultipartUpload request", "bucket", bucketName, "key", key,
+			"upload_id", uploadID, "parts", len(completeReq.Parts), "part_etags", etags)
 	}
 
 	// 最终检查：验证累积大小是否超过bucket可用空间
-	totalSize, err := h.storage.GetUploadSessionSize(uploadID)
+	totalSize, err := h.store(r.Context()).GetUploadSessionSize(uploadID)
 	if err != nil {
-		log.Printf("Warning: failed to get upload session size for uploadID %s: %v", uploadID, err)
+		logger.WarnContext(r.Context(), "Failed to get upload session size", "upload_id", uploadID, "error", err)
 		// 继续处理，不阻止完成操作
 		totalSize = 0
 	}
@@ -565,9 +563,11 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 		availableSpace := targetBucket.GetAvailableSpace()
 		if totalSize > availableSpace {
 			// 空间不足，自动中止后端分片上传
-			log.Printf("Upload size exceeds bucket capacity for key %s, aborting multipart upload. Total: %d bytes, Available: %d bytes",
-				key, totalSize, availableSpace)
-			h.abortMultipartUploadInternal(targetBucket, key, uploadID)
+			logger.WarnContext(r.Context(), "Upload size exceeds bucket capacity, aborting multipart upload",
+				"bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID,
+				"total_bytes", totalSize, "available_bytes", availableSpace)
+			h.abortMultipartUploadInternal(r.Context(), targetBucket, key, uploadID)
+			h.failUpload(r.Context(), bucketName, key, "")
 
 			h.sendS3Error(w, "EntityTooLarge",
 				fmt.Sprintf("Upload size exceeds bucket capacity. Total: %d bytes, Available: %d bytes",
@@ -577,7 +577,7 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 	}
 
 	// 完成分片上传
-	ctx := context.Background()
+	ctx := r.Context()
 	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
 	sort.SliceStable(completeReq.Parts, func(i, j int) bool {
 		return completeReq.Parts[i].PartNumber < completeReq.Parts[j].PartNumber
@@ -591,7 +591,8 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 		})
 	}
 
-	log.Printf("Calling CompleteMultipartUpload on real bucket %s with uploadID %s", targetBucket.Config.Name, uploadID)
+	logger.DebugContext(r.Context(), "Completing multipart upload on backend", "bucket", targetBucket.Config.Name,
+		"key", key, "upload_id", uploadID, "parts", len(parts))
 	completeResp, err := targetBucket.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
 		Bucket:   aws.String(targetBucket.Config.Name),
 		Key:      aws.String(key),
@@ -600,13 +601,11 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 			Parts: parts,
 		},
 	})
+	h.reportBackendResult(targetBucket, err)
 	if err != nil {
-		log.Printf("CompleteMultipartUpload failed: %v", err)
-		if apiErr, ok := getAPIError(err); ok {
-			h.sendS3Error(w, apiErr.ErrorCode(), apiErr.ErrorMessage(), key)
-		} else {
-			h.sendS3Error(w, "InternalError", "Failed to complete multipart upload", key)
-		}
+		err = datapath.Classify("CompleteMultipartUpload", targetBucket.Config.Name, key, err)
+		logger.ErrorContext(r.Context(), "Failed to complete multipart upload", "bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID, "error", err)
+		h.sendBackendError(w, err, "Failed to complete multipart upload", key)
 		return
 	}
 
@@ -627,65 +626,59 @@ func (h *S3Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http
 	})
 	if err != nil {
 		// 如果获取大小失败，记录警告但不影响响应
-		log.Printf("Warning: Failed to get object size after multipart upload for key %s: %v", key, err)
+		logger.WarnContext(r.Context(), "Failed to get object size after multipart upload", "bucket", targetBucket.Config.Name, "key", key, "error", err)
 		objectSize = 0
 	} else if headResp.ContentLength != nil {
 		objectSize = *headResp.ContentLength
 	}
 
-	// 记录对象元数据（使用实际大小）
-	h.storage.RecordObject(key, targetBucket.Config.Name, objectSize, nil)
-
-	// 更新存储桶使用量
-	if objectSize > 0 {
-		targetBucket.UpdateUsedSize(objectSize)
+	// 在同一事务中提交映射、对象元数据（使用实际大小）、存储桶统计和上传会话
+	previous, err := h.store(r.Context()).CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: bucketName,
+		ObjectKey:         key,
+		RealBucketName:    targetBucket.Config.Name,
+		RealObjectKey:     key,
+		Size:              objectSize,
+		ETag:              aws.ToString(completeResp.ETag),
+		UploadID:          uploadID,
+		CompletedParts:    len(completeReq.Parts),
+	})
+	if err != nil {
+		// 后端已合并但元数据未提交，映射保持 pending，由垃圾回收器清理
+		logger.ErrorContext(r.Context(), "Failed to commit multipart upload", "bucket", bucketName, "key", key, "upload_id", uploadID, "error", err)
+		h.sendS3Error(w, "InternalError", "Failed to record object metadata", key)
+		return
 	}
 
-	// 更新上传会话状态为已完成
-	if err := h.storage.UpdateUploadSession(uploadID, len(completeReq.Parts), "completed"); err != nil {
-		log.Printf("Failed to update upload session status to completed for uploadID %s: %v", uploadID, err)
-		// 不影响主流程
-	}
+	// 更新存储桶使用量
+	targetBucket.UpdateUsedSize(usedSizeDelta(previous, targetBucket.Config.Name, objectSize))
+	h.invalidateCommitted(previous, targetBucket.Config.Name, key)
 
 	h.sendXMLResponse(w, http.StatusOK, result)
 }
 
-func getAPIError(err error) (smithy.APIError, bool) {
-	var apiErr smithy.APIError
-	if errors.As(err, &apiErr) {
-		return apiErr, true
-	}
-
-	var opErr *smithy.OperationError
-	if errors.As(err, &opErr) {
-		if apiErr, ok := opErr.Err.(smithy.APIError); ok {
-			return apiErr, true
-		}
-	}
-
-	return nil, false
-}
-
 // abortMultipartUploadInternal 内部方法：向后端S3发送中止分片上传请求
-func (h *S3Handler) abortMultipartUploadInternal(targetBucket *bucket.BucketInfo, key, uploadID string) error {
+func (h *S3Handler) abortMultipartUploadInternal(ctx context.Context, targetBucket *bucket.BucketInfo, key, uploadID string) error {
 	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
-	ctx := context.Background()
+	// 请求被取消时仍需中止后端上传，只沿用追踪上下文
+	ctx = context.WithoutCancel(ctx)
 	_, err := targetBucket.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
 		Bucket:   aws.String(targetBucket.Config.Name),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadID),
 	})
+	h.reportBackendResult(targetBucket, err)
 	if err != nil {
-		log.Printf("Failed to abort multipart upload for key %s, uploadID %s: %v", key, uploadID, err)
+		logger.ErrorContext(ctx, "Failed to abort multipart upload", "bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID, "error", err)
 		return err
 	}
 
 	// 更新上传会话状态为已中止
-	if err := h.storage.UpdateUploadSession(uploadID, 0, "aborted"); err != nil {
-		log.Printf("Failed to update upload session status to aborted for uploadID %s: %v", uploadID, err)
+	if err := h.store(ctx).UpdateUploadSession(uploadID, 0, "aborted"); err != nil {
+		logger.ErrorContext(ctx, "Failed to mark upload session as aborted", "upload_id", uploadID, "error", err)
 	}
 
-	log.Printf("Successfully aborted multipart upload for key %s, uploadID %s", key, uploadID)
+	logger.InfoContext(ctx, "Aborted multipart upload", "bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID)
 	return nil
 }
 
@@ -707,8 +700,8 @@ func (h *S3Handler) handleAbortMultipartUpload(w http.ResponseWriter, r *http.Re
 
 	// 如果是虚拟存储桶，需要通过映射查找真实存储桶
 	if requestedBucket.IsVirtual() {
-		// 获取虚拟存储桶映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		// 获取虚拟存储桶映射（上传完成前为 pending 状态）
+		mapping, err := h.store(r.Context()).GetUploadMapping(bucketName, key)
 		if err != nil {
 			// 如果映射不存在，可能是上传已经被中止了，返回成功
 			w.WriteHeader(http.StatusNoContent)
@@ -728,28 +721,21 @@ func (h *S3Handler) handleAbortMultipartUpload(w http.ResponseWriter, r *http.Re
 	}
 
 	// 中止分片上传
-	ctx := context.Background()
+	ctx := r.Context()
 	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
 	_, err := targetBucket.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
 		Bucket:   aws.String(targetBucket.Config.Name),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadID),
 	})
+	h.reportBackendResult(targetBucket, err)
 	if err != nil {
 		// 如果中止失败，可能是因为上传已经完成或中止，不需要报错
-		log.Printf("Failed to abort multipart upload for key %s: %v", key, err)
-	}
-
-	// 更新上传会话状态为已中止
-	if err := h.storage.UpdateUploadSession(uploadID, 0, "aborted"); err != nil {
-		log.Printf("Failed to update upload session status to aborted for uploadID %s: %v", uploadID, err)
-		// 不影响主流程
+		logger.WarnContext(r.Context(), "Failed to abort multipart upload", "bucket", targetBucket.Config.Name, "key", key, "upload_id", uploadID, "error", err)
 	}
 
-	// 如果是虚拟存储桶，还需要删除文件级别映射
-	if requestedBucket.IsVirtual() {
-		h.storage.DeleteVirtualBucketFileMapping(bucketName, key)
-	}
+	// 在同一事务中将上传会话标记为已中止、未提交的映射标记为失败（已存在的对象不受影响）
+	h.failUpload(r.Context(), bucketName, key, uploadID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/cache"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/DullJZ/s3-balance/pkg/datapath"
+)
+
+// errRangeIgnored 后端忽略 Range 请求返回了完整对象
+var errRangeIgnored = errors.New("backend ignored range request")
+
+// SetObjectCache 设置代理模式下载使用的磁盘缓存，nil 表示不使用缓存
+func (h *S3Handler) SetObjectCache(c *cache.DiskCache) {
+	h.objectCache = c
+}
+
+// invalidateCache 真实对象被写入、覆盖或删除后删除其缓存
+func (h *S3Handler) invalidateCache(realBucket, realKey string) {
+	if h.objectCache != nil {
+		h.objectCache.Invalidate(realBucket, realKey)
+	}
+}
+
+// invalidateCommitted 上传提交后删除新对象与被覆盖对象的缓存
+func (h *S3Handler) invalidateCommitted(previous *storage.Object, realBucket, realKey string) {
+	h.invalidateCache(realBucket, realKey)
+	if previous != nil && previous.BucketName != realBucket {
+		h.invalidateCache(previous.BucketName, previous.Key)
+	}
+}
+
+// cachedResponse 通过磁盘缓存返回一个对象的状态
+type cachedResponse struct {
+	w          http.ResponseWriter
+	obj        cache.Object // ETag 为后端对象的 ETag，用于 If-Match
+	etag       string       // 返回给客户端的 ETag
+	meta       *cache.Meta
+	start, end int64 // 返回的字节范围（含 end）
+	partial    bool  // 是否为 Range 请求
+	written    bool  // 是否已写出响应头
+	fromCache  int64
+	fromBucket int64
+}
+
+// serveCachedObject 通过磁盘缓存返回对象，返回 false 表示不适用缓存，由调用方直接代理
+// 对象按分块缓存：命中的分块从磁盘读取，连续缺失的分块合并为一次带 If-Match 的 Range 请求从后端读取并写入缓存
+func (h *S3Handler) serveCachedObject(w http.ResponseWriter, r *http.Request, b *bucket.BucketInfo, realKey, key string) bool {
+	c := h.objectCache
+	if c == nil || b == nil {
+		return false
+	}
+	// 缓存以对象记录中后端的 ETag 标识版本，没有 ETag 的旧记录无法判断缓存是否过期
+	info, err := h.store(r.Context()).GetObjectInfo(realKey)
+	if err != nil || info.ETag == "" || info.BucketName != b.Config.Name || !c.Cacheable(info.Size) {
+		return false
+	}
+
+	start, end, partial, ok := parseByteRange(r.Header.Get("Range"), info.Size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		h.sendS3ErrorWithStatus(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable", key)
+		return true
+	}
+
+	resp := &cachedResponse{
+		w:       w,
+		obj:     cache.Object{Bucket: b.Config.Name, Key: realKey, ETag: info.StoredETag()},
+		etag:    info.ETag,
+		start:   start,
+		end:     end,
+		partial: partial,
+	}
+	if meta, ok := c.Meta(resp.obj); ok && meta.Size == info.Size {
+		resp.meta = meta
+	}
+
+	chunkSize := c.ChunkSize()
+	last := end / chunkSize
+	for index := start / chunkSize; index <= last; {
+		if resp.meta != nil {
+			if f, ok := c.OpenChunk(resp.obj, index); ok {
+				err := resp.copyChunk(f, index, chunkSize)
+				f.Close()
+				if err != nil {
+					logger.WarnContext(r.Context(), "Failed to stream cached object", "bucket", b.Config.Name, "key", realKey, "error", err)
+					return true
+				}
+				index++
+				continue
+			}
+		}
+
+		// 从 index 开始连续缺失的分块一次从后端读取
+		runEnd := index
+		for runEnd < last && !c.HasChunk(resp.obj, runEnd+1) {
+			runEnd++
+		}
+		err := h.fillChunks(r, b, resp, index, runEnd, info.Size)
+		if err != nil {
+			// 后端对象在代理之外被修改（ETag 不匹配）时丢弃该对象的缓存
+			typed, ok := datapath.AsError(err)
+			stale := ok && typed.Code == "PreconditionFailed"
+			if stale {
+				logger.InfoContext(r.Context(), "Cached ETag is stale, bypassing cache", "bucket", b.Config.Name, "key", realKey)
+				c.Invalidate(b.Config.Name, realKey)
+			}
+			if !resp.written {
+				// 尚未写出响应时改为直接代理
+				if stale || errors.Is(err, errRangeIgnored) {
+					return false
+				}
+				logger.ErrorContext(r.Context(), "Failed to fetch object", "bucket", b.Config.Name, "key", realKey, "error", err)
+				h.sendBackendError(w, err, "Failed to fetch object", key)
+				return true
+			}
+			logger.WarnContext(r.Context(), "Failed to stream object through cache", "bucket", b.Config.Name, "key", realKey, "error", err)
+			return true
+		}
+		index = runEnd + 1
+	}
+
+	if h.metrics != nil {
+		result := "hit"
+		if resp.fromBucket > 0 {
+			result = "miss"
+		}
+		h.metrics.RecordCacheRequest(b.Config.Name, result)
+		h.metrics.RecordCacheServedBytes(b.Config.Name, "cache", resp.fromCache)
+		h.metrics.RecordCacheServedBytes(b.Config.Name, "backend", resp.fromBucket)
+	}
+	return true
+}
+
+// fillChunks 从后端读取分块 [first, last]，写入缓存的同时把请求范围内的部分返回给客户端
+func (h *S3Handler) fillChunks(r *http.Request, b *bucket.BucketInfo, resp *cachedResponse, first, last, size int64) error {
+	c := h.objectCache
+	chunkSize := c.ChunkSize()
+	from := first * chunkSize
+	to := (last+1)*chunkSize - 1
+	if to >= size {
+		to = size - 1
+	}
+
+	h.recordBackendOperation(b, bucket.OperationTypeB)
+	out, err := datapath.GetObject(r.Context(), b, &datapath.GetInput{
+		Key:     resp.obj.Key,
+		Range:   fmt.Sprintf("bytes=%d-%d", from, to),
+		IfMatch: resp.obj.ETag,
+	})
+	h.reportBackendResult(b, err)
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	// 不支持 Range 的后端会返回完整对象，无法按分块缓存
+	if out.ContentRange == "" && (from != 0 || to != size-1) {
+		return errRangeIgnored
+	}
+
+	if resp.meta == nil {
+		resp.meta = &cache.Meta{
+			Size:            size,
+			ContentType:     out.ContentType,
+			ContentEncoding: out.ContentEncoding,
+			CacheControl:    out.CacheControl,
+			LastModified:    out.LastModified,
+		}
+		if err := c.SaveMeta(resp.obj, resp.meta); err != nil {
+			logger.WarnContext(r.Context(), "Failed to save cache metadata", "bucket", b.Config.Name, "key", resp.obj.Key, "error", err)
+		}
+	}
+	resp.writeHeaders()
+
+	for index := first; index <= last; index++ {
+		chunkStart := index * chunkSize
+		chunkLen := chunkSize
+		if chunkStart+chunkLen > size {
+			chunkLen = size - chunkStart
+		}
+
+		client := resp.window(index, chunkSize)
+		chunk, err := c.CreateChunk(resp.obj, index)
+		if err != nil {
+			// 无法写入缓存时仍然把数据返回给客户端
+			logger.WarnContext(r.Context(), "Failed to create cache chunk", "bucket", b.Config.Name, "key", resp.obj.Key, "error", err)
+			if _, err := io.CopyN(client, out.Body, chunkLen); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.CopyN(io.MultiWriter(chunk, client), out.Body, chunkLen); err != nil {
+			chunk.Abort()
+			return err
+		}
+		if err := chunk.Commit(); err != nil {
+			logger.WarnContext(r.Context(), "Failed to commit cache chunk", "bucket", b.Config.Name, "key", resp.obj.Key, "error", err)
+		}
+		resp.fromBucket += client.written
+	}
+	return nil
+}
+
+// writeHeaders 在写出第一个字节前写出响应头，状态码为 200 或 206
+// 推迟到此时是为了让第一次后端读取失败（如 ETag 已过期）时仍可改为直接代理
+func (resp *cachedResponse) writeHeaders() {
+	if resp.written {
+		return
+	}
+	header := resp.w.Header()
+	contentType := resp.meta.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(resp.end-resp.start+1, 10))
+	header.Set("ETag", resp.etag)
+	header.Set("Accept-Ranges", "bytes")
+	if !resp.meta.LastModified.IsZero() {
+		header.Set("Last-Modified", resp.meta.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if resp.meta.ContentEncoding != "" {
+		header.Set("Content-Encoding", resp.meta.ContentEncoding)
+	}
+	if resp.meta.CacheControl != "" {
+		header.Set("Cache-Control", resp.meta.CacheControl)
+	}
+	if resp.partial {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", resp.start, resp.end, resp.meta.Size))
+		resp.w.WriteHeader(http.StatusPartialContent)
+	} else {
+		resp.w.WriteHeader(http.StatusOK)
+	}
+	resp.written = true
+}
+
+// copyChunk 把已缓存分块中请求范围内的部分写给客户端
+func (resp *cachedResponse) copyChunk(f io.ReadSeeker, index, chunkSize int64) error {
+	client := resp.window(index, chunkSize)
+	if _, err := f.Seek(client.skip, io.SeekStart); err != nil {
+		return err
+	}
+	resp.writeHeaders()
+	n, err := io.CopyN(resp.w, f, client.remain)
+	resp.fromCache += n
+	return err
+}
+
+// window 返回只写出分块中请求范围内数据的写入器
+func (resp *cachedResponse) window(index, chunkSize int64) *windowWriter {
+	chunkStart := index * chunkSize
+	skip := int64(0)
+	if resp.start > chunkStart {
+		skip = resp.start - chunkStart
+	}
+	chunkEnd := chunkStart + chunkSize - 1
+	if resp.end < chunkEnd {
+		chunkEnd = resp.end
+	}
+	return &windowWriter{w: resp.w, skip: skip, remain: chunkEnd - chunkStart - skip + 1}
+}
+
+// windowWriter 丢弃前 skip 字节，写出随后的 remain 字节，丢弃其余数据
+type windowWriter struct {
+	w       io.Writer
+	skip    int64
+	remain  int64
+	written int64
+}
+
+func (ww *windowWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if ww.skip > 0 {
+		if int64(len(p)) <= ww.skip {
+			ww.skip -= int64(len(p))
+			return n, nil
+		}
+		p = p[ww.skip:]
+		ww.skip = 0
+	}
+	if int64(len(p)) > ww.remain {
+		p = p[:ww.remain]
+	}
+	if len(p) > 0 {
+		written, err := ww.w.Write(p)
+		ww.remain -= int64(written)
+		ww.written += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// parseByteRange 解析单个 Range（bytes=a-b、bytes=a-、bytes=-n），返回闭区间
+// 未提供、格式错误或多个范围时返回完整对象（partial 为 false）；起始位置超出对象大小时 ok 为 false
+func parseByteRange(header string, size int64) (start, end int64, partial, ok bool) {
+	full := func() (int64, int64, bool, bool) { return 0, size - 1, false, true }
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return full()
+	}
+	first, second, found := strings.Cut(spec, "-")
+	if !found {
+		return full()
+	}
+	first, second = strings.TrimSpace(first), strings.TrimSpace(second)
+
+	if first == "" {
+		// 最后 n 个字节
+		n, err := strconv.ParseInt(second, 10, 64)
+		if err != nil || n <= 0 {
+			return full()
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return full()
+	}
+	end = size - 1
+	if second != "" {
+		end, err = strconv.ParseInt(second, 10, 64)
+		if err != nil || end < start {
+			return full()
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	return start, end, true, true
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -12,9 +11,18 @@ import (
 	"time"
 
 	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/recovery"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/DullJZ/s3-balance/pkg/datapath"
 	"github.com/gorilla/mux"
 )
 
+// 后端数据请求超时
+const (
+	backendUploadTimeout = 30 * time.Minute
+	backendDeleteTimeout = 30 * time.Second
+)
+
 // handleObjectOperations 处理对象相关操作
 func (h *S3Handler) handleObjectOperations(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -61,7 +69,7 @@ func (h *S3Handler) handleGetObject(w http.ResponseWriter, r *http.Request, buck
 	var realKey string
 	if requestedBucket.IsVirtual() {
 		// 获取虚拟存储桶映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		mapping, err := h.store(r.Context()).GetVirtualBucketMapping(bucketName, key)
 		if err != nil {
 			h.sendS3Error(w, "NoSuchKey", "The specified key does not exist", key)
 			return
@@ -75,72 +83,76 @@ func (h *S3Handler) handleGetObject(w http.ResponseWriter, r *http.Request, buck
 		}
 
 		realKey = mapping.RealObjectKey
-		h.recordBackendOperation(bucket1, bucket.OperationTypeB)
 	} else {
 		realKey = key
 	}
 
-	// 生成预签名下载URL（使用真实key）
-	downloadInfo, err := h.presigner.GenerateDownloadURL(
-		context.Background(),
-		bucket1,
-		realKey,
-	)
-	if err != nil {
-		h.sendS3Error(w, "InternalError", "Failed to generate download URL", key)
-		return
-	}
-
-	// 根据配置决定使用代理模式还是重定向模式
+	// 代理模式：通过 SDK 客户端读取真实对象并流式传输给客户端
 	if h.proxyModeEnabled() {
-		// 代理模式：流式传输内容给客户端
-		resp, err := http.Get(downloadInfo.URL)
-		if err != nil {
-			h.sendS3Error(w, "InternalError", "Failed to fetch object", key)
+		// 启用磁盘缓存时优先从缓存返回，只有缺失的分块才向后端读取
+		if h.serveCachedObject(w, r, bucket1, realKey, key) {
 			return
 		}
-		defer resp.Body.Close()
 
-		// 检查响应状态
-		if resp.StatusCode != http.StatusOK {
-			w.WriteHeader(resp.StatusCode)
-			io.Copy(w, resp.Body)
+		h.recordBackendOperation(bucket1, bucket.OperationTypeB)
+		obj, err := datapath.GetObject(r.Context(), bucket1, &datapath.GetInput{
+			Key:   realKey,
+			Range: r.Header.Get("Range"),
+		})
+		h.reportBackendResult(bucket1, err)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "Failed to fetch object", "bucket", bucket1.Config.Name, "key", realKey, "error", err)
+			h.sendBackendError(w, err, "Failed to fetch object", key)
 			return
 		}
+		defer obj.Body.Close()
 
 		// 复制重要的响应头
-		if contentType := resp.Header.Get("Content-Type"); contentType != "" {
-			w.Header().Set("Content-Type", contentType)
+		if obj.ContentType != "" {
+			w.Header().Set("Content-Type", obj.ContentType)
 		}
-		if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
-			w.Header().Set("Content-Length", contentLength)
-		} else if resp.ContentLength >= 0 {
-			w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
-		} else if obj, err := h.storage.GetObjectInfo(key); err == nil {
-			w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+		if obj.ContentLength >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(obj.ContentLength, 10))
+		} else if info, err := h.store(r.Context()).GetObjectInfo(key); err == nil && obj.ContentRange == "" {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
 		}
-		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
-			w.Header().Set("Last-Modified", lastModified)
+		if !obj.LastModified.IsZero() {
+			w.Header().Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
 		}
-		if etag := resp.Header.Get("ETag"); etag != "" {
-			w.Header().Set("ETag", etag)
+		if obj.ETag != "" {
+			w.Header().Set("ETag", h.clientETag(r.Context(), realKey, obj.ETag))
 		}
-		if contentEncoding := resp.Header.Get("Content-Encoding"); contentEncoding != "" {
-			w.Header().Set("Content-Encoding", contentEncoding)
+		if obj.ContentEncoding != "" {
+			w.Header().Set("Content-Encoding", obj.ContentEncoding)
 		}
-		if cacheControl := resp.Header.Get("Cache-Control"); cacheControl != "" {
-			w.Header().Set("Cache-Control", cacheControl)
+		if obj.CacheControl != "" {
+			w.Header().Set("Cache-Control", obj.CacheControl)
+		}
+		w.Header().Set("Accept-Ranges", "bytes")
+		if obj.ContentRange != "" {
+			w.Header().Set("Content-Range", obj.ContentRange)
+			w.WriteHeader(http.StatusPartialContent)
 		}
 
 		// 流式复制响应体
-		_, err = io.Copy(w, resp.Body)
-		if err != nil {
-			log.Printf("Error streaming response body for key %s: %v", key, err)
+		if _, err := io.Copy(w, obj.Body); err != nil {
+			logger.WarnContext(r.Context(), "Failed to stream response body", "bucket", bucketName, "key", key, "error", err)
 		}
-	} else {
-		// 重定向模式：返回302重定向到预签名URL（默认）
-		http.Redirect(w, r, downloadInfo.URL, http.StatusFound)
+		return
+	}
+
+	// 重定向模式：返回302重定向到预签名URL（默认）
+	h.recordBackendOperation(bucket1, bucket.OperationTypeB)
+	downloadInfo, err := h.presigner.GenerateDownloadURL(
+		r.Context(),
+		bucket1,
+		realKey,
+	)
+	if err != nil {
+		h.sendS3Error(w, "InternalError", "Failed to generate download URL", key)
+		return
 	}
+	http.Redirect(w, r, downloadInfo.URL, http.StatusFound)
 }
 
 // handleHeadObject 获取对象元数据
@@ -155,7 +167,7 @@ func (h *S3Handler) handleHeadObject(w http.ResponseWriter, r *http.Request, buc
 	// 如果是虚拟存储桶，需要通过映射查找真实存储桶
 	if requestedBucket.IsVirtual() {
 		// 获取虚拟存储桶映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		mapping, err := h.store(r.Context()).GetVirtualBucketMapping(bucketName, key)
 		if err != nil {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -164,7 +176,7 @@ func (h *S3Handler) handleHeadObject(w http.ResponseWriter, r *http.Request, buc
 		_ = mapping // 使用mapping变量，避免编译错误
 
 		// 查找对象信息（在映射的真实存储桶中）
-		obj, err := h.storage.GetObjectInfo(key)
+		obj, err := h.store(r.Context()).GetObjectInfo(key)
 		if err != nil {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -176,7 +188,7 @@ func (h *S3Handler) handleHeadObject(w http.ResponseWriter, r *http.Request, buc
 
 	// 真实存储桶的直接处理
 	// 从存储中获取对象信息
-	obj, err := h.storage.GetObjectInfo(key)
+	obj, err := h.store(r.Context()).GetObjectInfo(key)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -202,107 +214,176 @@ func (h *S3Handler) handlePutObject(w http.ResponseWriter, r *http.Request, buck
 		return
 	}
 
-	// 获取内容长度
-	contentLength := r.ContentLength
-	if contentLength < 0 {
-		h.sendS3Error(w, "MissingContentLength", "Content-Length header is required", key)
+	// 解码 aws-chunked 请求体，长度未知时先暂存以获得内容长度
+	body, code, message := h.openUploadBody(r)
+	if body == nil {
+		h.sendS3Error(w, code, message, key)
 		return
 	}
+	defer body.Close()
+	contentLength := body.ContentLength
 
-	var targetBucket *bucket.BucketInfo
-	var err error
-
-	// 如果是虚拟存储桶，需要选择真实存储桶并创建映射
-	if requestedBucket.IsVirtual() {
-		// 获取虚拟存储桶文件映射，如果不存在则创建
-		mapping, mappingErr := h.storage.GetVirtualBucketMapping(bucketName, key)
-		if mappingErr != nil {
-			// 映射不存在，使用负载均衡器选择真实存储桶并创建映射
-			targetBucket, err = h.balancer.SelectBucket(key, contentLength)
-			if err != nil {
-				h.sendS3Error(w, "InsufficientStorage", "No bucket has enough space", key)
-				return
-			}
-
-			// 创建虚拟存储桶文件级映射（对于普通PUT，虚拟key和真实key相同）
-			if err := h.storage.CreateVirtualBucketMapping(bucketName, key, targetBucket.Config.Name, key); err != nil {
-				h.sendS3Error(w, "InternalError", "Failed to create virtual bucket file mapping", key)
-				return
-			}
-		} else {
-			// 映射已存在，获取对应的真实存储桶
-			targetBucket, ok = h.bucketManager.GetBucket(mapping.RealBucketName)
-			if !ok {
-				h.sendS3Error(w, "InternalError", "Mapped real bucket not found", key)
-				return
-			}
-		}
-	} else {
-		// 如果不是虚拟存储桶，拒绝客户端对真实存储桶的直接PUT操作
+	// 如果不是虚拟存储桶，拒绝客户端对真实存储桶的直接PUT操作
+	if !requestedBucket.IsVirtual() {
 		h.sendS3Error(w, "NoSuchBucket", "The specified bucket does not exist", bucketName)
 		return
 	}
+	targetBucket, code, message := h.placeUpload(r.Context(), bucketName, key, contentLength)
+	if targetBucket == nil {
+		h.sendS3Error(w, code, message, key)
+		return
+	}
 
-	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
-
-	// 生成预签名上传URL
-	uploadInfo, err := h.presigner.GenerateUploadURL(
-		context.Background(),
-		targetBucket,
-		key,
-		r.Header.Get("Content-Type"),
-		nil, // metadata
-	)
+	// 通过 SDK 客户端流式上传，写入放置标记以便元数据丢失时从后端恢复映射
+	input := &datapath.PutInput{
+		Key:           key,
+		Body:          body.Body,
+		ContentLength: contentLength,
+		ContentType:   r.Header.Get("Content-Type"),
+		ContentMD5:    r.Header.Get("Content-MD5"),
+		Metadata:      recovery.PlacementMetadata(bucketName, key),
+	}
+	out, err := h.putRealObject(r.Context(), targetBucket, input)
 	if err != nil {
-		log.Printf("Failed to generate upload URL for key %s in bucket %s: %v", key, targetBucket.Config.Name, err)
-		h.sendS3Error(w, "InternalError", "Failed to generate upload URL", key)
+		logger.ErrorContext(r.Context(), "Failed to upload object", "bucket", targetBucket.Config.Name, "key", key, "error", err)
+		h.failUpload(r.Context(), bucketName, key, "")
+		// 客户端请求体解码失败不是后端故障，不计入熔断器
+		if decodeErr := body.decodeError(); decodeErr != nil {
+			code, message := streamingError(decodeErr)
+			h.sendS3Error(w, code, message, key)
+			return
+		}
+		h.reportBackendResult(targetBucket, err)
+		h.sendBackendError(w, err, "Failed to upload object", key)
 		return
 	}
+	h.reportBackendResult(targetBucket, nil)
 
-	// 只使用反向代理上传到真实预签名URL，不再返回307重定向
-	// 创建新的请求
-	req, err := http.NewRequest(uploadInfo.Method, uploadInfo.URL, r.Body)
-	if err != nil {
-		h.sendS3Error(w, "InternalError", "Failed to create upload request", key)
+	if err := h.commitPut(r.Context(), bucketName, key, targetBucket, contentLength, out); err != nil {
+		h.sendS3Error(w, "InternalError", "Failed to record object metadata", key)
 		return
 	}
 
-	// 设置必要的头
-	req.ContentLength = contentLength
-	if ct := r.Header.Get("Content-Type"); ct != "" {
-		req.Header.Set("Content-Type", ct)
+	// 自动分片上传时返回请求体的 MD5，与单次 PUT 一致，不返回后端的分片形式 ETag
+	etag := out.ETag
+	if etag == "" {
+		etag = fmt.Sprintf("\"%x\"", time.Now().UnixNano())
 	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+}
 
-	// 添加预签名URL所需的额外头
-	for k, v := range uploadInfo.Headers {
-		req.Header.Set(k, v)
+// placeUpload 为虚拟存储桶中的 key 确定写入的真实存储桶：已有映射时沿用，否则由负载均衡器选择并创建 pending 映射
+// 失败时返回 nil 与 S3 错误码、说明
+func (h *S3Handler) placeUpload(ctx context.Context, bucketName, key string, size int64) (*bucket.BucketInfo, string, string) {
+	// 获取虚拟存储桶文件映射（包括未提交的），如果不存在则创建
+	mapping, err := h.store(ctx).GetUploadMapping(bucketName, key)
+	if err != nil {
+		// 映射不存在，使用负载均衡器选择真实存储桶
+		targetBucket, err := h.balancer.SelectBucket(ctx, key, size)
+		if err != nil {
+			return nil, "InsufficientStorage", "No bucket has enough space"
+		}
+
+		// 以 pending 状态创建虚拟存储桶文件级映射（对于普通PUT，虚拟key和真实key相同），上传成功后提交
+		mapping, err = h.store(ctx).BeginUpload(bucketName, key, targetBucket.Config.Name, key)
+		if err != nil {
+			return nil, "InternalError", "Failed to create virtual bucket file mapping"
+		}
 	}
 
-	// 执行上传
-	client := &http.Client{Timeout: 30 * time.Minute}
-	resp, err := client.Do(req)
+	// 写入映射记录的真实存储桶（已存在或被并发创建的映射可能指向其他存储桶）
+	targetBucket, ok := h.bucketManager.GetBucket(mapping.RealBucketName)
+	if !ok {
+		return nil, "InternalError", "Mapped real bucket not found"
+	}
+	return targetBucket, "", ""
+}
+
+// commitPut 在同一事务中提交映射、对象元数据和存储桶统计，并更新已用容量与下载缓存
+func (h *S3Handler) commitPut(ctx context.Context, bucketName, key string, targetBucket *bucket.BucketInfo, size int64, out *datapath.PutOutput) error {
+	previous, err := h.store(ctx).CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: bucketName,
+		ObjectKey:         key,
+		RealBucketName:    targetBucket.Config.Name,
+		RealObjectKey:     key,
+		Size:              size,
+		ETag:              out.ETag,
+		BackendETag:       out.BackendETag,
+	})
 	if err != nil {
-		h.sendS3Error(w, "InternalError", "Failed to upload object", key)
-		return
+		// 后端已写入但元数据未提交，映射保持 pending，由垃圾回收器清理
+		logger.ErrorContext(ctx, "Failed to commit upload", "bucket", bucketName, "key", key, "real_bucket", targetBucket.Config.Name, "error", err)
+		return err
+	}
+	targetBucket.UpdateUsedSize(usedSizeDelta(previous, targetBucket.Config.Name, size))
+	h.invalidateCommitted(previous, targetBucket.Config.Name, key)
+	return nil
+}
+
+// PutObject 把服务自身产生的数据（如访问日志文件）写入虚拟存储桶，放置与提交流程与客户端 PUT 相同
+func (h *S3Handler) PutObject(ctx context.Context, bucketName, key string, body io.Reader, size int64, contentType string) error {
+	requestedBucket, ok := h.bucketManager.GetBucket(bucketName)
+	if !ok || !requestedBucket.IsVirtual() {
+		return fmt.Errorf("virtual bucket %s not found", bucketName)
+	}
+	targetBucket, code, message := h.placeUpload(ctx, bucketName, key, size)
+	if targetBucket == nil {
+		return fmt.Errorf("%s: %s", code, message)
+	}
+
+	out, err := h.putRealObject(ctx, targetBucket, &datapath.PutInput{
+		Key:           key,
+		Body:          body,
+		ContentLength: size,
+		ContentType:   contentType,
+		Metadata:      recovery.PlacementMetadata(bucketName, key),
+	})
+	h.reportBackendResult(targetBucket, err)
+	if err != nil {
+		h.failUpload(ctx, bucketName, key, "")
+		return fmt.Errorf("failed to upload to bucket %s: %w", targetBucket.Config.Name, err)
 	}
-	defer resp.Body.Close()
+	return h.commitPut(ctx, bucketName, key, targetBucket, size, out)
+}
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		// 记录对象元数据
-		h.storage.RecordObject(key, targetBucket.Config.Name, contentLength, nil)
-		targetBucket.UpdateUsedSize(contentLength)
+// putRealObject 上传对象到真实存储桶，超过阈值时拆分为并行的后端分片上传
+// 分片上传的超时按分片计算，避免大文件在不稳定的链路上因单个长请求超时而整体失败
+func (h *S3Handler) putRealObject(ctx context.Context, targetBucket *bucket.BucketInfo, input *datapath.PutInput) (*datapath.PutOutput, error) {
+	am := h.loadSettings().autoMultipart
+	if !am.IsEnabled() || am.ThresholdBytes <= 0 || input.ContentLength <= am.ThresholdBytes {
+		h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
+		ctx, cancel := context.WithTimeout(ctx, backendUploadTimeout)
+		defer cancel()
+		return datapath.PutObject(ctx, targetBucket, input)
+	}
+
+	return datapath.PutObjectMultipart(ctx, targetBucket, input, datapath.MultipartOptions{
+		PartSize:    am.PartSizeBytes,
+		Concurrency: am.Concurrency,
+		PartRetries: am.PartRetries,
+		PartTimeout: backendUploadTimeout,
+		OnRequest: func() {
+			h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
+		},
+	})
+}
 
-		// 返回成功响应
-		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", time.Now().UnixNano()))
-		w.WriteHeader(http.StatusOK)
-	} else {
-		// 读取错误响应体以获取详细信息
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Upload failed with status %d: %s", resp.StatusCode, string(body))
-		h.sendS3Error(w, "InternalError", fmt.Sprintf("Upload failed with status %d", resp.StatusCode), key)
+// failUpload 将未提交的上传标记为失败，uploadID 非空时同时中止上传会话
+func (h *S3Handler) failUpload(ctx context.Context, bucketName, key, uploadID string) {
+	if err := h.store(ctx).FailUpload(bucketName, key, uploadID); err != nil {
+		logger.ErrorContext(ctx, "Failed to mark upload as failed", "bucket", bucketName, "key", key, "error", err)
 	}
 }
 
+// usedSizeDelta 计算提交上传后真实存储桶已用容量的变化（覆盖写只计入差值）
+func usedSizeDelta(previous *storage.Object, realBucketName string, size int64) int64 {
+	if previous != nil && previous.BucketName == realBucketName {
+		return size - previous.Size
+	}
+	return size
+}
+
 // handleCopyObject 复制对象（只在数据库中创建新映射）
 func (h *S3Handler) handleCopyObject(w http.ResponseWriter, r *http.Request, destBucket, destKey, copySource string) {
 	// 解析复制源 (格式: /source-bucket/source-key 或 source-bucket/source-key)
@@ -353,32 +434,29 @@ func (h *S3Handler) handleCopyObject(w http.ResponseWriter, r *http.Request, des
 	}
 	// 如果是 COPY 或未指定，则复制源对象的元数据（在 storage.CopyObject 中处理）
 
-	// 获取源对象的映射信息
-	sourceMapping, err := h.storage.GetVirtualBucketMapping(sourceBucket, sourceKey)
-	if err != nil {
-		log.Printf("Failed to get source object mapping %s: %v", sourceKey, err)
-		h.sendS3Error(w, "NoSuchKey", "The specified key does not exist", sourceKey)
-		return
-	}
-
-	// 复制操作只创建新的虚拟映射，指向相同的真实对象（零拷贝）
+	// 复制操作只让目标映射指向相同的真实对象（零拷贝）
 	destBucketInfo, destOk := h.bucketManager.GetBucket(destBucket)
 	if !destOk || !destBucketInfo.IsVirtual() {
 		h.sendS3Error(w, "NoSuchBucket", "The destination bucket does not exist", destBucket)
 		return
 	}
 
-	// 创建新的虚拟存储桶映射，指向相同的真实bucket和真实key
-	if err := h.storage.CreateVirtualBucketMapping(destBucket, destKey, sourceMapping.RealBucketName, sourceMapping.RealObjectKey); err != nil {
-		log.Printf("Failed to create virtual bucket mapping for copied object %s: %v", destKey, err)
-		h.sendS3Error(w, "InternalError", "Failed to create virtual bucket file mapping", destKey)
+	// 在同一事务中更新目标映射；目标原来的真实对象不再被引用时加入待删除队列
+	sourceObj, freed, err := h.store(r.Context()).CopyMapping(sourceBucket, sourceKey, destBucket, destKey)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to copy object", "source_bucket", sourceBucket, "source_key", sourceKey, "bucket", destBucket, "key", destKey, "error", err)
+		if _, mappingErr := h.store(r.Context()).GetVirtualBucketMapping(sourceBucket, sourceKey); mappingErr != nil {
+			h.sendS3Error(w, "NoSuchKey", "The specified key does not exist", sourceKey)
+		} else {
+			h.sendS3Error(w, "InternalError", "Failed to create virtual bucket file mapping", destKey)
+		}
 		return
 	}
-
-	// 获取源对象信息用于响应
-	sourceObj, err := h.storage.GetObjectInfo(sourceMapping.RealObjectKey)
-	if err != nil {
-		log.Printf("Failed to get source object info: %v", err)
+	if freed != nil {
+		if freedBucket, ok := h.bucketManager.GetBucket(freed.BucketName); ok {
+			freedBucket.UpdateUsedSize(-freed.Size)
+		}
+		h.invalidateCache(freed.BucketName, freed.Key)
 	}
 
 	// 返回成功响应
@@ -402,7 +480,33 @@ func (h *S3Handler) handleCopyObject(w http.ResponseWriter, r *http.Request, des
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(response))
 
-	log.Printf("Object copied successfully: %s -> %s", sourceKey, destKey)
+	logger.InfoContext(r.Context(), "Object copied", "source_bucket", sourceBucket, "source_key", sourceKey, "bucket", destBucket, "key", destKey)
+}
+
+// deleteRealObject 通过 SDK 客户端删除真实S3对象，返回后端是否确认删除（成功或对象已不存在）
+func (h *S3Handler) deleteRealObject(ctx context.Context, targetBucket *bucket.BucketInfo, realKey string) bool {
+	h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
+
+	ctx, cancel := context.WithTimeout(ctx, backendDeleteTimeout)
+	defer cancel()
+	err := datapath.DeleteObject(ctx, targetBucket, realKey)
+	h.reportBackendResult(targetBucket, err)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to delete real object, will retry", "bucket", targetBucket.Config.Name, "key", realKey, "error", err)
+		return false
+	}
+	return true
+}
+
+// clientETag 自动分片上传的对象在后端是分片形式的 ETag（"<md5>-N"），换成对象记录中返回给客户端的 ETag
+func (h *S3Handler) clientETag(ctx context.Context, realKey, backendETag string) string {
+	if !strings.Contains(backendETag, "-") {
+		return backendETag
+	}
+	if info, err := h.store(ctx).GetObjectInfo(realKey); err == nil && info.BackendETag == backendETag {
+		return info.ETag
+	}
+	return backendETag
 }
 
 // handleDeleteObject 删除对象
@@ -420,7 +524,7 @@ func (h *S3Handler) handleDeleteObject(w http.ResponseWriter, r *http.Request, b
 
 	if requestedBucket.IsVirtual() {
 		// 获取虚拟存储桶文件映射
-		mapping, err := h.storage.GetVirtualBucketMapping(bucketName, key)
+		mapping, err := h.store(r.Context()).GetVirtualBucketMapping(bucketName, key)
 		if err != nil {
 			// 对象不存在，S3规范要求返回204
 			w.WriteHeader(http.StatusNoContent)
@@ -441,45 +545,32 @@ func (h *S3Handler) handleDeleteObject(w http.ResponseWriter, r *http.Request, b
 		return
 	}
 
-	// 先删除虚拟存储桶映射
-	if err := h.storage.DeleteVirtualBucketObjectMapping(bucketName, key); err != nil {
-		log.Printf("Failed to delete virtual bucket mapping for %s/%s: %v", bucketName, key, err)
-	}
-
-	// 检查是否还有其他映射指向同一个真实对象
-	count, err := h.storage.CountMappingsToRealObject(targetBucket.Config.Name, realKey)
+	// 在同一事务中删除映射；没有其他映射引用真实对象时删除对象记录并加入待删除队列
+	// 真实对象由下面的请求立即删除，失败时由垃圾回收器重试，直到后端确认
+	// 事务提交后同一个键可能已被新的上传重新引用（真实键与虚拟键相同），删除前需再次确认
+	pending, obj, err := h.store(r.Context()).DeleteMappingAndEnqueue(bucketName, key, targetBucket.Config.Name, realKey)
 	if err != nil {
-		log.Printf("Failed to count mappings for real object %s: %v", realKey, err)
+		logger.ErrorContext(r.Context(), "Failed to delete mapping", "bucket", bucketName, "key", key, "error", err)
+		h.sendS3Error(w, "InternalError", "Failed to delete object", key)
+		return
 	}
-
-	// 只有当没有其他映射引用时，才删除真实S3对象
-	if count == 0 {
-		h.recordBackendOperation(targetBucket, bucket.OperationTypeA)
-
-		// 生成预签名删除URL（使用真实key）
-		deleteInfo, err := h.presigner.GenerateDeleteURL(
-			context.Background(),
-			targetBucket,
-			realKey,
-		)
-		if err != nil {
-			log.Printf("Failed to generate delete URL for %s: %v", realKey, err)
-		} else {
-			// 执行删除真实S3对象
-			req, _ := http.NewRequest("DELETE", deleteInfo.URL, nil)
-			client := &http.Client{Timeout: 30 * time.Second}
-			resp, err := client.Do(req)
-			if err != nil {
-				log.Printf("Failed to delete real S3 object %s: %v", realKey, err)
-			} else {
-				defer resp.Body.Close()
+	if obj != nil {
+		targetBucket.UpdateUsedSize(-obj.Size)
+		h.invalidateCache(targetBucket.Config.Name, realKey)
+	}
+
+	if pending != nil {
+		referenced, err := h.store(r.Context()).IsRealObjectReferenced(targetBucket.Config.Name, realKey)
+		switch {
+		case err != nil:
+			// 留给垃圾回收器在确认引用后删除
+			logger.WarnContext(r.Context(), "Failed to check references of deleted object", "bucket", targetBucket.Config.Name, "key", realKey, "error", err)
+		case referenced || h.deleteRealObject(r.Context(), targetBucket, realKey):
+			// 已被重新引用的对象不能删除，与删除成功一样移除待删除记录
+			if err := h.store(r.Context()).CompletePendingDeletion(pending.ID); err != nil {
+				logger.ErrorContext(r.Context(), "Failed to remove pending deletion", "bucket", targetBucket.Config.Name, "key", realKey, "error", err)
 			}
 		}
-
-		// 从数据库中删除对象记录
-		if err := h.storage.DeleteObject(realKey); err != nil {
-			log.Printf("Failed to delete object record for %s: %v", realKey, err)
-		}
 	}
 
 	// S3规范要求删除操作总是返回204
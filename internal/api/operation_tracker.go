@@ -1,8 +1,6 @@
 package api
 
 import (
-	"log"
-
 	"github.com/DullJZ/s3-balance/internal/bucket"
 )
 
@@ -12,25 +10,16 @@ func (h *S3Handler) recordBackendOperation(b *bucket.BucketInfo, category bucket
 		return
 	}
 
-	if h.metrics != nil {
-		h.metrics.RecordBackendOperation(b.Config.Name, string(category))
-	}
-
-	var disabled bool
-
-	if h.storage != nil {
-		newCount, err := h.storage.IncrementBucketOperation(b.Config.Name, string(category))
-		if err != nil {
-			log.Printf("failed to persist backend operation count for bucket %s: %v", b.Config.Name, err)
-			disabled = b.RecordOperation(category)
-		} else {
-			disabled = b.SetOperationCount(category, newCount)
-		}
-	} else {
-		disabled = b.RecordOperation(category)
+	disabled := h.bucketManager.CountOperation(b, category)
+	if disabled {
+		logger.Warn("Bucket disabled after exceeding operation limit", "bucket", b.Config.Name, "category", category)
 	}
+}
 
-	if disabled {
-		log.Printf("Bucket %s disabled after exceeding %s-type operation limit", b.Config.Name, category)
+// reportBackendResult feeds the outcome of a real backend request into the bucket's circuit breaker.
+func (h *S3Handler) reportBackendResult(b *bucket.BucketInfo, err error) {
+	if b == nil {
+		return
 	}
+	b.ReportBackendResult(err)
 }
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/reconcile"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// AuditActionReconcileRun 手动触发对账的审计动作
+const AuditActionReconcileRun = "reconcile.run"
+
+// ReconcileHandler 元数据对账处理器
+type ReconcileHandler struct {
+	job     *reconcile.Job
+	storage *storage.Service
+	ctx     context.Context
+}
+
+// NewReconcileHandler 创建对账处理器，ctx 结束时取消手动触发的对账
+func NewReconcileHandler(ctx context.Context, job *reconcile.Job, storage *storage.Service) *ReconcileHandler {
+	return &ReconcileHandler{
+		job:     job,
+		storage: storage,
+		ctx:     ctx,
+	}
+}
+
+// ReconcileStatusResponse 对账状态响应
+type ReconcileStatusResponse struct {
+	Running   bool              `json:"running"`
+	LastError string            `json:"last_error,omitempty"`
+	Report    *reconcile.Report `json:"report"`
+}
+
+// ReconcileRunRequest 手动触发对账请求，字段均可省略
+type ReconcileRunRequest struct {
+	Mode         string   `json:"mode"`
+	AdoptInto    string   `json:"adopt_into"`
+	Buckets      []string `json:"buckets"`
+	MinAge       string   `json:"min_age"`
+	PageInterval string   `json:"page_interval"`
+}
+
+// RegisterRoutes 注册对账路由
+// 注意: router 参数应该是已经带有 /api 前缀的子路由器
+func (h *ReconcileHandler) RegisterRoutes(router *mux.Router) {
+	handleWithRole(router, "/reconcile/report", middleware.RoleOperator, h.GetReport, http.MethodGet)
+	handleWithRole(router, "/reconcile/run", middleware.RoleAdmin, h.Run, http.MethodPost)
+}
+
+// GetReport 返回最近一次对账报告
+func (h *ReconcileHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	running, report, lastError := h.job.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReconcileStatusResponse{
+		Running:   running,
+		LastError: lastError,
+		Report:    report,
+	})
+}
+
+// Run 在后台触发一次对账，未指定的参数使用配置中的值
+func (h *ReconcileHandler) Run(w http.ResponseWriter, r *http.Request) {
+	var req ReconcileRunRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := reconcile.OptionsFromConfig(h.job.Config())
+	if req.Mode != "" {
+		opts.Mode = req.Mode
+	}
+	if req.AdoptInto != "" {
+		opts.AdoptInto = req.AdoptInto
+	}
+	opts.Buckets = req.Buckets
+	if req.MinAge != "" {
+		d, err := time.ParseDuration(req.MinAge)
+		if err != nil || d < 0 {
+			http.Error(w, `{"error": "invalid min_age"}`, http.StatusBadRequest)
+			return
+		}
+		opts.MinAge = d
+	}
+	if req.PageInterval != "" {
+		d, err := time.ParseDuration(req.PageInterval)
+		if err != nil || d < 0 {
+			http.Error(w, `{"error": "invalid page_interval"}`, http.StatusBadRequest)
+			return
+		}
+		opts.PageInterval = d
+	}
+
+	if err := h.job.Validate(opts); err != nil {
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+	if running, _, _ := h.job.Status(); running {
+		http.Error(w, `{"error": "reconcile already running"}`, http.StatusConflict)
+		return
+	}
+
+	recordAudit(h.storage, r, AuditActionReconcileRun, "reconcile", nil, req, nil)
+
+	go func() {
+		if _, err := h.job.Run(h.ctx, opts); err != nil && !errors.Is(err, reconcile.ErrAlreadyRunning) {
+			logger.Error("Reconcile run failed", "error", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+}
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"context"
 	"sync/atomic"
 
+	"github.com/DullJZ/s3-balance/internal/accesslog"
 	"github.com/DullJZ/s3-balance/internal/balancer"
 	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/cache"
 	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/DullJZ/s3-balance/internal/metrics"
 	"github.com/DullJZ/s3-balance/internal/middleware"
 	"github.com/DullJZ/s3-balance/internal/storage"
@@ -13,13 +17,17 @@ import (
 	"github.com/gorilla/mux"
 )
 
+var logger = logging.Logger(logging.SubsystemAPI)
+
 // S3Handler S3兼容的API处理器
 type S3Handler struct {
 	bucketManager *bucket.Manager
 	balancer      *balancer.Balancer
 	presigner     *presigner.Presigner
-	storage       *storage.Service
+	storage       storage.MetadataStore
 	metrics       *metrics.Metrics
+	objectCache   *cache.DiskCache
+	accessLogs    *accesslog.Writer
 	settings      atomic.Value
 }
 
@@ -30,6 +38,9 @@ type handlerSettings struct {
 	authRequired  bool
 	virtualHost   bool
 	signatureHost string
+	spoolDir      string
+	maxSpoolSize  int64
+	autoMultipart config.AutoMultipartConfig
 }
 
 // NewS3Handler 创建新的S3兼容API处理器
@@ -37,7 +48,7 @@ func NewS3Handler(
 	bucketManager *bucket.Manager,
 	balancer *balancer.Balancer,
 	presigner *presigner.Presigner,
-	storage *storage.Service,
+	storage storage.MetadataStore,
 	accessKey string,
 	secretKey string,
 	metrics *metrics.Metrics,
@@ -45,7 +56,9 @@ func NewS3Handler(
 	authRequired bool,
 	virtualHost bool,
 	signatureHost string,
-
+	spoolDir string,
+	maxSpoolSize int64,
+	autoMultipart config.AutoMultipartConfig,
 ) *S3Handler {
 	handler := &S3Handler{
 		bucketManager: bucketManager,
@@ -54,11 +67,17 @@ func NewS3Handler(
 		storage:       storage,
 		metrics:       metrics,
 	}
-	handler.initSettings(accessKey, secretKey, proxyMode, authRequired, virtualHost, signatureHost)
+	handler.initSettings(accessKey, secretKey, proxyMode, authRequired, virtualHost, signatureHost, spoolDir, maxSpoolSize, autoMultipart)
 	return handler
 }
 
-func (h *S3Handler) initSettings(accessKey, secretKey string, proxyMode, authRequired, virtualHost bool, signatureHost string) {
+// store 返回挂在请求追踪上下文下的元数据存储
+// 请求被取消（客户端断开）时仍需完成提交或标记失败，元数据调用只沿用追踪信息，不继承取消
+func (h *S3Handler) store(ctx context.Context) storage.MetadataStore {
+	return h.storage.WithContext(context.WithoutCancel(ctx))
+}
+
+func (h *S3Handler) initSettings(accessKey, secretKey string, proxyMode, authRequired, virtualHost bool, signatureHost, spoolDir string, maxSpoolSize int64, autoMultipart config.AutoMultipartConfig) {
 	h.settings.Store(handlerSettings{
 		accessKey:     accessKey,
 		secretKey:     secretKey,
@@ -66,6 +85,9 @@ func (h *S3Handler) initSettings(accessKey, secretKey string, proxyMode, authReq
 		authRequired:  authRequired,
 		virtualHost:   virtualHost,
 		signatureHost: signatureHost,
+		spoolDir:      spoolDir,
+		maxSpoolSize:  maxSpoolSize,
+		autoMultipart: autoMultipart,
 	})
 }
 
@@ -149,5 +171,8 @@ func (h *S3Handler) UpdateS3APIConfig(cfg *config.S3APIConfig) {
 		authRequired:  cfg.AuthRequired,
 		virtualHost:   cfg.VirtualHost,
 		signatureHost: cfg.Host,
+		spoolDir:      cfg.SpoolDir,
+		maxSpoolSize:  cfg.MaxSpoolSizeBytes,
+		autoMultipart: cfg.AutoMultipart,
 	})
 }
@@ -2,22 +2,22 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/middleware"
 	"github.com/DullJZ/s3-balance/internal/storage"
 	"github.com/gorilla/mux"
 )
 
 // StatsHandler 统计数据处理器
 type StatsHandler struct {
-	storage *storage.Service
+	storage storage.MetadataStore
 }
 
 // NewStatsHandler 创建统计处理器
-func NewStatsHandler(storage *storage.Service) *StatsHandler {
+func NewStatsHandler(storage storage.MetadataStore) *StatsHandler {
 	return &StatsHandler{
 		storage: storage,
 	}
@@ -26,10 +26,10 @@ func NewStatsHandler(storage *storage.Service) *StatsHandler {
 // RegisterRoutes 注册统计API路由
 func (h *StatsHandler) RegisterRoutes(router *mux.Router) {
 	// 注意: router 参数应该是已经带有 /api 前缀的子路由器
-	router.HandleFunc("/stats/monthly", h.GetCurrentMonthStats).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/stats/monthly/{year}/{month}", h.GetMonthlyStats).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/stats/monthly/range", h.GetMonthlyStatsRange).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/stats/bucket/{bucket}/history", h.GetBucketHistory).Methods(http.MethodGet, http.MethodOptions)
+	handleWithRole(router, "/stats/monthly", middleware.RoleViewer, h.GetCurrentMonthStats, http.MethodGet)
+	handleWithRole(router, "/stats/monthly/{year}/{month}", middleware.RoleViewer, h.GetMonthlyStats, http.MethodGet)
+	handleWithRole(router, "/stats/monthly/range", middleware.RoleViewer, h.GetMonthlyStatsRange, http.MethodGet)
+	handleWithRole(router, "/stats/bucket/{bucket}/history", middleware.RoleViewer, h.GetBucketHistory, http.MethodGet)
 }
 
 // MonthlyStatsResponse 月度统计响应
@@ -51,7 +51,7 @@ type BucketOperationCounts struct {
 func (h *StatsHandler) GetCurrentMonthStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := h.storage.GetCurrentMonthStats()
 	if err != nil {
-		log.Printf("Failed to get current month stats: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to get current month stats", "error", err)
 		http.Error(w, "Failed to fetch statistics", http.StatusInternalServerError)
 		return
 	}
@@ -78,7 +78,7 @@ func (h *StatsHandler) GetMonthlyStats(w http.ResponseWriter, r *http.Request) {
 
 	stats, err := h.storage.GetMonthlyStats(year, month)
 	if err != nil {
-		log.Printf("Failed to get monthly stats: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to get monthly stats", "error", err)
 		http.Error(w, "Failed to fetch statistics", http.StatusInternalServerError)
 		return
 	}
@@ -118,7 +118,7 @@ func (h *StatsHandler) GetMonthlyStatsRange(w http.ResponseWriter, r *http.Reque
 
 	stats, err := h.storage.GetMonthlyStatsRange(startYear, startMonth, endYear, endMonth)
 	if err != nil {
-		log.Printf("Failed to get monthly stats range: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to get monthly stats range", "error", err)
 		http.Error(w, "Failed to fetch statistics", http.StatusInternalServerError)
 		return
 	}
@@ -143,7 +143,7 @@ func (h *StatsHandler) GetBucketHistory(w http.ResponseWriter, r *http.Request)
 
 	stats, err := h.storage.GetBucketMonthlyHistory(bucket, months)
 	if err != nil {
-		log.Printf("Failed to get bucket history: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to get bucket history", "error", err)
 		http.Error(w, "Failed to fetch statistics", http.StatusInternalServerError)
 		return
 	}
@@ -179,7 +179,7 @@ func (h *StatsHandler) ArchiveCurrentMonth(w http.ResponseWriter, r *http.Reques
 	year, month := now.Year(), int(now.Month())
 
 	if err := h.storage.ArchiveMonthlyStats(year, month); err != nil {
-		log.Printf("Failed to archive monthly stats: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to archive monthly stats", "year", year, "month", month, "error", err)
 		http.Error(w, "Failed to archive statistics", http.StatusInternalServerError)
 		return
 	}
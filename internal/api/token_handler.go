@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/middleware"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// TokenHandler 管理API令牌处理器
+type TokenHandler struct {
+	storage *storage.Service
+}
+
+// NewTokenHandler 创建令牌处理器
+func NewTokenHandler(storage *storage.Service) *TokenHandler {
+	return &TokenHandler{
+		storage: storage,
+	}
+}
+
+// CreateTokenRequest 创建令牌请求
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateTokenResponse 创建令牌响应（明文令牌只返回这一次）
+type CreateTokenResponse struct {
+	Token string            `json:"token"`
+	Info  *storage.APIToken `json:"info"`
+}
+
+// RegisterRoutes 注册令牌管理路由
+// 注意: router 参数应该是已经带有 /api 前缀的子路由器
+func (h *TokenHandler) RegisterRoutes(router *mux.Router) {
+	handleWithRole(router, "/tokens", middleware.RoleAdmin, h.ListTokens, http.MethodGet)
+	handleWithRole(router, "/tokens", middleware.RoleAdmin, h.CreateToken, http.MethodPost)
+	handleWithRole(router, "/tokens/{id:[0-9]+}", middleware.RoleAdmin, h.RevokeToken, http.MethodDelete)
+}
+
+// Lookup 实现 middleware.TokenLookup，将数据库中的命名令牌转换为调用方
+func (h *TokenHandler) Lookup(token string) (*middleware.Principal, error) {
+	apiToken, err := h.storage.AuthenticateAPIToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if apiToken == nil {
+		return nil, nil
+	}
+
+	role, err := middleware.ParseRole(apiToken.Role)
+	if err != nil {
+		logger.Warn("API token has invalid role, rejecting", "token_id", apiToken.ID, "role", apiToken.Role)
+		return nil, nil
+	}
+
+	return &middleware.Principal{
+		Name:    apiToken.Name,
+		Role:    role,
+		TokenID: apiToken.ID,
+	}, nil
+}
+
+// ListTokens 列出所有令牌
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.storage.ListAPITokens()
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to list API tokens", "error", err)
+		http.Error(w, `{"error": "failed to list tokens"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":  len(tokens),
+		"tokens": tokens,
+	})
+}
+
+// CreateToken 创建命名令牌
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid JSON format: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, `{"error": "name is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	role, err := middleware.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		http.Error(w, `{"error": "expires_at must be in the future"}`, http.StatusBadRequest)
+		return
+	}
+
+	plaintext, token, err := h.storage.CreateAPIToken(req.Name, string(role), req.ExpiresAt)
+	if err != nil {
+		recordAudit(h.storage, r, AuditActionTokenCreate, "token/"+req.Name, nil, req, err)
+		logger.ErrorContext(r.Context(), "Failed to create API token", "name", req.Name, "error", err)
+		http.Error(w, `{"error": "failed to create token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.storage, r, AuditActionTokenCreate, "token/"+strconv.FormatUint(uint64(token.ID), 10), nil, token, nil)
+	logger.InfoContext(r.Context(), "API token created", "token_id", token.ID, "name", token.Name, "role", token.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateTokenResponse{
+		Token: plaintext,
+		Info:  token,
+	})
+}
+
+// RevokeToken 吊销令牌
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "invalid token id"}`, http.StatusBadRequest)
+		return
+	}
+
+	resource := "token/" + strconv.FormatUint(id, 10)
+	before, _ := h.storage.GetAPIToken(uint(id))
+	if err := h.storage.RevokeAPIToken(uint(id)); err != nil {
+		recordAudit(h.storage, r, AuditActionTokenRevoke, resource, nil, nil, err)
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+		return
+	}
+
+	after, _ := h.storage.GetAPIToken(uint(id))
+	recordAudit(h.storage, r, AuditActionTokenRevoke, resource, before, after, nil)
+	logger.InfoContext(r.Context(), "API token revoked", "token_id", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
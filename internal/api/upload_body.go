@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/DullJZ/s3-balance/internal/middleware"
+)
+
+// uploadBody 上传请求体：解码 aws-chunked 编码，长度未知时暂存到本地文件
+type uploadBody struct {
+	Body          io.Reader
+	ContentLength int64
+
+	chunked *middleware.ChunkedReader
+	spool   *os.File
+}
+
+// openUploadBody 准备上传请求体，失败时返回 S3 错误码与错误信息
+// 需要在选择存储桶之前调用，以便负载均衡器按真实大小选择
+func (h *S3Handler) openUploadBody(r *http.Request) (*uploadBody, string, string) {
+	body := &uploadBody{Body: r.Body, ContentLength: r.ContentLength}
+
+	if middleware.IsStreamingPayload(r) {
+		chunked, err := middleware.NewChunkedReader(r)
+		if err != nil {
+			code, message := streamingError(err)
+			return nil, code, message
+		}
+		body.chunked = chunked
+		body.Body = chunked
+		body.ContentLength = middleware.DecodedContentLength(r)
+	}
+
+	if body.ContentLength >= 0 {
+		return body, "", ""
+	}
+
+	// 长度未知（HTTP chunked 或未声明解码长度），暂存后以确定长度上传
+	settings := h.loadSettings()
+	spool, err := os.CreateTemp(settings.spoolDir, "s3-balance-upload-*")
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to create spool file", "dir", settings.spoolDir, "error", err)
+		return nil, "InternalError", "Failed to buffer request body"
+	}
+	body.spool = spool
+
+	maxSize := settings.maxSpoolSize
+	n, err := io.Copy(spool, io.LimitReader(body.Body, maxSize+1))
+	if err != nil {
+		body.Close()
+		if body.chunked != nil && body.chunked.Err() != nil {
+			code, message := streamingError(body.chunked.Err())
+			return nil, code, message
+		}
+		return nil, "IncompleteBody", "Failed to read request body"
+	}
+	if n > maxSize {
+		body.Close()
+		return nil, "EntityTooLarge", fmt.Sprintf("Request body of unknown length exceeds the maximum of %d bytes", maxSize)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		body.Close()
+		logger.ErrorContext(r.Context(), "Failed to rewind spool file", "file", spool.Name(), "error", err)
+		return nil, "InternalError", "Failed to buffer request body"
+	}
+
+	body.Body = spool
+	body.ContentLength = n
+	return body, "", ""
+}
+
+// Close 删除暂存文件
+func (b *uploadBody) Close() {
+	if b.spool == nil {
+		return
+	}
+	b.spool.Close()
+	if err := os.Remove(b.spool.Name()); err != nil {
+		logger.Warn("Failed to remove spool file", "file", b.spool.Name(), "error", err)
+	}
+	b.spool = nil
+}
+
+// decodeError 返回直接流式上传时请求体解码或校验失败的原因
+func (b *uploadBody) decodeError() error {
+	if b.chunked == nil || b.spool != nil {
+		return nil
+	}
+	return b.chunked.Err()
+}
+
+// streamingError 取 aws-chunked 解码错误对应的 S3 错误码与错误信息
+func streamingError(err error) (string, string) {
+	var streamingErr *middleware.StreamingError
+	if errors.As(err, &streamingErr) {
+		return streamingErr.Code, streamingErr.Message
+	}
+	return "IncompleteBody", err.Error()
+}
@@ -7,7 +7,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/middleware"
 	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/DullJZ/s3-balance/internal/tracing"
+	"github.com/DullJZ/s3-balance/pkg/datapath"
+	"github.com/gorilla/mux"
 )
 
 // sendXMLResponse 发送XML响应
@@ -29,16 +33,52 @@ func (h *S3Handler) sendXMLResponse(w http.ResponseWriter, statusCode int, data
 
 // sendS3Error 发送S3错误响应
 func (h *S3Handler) sendS3Error(w http.ResponseWriter, code string, message string, resource string) {
+	h.sendS3ErrorWithStatus(w, s3ErrorStatus(code), code, message, resource)
+}
+
+// sendS3ErrorWithStatus 以指定状态码发送S3错误响应
+func (h *S3Handler) sendS3ErrorWithStatus(w http.ResponseWriter, statusCode int, code string, message string, resource string) {
+	// 请求 ID 由追踪中间件写入响应头，错误响应体中使用同一个值
+	requestID := w.Header().Get(tracing.RequestIDHeader)
+	if requestID == "" {
+		requestID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
 	errorResp := ErrorResponse{
 		Code:      code,
 		Message:   message,
 		Resource:  resource,
-		RequestID: fmt.Sprintf("%d", time.Now().UnixNano()),
+		RequestID: requestID,
 	}
 
 	w.Header().Set("X-Amz-Error-Code", code)
 	w.Header().Set("X-Amz-Error-Message", message)
 
+	h.sendXMLResponse(w, statusCode, errorResp)
+}
+
+// sendBackendError 把后端数据请求的错误以对应的S3错误码返回给客户端
+// 说明代理自身配置有误的错误（真实存储桶不存在、凭据无效等）对客户端没有意义，统一返回 InternalError
+func (h *S3Handler) sendBackendError(w http.ResponseWriter, err error, fallbackMessage string, resource string) {
+	backendErr, ok := datapath.AsError(err)
+	if !ok {
+		h.sendS3Error(w, "InternalError", fallbackMessage, resource)
+		return
+	}
+	switch backendErr.Code {
+	case "NoSuchBucket", "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch",
+		"RequestTimeTooSkewed", "InvalidBucketName", "PermanentRedirect", "AuthorizationHeaderMalformed":
+		h.sendS3Error(w, "InternalError", fallbackMessage, resource)
+		return
+	}
+	message := backendErr.Message
+	if message == "" {
+		message = fallbackMessage
+	}
+	h.sendS3ErrorWithStatus(w, backendErr.StatusCode, backendErr.Code, message, resource)
+}
+
+// s3ErrorStatus 返回代理自身产生的S3错误码对应的状态码
+func s3ErrorStatus(code string) int {
 	statusCode := http.StatusBadRequest
 	switch code {
 	case "NoSuchBucket", "NoSuchKey":
@@ -51,19 +91,34 @@ func (h *S3Handler) sendS3Error(w http.ResponseWriter, code string, message stri
 		statusCode = http.StatusInternalServerError
 	case "InsufficientStorage":
 		statusCode = http.StatusInsufficientStorage
+	case "NotImplemented":
+		statusCode = http.StatusNotImplemented
 	}
-
-	h.sendXMLResponse(w, statusCode, errorResp)
+	return statusCode
 }
 
 // setObjectHeaders 设置对象响应头
 func (h *S3Handler) setObjectHeaders(w http.ResponseWriter, obj *storage.Object) {
 	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
 	w.Header().Set("Last-Modified", obj.UpdatedAt.Format(http.TimeFormat))
-	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", obj.ID))
+	w.Header().Set("ETag", objectETag(obj))
 	if obj.ContentType != "" {
 		w.Header().Set("Content-Type", obj.ContentType)
 	} else {
 		w.Header().Set("Content-Type", "application/octet-stream")
 	}
 }
+
+// objectETag 返回对象记录中后端的 ETag，旧记录没有时使用对象ID生成
+func objectETag(obj *storage.Object) string {
+	if obj.ETag != "" {
+		return obj.ETag
+	}
+	return fmt.Sprintf("\"%x\"", obj.ID)
+}
+
+// handleWithRole 注册管理API路由并声明所需角色，同时支持 OPTIONS 方法用于 CORS 预检
+func handleWithRole(router *mux.Router, path string, role middleware.Role, handler http.HandlerFunc, methods ...string) *mux.Route {
+	methods = append(methods, http.MethodOptions)
+	return router.Handle(path, middleware.RequireRole(role)(handler)).Methods(methods...)
+}
@@ -0,0 +1,212 @@
+// Package audit 提供审计记录所需的前后差异计算与敏感字段脱敏
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RedactedValue 脱敏后的占位值
+const RedactedValue = "******"
+
+// sensitiveKeys 需要脱敏的字段名（按 JSON 字段名匹配，不区分大小写）
+var sensitiveKeys = map[string]bool{
+	"secret_access_key": true,
+	"secretaccesskey":   true,
+	"secret_key":        true,
+	"secretkey":         true,
+	"token":             true,
+	"token_hash":        true,
+	"password":          true,
+	"dsn":               true,
+	"headers":           true,
+}
+
+// Change 单个字段的变更
+type Change struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// IsSensitive 判断字段名是否需要脱敏
+func IsSensitive(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// Diff 比较两个值的 JSON 表示，返回按路径排序的变更列表
+// 任一侧可以为 nil（表示创建或删除），敏感字段只记录“已变更”而不记录取值
+func Diff(before, after interface{}) ([]Change, error) {
+	beforeFlat, err := flatten(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to flatten before value: %w", err)
+	}
+	afterFlat, err := flatten(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to flatten after value: %w", err)
+	}
+
+	paths := make(map[string]struct{}, len(beforeFlat)+len(afterFlat))
+	for p := range beforeFlat {
+		paths[p] = struct{}{}
+	}
+	for p := range afterFlat {
+		paths[p] = struct{}{}
+	}
+
+	changes := make([]Change, 0)
+	for p := range paths {
+		b, hasBefore := beforeFlat[p]
+		a, hasAfter := afterFlat[p]
+		if hasBefore && hasAfter && reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		change := Change{Path: p}
+		if hasBefore {
+			change.Before = b
+		}
+		if hasAfter {
+			change.After = a
+		}
+		if IsSensitive(lastSegment(p)) {
+			if hasBefore {
+				change.Before = RedactedValue
+			}
+			if hasAfter {
+				change.After = RedactedValue
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+// Redact 返回值的 JSON 结构副本，其中敏感字段被替换为占位值
+func Redact(v interface{}) (interface{}, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return redactValue(generic), nil
+}
+
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if IsSensitive(k) {
+				if s, ok := child.(string); ok && s == "" {
+					continue
+				}
+				val[k] = RedactedValue
+				continue
+			}
+			val[k] = redactValue(child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// flatten 将值展开为 路径 -> 标量 的映射
+// 数组中带名称字段的元素使用 name 作为路径段，避免顺序变化产生大量噪音
+func flatten(v interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if v == nil {
+		return result, nil
+	}
+
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	if generic == nil {
+		return result, nil
+	}
+
+	flattenInto(result, "", generic)
+	return result, nil
+}
+
+func flattenInto(result map[string]interface{}, prefix string, v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 && prefix != "" {
+			result[prefix] = val
+			return
+		}
+		for k, child := range val {
+			flattenInto(result, joinPath(prefix, k), child)
+		}
+	case []interface{}:
+		if len(val) == 0 && prefix != "" {
+			result[prefix] = val
+			return
+		}
+		for i, child := range val {
+			segment := fmt.Sprintf("[%d]", i)
+			if m, ok := child.(map[string]interface{}); ok {
+				if name := elementName(m); name != "" {
+					segment = "[" + name + "]"
+				}
+			}
+			flattenInto(result, prefix+segment, child)
+		}
+	default:
+		if prefix == "" {
+			prefix = "."
+		}
+		result[prefix] = val
+	}
+}
+
+// elementName 返回数组元素的名称字段（兼容 name 与未加 json 标签的 Name）
+func elementName(m map[string]interface{}) string {
+	for _, key := range []string{"name", "Name"} {
+		if name, ok := m[key].(string); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func lastSegment(path string) string {
+	if idx := strings.LastIndex(path, "."); idx >= 0 {
+		return path[idx+1:]
+	}
+	return path
+}
@@ -1,14 +1,21 @@
 package balancer
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/DullJZ/s3-balance/internal/bucket"
 	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/DullJZ/s3-balance/internal/metrics"
+	"github.com/DullJZ/s3-balance/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var logger = logging.Logger(logging.SubsystemBalancer)
+
 // Balancer 负载均衡器
 // 负责根据配置的策略选择合适的存储桶
 type Balancer struct {
@@ -43,8 +50,9 @@ func NewBalancer(manager *bucket.Manager, cfg *config.BalancerConfig) (*Balancer
 }
 
 // SelectBucket 选择一个存储桶
-// 首先过滤出有足够空间的存储桶，然后使用策略选择
-func (b *Balancer) SelectBucket(key string, size int64) (*bucket.BucketInfo, error) {
+// 首先过滤出有足够空间的存储桶，然后使用策略选择；没有可选的存储桶时按 retry_attempts 间隔 retry_delay 重试
+// 每次重试等待记录为 span 事件，ctx 取消时停止等待
+func (b *Balancer) SelectBucket(ctx context.Context, key string, size int64) (selected *bucket.BucketInfo, err error) {
 	attempts := 1
 	delay := time.Second
 
@@ -57,19 +65,45 @@ func (b *Balancer) SelectBucket(key string, size int64) (*bucket.BucketInfo, err
 		}
 	}
 
-	var lastErr error
-	for i := 0; i < attempts; i++ {
-		selected, err := b.selectOnce(key, size)
+	ctx, span := tracing.Start(ctx, "balancer.SelectBucket",
+		attribute.String("balancer.strategy", b.strategy.Name()),
+		attribute.Int64("object.size", size),
+	)
+	attempt := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("balancer.attempts", attempt))
+		if selected != nil {
+			span.SetAttributes(attribute.String("bucket.name", selected.Config.Name))
+		}
+		tracing.End(span, err)
+	}()
+
+	for attempt = 1; attempt <= attempts; attempt++ {
+		selected, err = b.selectOnce(key, size)
 		if err == nil {
+			logger.DebugContext(ctx, "Bucket selected", "strategy", b.strategy.Name(), "bucket", selected.Config.Name,
+				"key", key, "size", size, "attempt", attempt)
 			return selected, nil
 		}
-		lastErr = err
-		if i < attempts-1 {
-			time.Sleep(delay)
+		if attempt == attempts {
+			break
+		}
+		logger.WarnContext(ctx, "Bucket selection failed, retrying", "strategy", b.strategy.Name(), "key", key,
+			"size", size, "attempt", attempt, "delay", delay.String(), "error", err)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.String("error", err.Error()),
+			attribute.Int64("delay_ms", delay.Milliseconds()),
+		))
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
 		}
 	}
 
-	return nil, lastErr
+	logger.ErrorContext(ctx, "Bucket selection failed", "strategy", b.strategy.Name(), "key", key,
+		"size", size, "attempts", attempt, "error", err)
+	return nil, err
 }
 
 func (b *Balancer) selectOnce(key string, size int64) (*bucket.BucketInfo, error) {
@@ -97,6 +131,11 @@ func (b *Balancer) selectOnce(key string, size int64) (*bucket.BucketInfo, error
 		return nil, err
 	}
 
+	// 半开状态的存储桶被选中时占用一个试探名额
+	if selected != nil {
+		selected.AcquireTrial()
+	}
+
 	// 记录指标
 	if b.metrics != nil && selected != nil {
 		b.metrics.RecordBalancerDecision(b.strategy.Name(), selected.Config.Name)
@@ -0,0 +1,249 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	// BreakerClosed 正常放行
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen 半开，只放行有限的试探请求
+	BreakerHalfOpen
+	// BreakerOpen 熔断，不参与负载均衡
+	BreakerOpen
+)
+
+// String 返回状态名称
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerStateFunc 熔断器状态变化回调
+type BreakerStateFunc func(from, to BreakerState)
+
+// CircuitBreaker 基于真实请求结果的后端熔断器
+// 连续失败达到阈值后熔断；熔断超时后进入半开状态放行试探请求，试探连续成功后恢复，失败则重新熔断
+type CircuitBreaker struct {
+	mu             sync.Mutex
+	cfg            config.CircuitBreakerConfig
+	state          BreakerState
+	failures       int
+	successes      int
+	openedAt       time.Time
+	trialsInFlight int
+	lastTrialAt    time.Time
+	onStateChange  BreakerStateFunc
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker(cfg config.CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		cfg:   cfg,
+		state: BreakerClosed,
+	}
+}
+
+// SetConfig 热更新熔断器配置；禁用时立即恢复为关闭状态
+func (cb *CircuitBreaker) SetConfig(cfg config.CircuitBreakerConfig) {
+	cb.mu.Lock()
+	cb.cfg = cfg
+	var transition func()
+	if !cfg.IsEnabled() && cb.state != BreakerClosed {
+		transition = cb.setStateLocked(BreakerClosed)
+	}
+	cb.mu.Unlock()
+
+	if transition != nil {
+		transition()
+	}
+}
+
+// OnStateChange 设置状态变化回调（在锁外调用）
+func (cb *CircuitBreaker) OnStateChange(fn BreakerStateFunc) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onStateChange = fn
+}
+
+// State 返回当前状态（熔断超时后会报告为半开）
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	transition := cb.advanceLocked(time.Now())
+	state := cb.state
+	cb.mu.Unlock()
+
+	if transition != nil {
+		transition()
+	}
+	return state
+}
+
+// Ready 判断存储桶是否可以参与负载均衡（不占用试探名额）
+func (cb *CircuitBreaker) Ready() bool {
+	cb.mu.Lock()
+	now := time.Now()
+	transition := cb.advanceLocked(now)
+	ready := true
+	switch cb.state {
+	case BreakerOpen:
+		ready = false
+	case BreakerHalfOpen:
+		ready = cb.trialsInFlight < cb.cfg.HalfOpenMaxRequests
+	}
+	cb.mu.Unlock()
+
+	if transition != nil {
+		transition()
+	}
+	return ready
+}
+
+// AcquireTrial 存储桶被选中时调用，半开状态下占用一个试探名额
+func (cb *CircuitBreaker) AcquireTrial() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == BreakerHalfOpen {
+		cb.trialsInFlight++
+		cb.lastTrialAt = time.Now()
+	}
+}
+
+// RecordSuccess 记录一次成功的后端请求
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	var transition func()
+	switch cb.state {
+	case BreakerClosed:
+		cb.failures = 0
+	case BreakerHalfOpen:
+		cb.releaseTrialLocked()
+		cb.successes++
+		if cb.successes >= cb.cfg.SuccessThreshold {
+			transition = cb.setStateLocked(BreakerClosed)
+		}
+	}
+	cb.mu.Unlock()
+
+	if transition != nil {
+		transition()
+	}
+}
+
+// RecordFailure 记录一次失败的后端请求
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	var transition func()
+	if cb.cfg.IsEnabled() {
+		switch cb.state {
+		case BreakerClosed:
+			cb.failures++
+			if cb.failures >= cb.cfg.FailureThreshold {
+				transition = cb.setStateLocked(BreakerOpen)
+			}
+		case BreakerHalfOpen:
+			cb.releaseTrialLocked()
+			transition = cb.setStateLocked(BreakerOpen)
+		}
+	}
+	cb.mu.Unlock()
+
+	if transition != nil {
+		transition()
+	}
+}
+
+// advanceLocked 处理基于时间的状态推进，调用方需持有锁
+func (cb *CircuitBreaker) advanceLocked(now time.Time) func() {
+	switch cb.state {
+	case BreakerOpen:
+		if now.Sub(cb.openedAt) >= cb.cfg.OpenTimeout {
+			return cb.setStateLocked(BreakerHalfOpen)
+		}
+	case BreakerHalfOpen:
+		// 试探请求长时间没有结果（例如客户端中途断开），释放名额避免一直卡在半开
+		if cb.trialsInFlight > 0 && now.Sub(cb.lastTrialAt) >= cb.cfg.OpenTimeout {
+			cb.trialsInFlight = 0
+		}
+	}
+	return nil
+}
+
+func (cb *CircuitBreaker) releaseTrialLocked() {
+	if cb.trialsInFlight > 0 {
+		cb.trialsInFlight--
+	}
+}
+
+// setStateLocked 切换状态并返回需要在锁外执行的回调
+func (cb *CircuitBreaker) setStateLocked(to BreakerState) func() {
+	from := cb.state
+	if from == to {
+		return nil
+	}
+
+	cb.state = to
+	cb.failures = 0
+	cb.successes = 0
+	cb.trialsInFlight = 0
+	if to == BreakerOpen {
+		cb.openedAt = time.Now()
+	}
+
+	fn := cb.onStateChange
+	if fn == nil {
+		return nil
+	}
+	return func() { fn(from, to) }
+}
+
+// ErrClientBody 读取客户端请求体失败（连接中断、长度不足、校验不符），与后端是否可用无关
+var ErrClientBody = errors.New("failed to read client request body")
+
+// IsBackendFailure 判断后端请求错误是否说明后端不可用（用于熔断统计）
+// 网络错误、超时和 5xx 视为失败；4xx 说明后端正常响应，不计入失败；调用方取消的请求和客户端请求体错误也不计入
+func IsBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrClientBody) {
+		return false
+	}
+
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		return IsBackendFailureStatus(respErr.HTTPStatusCode())
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorFault() == smithy.FaultServer
+	}
+
+	return true
+}
+
+// IsBackendFailureStatus 判断后端HTTP状态码是否说明后端不可用
+func IsBackendFailureStatus(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError
+}
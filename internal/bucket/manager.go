@@ -2,21 +2,26 @@ package bucket
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/DullJZ/s3-balance/internal/config"
 	"github.com/DullJZ/s3-balance/internal/health"
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/DullJZ/s3-balance/internal/metrics"
 	"github.com/DullJZ/s3-balance/internal/storage"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+var logger = logging.Logger(logging.SubsystemHealth)
+
 // OperationCategory 表示后端操作分类
 type OperationCategory string
 
@@ -31,13 +36,17 @@ const (
 type BucketInfo struct {
 	Config                config.BucketConfig
 	Client                *s3.Client
-	UsedSize              int64     // 已使用容量（字节）
-	Available             bool      // 是否可用（由health监控更新）
-	LastChecked           time.Time // 最后检查时间（由health监控更新）
+	transport             *http.Transport // Client 使用的连接池，代理的数据传输也经由 Client
+	UsedSize              int64           // 已使用容量（字节）
+	Available             bool            // 是否可用（由health监控更新）
+	LastChecked           time.Time       // 最后检查时间（由health监控更新）
+	Degraded              bool            // 可用但健康检查延迟超过SLO（由health监控更新）
+	HealthMessage         string          // 最近一次健康检查的结果说明
 	mu                    sync.RWMutex
 	operationCountA       int64
 	operationCountB       int64
 	operationLimitReached bool
+	breaker               *CircuitBreaker
 }
 
 // Manager 存储桶管理器
@@ -50,17 +59,22 @@ type Manager struct {
 	healthMonitor *health.Monitor
 	statsMonitor  *health.StatsMonitor
 	monitorCtx    context.Context
-	storage       *storage.Service
+	storage       storage.MetadataStore
+	events        *storage.Service
+	opMu          sync.Mutex
+	pendingOps    map[string]storage.OperationCounts // 尚未持久化的操作计数增量，nil 表示不批量写入
 }
 
 // NewManager 创建新的存储桶管理器
-func NewManager(cfg *config.Config, metrics *metrics.Metrics, storageService *storage.Service) (*Manager, error) {
+// store 保存操作计数与用量统计，events 保存健康事件历史（可为 nil）
+func NewManager(cfg *config.Config, metrics *metrics.Metrics, store storage.MetadataStore, events *storage.Service) (*Manager, error) {
 	m := &Manager{
 		buckets:  make(map[string]*BucketInfo),
 		config:   cfg,
 		stopChan: make(chan struct{}),
 		metrics:  metrics,
-		storage:  storageService,
+		storage:  store,
+		events:   events,
 	}
 
 	// 初始化所有存储桶客户端
@@ -69,16 +83,9 @@ func NewManager(cfg *config.Config, metrics *metrics.Metrics, storageService *st
 			continue
 		}
 
-		client, err := createS3Client(bucketCfg)
+		info, err := m.newBucketInfo(bucketCfg, cfg.Balancer.CircuitBreaker)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create S3 client for bucket %s: %w", bucketCfg.Name, err)
-		}
-
-		info := &BucketInfo{
-			Config:      bucketCfg,
-			Client:      client,
-			Available:   true,
-			LastChecked: time.Now(),
+			return nil, err
 		}
 
 		m.buckets[bucketCfg.Name] = info
@@ -100,7 +107,7 @@ func (m *Manager) loadOperationCounts() {
 
 	counts, err := m.storage.GetBucketOperationCounts()
 	if err != nil {
-		log.Printf("Failed to load bucket operation counts: %v", err)
+		logger.Error("Failed to load bucket operation counts", "error", err)
 		return
 	}
 
@@ -122,16 +129,50 @@ func (m *Manager) loadOperationCounts() {
 		}
 
 		if info.SetOperationCount(OperationTypeA, oc.CountA) {
-			log.Printf("Bucket %s disabled after exceeding A-type operation limit (persisted)", name)
+			logger.Warn("Bucket disabled after exceeding operation limit", "bucket", name, "category", OperationTypeA, "source", "persisted")
 		}
 		if info.SetOperationCount(OperationTypeB, oc.CountB) {
-			log.Printf("Bucket %s disabled after exceeding B-type operation limit (persisted)", name)
+			logger.Warn("Bucket disabled after exceeding operation limit", "bucket", name, "category", OperationTypeB, "source", "persisted")
 		}
 	}
 }
 
-// createS3Client 创建S3客户端
-func createS3Client(bucketCfg config.BucketConfig) (*s3.Client, error) {
+// newBucketInfo 为存储桶配置创建客户端和初始运行时状态
+func (m *Manager) newBucketInfo(bucketCfg config.BucketConfig, breakerCfg config.CircuitBreakerConfig) (*BucketInfo, error) {
+	transport, err := newTransport(bucketCfg.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport for bucket %s: %w", bucketCfg.Name, err)
+	}
+	client, err := createS3Client(bucketCfg, &http.Client{Transport: transport})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for bucket %s: %w", bucketCfg.Name, err)
+	}
+
+	name := bucketCfg.Name
+	breaker := NewCircuitBreaker(breakerCfg)
+	breaker.OnStateChange(func(from, to BreakerState) {
+		logger.Warn("Bucket circuit breaker state changed", "bucket", name, "from", from.String(), "to", to.String())
+		if m.metrics != nil {
+			m.metrics.SetCircuitState(name, int(to))
+			m.metrics.RecordCircuitTransition(name, from.String(), to.String())
+		}
+	})
+	if m.metrics != nil && !bucketCfg.Virtual {
+		m.metrics.SetCircuitState(name, int(BreakerClosed))
+	}
+
+	return &BucketInfo{
+		Config:      bucketCfg,
+		Client:      client,
+		transport:   transport,
+		Available:   true,
+		LastChecked: time.Now(),
+		breaker:     breaker,
+	}, nil
+}
+
+// createS3Client 创建使用指定HTTP客户端的S3客户端
+func createS3Client(bucketCfg config.BucketConfig, httpClient *http.Client) (*s3.Client, error) {
 	// 创建自定义端点解析器
 	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
 		if bucketCfg.Endpoint != "" {
@@ -161,9 +202,16 @@ func createS3Client(bucketCfg config.BucketConfig) (*s3.Client, error) {
 		return nil, err
 	}
 
+	// 后端 HTTP 请求记录为追踪 span（未启用追踪时为空实现）
+	tracedClient := *httpClient
+	tracedClient.Transport = otelhttp.NewTransport(httpClient.Transport, otelhttp.WithFilter(hasParentSpan))
+
 	// 创建S3客户端
 	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
 		o.UsePathStyle = bucketCfg.PathStyle
+		// 在这里而不是 LoadDefaultConfig 中替换，AWS_CA_BUNDLE 由 newTransport 处理
+		o.HTTPClient = &tracedClient
+		o.APIOptions = append(o.APIOptions, withTracing(bucketCfg.Name))
 	})
 
 	return client, nil
@@ -175,12 +223,8 @@ func (m *Manager) initHealthMonitoring() {
 	reporter := NewMetricsReporter(m.metrics, m)
 
 	// 创建健康检查配置
-	healthConfig := health.Config{
-		Strategy: health.StrategySimple,
-		Interval: m.config.Balancer.HealthCheckPeriod,
-		Timeout:  5 * time.Second,
-		Retries:  1,
-	}
+	healthConfig := toHealthConfig(m.config.Balancer.HealthCheck)
+	healthConfig.Interval = m.config.Balancer.HealthCheckPeriod
 
 	// 创建S3健康检查器
 	healthChecker := health.NewS3Checker(healthConfig)
@@ -190,10 +234,8 @@ func (m *Manager) initHealthMonitoring() {
 	// 创建健康监控器
 	m.healthMonitor = health.NewMonitor(healthChecker, reporter)
 
-	// 创建统计收集器
-	statsCollector := health.NewS3StatsCollector(30 * time.Second)
-	// 设置操作记录器以统计 Stats 收集的 ListObjects 操作
-	statsCollector.SetOperationRecorder(reporter)
+	// 创建统计收集器：已用容量来自代理自身记录的对象大小，不再列出后端对象
+	statsCollector := &accountingStatsCollector{storage: m.storage}
 
 	// 创建统计监控器
 	m.statsMonitor = health.NewStatsMonitor(
@@ -204,26 +246,54 @@ func (m *Manager) initHealthMonitoring() {
 
 	// 注册所有非虚拟存储桶到监控系统
 	for _, bucket := range m.buckets {
-		if bucket.Config.Virtual {
-			continue
-		}
+		m.registerTarget(bucket)
+	}
+}
 
-		target := &health.S3Target{
-			ID:       bucket.Config.Name,
-			Bucket:   bucket.Config.Name,
-			Endpoint: bucket.Config.Endpoint,
-			Client:   bucket.Client,
-		}
+// registerTarget 将非虚拟存储桶注册到健康与统计监控，调用方需持有写锁
+func (m *Manager) registerTarget(bucket *BucketInfo) {
+	if bucket.Config.Virtual {
+		return
+	}
+
+	target := &health.S3Target{
+		ID:       bucket.Config.Name,
+		Bucket:   bucket.Config.Name,
+		Endpoint: bucket.Config.Endpoint,
+		Client:   bucket.Client,
+	}
+	if bucket.Config.HealthCheck != (config.HealthCheckConfig{}) {
+		checkConfig := toHealthConfig(bucket.Config.HealthCheck)
+		target.Config = &checkConfig
+	}
 
+	if m.healthMonitor != nil {
 		m.healthMonitor.RegisterTarget(target)
+	}
+	if m.statsMonitor != nil {
 		m.statsMonitor.RegisterTarget(target)
 	}
 }
 
-// Start 启动管理器（健康检查和统计更新）
+// unregisterTarget 从健康与统计监控中注销存储桶，调用方需持有写锁
+func (m *Manager) unregisterTarget(name string) {
+	if m.healthMonitor != nil {
+		m.healthMonitor.UnregisterTarget(name)
+	}
+	if m.statsMonitor != nil {
+		m.statsMonitor.UnregisterTarget(name)
+	}
+}
+
+// Start 启动管理器（健康检查、统计更新、对账扫描和操作计数的批量持久化）
 func (m *Manager) Start(ctx context.Context) {
 	m.monitorCtx = ctx
+	m.opMu.Lock()
+	m.pendingOps = make(map[string]storage.OperationCounts)
+	m.opMu.Unlock()
 	m.startMonitors()
+	go m.runUsageScanner(ctx)
+	go m.runOperationFlusher(ctx)
 }
 
 func (m *Manager) startMonitors() {
@@ -256,6 +326,9 @@ func (m *Manager) Stop() {
 	if m.statsMonitor != nil {
 		m.statsMonitor.Stop()
 	}
+
+	// 写入尚未持久化的操作计数
+	m.flushOperations(true)
 }
 
 // GetBucket 获取指定名称的存储桶
@@ -287,14 +360,27 @@ func (m *Manager) GetAvailableBuckets() []*BucketInfo {
 	for _, b := range m.buckets {
 		b.mu.RLock()
 		// 虚拟存储桶不用于负载均衡，排除它们
-		if !b.Config.Virtual && b.Available && (b.Config.MaxSizeBytes == 0 || b.UsedSize < b.Config.MaxSizeBytes) {
+		ok := !b.Config.Virtual && b.Available && (b.Config.MaxSizeBytes == 0 || b.UsedSize < b.Config.MaxSizeBytes)
+		b.mu.RUnlock()
+		// 熔断中的存储桶不参与负载均衡，半开状态只在还有试探名额时参与
+		if ok && b.breaker.Ready() {
 			available = append(available, b)
 		}
-		b.mu.RUnlock()
 	}
 	return available
 }
 
+// RecordBackendOperation 为后台任务（对账、清理等）发起的后端请求计数，超过上限时禁用存储桶
+func (m *Manager) RecordBackendOperation(name string, category OperationCategory) {
+	b, ok := m.GetBucket(name)
+	if !ok {
+		return
+	}
+	if m.CountOperation(b, category) {
+		logger.Warn("Bucket disabled after exceeding operation limit", "bucket", name, "category", category)
+	}
+}
+
 // GetAvailableSpace 获取存储桶的可用空间
 func (b *BucketInfo) GetAvailableSpace() int64 {
 	b.mu.RLock()
@@ -465,109 +551,216 @@ func (m *Manager) GetRealBuckets() []*BucketInfo {
 }
 
 // UpdateConfig 更新配置（支持热更新）
+// 只重建新增或关键字段变化的存储桶，其余存储桶原地更新配置并保留已用容量、健康状态与操作计数
 func (m *Manager) UpdateConfig(newConfig *config.Config) error {
-	log.Println("Updating bucket manager configuration...")
+	logger.Info("Updating bucket manager configuration")
 
 	m.mu.Lock()
 	oldConfig := m.config
-	m.config = newConfig
-
-	// 检查是否需要重新创建存储桶
-	needsRestart := m.checkIfRestartNeeded(oldConfig, newConfig)
-	restartMonitors := false
+	oldBuckets := enabledBuckets(oldConfig)
+	newBuckets := enabledBuckets(newConfig)
+
+	// 先为新增和变化的存储桶创建客户端，任一失败则保持当前状态不变
+	created := make(map[string]*BucketInfo)
+	for name, bucketCfg := range newBuckets {
+		if oldCfg, ok := oldBuckets[name]; ok && !BucketKeyFieldsChanged(oldCfg, bucketCfg) {
+			if _, exists := m.buckets[name]; exists {
+				continue
+			}
+		}
 
-	if needsRestart {
-		log.Println("Bucket configuration changed significantly, recreating buckets...")
+		info, err := m.newBucketInfo(bucketCfg, newConfig.Balancer.CircuitBreaker)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		created[name] = info
+	}
 
-		// 停止现有的监控
+	// 检查间隔变化时需要重建监控器，否则只增减监控目标
+	restartMonitors := monitorConfigChanged(oldConfig, newConfig)
+	var previousStatuses map[string]health.Status
+	if restartMonitors {
+		logger.Info("Monitoring settings changed, restarting monitors")
 		if m.healthMonitor != nil {
-			m.healthMonitor.Stop()
-		}
-		if m.statsMonitor != nil {
-			m.statsMonitor.Stop()
+			previousStatuses = m.healthMonitor.GetAllStatuses()
 		}
+		m.stopMonitors()
+	}
 
-		// 重新创建bucket映射
-		m.buckets = make(map[string]*BucketInfo)
-
-		// 初始化所有存储桶客户端
-		for _, bucketCfg := range newConfig.Buckets {
-			if !bucketCfg.Enabled {
-				continue
-			}
+	// 移除被删除或禁用的存储桶
+	for name := range m.buckets {
+		if _, ok := newBuckets[name]; !ok {
+			m.unregisterTarget(name)
+			m.buckets[name].closeIdleConnections()
+			delete(m.buckets, name)
+			logger.Info("Bucket removed", "bucket", name)
+		}
+	}
 
-			client, err := createS3Client(bucketCfg)
-			if err != nil {
-				// 如果创建失败，恢复旧配置并回滚
-				m.config = oldConfig
-				m.mu.Unlock()
-				return fmt.Errorf("failed to create S3 client for bucket %s: %v", bucketCfg.Name, err)
+	// 新增、替换或原地更新
+	added := make([]string, 0, len(created))
+	for name, bucketCfg := range newBuckets {
+		if info, ok := created[name]; ok {
+			if old, exists := m.buckets[name]; exists {
+				m.unregisterTarget(name)
+				old.closeIdleConnections()
+				logger.Info("Bucket recreated, endpoint, credentials or transport changed", "bucket", name)
+			} else {
+				logger.Info("Bucket added", "bucket", name)
 			}
-
-			info := &BucketInfo{
-				Config:      bucketCfg,
-				Client:      client,
-				Available:   true,
-				LastChecked: time.Now(),
+			m.buckets[name] = info
+			if !restartMonitors {
+				m.registerTarget(info)
+				added = append(added, name)
 			}
+			continue
+		}
 
-			m.buckets[bucketCfg.Name] = info
+		info := m.buckets[name]
+		healthCheckChanged := info.Config.HealthCheck != bucketCfg.HealthCheck
+		info.applyConfig(bucketCfg)
+		// 存储桶级健康检查配置变化时替换监控目标，保留已有健康状态以继续按阈值切换
+		if healthCheckChanged && !restartMonitors {
+			m.registerTarget(info)
+			added = append(added, name)
 		}
+	}
+
+	// 熔断参数变化对所有存储桶生效，保留当前熔断状态
+	for _, info := range m.buckets {
+		info.breaker.SetConfig(newConfig.Balancer.CircuitBreaker)
+	}
 
-		// 重新初始化监控
+	m.config = newConfig
+	if restartMonitors {
 		m.initHealthMonitoring()
-		restartMonitors = true
-	} else {
-		// 只更新监控间隔（需要重启监控来改变间隔）
-		log.Println("Updating monitoring intervals...")
-		if m.healthMonitor != nil {
-			m.healthMonitor.Stop()
-		}
-		if m.statsMonitor != nil {
-			m.statsMonitor.Stop()
+		// 端点或凭据变化而重建的存储桶是新的后端，不沿用旧状态
+		for name := range created {
+			delete(previousStatuses, name)
 		}
-		// 重新初始化监控以应用新的间隔
-		m.initHealthMonitoring()
-		restartMonitors = true
+		m.healthMonitor.RestoreStatuses(previousStatuses)
 	}
-
 	m.mu.Unlock()
 
-	m.loadOperationCounts()
+	if len(created) > 0 {
+		m.loadOperationCounts()
+	}
 
 	if restartMonitors {
 		m.startMonitors()
+	} else {
+		m.checkNow(added)
 	}
 
-	log.Println("Bucket manager configuration updated successfully")
+	logger.Info("Bucket manager configuration updated")
 	return nil
 }
 
-// checkIfRestartNeeded 检查是否需要重启bucket manager
-func (m *Manager) checkIfRestartNeeded(oldConfig, newConfig *config.Config) bool {
-	// 检查bucket数量变化
-	if len(oldConfig.Buckets) != len(newConfig.Buckets) {
-		return true
+// stopMonitors 停止当前的健康与统计监控，调用方需持有写锁
+func (m *Manager) stopMonitors() {
+	if m.healthMonitor != nil {
+		m.healthMonitor.Stop()
+	}
+	if m.statsMonitor != nil {
+		m.statsMonitor.Stop()
+	}
+}
+
+// checkNow 在监控运行时立即检查新注册的存储桶，避免等待下一个周期
+func (m *Manager) checkNow(names []string) {
+	ctx := m.monitorCtx
+	if ctx == nil || len(names) == 0 {
+		return
 	}
 
-	// 检查bucket配置变化
-	for i, oldBucket := range oldConfig.Buckets {
-		if i >= len(newConfig.Buckets) {
-			return true
+	m.mu.RLock()
+	healthMonitor := m.healthMonitor
+	statsMonitor := m.statsMonitor
+	m.mu.RUnlock()
+
+	for _, name := range names {
+		go func(name string) {
+			if healthMonitor != nil {
+				healthMonitor.CheckNow(ctx, name)
+			}
+			if statsMonitor != nil {
+				statsMonitor.CollectNow(ctx, name)
+			}
+		}(name)
+	}
+}
+
+// monitorConfigChanged 判断健康检查周期、全局健康检查配置或统计周期是否变化
+func monitorConfigChanged(oldConfig, newConfig *config.Config) bool {
+	return oldConfig.Balancer.HealthCheckPeriod != newConfig.Balancer.HealthCheckPeriod ||
+		oldConfig.Balancer.HealthCheck != newConfig.Balancer.HealthCheck ||
+		oldConfig.Balancer.UpdateStatsPeriod != newConfig.Balancer.UpdateStatsPeriod
+}
+
+// applyConfig 原地更新存储桶的非关键配置（权重、容量、操作上限等）
+func (b *BucketInfo) applyConfig(cfg config.BucketConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Config = cfg
+
+	// 操作上限被调高或取消后恢复可用，由下一次健康检查确认实际状态
+	if b.operationLimitReached && !b.operationLimitExceeded() {
+		b.operationLimitReached = false
+		b.Available = true
+	}
+}
+
+// operationLimitExceeded 判断当前计数是否超过配置的上限，调用方需持有锁
+func (b *BucketInfo) operationLimitExceeded() bool {
+	limitA := int64(b.Config.OperationLimits.TypeA)
+	limitB := int64(b.Config.OperationLimits.TypeB)
+	return (limitA > 0 && b.operationCountA >= limitA) ||
+		(limitB > 0 && b.operationCountB >= limitB)
+}
+
+// ReportBackendResult 根据一次真实后端请求的结果更新熔断器
+// err 为 nil 表示成功；只有说明后端不可用的错误（网络错误、超时、5xx）才计为失败
+func (b *BucketInfo) ReportBackendResult(err error) {
+	if err != nil {
+		// 调用方取消的请求无法说明后端状态，不计入统计
+		if errors.Is(err, context.Canceled) {
+			return
 		}
-		newBucket := newConfig.Buckets[i]
-
-		// 检查关键配置项
-		if oldBucket.Name != newBucket.Name ||
-			oldBucket.Endpoint != newBucket.Endpoint ||
-			oldBucket.AccessKeyID != newBucket.AccessKeyID ||
-			oldBucket.SecretAccessKey != newBucket.SecretAccessKey ||
-			oldBucket.Region != newBucket.Region ||
-			oldBucket.Enabled != newBucket.Enabled ||
-			oldBucket.Virtual != newBucket.Virtual {
-			return true
+		if IsBackendFailure(err) {
+			b.breaker.RecordFailure()
+			return
 		}
 	}
+	b.breaker.RecordSuccess()
+}
 
-	return false
+// AcquireTrial 存储桶被负载均衡选中时调用，半开状态下占用一个试探名额
+func (b *BucketInfo) AcquireTrial() {
+	b.breaker.AcquireTrial()
+}
+
+// CircuitState 返回存储桶当前的熔断状态
+func (b *BucketInfo) CircuitState() BreakerState {
+	return b.breaker.State()
+}
+
+// toHealthConfig 将配置文件中的健康检查配置转换为 health.Config
+func toHealthConfig(cfg config.HealthCheckConfig) health.Config {
+	return health.Config{
+		Strategy:   health.Strategy(cfg.Strategy),
+		Timeout:    cfg.Timeout,
+		Retries:    cfg.Retries,
+		LatencySLO: cfg.LatencySLO,
+		Rise:       cfg.Rise,
+		Fall:       cfg.Fall,
+	}
+}
+
+// IsDegraded 检查存储桶是否处于降级状态
+func (b *BucketInfo) IsDegraded() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Degraded
 }
@@ -0,0 +1,135 @@
+package bucket
+
+import (
+	"context"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// CountOperation 记录一次后端操作，返回存储桶是否因超过操作上限而被禁用
+// 内存计数立即更新（上限检查不受持久化延迟影响）；管理器运行期间增量由后台协程批量写入元数据存储，
+// 未启动时（命令行工具）每次操作直接写入
+func (m *Manager) CountOperation(b *BucketInfo, category OperationCategory) bool {
+	if b == nil {
+		return false
+	}
+	name := b.Config.Name
+
+	if m.metrics != nil {
+		m.metrics.RecordBackendOperation(name, string(category))
+	}
+	if m.storage == nil {
+		return b.RecordOperation(category)
+	}
+
+	delta := storage.OperationCounts{}
+	switch category {
+	case OperationTypeA:
+		delta.CountA = 1
+	case OperationTypeB:
+		delta.CountB = 1
+	default:
+		return false
+	}
+
+	m.opMu.Lock()
+	if m.pendingOps != nil {
+		// 在同一把锁内更新内存计数与增量，刷新时据此校正内存计数
+		m.pendingOps[name] = addCounts(m.pendingOps[name], delta)
+		disabled := b.RecordOperation(category)
+		m.opMu.Unlock()
+		return disabled
+	}
+	m.opMu.Unlock()
+
+	totals, err := m.storage.AddBucketOperations(map[string]storage.OperationCounts{name: delta})
+	if err != nil {
+		logger.Error("Failed to persist backend operation count", "bucket", name, "error", err)
+		// 数据库更新失败时仍然更新内存计数
+		return b.RecordOperation(category)
+	}
+	total := totals[name]
+	if category == OperationTypeA {
+		return b.SetOperationCount(category, total.CountA)
+	}
+	return b.SetOperationCount(category, total.CountB)
+}
+
+// FlushOperations 把尚未持久化的操作计数写入元数据存储，
+// 并以存储中的累计值（加上写入期间新增的增量）校正内存计数，多个实例共享数据库时计数随之同步
+func (m *Manager) FlushOperations() {
+	m.flushOperations(false)
+}
+
+// flushOperations final 为 true 时停止批量写入，之后的操作直接写入元数据存储
+func (m *Manager) flushOperations(final bool) {
+	if m.storage == nil {
+		return
+	}
+
+	m.opMu.Lock()
+	deltas := m.pendingOps
+	if final {
+		m.pendingOps = nil
+	} else if len(deltas) > 0 {
+		m.pendingOps = make(map[string]storage.OperationCounts)
+	}
+	m.opMu.Unlock()
+	if len(deltas) == 0 {
+		return
+	}
+
+	totals, err := m.storage.AddBucketOperations(deltas)
+
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	if err != nil {
+		logger.Error("Failed to persist backend operation counts", "error", err)
+		// 放回增量，下次刷新时重试
+		if m.pendingOps != nil {
+			for name, delta := range deltas {
+				m.pendingOps[name] = addCounts(m.pendingOps[name], delta)
+			}
+		}
+		return
+	}
+
+	for name, total := range totals {
+		b, ok := m.GetBucket(name)
+		if !ok {
+			continue
+		}
+		pending := m.pendingOps[name]
+		disabledA := b.SetOperationCount(OperationTypeA, total.CountA+pending.CountA)
+		disabledB := b.SetOperationCount(OperationTypeB, total.CountB+pending.CountB)
+		if disabledA || disabledB {
+			logger.Warn("Bucket disabled after exceeding operation limit", "bucket", name)
+		}
+	}
+}
+
+// runOperationFlusher 按 flush_interval 批量持久化操作计数
+func (m *Manager) runOperationFlusher(ctx context.Context) {
+	for {
+		m.mu.RLock()
+		interval := m.config.Database.AsyncWrite.FlushInterval
+		m.mu.RUnlock()
+		if interval <= 0 {
+			interval = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopChan:
+			return
+		case <-time.After(interval):
+			m.FlushOperations()
+		}
+	}
+}
+
+func addCounts(a, b storage.OperationCounts) storage.OperationCounts {
+	return storage.OperationCounts{CountA: a.CountA + b.CountA, CountB: a.CountB + b.CountB}
+}
@@ -0,0 +1,193 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// 监控器名称
+const (
+	MonitorHealth = "health"
+	MonitorStats  = "stats"
+)
+
+// UpdatePlan 描述 UpdateConfig 应用新配置时将要执行的动作（不做任何修改）
+type UpdatePlan struct {
+	Added             []string `json:"added"`              // 新增的存储桶
+	Removed           []string `json:"removed"`            // 被删除或禁用的存储桶
+	Changed           []string `json:"changed"`            // 端点、凭据、连接池等关键字段变化的存储桶
+	Recreated         []string `json:"recreated"`          // 将被重建（丢失运行时状态）的存储桶
+	Updated           []string `json:"updated"`            // 原地更新配置并保留运行时状态的存储桶
+	RestartedMonitors []string `json:"restarted_monitors"` // 因检查周期或全局检查配置变化将被重建的监控器
+	MonitoredBuckets  []string `json:"monitored_buckets"`  // 应用后参与健康检查与统计的存储桶
+}
+
+// ProbeResult 后端探测结果
+type ProbeResult struct {
+	Bucket    string `json:"bucket"`
+	Endpoint  string `json:"endpoint"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// PlanUpdate 计算应用新配置时的影响
+func (m *Manager) PlanUpdate(newConfig *config.Config) *UpdatePlan {
+	m.mu.RLock()
+	oldConfig := m.config
+	m.mu.RUnlock()
+
+	plan := &UpdatePlan{
+		Added:             []string{},
+		Removed:           []string{},
+		Changed:           []string{},
+		Recreated:         []string{},
+		Updated:           []string{},
+		RestartedMonitors: []string{},
+		MonitoredBuckets:  []string{},
+	}
+
+	oldBuckets := enabledBuckets(oldConfig)
+	newBuckets := enabledBuckets(newConfig)
+
+	for name, newBucket := range newBuckets {
+		oldBucket, ok := oldBuckets[name]
+		if !ok {
+			plan.Added = append(plan.Added, name)
+			continue
+		}
+		if BucketKeyFieldsChanged(oldBucket, newBucket) {
+			plan.Changed = append(plan.Changed, name)
+		} else if oldBucket != newBucket {
+			plan.Updated = append(plan.Updated, name)
+		}
+	}
+	for name := range oldBuckets {
+		if _, ok := newBuckets[name]; !ok {
+			plan.Removed = append(plan.Removed, name)
+		}
+	}
+
+	// 关键字段变化的存储桶会重建客户端，健康状态与已用容量重新开始统计
+	plan.Recreated = append(plan.Recreated, plan.Changed...)
+
+	if monitorConfigChanged(oldConfig, newConfig) {
+		plan.RestartedMonitors = append(plan.RestartedMonitors, MonitorHealth, MonitorStats)
+	}
+	for name, b := range newBuckets {
+		if !b.Virtual {
+			plan.MonitoredBuckets = append(plan.MonitoredBuckets, name)
+		}
+	}
+
+	sort.Strings(plan.Added)
+	sort.Strings(plan.Removed)
+	sort.Strings(plan.Changed)
+	sort.Strings(plan.Recreated)
+	sort.Strings(plan.Updated)
+	sort.Strings(plan.MonitoredBuckets)
+
+	return plan
+}
+
+// ProbeBackends 为新配置中新增或关键字段变化的真实存储桶创建客户端并执行 ListObjectsV2 探测
+func (m *Manager) ProbeBackends(ctx context.Context, newConfig *config.Config, timeout time.Duration) []ProbeResult {
+	m.mu.RLock()
+	oldBuckets := enabledBuckets(m.config)
+	m.mu.RUnlock()
+
+	var targets []config.BucketConfig
+	for _, b := range newConfig.Buckets {
+		if !b.Enabled || b.Virtual {
+			continue
+		}
+		if old, ok := oldBuckets[b.Name]; ok && !old.Virtual && !BucketKeyFieldsChanged(old, b) {
+			continue
+		}
+		targets = append(targets, b)
+	}
+
+	results := make([]ProbeResult, len(targets))
+	var wg sync.WaitGroup
+	for i, b := range targets {
+		wg.Add(1)
+		go func(i int, b config.BucketConfig) {
+			defer wg.Done()
+			results[i] = ProbeBucket(ctx, b, timeout)
+		}(i, b)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// ProbeBucket 使用给定配置创建客户端并列出最多一个对象，用于验证端点与凭据
+func ProbeBucket(ctx context.Context, bucketCfg config.BucketConfig, timeout time.Duration) ProbeResult {
+	result := ProbeResult{
+		Bucket:   bucketCfg.Name,
+		Endpoint: bucketCfg.Endpoint,
+	}
+
+	transport, err := newTransport(bucketCfg.Transport)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create transport: %v", err)
+		return result
+	}
+	defer transport.CloseIdleConnections()
+
+	client, err := createS3Client(bucketCfg, &http.Client{Transport: transport})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create S3 client: %v", err)
+		return result
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err = client.ListObjectsV2(probeCtx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucketCfg.Name),
+		MaxKeys: aws.Int32(1),
+	})
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.OK = true
+	return result
+}
+
+// enabledBuckets 返回配置中已启用的存储桶（按名称索引）
+func enabledBuckets(cfg *config.Config) map[string]config.BucketConfig {
+	result := make(map[string]config.BucketConfig)
+	if cfg == nil {
+		return result
+	}
+	for _, b := range cfg.Buckets {
+		if b.Enabled {
+			result[b.Name] = b
+		}
+	}
+	return result
+}
+
+// BucketKeyFieldsChanged 判断影响客户端或存储桶身份的字段是否变化
+func BucketKeyFieldsChanged(oldBucket, newBucket config.BucketConfig) bool {
+	return oldBucket.Endpoint != newBucket.Endpoint ||
+		oldBucket.AccessKeyID != newBucket.AccessKeyID ||
+		oldBucket.SecretAccessKey != newBucket.SecretAccessKey ||
+		oldBucket.Region != newBucket.Region ||
+		oldBucket.PathStyle != newBucket.PathStyle ||
+		oldBucket.Virtual != newBucket.Virtual ||
+		oldBucket.Transport != newBucket.Transport
+}
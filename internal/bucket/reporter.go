@@ -1,10 +1,12 @@
 package bucket
 
 import (
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/DullJZ/s3-balance/internal/health"
 	"github.com/DullJZ/s3-balance/internal/metrics"
+	"github.com/DullJZ/s3-balance/internal/storage"
 )
 
 // MetricsReporter 实现 health.HealthReporter 和 health.StatsReporter 接口
@@ -39,10 +41,51 @@ func (r *MetricsReporter) ReportHealth(targetID string, status health.Status) {
 			bucket.Available = status.Healthy
 		}
 		bucket.LastChecked = status.LastChecked
+		bucket.Degraded = status.Healthy && status.Degraded
+		bucket.HealthMessage = status.Message
+		if status.Error != nil {
+			bucket.HealthMessage = status.Message + ": " + status.Error.Error()
+		}
 		bucket.mu.Unlock()
 
 		// 更新 Prometheus 指标
 		r.metrics.SetBucketHealthy(targetID, bucket.Config.Endpoint, status.Healthy)
+		r.metrics.SetBucketDegraded(targetID, status.Healthy && status.Degraded)
+		for step, latency := range status.Latencies {
+			r.metrics.SetHealthCheckLatency(targetID, step, latency.Seconds())
+		}
+	}
+}
+
+// ReportHealthEvent 实现 health.EventReporter 接口，持久化健康状态变化
+func (r *MetricsReporter) ReportHealthEvent(event health.Event) {
+	level := slog.LevelWarn
+	if event.State == health.StateHealthy {
+		level = slog.LevelInfo
+	}
+	logger.Log(context.Background(), level, "Bucket health changed", "bucket", event.TargetID,
+		"from", event.PreviousState, "to", event.State, "message", event.Message)
+
+	r.manager.mu.RLock()
+	store := r.manager.events
+	r.manager.mu.RUnlock()
+
+	if store == nil {
+		return
+	}
+
+	record := &storage.HealthEvent{
+		BucketName:    event.TargetID,
+		PreviousState: event.PreviousState,
+		State:         event.State,
+		Message:       event.Message,
+		CreatedAt:     event.Time,
+	}
+	if event.Error != nil {
+		record.ErrorMsg = event.Error.Error()
+	}
+	if err := store.RecordHealthEvent(record); err != nil {
+		logger.Error("Failed to record health event", "bucket", event.TargetID, "error", err)
 	}
 }
 
@@ -71,7 +114,6 @@ func (r *MetricsReporter) ReportStats(stats *health.Stats) {
 func (r *MetricsReporter) RecordOperation(targetID string, category health.OperationCategory) {
 	r.manager.mu.RLock()
 	bucket, exists := r.manager.buckets[targetID]
-	storage := r.manager.storage
 	r.manager.mu.RUnlock()
 
 	if !exists {
@@ -89,30 +131,9 @@ func (r *MetricsReporter) RecordOperation(targetID string, category health.Opera
 		return
 	}
 
-	// 更新 Prometheus 指标
-	if r.metrics != nil {
-		r.metrics.RecordBackendOperation(targetID, string(bucketCategory))
-	}
-
-	// 持久化操作计数到数据库并更新内存计数
-	var disabled bool
-	if storage != nil {
-		// 先持久化到数据库
-		newCount, err := storage.IncrementBucketOperation(targetID, string(bucketCategory))
-		if err != nil {
-			log.Printf("Failed to persist health check operation count for bucket %s: %v", targetID, err)
-			// 如果数据库更新失败，仍然更新内存计数
-			disabled = bucket.RecordOperation(bucketCategory)
-		} else {
-			// 使用数据库返回的最新计数更新内存
-			disabled = bucket.SetOperationCount(bucketCategory, newCount)
-		}
-	} else {
-		// 没有 storage service，只更新内存
-		disabled = bucket.RecordOperation(bucketCategory)
-	}
-
+	// 更新指标与内存计数，由管理器批量持久化
+	disabled := r.manager.CountOperation(bucket, bucketCategory)
 	if disabled {
-		log.Printf("Bucket %s disabled after exceeding %s-type operation limit (detected by health check)", targetID, bucketCategory)
+		logger.Warn("Bucket disabled after exceeding operation limit", "bucket", targetID, "category", bucketCategory, "source", "health_check")
 	}
 }
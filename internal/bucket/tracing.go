@@ -0,0 +1,46 @@
+package bucket
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/DullJZ/s3-balance/internal/tracing"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// hasParentSpan 只追踪属于某个请求链路的后端调用；健康检查、垃圾回收等后台任务没有上级 span，不单独产生链路
+func hasParentSpan(r *http.Request) bool {
+	return trace.SpanContextFromContext(r.Context()).IsValid()
+}
+
+// withTracing 为每次 SDK 调用创建一个 span（包含 SDK 内部的全部重试），每次 HTTP 尝试由 otelhttp 传输层记录为子 span
+func withTracing(bucketName string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		// 放在 Initialize 阶段末尾，此时操作名已经写入上下文
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Tracing",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if !trace.SpanContextFromContext(ctx).IsValid() {
+					return next.HandleInitialize(ctx, in)
+				}
+				operation := awsmiddleware.GetOperationName(ctx)
+				ctx, span := tracing.Tracer().Start(ctx, "S3."+operation,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(
+						attribute.String("rpc.system", "aws-api"),
+						attribute.String("rpc.service", "S3"),
+						attribute.String("rpc.method", operation),
+						attribute.String("bucket.name", bucketName),
+					),
+				)
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+					span.SetAttributes(attribute.String("aws.request_id", requestID))
+				}
+				tracing.End(span, err)
+				return out, metadata, err
+			}), middleware.After)
+	}
+}
@@ -0,0 +1,122 @@
+package bucket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+)
+
+// 连接池默认值；Go 默认每个主机只保留2个空闲连接，高并发时大量连接用完即关，会耗尽本地临时端口
+const (
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 10 * time.Second
+	defaultDialKeepAlive       = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// newTransport 按存储桶配置创建HTTP连接池
+func newTransport(cfg config.TransportConfig) (*http.Transport, error) {
+	maxIdle := cfg.MaxIdleConnsPerHost
+	if maxIdle == 0 {
+		maxIdle = defaultMaxIdleConnsPerHost
+	}
+	idleTimeout := cfg.IdleConnTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleConnTimeout
+	}
+	dialTimeout := cfg.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	handshakeTimeout := cfg.TLSHandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = defaultTLSHandshakeTimeout
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: defaultDialKeepAlive,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   handshakeTimeout,
+		MaxIdleConns:          0, // 只按主机限制
+		MaxIdleConnsPerHost:   maxIdle,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       idleTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+	}
+	if !cfg.HTTP2 {
+		// 非 nil 的空映射禁止通过 ALPN 协商 HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport, nil
+}
+
+// newTLSConfig 创建访问后端的TLS配置，启用会话缓存以复用TLS会话
+// 未配置 ca_file 时沿用 SDK 的 AWS_CA_BUNDLE 环境变量
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+	if cfg.MinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+
+	caFile := cfg.CAFile
+	if caFile == "" {
+		caFile = os.Getenv("AWS_CA_BUNDLE")
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// closeIdleConnections 关闭连接池中的空闲连接，存储桶被移除或重建时调用；进行中的请求不受影响
+func (b *BucketInfo) closeIdleConnections() {
+	if b.transport != nil {
+		b.transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,201 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/health"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// accountingStatsCollector 根据代理自身记录的对象大小统计已用容量，不访问后端
+// 加上最近一次对账扫描发现的、未经代理写入的数据大小
+type accountingStatsCollector struct {
+	storage storage.MetadataStore
+}
+
+// CollectStats 实现 health.StatsCollector 接口
+func (c *accountingStatsCollector) CollectStats(ctx context.Context, target health.Target) (*health.Stats, error) {
+	if c.storage == nil {
+		return nil, fmt.Errorf("storage not available")
+	}
+
+	name := target.GetID()
+	size, err := c.storage.GetBucketSize(name)
+	if err != nil {
+		return nil, err
+	}
+	count, err := c.storage.GetBucketObjectCount(name)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := c.storage.GetUntrackedSize(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &health.Stats{
+		TargetID:    name,
+		UsedSize:    size + untracked,
+		ObjectCount: count,
+		LastUpdated: time.Now(),
+	}, nil
+}
+
+// runUsageScanner 周期性执行对账扫描，直到 ctx 结束或管理器停止
+func (m *Manager) runUsageScanner(ctx context.Context) {
+	for {
+		m.mu.RLock()
+		interval := m.config.Balancer.UsageScan.Interval
+		m.mu.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopChan:
+			return
+		case <-time.After(interval):
+			m.scanUsageOnce(ctx)
+		}
+	}
+}
+
+// scanUsageOnce 对每个真实存储桶推进一轮对账扫描
+func (m *Manager) scanUsageOnce(ctx context.Context) {
+	m.mu.RLock()
+	scanCfg := m.config.Balancer.UsageScan
+	var buckets []*BucketInfo
+	for _, b := range m.buckets {
+		if !b.Config.Virtual {
+			buckets = append(buckets, b)
+		}
+	}
+	m.mu.RUnlock()
+
+	if !scanCfg.IsEnabled() || m.storage == nil {
+		return
+	}
+
+	// 逐个存储桶扫描，限速针对整个进程
+	for _, b := range buckets {
+		if err := m.scanBucketUsage(ctx, b, scanCfg.PagesPerRun, scanCfg.PageInterval); err != nil {
+			logger.Warn("Usage scan paused", "bucket", b.Config.Name, "error", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// scanBucketUsage 从保存的续传令牌继续列出存储桶对象，最多列出 maxPages 页
+// 列出完成后记录后端实际大小与代理记录大小的差值
+func (m *Manager) scanBucketUsage(ctx context.Context, b *BucketInfo, maxPages int, pageInterval time.Duration) error {
+	name := b.Config.Name
+	state, err := m.storage.GetUsageScanState(name)
+	if err != nil {
+		return err
+	}
+
+	if state.ContinuationToken == "" && state.Pages == 0 {
+		now := time.Now()
+		state.StartedAt = &now
+		state.PartialSize = 0
+		state.PartialObjects = 0
+	}
+
+	for page := 0; page < maxPages; page++ {
+		if page > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-m.stopChan:
+				return nil
+			case <-time.After(pageInterval):
+			}
+		}
+
+		input := &s3.ListObjectsV2Input{Bucket: aws.String(name)}
+		if state.ContinuationToken != "" {
+			input.ContinuationToken = aws.String(state.ContinuationToken)
+		}
+		output, err := b.Client.ListObjectsV2(ctx, input)
+		// 每次 ListObjectsV2 调用都是 Class A 操作
+		m.RecordBackendOperation(name, OperationTypeA)
+		if err != nil {
+			// 保留当前进度，下一轮从同一页重试
+			return fmt.Errorf("list objects: %w", err)
+		}
+
+		for _, obj := range output.Contents {
+			// 跳过详细健康检查残留的探测对象
+			if obj.Key != nil && strings.HasPrefix(*obj.Key, health.CanaryPrefix) {
+				continue
+			}
+			state.PartialObjects++
+			if obj.Size != nil {
+				state.PartialSize += *obj.Size
+			}
+		}
+		state.Pages++
+
+		if output.IsTruncated != nil && *output.IsTruncated && output.NextContinuationToken != nil {
+			state.ContinuationToken = *output.NextContinuationToken
+			if err := m.storage.SaveUsageScanState(state); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return m.completeUsageScan(b, state)
+	}
+
+	return nil
+}
+
+// completeUsageScan 记录一次完整扫描的结果并重置进度
+func (m *Manager) completeUsageScan(b *BucketInfo, state *storage.UsageScanState) error {
+	name := b.Config.Name
+	accounted, err := m.storage.GetBucketSize(name)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	state.ScannedSize = state.PartialSize
+	state.ScannedObjects = state.PartialObjects
+	state.AccountedSize = accounted
+	state.UntrackedSize = 0
+	if state.ScannedSize > accounted {
+		state.UntrackedSize = state.ScannedSize - accounted
+	}
+	state.CompletedAt = &now
+	state.ContinuationToken = ""
+	state.PartialSize = 0
+	state.PartialObjects = 0
+	state.Pages = 0
+	state.StartedAt = nil
+
+	if err := m.storage.SaveUsageScanState(state); err != nil {
+		return err
+	}
+
+	logger.Info("Usage scan completed", "bucket", name, "backend_bytes", state.ScannedSize, "backend_objects", state.ScannedObjects,
+		"accounted_bytes", state.AccountedSize, "untracked_bytes", state.UntrackedSize)
+	if m.metrics != nil {
+		m.metrics.SetBucketUntrackedBytes(name, state.UntrackedSize)
+	}
+
+	// 立即用新的差值刷新已用容量
+	m.mu.RLock()
+	statsMonitor := m.statsMonitor
+	m.mu.RUnlock()
+	if statsMonitor != nil && m.monitorCtx != nil {
+		statsMonitor.CollectNow(m.monitorCtx, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,387 @@
+// Package cache 代理模式下载的本地磁盘读缓存
+// 对象按固定大小分块缓存，以（真实存储桶、真实key、ETag）标识一个对象版本：
+// 覆盖写产生新的 ETag，旧版本不会再被命中；写入与删除时仍会主动失效以释放空间
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"github.com/DullJZ/s3-balance/internal/metrics"
+)
+
+var logger = logging.Logger(logging.SubsystemCache)
+
+const (
+	metaFile    = "meta.json"
+	chunkPrefix = "chunk-"
+	tmpSuffix   = ".tmp"
+)
+
+// Config 磁盘缓存配置
+type Config struct {
+	Dir           string
+	MaxSize       int64 // 缓存总大小上限
+	ChunkSize     int64 // 分块大小
+	MaxObjectSize int64 // 超过该大小的对象不缓存
+}
+
+// Object 一个对象版本
+type Object struct {
+	Bucket string // 真实存储桶
+	Key    string // 真实key
+	ETag   string
+}
+
+// Meta 对象版本的响应头，首次从后端读取时保存
+type Meta struct {
+	Size            int64     `json:"size"`
+	ContentType     string    `json:"content_type,omitempty"`
+	ContentEncoding string    `json:"content_encoding,omitempty"`
+	CacheControl    string    `json:"cache_control,omitempty"`
+	LastModified    time.Time `json:"last_modified"`
+}
+
+// entry 一个已缓存的分块
+type entry struct {
+	path    string
+	version string // 所属对象版本目录
+	size    int64
+}
+
+// DiskCache 按分块 LRU 淘汰的磁盘缓存，可并发使用
+type DiskCache struct {
+	cfg     Config
+	metrics *metrics.Metrics
+
+	mu       sync.Mutex
+	lru      *list.List               // 前端为最近使用
+	entries  map[string]*list.Element // 分块路径 -> LRU 元素
+	versions map[string]int           // 对象版本目录 -> 已缓存的分块数
+	size     int64
+}
+
+// New 创建磁盘缓存并载入目录中已有的分块（按修改时间恢复 LRU 顺序）
+func New(cfg Config, m *metrics.Metrics) (*DiskCache, error) {
+	if cfg.ChunkSize <= 0 || cfg.MaxSize <= 0 {
+		return nil, fmt.Errorf("cache max_size and chunk_size must be positive")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	c := &DiskCache{
+		cfg:      cfg,
+		metrics:  m,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		versions: make(map[string]int),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load 扫描缓存目录，删除未完成的临时文件与没有分块的对象版本
+func (c *DiskCache) load() error {
+	type found struct {
+		entry
+		modTime time.Time
+	}
+	var chunks []found
+	versionDirs := make(map[string]bool)
+
+	err := filepath.WalkDir(c.cfg.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, tmpSuffix) {
+			os.Remove(path)
+			return nil
+		}
+		version := filepath.Dir(path)
+		versionDirs[version] = true
+		if !strings.HasPrefix(name, chunkPrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		chunks = append(chunks, found{
+			entry:   entry{path: path, version: version, size: info.Size()},
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan cache dir: %w", err)
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].modTime.Before(chunks[j].modTime) })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range chunks {
+		e := f.entry
+		c.entries[e.path] = c.lru.PushFront(&e)
+		c.versions[e.version]++
+		c.size += e.size
+	}
+	for dir := range versionDirs {
+		if c.versions[dir] == 0 {
+			os.RemoveAll(dir)
+		}
+	}
+	c.evictLocked()
+	if len(chunks) > 0 {
+		logger.Info("Loaded cached chunks", "chunks", len(chunks), "bytes", c.size, "dir", c.cfg.Dir)
+	}
+	return nil
+}
+
+// ChunkSize 分块大小
+func (c *DiskCache) ChunkSize() int64 {
+	return c.cfg.ChunkSize
+}
+
+// Cacheable 该大小的对象是否缓存
+func (c *DiskCache) Cacheable(size int64) bool {
+	return size > 0 && size <= c.cfg.MaxObjectSize
+}
+
+// keyDir 真实对象所有版本所在的目录
+func (c *DiskCache) keyDir(bucket, key string) string {
+	sum := sha256.Sum256([]byte(bucket + "\x00" + key))
+	return filepath.Join(c.cfg.Dir, hex.EncodeToString(sum[:16]))
+}
+
+// versionDir 对象版本目录
+func (c *DiskCache) versionDir(o Object) string {
+	sum := sha256.Sum256([]byte(o.ETag))
+	return filepath.Join(c.keyDir(o.Bucket, o.Key), hex.EncodeToString(sum[:8]))
+}
+
+func (c *DiskCache) chunkPath(o Object, index int64) string {
+	return filepath.Join(c.versionDir(o), chunkPrefix+strconv.FormatInt(index, 10))
+}
+
+// Meta 读取对象版本的响应头
+func (c *DiskCache) Meta(o Object) (*Meta, bool) {
+	data, err := os.ReadFile(filepath.Join(c.versionDir(o), metaFile))
+	if err != nil {
+		return nil, false
+	}
+	var m Meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, false
+	}
+	return &m, true
+}
+
+// SaveMeta 保存对象版本的响应头
+func (c *DiskCache) SaveMeta(o Object, m *Meta) error {
+	dir := c.versionDir(o)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, metaFile), data)
+}
+
+// HasChunk 分块是否已缓存（不更新 LRU 顺序）
+func (c *DiskCache) HasChunk(o Object, index int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[c.chunkPath(o, index)]
+	return ok
+}
+
+// OpenChunk 打开已缓存的分块并标记为最近使用，调用方负责关闭
+func (c *DiskCache) OpenChunk(o Object, index int64) (*os.File, bool) {
+	path := c.chunkPath(o, index)
+	c.mu.Lock()
+	elem, ok := c.entries[path]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		c.mu.Lock()
+		if elem, ok := c.entries[path]; ok {
+			c.removeLocked(elem)
+		}
+		c.mu.Unlock()
+		return nil, false
+	}
+	return f, true
+}
+
+// ChunkWriter 写入一个分块，Commit 后才对读取可见
+type ChunkWriter struct {
+	c    *DiskCache
+	o    Object
+	path string
+	f    *os.File
+	n    int64
+}
+
+// CreateChunk 开始写入一个分块
+func (c *DiskCache) CreateChunk(o Object, index int64) (*ChunkWriter, error) {
+	dir := c.versionDir(o)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, chunkPrefix+"*"+tmpSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkWriter{c: c, o: o, path: c.chunkPath(o, index), f: f}, nil
+}
+
+// Write 实现 io.Writer
+func (w *ChunkWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Commit 完成分块写入并加入缓存，超过容量时淘汰最久未使用的分块
+func (w *ChunkWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	if err := os.Rename(w.f.Name(), w.path); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+
+	c := w.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[w.path]; ok {
+		// 并发填充了同一个分块
+		e := elem.Value.(*entry)
+		c.size += w.n - e.size
+		e.size = w.n
+		c.lru.MoveToFront(elem)
+	} else {
+		e := &entry{path: w.path, version: c.versionDir(w.o), size: w.n}
+		c.entries[w.path] = c.lru.PushFront(e)
+		c.versions[e.version]++
+		c.size += w.n
+	}
+	c.evictLocked()
+	return nil
+}
+
+// Abort 放弃未完成的分块
+func (w *ChunkWriter) Abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// Invalidate 删除真实对象所有版本的缓存
+func (c *DiskCache) Invalidate(bucket, key string) {
+	dir := c.keyDir(bucket, key)
+	prefix := dir + string(filepath.Separator)
+	c.mu.Lock()
+	for path, elem := range c.entries {
+		if strings.HasPrefix(path, prefix) {
+			c.removeLocked(elem)
+		}
+	}
+	if c.metrics != nil {
+		c.metrics.SetCacheSize(c.size)
+	}
+	c.mu.Unlock()
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Warn("Failed to remove cache dir", "dir", dir, "error", err)
+	}
+}
+
+// Size 当前缓存大小
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evictLocked 淘汰最久未使用的分块直到不超过容量
+func (c *DiskCache) evictLocked() {
+	for c.size > c.cfg.MaxSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			break
+		}
+		e := c.removeLocked(elem)
+		os.Remove(e.path)
+		if c.versions[e.version] == 0 {
+			os.RemoveAll(e.version)
+		}
+		if c.metrics != nil {
+			c.metrics.RecordCacheEviction()
+		}
+	}
+	if c.metrics != nil {
+		c.metrics.SetCacheSize(c.size)
+	}
+}
+
+// removeLocked 从索引中移除分块，不删除文件
+func (c *DiskCache) removeLocked(elem *list.Element) *entry {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.entries, e.path)
+	c.size -= e.size
+	c.versions[e.version]--
+	if c.versions[e.version] <= 0 {
+		delete(c.versions, e.version)
+	}
+	return e
+}
+
+// writeFileAtomic 先写临时文件再重命名，读取方不会看到写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
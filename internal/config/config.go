@@ -1,22 +1,180 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"gopkg.in/yaml.v3"
 )
 
 // Config 全局配置结构
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Buckets  []BucketConfig `yaml:"buckets"`
-	Balancer BalancerConfig `yaml:"balancer"`
-	Metrics  MetricsConfig  `yaml:"metrics"`
-	S3API    S3APIConfig    `yaml:"s3api"`
-	API      APIConfig      `yaml:"api"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Buckets   []BucketConfig  `yaml:"buckets"`
+	Balancer  BalancerConfig  `yaml:"balancer"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	S3API     S3APIConfig     `yaml:"s3api"`
+	API       APIConfig       `yaml:"api"`
+	Reconcile ReconcileConfig `yaml:"reconcile"`
+	GC        GCConfig        `yaml:"gc"`
+	Cache     CacheConfig     `yaml:"cache"`
+	AccessLog AccessLogConfig `yaml:"access_log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Logging   LoggingConfig   `yaml:"logging"`
+}
+
+// LoggingConfig 结构化日志（支持热更新）
+type LoggingConfig struct {
+	Format string            `yaml:"format"` // 输出格式: json（默认）, text
+	Level  string            `yaml:"level"`  // 默认级别: debug, info（默认）, warn, error
+	Levels map[string]string `yaml:"levels"` // 按子系统覆盖级别，如 api: debug
+}
+
+// 追踪导出器
+const (
+	TracingExporterOTLP   = "otlp"   // 通过 OTLP 发送到 Collector 或兼容的后端
+	TracingExporterStdout = "stdout" // 输出到标准输出，用于本地调试
+)
+
+// OTLP 传输协议
+const (
+	TracingProtocolGRPC = "grpc"
+	TracingProtocolHTTP = "http"
+)
+
+// TracingConfig OpenTelemetry 链路追踪（修改后需重启生效）
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`      // 是否启用（默认关闭）
+	Exporter    string            `yaml:"exporter"`     // 导出器: otlp（默认）, stdout
+	Endpoint    string            `yaml:"endpoint"`     // OTLP 端点（host:port），留空使用 OTEL_EXPORTER_OTLP_ENDPOINT 或默认端口
+	Protocol    string            `yaml:"protocol"`     // OTLP 协议: grpc（默认）, http
+	Insecure    bool              `yaml:"insecure"`     // 不使用 TLS 连接 OTLP 端点
+	Headers     map[string]string `yaml:"headers"`      // OTLP 请求附加的请求头（如认证信息）
+	ServiceName string            `yaml:"service_name"` // 上报的服务名
+	SampleRatio float64           `yaml:"sample_ratio"` // 采样比例（0-1），未配置时全部采样；上游请求已带采样决定时沿用
+}
+
+// 访问日志导出文件格式
+const (
+	AccessLogFormatJSON = "json" // 每行一条 JSON
+	AccessLogFormatS3   = "s3"   // AWS S3 服务器访问日志格式
+)
+
+// AccessLogConfig 访问日志的保留、汇总与导出（修改后需重启生效）
+type AccessLogConfig struct {
+	RetentionDays       int                 `yaml:"retention_days"`        // 原始访问日志保留天数，0 表示永久保留
+	Rollup              *bool               `yaml:"rollup"`                // 是否生成按小时、按天的汇总（默认启用）
+	HourlyRetentionDays int                 `yaml:"hourly_retention_days"` // 小时汇总保留天数，0 表示永久保留
+	DailyRetentionDays  int                 `yaml:"daily_retention_days"`  // 天汇总保留天数，0 表示永久保留
+	Sink                AccessLogSinkConfig `yaml:"sink"`                  // 导出为轮转的日志文件
+}
+
+// RollupEnabled 是否生成访问日志汇总，未配置时默认启用
+func (c AccessLogConfig) RollupEnabled() bool {
+	return c.Rollup == nil || *c.Rollup
+}
+
+// AccessLogSinkConfig 把访问日志写入轮转的文件，可选在轮转后上传到虚拟存储桶
+type AccessLogSinkConfig struct {
+	Enabled         bool          `yaml:"enabled"`         // 是否启用（默认关闭）
+	Format          string        `yaml:"format"`          // 文件格式: json（默认）, s3
+	Dir             string        `yaml:"dir"`             // 日志文件目录，上传到存储桶时作为暂存目录
+	Bucket          string        `yaml:"bucket"`          // 轮转后上传到的虚拟存储桶，留空时只保存在本地
+	Prefix          string        `yaml:"prefix"`          // 上传到存储桶时的 key 前缀
+	RotateSize      string        `yaml:"rotate_size"`     // 单个文件的大小上限，例如 64MB
+	RotateInterval  time.Duration `yaml:"rotate_interval"` // 单个文件的最长写入时间
+	MaxFiles        int           `yaml:"max_files"`       // 本地最多保留的文件数，0 表示不限（上传到存储桶的文件上传后即删除）
+	RotateSizeBytes int64         `yaml:"-"`               // 内部使用，字节为单位
+}
+
+// ParseSizes 解析轮转大小字符串为字节
+func (c *AccessLogSinkConfig) ParseSizes() error {
+	size, err := parseSize(valueOrDefault(c.RotateSize, defaultAccessLogRotateSize))
+	if err != nil {
+		return fmt.Errorf("invalid rotate_size: %w", err)
+	}
+	if size <= 0 {
+		return fmt.Errorf("rotate_size must be positive")
+	}
+	c.RotateSizeBytes = size
+	return nil
+}
+
+// CacheConfig 代理模式下载的本地磁盘读缓存（修改后需重启生效）
+type CacheConfig struct {
+	Enabled            bool   `yaml:"enabled"`         // 是否启用（默认关闭）
+	Dir                string `yaml:"dir"`             // 缓存目录
+	MaxSize            string `yaml:"max_size"`        // 缓存总大小上限，例如 10GB
+	ChunkSize          string `yaml:"chunk_size"`      // 缓存分块大小，Range 请求按分块命中
+	MaxObjectSize      string `yaml:"max_object_size"` // 超过该大小的对象不缓存（默认为 max_size 的四分之一）
+	MaxSizeBytes       int64  `yaml:"-"`               // 内部使用，字节为单位
+	ChunkSizeBytes     int64  `yaml:"-"`               // 内部使用，字节为单位
+	MaxObjectSizeBytes int64  `yaml:"-"`               // 内部使用，字节为单位
+}
+
+// ParseSizes 解析缓存大小字符串为字节
+func (c *CacheConfig) ParseSizes() error {
+	var err error
+	if c.MaxSizeBytes, err = parseSize(valueOrDefault(c.MaxSize, defaultCacheMaxSize)); err != nil {
+		return fmt.Errorf("invalid max_size: %w", err)
+	}
+	if c.ChunkSizeBytes, err = parseSize(valueOrDefault(c.ChunkSize, defaultCacheChunkSize)); err != nil {
+		return fmt.Errorf("invalid chunk_size: %w", err)
+	}
+	if c.MaxSizeBytes <= 0 || c.ChunkSizeBytes <= 0 {
+		return fmt.Errorf("max_size and chunk_size must be positive")
+	}
+	if c.ChunkSizeBytes > c.MaxSizeBytes {
+		return fmt.Errorf("chunk_size must not exceed max_size")
+	}
+	c.MaxObjectSizeBytes = c.MaxSizeBytes / 4
+	if c.MaxObjectSize != "" {
+		if c.MaxObjectSizeBytes, err = parseSize(c.MaxObjectSize); err != nil {
+			return fmt.Errorf("invalid max_object_size: %w", err)
+		}
+	}
+	return nil
+}
+
+// GCConfig 后端垃圾回收配置：重试待删除的真实对象，中止过期的分片上传
+type GCConfig struct {
+	Enabled           *bool         `yaml:"enabled"`            // 是否启用（默认启用）
+	Interval          time.Duration `yaml:"interval"`           // 处理待删除队列的间隔
+	BatchSize         int           `yaml:"batch_size"`         // 每轮最多处理的待删除对象数
+	RetryBaseDelay    time.Duration `yaml:"retry_base_delay"`   // 删除失败后的首次重试延迟，之后指数退避
+	RetryMaxDelay     time.Duration `yaml:"retry_max_delay"`    // 重试延迟上限
+	MultipartInterval time.Duration `yaml:"multipart_interval"` // 扫描过期分片上传的间隔
+	MultipartMaxAge   time.Duration `yaml:"multipart_max_age"`  // 没有进行中会话且早于该时长的分片上传会被中止
+}
+
+// IsEnabled 垃圾回收是否启用
+func (c GCConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// 对账修复模式
+const (
+	ReconcileModeReport        = "report"         // 只报告
+	ReconcileModeAdopt         = "adopt"          // 将后端孤儿对象收编到指定虚拟存储桶
+	ReconcileModeDeleteOrphans = "delete-orphans" // 删除后端孤儿对象
+	ReconcileModePurgeDangling = "purge-dangling" // 清除后端已不存在的映射与对象记录
+)
+
+// ReconcileConfig 元数据与后端内容对账任务配置
+type ReconcileConfig struct {
+	Enabled      bool          `yaml:"enabled"`       // 是否定期执行
+	Interval     time.Duration `yaml:"interval"`      // 执行间隔
+	Mode         string        `yaml:"mode"`          // 修复模式: report, adopt, delete-orphans, purge-dangling
+	AdoptInto    string        `yaml:"adopt_into"`    // adopt 模式下收编孤儿对象的虚拟存储桶
+	MinAge       time.Duration `yaml:"min_age"`       // 只处理早于该时长的对象，避免误判正在写入的对象
+	PageInterval time.Duration `yaml:"page_interval"` // 两次列出请求之间的最小间隔（限速）
 }
 
 // ServerConfig 服务器配置
@@ -26,6 +184,8 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
 	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// TrustedProxies 可信反向代理（IP 或 CIDR），只有来自这些地址的请求才采用 X-Forwarded-For / X-Real-IP 作为客户端地址
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 // BucketConfig S3存储桶配置
@@ -42,6 +202,39 @@ type BucketConfig struct {
 	PathStyle       bool                 `yaml:"path_style"`        // 是否使用路径风格访问
 	Virtual         bool                 `yaml:"virtual"`           // 是否为虚拟存储桶（仅S3 API中可见）
 	OperationLimits OperationLimitConfig `yaml:"operation_limits"`
+	HealthCheck     HealthCheckConfig    `yaml:"health_check"` // 覆盖全局健康检查配置（未设置的字段沿用全局值）
+	Transport       TransportConfig      `yaml:"transport"`    // 访问后端的HTTP连接池（未设置的字段使用默认值）
+}
+
+// TransportConfig 后端HTTP连接池配置，SDK客户端与预签名URL数据传输共用同一个连接池
+type TransportConfig struct {
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"` // 保留的空闲连接数（默认100）
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host"`      // 最大连接数，超出的请求排队等待（0表示不限制）
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`       // 空闲连接保留时间（默认90s）
+	DialTimeout           time.Duration `yaml:"dial_timeout"`            // 建立TCP连接超时（默认10s）
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`   // TLS握手超时（默认10s）
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"` // 请求发送完毕后等待响应头的超时（0表示不限制）
+	HTTP2                 bool          `yaml:"http2"`                   // 是否尝试HTTP/2（默认只用HTTP/1.1）
+	ProxyURL              string        `yaml:"proxy_url"`               // 访问后端使用的代理（为空时读取 HTTP_PROXY/HTTPS_PROXY 环境变量）
+	TLS                   TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig 访问后端的TLS配置
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`              // 额外信任的CA证书（PEM）
+	ServerName         string `yaml:"server_name"`          // 覆盖证书校验使用的主机名
+	MinVersion         string `yaml:"min_version"`          // 最低TLS版本: "1.2"、"1.3"（默认1.2）
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 跳过证书校验（仅用于测试环境）
+}
+
+// HealthCheckConfig 健康检查配置
+type HealthCheckConfig struct {
+	Strategy   string        `yaml:"strategy"`    // 检查策略: "simple"（列出对象）、"detailed"（写入、读取并删除探测对象）
+	Timeout    time.Duration `yaml:"timeout"`     // 单次检查超时时间
+	Retries    int           `yaml:"retries"`     // 失败重试次数
+	LatencySLO time.Duration `yaml:"latency_slo"` // 任一步骤延迟超过该值时标记为降级（0表示不检查）
+	Rise       int           `yaml:"rise"`        // 不可用的存储桶连续成功多少次后恢复
+	Fall       int           `yaml:"fall"`        // 可用的存储桶连续失败多少次后标记为不可用
 }
 
 // OperationLimitConfig 后端操作次数限制配置
@@ -52,11 +245,42 @@ type OperationLimitConfig struct {
 
 // BalancerConfig 负载均衡配置
 type BalancerConfig struct {
-	Strategy          string        `yaml:"strategy"`            // 负载均衡策略: "round-robin", "least-space", "weighted"
-	HealthCheckPeriod time.Duration `yaml:"health_check_period"` // 健康检查周期
-	UpdateStatsPeriod time.Duration `yaml:"update_stats_period"` // 统计更新周期
-	RetryAttempts     int           `yaml:"retry_attempts"`      // 重试次数
-	RetryDelay        time.Duration `yaml:"retry_delay"`         // 重试延迟
+	Strategy          string               `yaml:"strategy"`            // 负载均衡策略: "round-robin", "least-space", "weighted"
+	HealthCheckPeriod time.Duration        `yaml:"health_check_period"` // 健康检查周期
+	UpdateStatsPeriod time.Duration        `yaml:"update_stats_period"` // 统计更新周期
+	RetryAttempts     int                  `yaml:"retry_attempts"`      // 重试次数
+	RetryDelay        time.Duration        `yaml:"retry_delay"`         // 重试延迟
+	CircuitBreaker    CircuitBreakerConfig `yaml:"circuit_breaker"`     // 基于真实请求结果的熔断器
+	HealthCheck       HealthCheckConfig    `yaml:"health_check"`        // 全局健康检查配置，可在存储桶中覆盖
+	UsageScan         UsageScanConfig      `yaml:"usage_scan"`          // 已用容量对账扫描
+}
+
+// UsageScanConfig 已用容量对账扫描配置
+// 已用容量以代理自身记录的对象大小为准，对账扫描缓慢地列出后端全部对象，用于发现未经代理写入的数据
+type UsageScanConfig struct {
+	Enabled      *bool         `yaml:"enabled"`       // 是否启用（默认启用）
+	Interval     time.Duration `yaml:"interval"`      // 两轮扫描之间的间隔
+	PagesPerRun  int           `yaml:"pages_per_run"` // 每轮每个存储桶最多列出的页数（每页最多1000个对象，每页一次A类操作）
+	PageInterval time.Duration `yaml:"page_interval"` // 两次列出请求之间的最小间隔（限速）
+}
+
+// IsEnabled 对账扫描是否启用
+func (c UsageScanConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// CircuitBreakerConfig 后端熔断器配置
+type CircuitBreakerConfig struct {
+	Enabled             *bool         `yaml:"enabled"`                // 是否启用（默认启用）
+	FailureThreshold    int           `yaml:"failure_threshold"`      // 连续失败多少次后熔断
+	OpenTimeout         time.Duration `yaml:"open_timeout"`           // 熔断后多久进入半开状态
+	HalfOpenMaxRequests int           `yaml:"half_open_max_requests"` // 半开状态允许同时进行的试探请求数
+	SuccessThreshold    int           `yaml:"success_threshold"`      // 半开状态连续成功多少次后恢复
+}
+
+// IsEnabled 熔断器是否启用
+func (c CircuitBreakerConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
 }
 
 // MetricsConfig 监控指标配置
@@ -74,6 +298,79 @@ type S3APIConfig struct {
 	ProxyMode    bool   `yaml:"proxy_mode"`    // 是否使用代理模式（而非重定向）
 	AuthRequired bool   `yaml:"auth_required"` // 是否需要认证
 	Host         string `yaml:"host"`          // 用于签名验证的Host（为空则使用请求的Host）
+
+	SpoolDir          string `yaml:"spool_dir"`      // 长度未知的上传请求体的暂存目录（为空则使用系统临时目录）
+	MaxSpoolSize      string `yaml:"max_spool_size"` // 单个暂存请求体的最大大小，例如 5GB
+	MaxSpoolSizeBytes int64  `yaml:"-"`              // 内部使用，字节为单位
+
+	AutoMultipart AutoMultipartConfig `yaml:"auto_multipart"` // 大文件 PUT 自动转为后端分片上传
+}
+
+// AutoMultipartConfig 超过阈值的单次 PUT 由代理拆分为后端分片上传
+type AutoMultipartConfig struct {
+	Enabled        *bool  `yaml:"enabled"`      // 是否启用（默认启用）
+	Threshold      string `yaml:"threshold"`    // 超过该大小的 PUT 转为分片上传，例如 1GB
+	PartSize       string `yaml:"part_size"`    // 分片大小（不小于 5MB）
+	Concurrency    int    `yaml:"concurrency"`  // 并行上传的分片数
+	PartRetries    int    `yaml:"part_retries"` // 单个分片失败后的重试次数
+	ThresholdBytes int64  `yaml:"-"`            // 内部使用，字节为单位
+	PartSizeBytes  int64  `yaml:"-"`            // 内部使用，字节为单位
+}
+
+// IsEnabled 自动分片上传是否启用
+func (c AutoMultipartConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+const (
+	// 暂存请求体默认上限，与 S3 单次 PUT 上限一致
+	defaultMaxSpoolSize = "5GB"
+
+	defaultCacheMaxSize   = "10GB"
+	defaultCacheChunkSize = "8MB"
+
+	defaultAccessLogRotateSize = "64MB"
+
+	defaultAutoMultipartThreshold = "1GB"
+	defaultAutoMultipartPartSize  = "64MB"
+	minAutoMultipartPartSize      = 5 * 1024 * 1024
+)
+
+// ParseSizes 解析暂存上限与自动分片上传的大小字符串为字节
+func (c *S3APIConfig) ParseSizes() error {
+	size, err := parseSize(valueOrDefault(c.MaxSpoolSize, defaultMaxSpoolSize))
+	if err != nil {
+		return fmt.Errorf("invalid max_spool_size: %w", err)
+	}
+	if size <= 0 {
+		return fmt.Errorf("max_spool_size must be positive")
+	}
+	c.MaxSpoolSizeBytes = size
+
+	am := &c.AutoMultipart
+	if am.ThresholdBytes, err = parseSize(valueOrDefault(am.Threshold, defaultAutoMultipartThreshold)); err != nil {
+		return fmt.Errorf("invalid auto_multipart threshold: %w", err)
+	}
+	if am.PartSizeBytes, err = parseSize(valueOrDefault(am.PartSize, defaultAutoMultipartPartSize)); err != nil {
+		return fmt.Errorf("invalid auto_multipart part_size: %w", err)
+	}
+	if am.PartSizeBytes < minAutoMultipartPartSize {
+		return fmt.Errorf("auto_multipart part_size must be at least 5MB")
+	}
+	if am.ThresholdBytes <= 0 {
+		return fmt.Errorf("auto_multipart threshold must be positive")
+	}
+	if am.Concurrency < 0 || am.PartRetries < 0 {
+		return fmt.Errorf("auto_multipart concurrency and part_retries must not be negative")
+	}
+	return nil
+}
+
+func valueOrDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
 }
 
 // APIConfig 管理API配置
@@ -91,18 +388,67 @@ type DatabaseConfig struct {
 	ConnMaxLifetime int    `yaml:"conn_max_lifetime"` // 连接最大生命周期（秒）
 	LogLevel        string `yaml:"log_level"`         // 日志级别: silent, error, warn, info
 	AutoMigrate     bool   `yaml:"auto_migrate"`      // 是否自动迁移
+	MetadataStore   string `yaml:"metadata_store"`    // 元数据存储: sql（默认，使用上面的数据库）, bolt（内嵌键值存储）
+	MetadataPath    string `yaml:"metadata_path"`     // bolt 元数据文件路径
+
+	LookupCache LookupCacheConfig `yaml:"lookup_cache"` // 映射与对象记录查询缓存
+	AsyncWrite  AsyncWriteConfig  `yaml:"async_write"`  // 访问日志与操作计数的后台批量写入
+}
+
+// AsyncWriteConfig 访问日志与后端操作计数的后台批量写入（修改后需重启生效）
+type AsyncWriteConfig struct {
+	QueueSize     int           `yaml:"queue_size"`     // 访问日志队列长度，队列已满时丢弃新的日志
+	BatchSize     int           `yaml:"batch_size"`     // 单次写入的最大访问日志条数
+	FlushInterval time.Duration `yaml:"flush_interval"` // 未攒满一批时的写入间隔，也是操作计数的持久化间隔
+}
+
+// LookupCacheConfig 虚拟映射与对象记录查询的进程内缓存（修改后需重启生效）
+type LookupCacheConfig struct {
+	Enabled      *bool         `yaml:"enabled"`       // 是否启用（默认启用）
+	MaxEntries   int           `yaml:"max_entries"`   // 缓存条目上限，超出后淘汰最久未使用的条目
+	TTL          time.Duration `yaml:"ttl"`           // 查询结果的缓存时间
+	NegativeTTL  time.Duration `yaml:"negative_ttl"`  // 不存在结果的缓存时间
+	ChangeFeed   *bool         `yaml:"change_feed"`   // 是否通过 metadata_changes 表在多个实例间传播失效
+	PollInterval time.Duration `yaml:"poll_interval"` // 轮询变更通知表的间隔
+}
+
+// IsEnabled 是否启用查询缓存，未配置时默认启用
+func (c LookupCacheConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
 }
 
+// ChangeFeedEnabled 是否启用多实例失效通知
+// 未配置时，元数据保存在 mysql/postgres 中（可能由多个实例共享）时启用；bolt 只能被一个进程打开，始终不需要
+func (c *DatabaseConfig) ChangeFeedEnabled() bool {
+	if c.MetadataStore == MetadataStoreBolt {
+		return false
+	}
+	if c.LookupCache.ChangeFeed != nil {
+		return *c.LookupCache.ChangeFeed
+	}
+	return c.Type == "mysql" || c.Type == "postgres"
+}
+
+// 元数据存储类型
+const (
+	MetadataStoreSQL  = "sql"
+	MetadataStoreBolt = "bolt"
+)
+
 // Load 从文件加载配置
 func Load(configPath string) (*Config, error) {
-	file, err := os.Open(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
-	defer file.Close()
 
+	return Parse(data)
+}
+
+// Parse 从 YAML 内容解析配置
+func Parse(data []byte) (*Config, error) {
 	var config Config
-	decoder := yaml.NewDecoder(file)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
 	if err := decoder.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to decode config: %w", err)
 	}
@@ -118,9 +464,72 @@ func Load(configPath string) (*Config, error) {
 	// 设置默认值
 	config.SetDefaults()
 
+	if err := config.S3API.ParseSizes(); err != nil {
+		return nil, fmt.Errorf("failed to parse s3api config: %w", err)
+	}
+	if err := config.Cache.ParseSizes(); err != nil {
+		return nil, fmt.Errorf("failed to parse cache config: %w", err)
+	}
+	if err := config.AccessLog.Sink.ParseSizes(); err != nil {
+		return nil, fmt.Errorf("failed to parse access_log config: %w", err)
+	}
+
 	return &config, nil
 }
 
+// Clone 返回配置的深拷贝，修改副本不会影响原配置
+func (c *Config) Clone() *Config {
+	clone := *c
+	if c.Buckets != nil {
+		clone.Buckets = make([]BucketConfig, len(c.Buckets))
+		copy(clone.Buckets, c.Buckets)
+	}
+	if c.Server.TrustedProxies != nil {
+		clone.Server.TrustedProxies = append([]string(nil), c.Server.TrustedProxies...)
+	}
+	if c.Balancer.CircuitBreaker.Enabled != nil {
+		enabled := *c.Balancer.CircuitBreaker.Enabled
+		clone.Balancer.CircuitBreaker.Enabled = &enabled
+	}
+	if c.Balancer.UsageScan.Enabled != nil {
+		enabled := *c.Balancer.UsageScan.Enabled
+		clone.Balancer.UsageScan.Enabled = &enabled
+	}
+	if c.GC.Enabled != nil {
+		enabled := *c.GC.Enabled
+		clone.GC.Enabled = &enabled
+	}
+	if c.S3API.AutoMultipart.Enabled != nil {
+		enabled := *c.S3API.AutoMultipart.Enabled
+		clone.S3API.AutoMultipart.Enabled = &enabled
+	}
+	if c.Database.LookupCache.Enabled != nil {
+		enabled := *c.Database.LookupCache.Enabled
+		clone.Database.LookupCache.Enabled = &enabled
+	}
+	if c.Database.LookupCache.ChangeFeed != nil {
+		changeFeed := *c.Database.LookupCache.ChangeFeed
+		clone.Database.LookupCache.ChangeFeed = &changeFeed
+	}
+	if c.AccessLog.Rollup != nil {
+		rollup := *c.AccessLog.Rollup
+		clone.AccessLog.Rollup = &rollup
+	}
+	if c.Logging.Levels != nil {
+		clone.Logging.Levels = make(map[string]string, len(c.Logging.Levels))
+		for k, v := range c.Logging.Levels {
+			clone.Logging.Levels[k] = v
+		}
+	}
+	if c.Tracing.Headers != nil {
+		clone.Tracing.Headers = make(map[string]string, len(c.Tracing.Headers))
+		for k, v := range c.Tracing.Headers {
+			clone.Tracing.Headers[k] = v
+		}
+	}
+	return &clone
+}
+
 // SetDefaults 设置默认配置值
 func (c *Config) SetDefaults() {
 	if c.Server.Host == "" {
@@ -154,6 +563,69 @@ func (c *Config) SetDefaults() {
 	if c.Balancer.RetryDelay == 0 {
 		c.Balancer.RetryDelay = time.Second
 	}
+	if c.Balancer.HealthCheck.Strategy == "" {
+		c.Balancer.HealthCheck.Strategy = "simple"
+	}
+	if c.Balancer.HealthCheck.Timeout == 0 {
+		c.Balancer.HealthCheck.Timeout = 5 * time.Second
+	}
+	if c.Balancer.HealthCheck.Retries == 0 {
+		c.Balancer.HealthCheck.Retries = 1
+	}
+	if c.Balancer.HealthCheck.Rise == 0 {
+		c.Balancer.HealthCheck.Rise = 2
+	}
+	if c.Balancer.HealthCheck.Fall == 0 {
+		c.Balancer.HealthCheck.Fall = 3
+	}
+	if c.Reconcile.Interval == 0 {
+		c.Reconcile.Interval = 24 * time.Hour
+	}
+	if c.Reconcile.Mode == "" {
+		c.Reconcile.Mode = ReconcileModeReport
+	}
+	if c.Reconcile.MinAge == 0 {
+		c.Reconcile.MinAge = time.Hour
+	}
+	if c.GC.Interval == 0 {
+		c.GC.Interval = time.Minute
+	}
+	if c.GC.BatchSize == 0 {
+		c.GC.BatchSize = 100
+	}
+	if c.GC.RetryBaseDelay == 0 {
+		c.GC.RetryBaseDelay = 30 * time.Second
+	}
+	if c.GC.RetryMaxDelay == 0 {
+		c.GC.RetryMaxDelay = time.Hour
+	}
+	if c.GC.MultipartInterval == 0 {
+		c.GC.MultipartInterval = time.Hour
+	}
+	if c.GC.MultipartMaxAge == 0 {
+		c.GC.MultipartMaxAge = 24 * time.Hour
+	}
+	if c.Balancer.UsageScan.Interval == 0 {
+		c.Balancer.UsageScan.Interval = time.Hour
+	}
+	if c.Balancer.UsageScan.PagesPerRun == 0 {
+		c.Balancer.UsageScan.PagesPerRun = 10
+	}
+	if c.Balancer.UsageScan.PageInterval == 0 {
+		c.Balancer.UsageScan.PageInterval = time.Second
+	}
+	if c.Balancer.CircuitBreaker.FailureThreshold == 0 {
+		c.Balancer.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.Balancer.CircuitBreaker.OpenTimeout == 0 {
+		c.Balancer.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+	if c.Balancer.CircuitBreaker.HalfOpenMaxRequests == 0 {
+		c.Balancer.CircuitBreaker.HalfOpenMaxRequests = 1
+	}
+	if c.Balancer.CircuitBreaker.SuccessThreshold == 0 {
+		c.Balancer.CircuitBreaker.SuccessThreshold = 2
+	}
 
 	if c.Metrics.Path == "" {
 		c.Metrics.Path = "/metrics"
@@ -178,6 +650,33 @@ func (c *Config) SetDefaults() {
 	if c.Database.LogLevel == "" {
 		c.Database.LogLevel = "warn"
 	}
+	if c.Database.MetadataStore == "" {
+		c.Database.MetadataStore = MetadataStoreSQL
+	}
+	if c.Database.MetadataStore == MetadataStoreBolt && c.Database.MetadataPath == "" {
+		c.Database.MetadataPath = "data/metadata.bolt"
+	}
+	if c.Database.LookupCache.MaxEntries == 0 {
+		c.Database.LookupCache.MaxEntries = 100000
+	}
+	if c.Database.LookupCache.TTL == 0 {
+		c.Database.LookupCache.TTL = 30 * time.Second
+	}
+	if c.Database.LookupCache.NegativeTTL == 0 {
+		c.Database.LookupCache.NegativeTTL = 5 * time.Second
+	}
+	if c.Database.LookupCache.PollInterval == 0 {
+		c.Database.LookupCache.PollInterval = time.Second
+	}
+	if c.Database.AsyncWrite.QueueSize == 0 {
+		c.Database.AsyncWrite.QueueSize = 10000
+	}
+	if c.Database.AsyncWrite.BatchSize == 0 {
+		c.Database.AsyncWrite.BatchSize = 500
+	}
+	if c.Database.AsyncWrite.FlushInterval == 0 {
+		c.Database.AsyncWrite.FlushInterval = time.Second
+	}
 
 	// S3 API默认值
 	if c.S3API.AccessKey == "" {
@@ -186,6 +685,64 @@ func (c *Config) SetDefaults() {
 	if c.S3API.SecretKey == "" {
 		c.S3API.SecretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
 	}
+	if c.S3API.MaxSpoolSize == "" {
+		c.S3API.MaxSpoolSize = defaultMaxSpoolSize
+	}
+	if c.S3API.AutoMultipart.Threshold == "" {
+		c.S3API.AutoMultipart.Threshold = defaultAutoMultipartThreshold
+	}
+	if c.S3API.AutoMultipart.PartSize == "" {
+		c.S3API.AutoMultipart.PartSize = defaultAutoMultipartPartSize
+	}
+	if c.S3API.AutoMultipart.Concurrency == 0 {
+		c.S3API.AutoMultipart.Concurrency = 4
+	}
+	if c.S3API.AutoMultipart.PartRetries == 0 {
+		c.S3API.AutoMultipart.PartRetries = 3
+	}
+
+	if c.Cache.Dir == "" {
+		c.Cache.Dir = "data/cache"
+	}
+	if c.Cache.MaxSize == "" {
+		c.Cache.MaxSize = defaultCacheMaxSize
+	}
+	if c.Cache.ChunkSize == "" {
+		c.Cache.ChunkSize = defaultCacheChunkSize
+	}
+
+	if c.AccessLog.Sink.Format == "" {
+		c.AccessLog.Sink.Format = AccessLogFormatJSON
+	}
+	if c.AccessLog.Sink.Dir == "" {
+		c.AccessLog.Sink.Dir = "data/access-logs"
+	}
+	if c.AccessLog.Sink.RotateSize == "" {
+		c.AccessLog.Sink.RotateSize = defaultAccessLogRotateSize
+	}
+	if c.AccessLog.Sink.RotateInterval == 0 {
+		c.AccessLog.Sink.RotateInterval = time.Hour
+	}
+
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = TracingExporterOTLP
+	}
+	if c.Tracing.Protocol == "" {
+		c.Tracing.Protocol = TracingProtocolGRPC
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "s3-balance"
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+
+	if c.Logging.Format == "" {
+		c.Logging.Format = logging.FormatJSON
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
 
 	// 管理API默认值
 	if c.API.Token == "" {
@@ -193,6 +750,211 @@ func (c *Config) SetDefaults() {
 	}
 }
 
+// validTrustedProxy 可信代理条目需为 IP 或 CIDR
+func validTrustedProxy(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, err := netip.ParsePrefix(entry)
+		return err == nil
+	}
+	_, err := netip.ParseAddr(entry)
+	return err == nil
+}
+
+// Validate 验证配置的有效性（API 更新、回滚与预检共用）
+func (c *Config) Validate() error {
+	// 基本验证
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("invalid server port: %d", c.Server.Port)
+	}
+	for i, proxy := range c.Server.TrustedProxies {
+		if !validTrustedProxy(proxy) {
+			return fmt.Errorf("server.trusted_proxies[%d]: invalid IP or CIDR: %s", i, proxy)
+		}
+	}
+
+	if len(c.Buckets) == 0 {
+		return fmt.Errorf("at least one bucket is required")
+	}
+
+	// 验证存储桶配置
+	names := make(map[string]bool, len(c.Buckets))
+	for i, bucket := range c.Buckets {
+		if bucket.Name == "" {
+			return fmt.Errorf("bucket[%d]: name is required", i)
+		}
+		if names[bucket.Name] {
+			return fmt.Errorf("bucket[%d]: duplicate bucket name %s", i, bucket.Name)
+		}
+		names[bucket.Name] = true
+
+		// 虚拟存储桶不需要端点和凭据
+		if !bucket.Virtual {
+			if bucket.Endpoint == "" {
+				return fmt.Errorf("bucket[%d] (%s): endpoint is required for non-virtual bucket", i, bucket.Name)
+			}
+			if bucket.AccessKeyID == "" {
+				return fmt.Errorf("bucket[%d] (%s): access_key_id is required for non-virtual bucket", i, bucket.Name)
+			}
+			if bucket.SecretAccessKey == "" {
+				return fmt.Errorf("bucket[%d] (%s): secret_access_key is required for non-virtual bucket", i, bucket.Name)
+			}
+		}
+
+		if err := bucket.HealthCheck.validate(); err != nil {
+			return fmt.Errorf("bucket[%d] (%s): invalid health_check: %w", i, bucket.Name, err)
+		}
+
+		if err := bucket.Transport.validate(); err != nil {
+			return fmt.Errorf("bucket[%d] (%s): invalid transport: %w", i, bucket.Name, err)
+		}
+
+		// 解析并验证容量大小
+		if err := c.Buckets[i].ParseMaxSize(); err != nil {
+			return fmt.Errorf("bucket[%d] (%s): invalid max_size: %w", i, bucket.Name, err)
+		}
+	}
+
+	// 验证负载均衡策略
+	validStrategies := map[string]bool{
+		"round-robin": true,
+		"least-space": true,
+		"weighted":    true,
+	}
+	if !validStrategies[c.Balancer.Strategy] {
+		return fmt.Errorf("invalid balancer strategy: %s (must be one of: round-robin, least-space, weighted)", c.Balancer.Strategy)
+	}
+
+	if err := c.Balancer.HealthCheck.validate(); err != nil {
+		return fmt.Errorf("invalid balancer health_check: %w", err)
+	}
+
+	if c.Balancer.UsageScan.Interval < 0 || c.Balancer.UsageScan.PagesPerRun < 0 || c.Balancer.UsageScan.PageInterval < 0 {
+		return fmt.Errorf("invalid usage_scan config: interval, pages_per_run and page_interval must not be negative")
+	}
+
+	if err := c.Reconcile.ValidateFor(c); err != nil {
+		return fmt.Errorf("invalid reconcile config: %w", err)
+	}
+
+	gc := c.GC
+	if gc.Interval < 0 || gc.BatchSize < 0 || gc.RetryBaseDelay < 0 || gc.RetryMaxDelay < 0 || gc.MultipartInterval < 0 || gc.MultipartMaxAge < 0 {
+		return fmt.Errorf("invalid gc config: values must not be negative")
+	}
+
+	// 验证熔断器配置
+	cb := c.Balancer.CircuitBreaker
+	if cb.FailureThreshold < 0 || cb.HalfOpenMaxRequests < 0 || cb.SuccessThreshold < 0 || cb.OpenTimeout < 0 {
+		return fmt.Errorf("invalid circuit_breaker config: thresholds and open_timeout must not be negative")
+	}
+
+	// 验证数据库配置
+	if c.Database.Type == "" {
+		return fmt.Errorf("database type is required")
+	}
+	validDBTypes := map[string]bool{
+		"sqlite":   true,
+		"mysql":    true,
+		"postgres": true,
+	}
+	if !validDBTypes[c.Database.Type] {
+		return fmt.Errorf("invalid database type: %s (must be one of: sqlite, mysql, postgres)", c.Database.Type)
+	}
+	switch c.Database.MetadataStore {
+	case "", MetadataStoreSQL, MetadataStoreBolt:
+	default:
+		return fmt.Errorf("invalid metadata_store: %s (must be one of: sql, bolt)", c.Database.MetadataStore)
+	}
+	if c.Database.LookupCache.MaxEntries < 0 || c.Database.LookupCache.TTL < 0 || c.Database.LookupCache.NegativeTTL < 0 || c.Database.LookupCache.PollInterval < 0 {
+		return fmt.Errorf("lookup_cache max_entries, ttl, negative_ttl and poll_interval must not be negative")
+	}
+	if c.Database.AsyncWrite.QueueSize < 0 || c.Database.AsyncWrite.BatchSize < 0 || c.Database.AsyncWrite.FlushInterval < 0 {
+		return fmt.Errorf("async_write queue_size, batch_size and flush_interval must not be negative")
+	}
+
+	if err := c.S3API.ParseSizes(); err != nil {
+		return fmt.Errorf("invalid s3api config: %w", err)
+	}
+	if err := c.Cache.ParseSizes(); err != nil {
+		return fmt.Errorf("invalid cache config: %w", err)
+	}
+	if err := c.validateAccessLog(); err != nil {
+		return fmt.Errorf("invalid access_log config: %w", err)
+	}
+	if err := c.Tracing.validate(); err != nil {
+		return fmt.Errorf("invalid tracing config: %w", err)
+	}
+	if err := logging.Validate(c.Logging.Options()); err != nil {
+		return fmt.Errorf("invalid logging config: %w", err)
+	}
+
+	return nil
+}
+
+// validateAccessLog 验证访问日志的保留期与导出配置
+func (c *Config) validateAccessLog() error {
+	al := &c.AccessLog
+	if al.RetentionDays < 0 || al.HourlyRetentionDays < 0 || al.DailyRetentionDays < 0 {
+		return fmt.Errorf("retention days must not be negative")
+	}
+	// 天汇总由小时汇总计算，小时汇总至少要保留到前一天的天汇总完成
+	if al.HourlyRetentionDays == 1 {
+		return fmt.Errorf("hourly_retention_days must be 0 or at least 2")
+	}
+
+	sink := &al.Sink
+	switch sink.Format {
+	case "", AccessLogFormatJSON, AccessLogFormatS3:
+	default:
+		return fmt.Errorf("invalid sink format: %s (must be one of: json, s3)", sink.Format)
+	}
+	if sink.RotateInterval < 0 || sink.MaxFiles < 0 {
+		return fmt.Errorf("sink rotate_interval and max_files must not be negative")
+	}
+	if err := sink.ParseSizes(); err != nil {
+		return fmt.Errorf("invalid sink config: %w", err)
+	}
+	if sink.Enabled && sink.Bucket != "" {
+		for _, b := range c.Buckets {
+			if b.Name == sink.Bucket {
+				if !b.Virtual {
+					return fmt.Errorf("sink bucket %s must be a virtual bucket", sink.Bucket)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("sink bucket %s is not configured", sink.Bucket)
+	}
+	return nil
+}
+
+// validate 验证追踪配置
+// Options 转换为日志包的配置
+func (l LoggingConfig) Options() logging.Options {
+	return logging.Options{
+		Format: l.Format,
+		Level:  l.Level,
+		Levels: l.Levels,
+	}
+}
+
+func (t *TracingConfig) validate() error {
+	switch t.Exporter {
+	case "", TracingExporterOTLP, TracingExporterStdout:
+	default:
+		return fmt.Errorf("invalid exporter: %s (must be one of: otlp, stdout)", t.Exporter)
+	}
+	switch t.Protocol {
+	case "", TracingProtocolGRPC, TracingProtocolHTTP:
+	default:
+		return fmt.Errorf("invalid protocol: %s (must be one of: grpc, http)", t.Protocol)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
 // ParseMaxSize 解析最大容量字符串为字节
 func (bc *BucketConfig) ParseMaxSize() error {
 	if bc.MaxSize == "" {
@@ -200,27 +962,100 @@ func (bc *BucketConfig) ParseMaxSize() error {
 		return nil
 	}
 
+	size, err := parseSize(bc.MaxSize)
+	if err != nil {
+		return err
+	}
+	bc.MaxSizeBytes = size
+	return nil
+}
+
+// parseSize 解析带单位的大小字符串（B/KB/MB/GB/TB）为字节
+func parseSize(value string) (int64, error) {
 	var size int64
 	var unit string
-	_, err := fmt.Sscanf(bc.MaxSize, "%d%s", &size, &unit)
+	_, err := fmt.Sscanf(value, "%d%s", &size, &unit)
 	if err != nil {
-		return fmt.Errorf("invalid size format: %s", bc.MaxSize)
+		return 0, fmt.Errorf("invalid size format: %s", value)
 	}
 
 	switch unit {
 	case "B", "b":
-		bc.MaxSizeBytes = size
+		return size, nil
 	case "KB", "kb", "K", "k":
-		bc.MaxSizeBytes = size * 1024
+		return size * 1024, nil
 	case "MB", "mb", "M", "m":
-		bc.MaxSizeBytes = size * 1024 * 1024
+		return size * 1024 * 1024, nil
 	case "GB", "gb", "G", "g":
-		bc.MaxSizeBytes = size * 1024 * 1024 * 1024
+		return size * 1024 * 1024 * 1024, nil
 	case "TB", "tb", "T", "t":
-		bc.MaxSizeBytes = size * 1024 * 1024 * 1024 * 1024
+		return size * 1024 * 1024 * 1024 * 1024, nil
 	default:
-		return fmt.Errorf("unsupported unit: %s", unit)
+		return 0, fmt.Errorf("unsupported unit: %s", unit)
 	}
+}
 
+// validate 校验健康检查配置，空字段表示沿用默认值
+func (c HealthCheckConfig) validate() error {
+	switch c.Strategy {
+	case "", "simple", "detailed":
+	default:
+		return fmt.Errorf("invalid strategy: %s (must be one of: simple, detailed)", c.Strategy)
+	}
+	if c.Timeout < 0 || c.Retries < 0 || c.LatencySLO < 0 || c.Rise < 0 || c.Fall < 0 {
+		return fmt.Errorf("timeout, retries, latency_slo, rise and fall must not be negative")
+	}
+	return nil
+}
+
+// validate 校验连接池配置，空字段表示使用默认值
+func (c TransportConfig) validate() error {
+	if c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 || c.IdleConnTimeout < 0 ||
+		c.DialTimeout < 0 || c.TLSHandshakeTimeout < 0 || c.ResponseHeaderTimeout < 0 {
+		return fmt.Errorf("connection limits and timeouts must not be negative")
+	}
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("invalid proxy_url scheme: %s (must be one of: http, https, socks5)", u.Scheme)
+		}
+	}
+	switch c.TLS.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		return fmt.Errorf("invalid tls.min_version: %s (must be one of: 1.2, 1.3)", c.TLS.MinVersion)
+	}
+	return nil
+}
+
+// ValidateFor 校验对账配置，adopt 模式要求 adopt_into 是配置中的虚拟存储桶
+func (c ReconcileConfig) ValidateFor(cfg *Config) error {
+	switch c.Mode {
+	case "", ReconcileModeReport, ReconcileModeDeleteOrphans, ReconcileModePurgeDangling:
+	case ReconcileModeAdopt:
+		if c.AdoptInto == "" {
+			return fmt.Errorf("adopt_into is required in adopt mode")
+		}
+		found := false
+		for _, b := range cfg.Buckets {
+			if b.Name == c.AdoptInto && b.Virtual {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("adopt_into %s is not a virtual bucket", c.AdoptInto)
+		}
+	default:
+		return fmt.Errorf("invalid mode: %s (must be one of: report, adopt, delete-orphans, purge-dangling)", c.Mode)
+	}
+	if c.Interval < 0 || c.MinAge < 0 || c.PageInterval < 0 {
+		return fmt.Errorf("interval, min_age and page_interval must not be negative")
+	}
 	return nil
 }
@@ -2,16 +2,31 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/fsnotify/fsnotify"
 	"gopkg.in/yaml.v3"
 )
 
+var logger = logging.Logger(logging.SubsystemConfig)
+
+// 配置变更来源
+const (
+	ChangeSourceFile = "file" // 配置文件被外部修改后热加载
+	ChangeSourceAPI  = "api"  // 通过管理API更新
+)
+
+// ErrConfigChanged 配置在读取之后已被修改
+var ErrConfigChanged = errors.New("configuration was modified concurrently, reload and retry")
+
+// TransitionFunc 配置变更监听函数，可同时拿到变更前后的配置与变更来源
+type TransitionFunc func(oldConfig, newConfig *Config, source string)
+
 // Manager 配置管理器，支持热更新
 type Manager struct {
 	configFile    string
@@ -19,6 +34,9 @@ type Manager struct {
 	mutex         sync.RWMutex
 	watcher       *fsnotify.Watcher
 	callbacks     []func(*Config)
+	transitions   []TransitionFunc
+	revisions     *RevisionStore
+	checksum      string // 当前生效配置内容的校验和，用于忽略自身写入触发的重载
 	stopChan      chan struct{}
 	lastModTime   time.Time
 	pollingTicker *time.Ticker
@@ -27,7 +45,11 @@ type Manager struct {
 // NewManager 创建新的配置管理器
 func NewManager(configFile string) (*Manager, error) {
 	// 初始加载配置
-	cfg, err := Load(configFile)
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	cfg, err := Parse(data)
 	if err != nil {
 		return nil, err
 	}
@@ -44,6 +66,16 @@ func NewManager(configFile string) (*Manager, error) {
 		callbacks:   make([]func(*Config), 0),
 		stopChan:    make(chan struct{}),
 		lastModTime: fileInfo.ModTime(),
+		checksum:    checksumOf(data),
+	}
+
+	// 修订历史保存在配置文件旁边的 <config>.revisions 目录，不可用时仅禁用历史功能
+	revisions, err := NewRevisionStore(configFile+".revisions", DefaultMaxRevisions)
+	if err != nil {
+		logger.Warn("Config revision history disabled", "error", err)
+	} else {
+		manager.revisions = revisions
+		manager.recordRevision(data, ChangeSourceStartup, 0)
 	}
 
 	// 同时启用fsnotify和轮询监听
@@ -60,20 +92,20 @@ func (m *Manager) initWatching() {
 	if err == nil {
 		if err := watcher.Add(m.configFile); err == nil {
 			m.watcher = watcher
-			log.Println("fsnotify watcher enabled for config file")
+			logger.Info("Config file watcher enabled", "method", "fsnotify", "path", m.configFile)
 			go m.watchConfig()
 		} else {
-			log.Printf("Failed to add file to fsnotify watcher: %v", err)
+			logger.Warn("Failed to add config file to fsnotify watcher", "path", m.configFile, "error", err)
 			watcher.Close()
 		}
 	} else {
-		log.Printf("Failed to create fsnotify watcher: %v", err)
+		logger.Warn("Failed to create fsnotify watcher", "error", err)
 	}
 
 	// 同时启用轮询模式（作为备用和补充）
 	// 在Docker挂载等场景下，轮询更可靠
 	m.pollingTicker = time.NewTicker(3 * time.Second)
-	log.Println("Config file polling enabled (3s interval)")
+	logger.Info("Config file watcher enabled", "method", "polling", "path", m.configFile, "interval", "3s")
 	go m.pollConfig()
 }
 
@@ -84,13 +116,13 @@ func (m *Manager) pollConfig() {
 		case <-m.pollingTicker.C:
 			fileInfo, err := os.Stat(m.configFile)
 			if err != nil {
-				log.Printf("Failed to stat config file during polling: %v", err)
+				logger.Warn("Failed to stat config file during polling", "path", m.configFile, "error", err)
 				continue
 			}
 
 			// 检查文件修改时间
 			if fileInfo.ModTime().After(m.lastModTime) {
-				log.Printf("Config file %s modified (detected by polling), reloading...", m.configFile)
+				logger.Info("Config file modified, reloading", "path", m.configFile, "detected_by", "polling")
 				m.lastModTime = fileInfo.ModTime()
 				m.reloadConfig()
 			}
@@ -106,9 +138,8 @@ func (m *Manager) GetConfig() *Config {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	// 返回配置的副本以避免并发修改
-	configCopy := *m.config
-	return &configCopy
+	// 返回配置的深拷贝以避免并发修改（存储桶列表也会被复制）
+	return m.config.Clone()
 }
 
 // OnConfigChange 注册配置变化回调
@@ -118,6 +149,27 @@ func (m *Manager) OnConfigChange(callback func(*Config)) {
 	m.callbacks = append(m.callbacks, callback)
 }
 
+// OnConfigTransition 注册配置变更监听（用于审计等需要前后对比的场景）
+func (m *Manager) OnConfigTransition(fn TransitionFunc) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transitions = append(m.transitions, fn)
+}
+
+// notifyTransition 同步调用配置变更监听，调用方不能持有锁
+func (m *Manager) notifyTransition(transitions []TransitionFunc, oldConfig, newConfig *Config, source string) {
+	for _, fn := range transitions {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("Config transition listener panic", "panic", r)
+				}
+			}()
+			fn(oldConfig, newConfig, source)
+		}()
+	}
+}
+
 // watchConfig 监听配置文件变化（fsnotify模式）
 func (m *Manager) watchConfig() {
 	for {
@@ -130,7 +182,7 @@ func (m *Manager) watchConfig() {
 			// 只处理修改和重命名事件
 			if event.Op&fsnotify.Write == fsnotify.Write ||
 				event.Op&fsnotify.Rename == fsnotify.Rename {
-				log.Printf("Config file %s modified (detected by fsnotify), reloading...", m.configFile)
+				logger.Info("Config file modified, reloading", "path", m.configFile, "detected_by", "fsnotify")
 
 				// 更新最后修改时间以避免轮询重复触发
 				if fileInfo, err := os.Stat(m.configFile); err == nil {
@@ -144,7 +196,7 @@ func (m *Manager) watchConfig() {
 			if !ok {
 				return
 			}
-			log.Printf("Config watcher error: %v", err)
+			logger.Warn("Config watcher error", "error", err)
 
 		case <-m.stopChan:
 			return
@@ -158,21 +210,36 @@ func (m *Manager) reloadConfig() {
 	time.Sleep(100 * time.Millisecond)
 
 	// 加载新配置
-	newConfig, err := Load(m.configFile)
+	data, err := os.ReadFile(m.configFile)
 	if err != nil {
-		log.Printf("Failed to reload config: %v", err)
+		logger.Error("Failed to reload config", "path", m.configFile, "error", err)
+		return
+	}
+	newConfig, err := Parse(data)
+	if err != nil {
+		logger.Error("Failed to reload config", "path", m.configFile, "error", err)
 		return
 	}
 
-	// 更新配置
+	// 更新配置（内容未变化时跳过，例如 UpdateConfig 自身写文件触发的事件）
 	m.mutex.Lock()
+	checksum := checksumOf(data)
+	if checksum == m.checksum {
+		m.mutex.Unlock()
+		return
+	}
+	m.checksum = checksum
+	m.recordRevision(data, ChangeSourceFile, 0)
 	oldConfig := m.config
 	m.config = newConfig
 	callbacks := make([]func(*Config), len(m.callbacks))
 	copy(callbacks, m.callbacks)
+	transitions := make([]TransitionFunc, len(m.transitions))
+	copy(transitions, m.transitions)
 	m.mutex.Unlock()
 
-	log.Printf("Configuration reloaded successfully")
+	logger.Info("Configuration reloaded", "source", ChangeSourceFile)
+	m.notifyTransition(transitions, oldConfig, newConfig, ChangeSourceFile)
 
 	// 异步调用回调函数
 	go func() {
@@ -180,7 +247,7 @@ func (m *Manager) reloadConfig() {
 			func() {
 				defer func() {
 					if r := recover(); r != nil {
-						log.Printf("Config change callback panic: %v", r)
+						logger.Error("Config change callback panic", "panic", r)
 					}
 				}()
 				callback(newConfig)
@@ -196,83 +263,162 @@ func (m *Manager) reloadConfig() {
 func (m *Manager) logConfigChanges(oldConfig, newConfig *Config) {
 	// 检查服务器端口变化
 	if oldConfig.Server.Port != newConfig.Server.Port {
-		log.Printf("Server port changed: %d -> %d (restart required)",
-			oldConfig.Server.Port, newConfig.Server.Port)
+		logger.Warn("Server port changed, restart required",
+			"old", oldConfig.Server.Port, "new", newConfig.Server.Port)
 	}
 
 	// 检查数据库配置变化
 	if oldConfig.Database.DSN != newConfig.Database.DSN {
-		log.Printf("Database DSN changed (restart required)")
+		logger.Warn("Database DSN changed, restart required")
+	}
+	if oldConfig.Database.MetadataStore != newConfig.Database.MetadataStore || oldConfig.Database.MetadataPath != newConfig.Database.MetadataPath {
+		logger.Warn("Metadata store changed, restart required")
 	}
 
 	// 检查存储桶数量变化
 	if len(oldConfig.Buckets) != len(newConfig.Buckets) {
-		log.Printf("Bucket count changed: %d -> %d",
-			len(oldConfig.Buckets), len(newConfig.Buckets))
+		logger.Info("Bucket count changed",
+			"old", len(oldConfig.Buckets), "new", len(newConfig.Buckets))
 	}
 
 	// 检查负载均衡策略变化
 	if oldConfig.Balancer.Strategy != newConfig.Balancer.Strategy {
-		log.Printf("Load balancer strategy changed: %s -> %s",
-			oldConfig.Balancer.Strategy, newConfig.Balancer.Strategy)
+		logger.Info("Load balancer strategy changed",
+			"old", oldConfig.Balancer.Strategy, "new", newConfig.Balancer.Strategy)
 	}
 
 	// 检查代理模式变化
 	if oldConfig.S3API.ProxyMode != newConfig.S3API.ProxyMode {
-		log.Printf("S3 API proxy mode changed: %t -> %t",
-			oldConfig.S3API.ProxyMode, newConfig.S3API.ProxyMode)
+		logger.Info("S3 API proxy mode changed",
+			"old", oldConfig.S3API.ProxyMode, "new", newConfig.S3API.ProxyMode)
 	}
 
 	// 检查指标配置变化
 	if oldConfig.Metrics.Enabled != newConfig.Metrics.Enabled {
-		log.Printf("Metrics enabled changed: %t -> %t",
-			oldConfig.Metrics.Enabled, newConfig.Metrics.Enabled)
+		logger.Info("Metrics enabled changed",
+			"old", oldConfig.Metrics.Enabled, "new", newConfig.Metrics.Enabled)
 	}
 }
 
+// Snapshot 返回当前配置的深拷贝及其校验和，与 UpdateConfigIfUnchanged 配合完成读-改-写
+func (m *Manager) Snapshot() (*Config, string) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.config.Clone(), m.checksum
+}
+
 // UpdateConfig 通过 API 更新配置文件
 // 返回错误如果验证失败或写入失败
 func (m *Manager) UpdateConfig(newConfig *Config) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	return m.updateLocked(newConfig)
+}
+
+// UpdateConfigIfUnchanged 仅当生效配置仍是 Snapshot 返回的版本时才更新
+// 期间配置已被其他请求或文件热加载修改时返回 ErrConfigChanged，调用方应重新读取后再修改
+func (m *Manager) UpdateConfigIfUnchanged(newConfig *Config, checksum string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if checksum != m.checksum {
+		return ErrConfigChanged
+	}
+	return m.updateLocked(newConfig)
+}
+
+// updateLocked 验证并应用 API 提交的配置，调用方需持有写锁
+func (m *Manager) updateLocked(newConfig *Config) error {
 	// 1. 验证新配置
 	if err := m.validateConfig(newConfig); err != nil {
 		return err
 	}
 
-	// 2. 备份当前配置文件
-	if err := m.backupConfigFile(); err != nil {
-		log.Printf("Failed to backup config file: %v", err)
-		// 继续执行，备份失败不应阻止更新
+	// 2. 编码新配置
+	data, err := encodeConfig(newConfig)
+	if err != nil {
+		return err
 	}
 
-	// 3. 将新配置写入文件
-	if err := m.writeConfigFile(newConfig); err != nil {
+	if _, err := m.applyLocked(newConfig, data, ChangeSourceAPI, 0); err != nil {
 		return err
 	}
 
+	logger.Info("Configuration updated", "source", ChangeSourceAPI)
+	return nil
+}
+
+// Rollback 回滚到指定修订，回滚本身会作为一个新修订记录
+func (m *Manager) Rollback(id int) (*Revision, *Config, error) {
+	if m.revisions == nil {
+		return nil, nil, fmt.Errorf("config revisions are not available")
+	}
+
+	_, data, err := m.revisions.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target, err := Parse(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("revision %d is not a valid config: %w", id, err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.validateConfig(target); err != nil {
+		return nil, nil, fmt.Errorf("revision %d failed validation: %w", id, err)
+	}
+
+	rev, err := m.applyLocked(target, data, ChangeSourceRollback, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Info("Configuration rolled back", "revision", id)
+	return rev, target, nil
+}
+
+// applyLocked 写入配置文件、记录修订并通知监听者，调用方需持有写锁
+func (m *Manager) applyLocked(newConfig *Config, data []byte, source string, rollbackFrom int) (*Revision, error) {
+	// 1. 当前文件如果在被监听到之前就被外部修改过，先把它记录下来，保证回滚有据可依
+	m.recordCurrentFileLocked()
+
+	// 2. 将新配置写入文件
+	if err := m.writeConfigFile(data); err != nil {
+		return nil, err
+	}
+
+	// 3. 记录修订（失败不影响已经写入的配置）
+	rev := m.recordRevision(data, source, rollbackFrom)
+
 	// 4. 更新内存中的配置
 	oldConfig := m.config
 	m.config = newConfig
+	m.checksum = checksumOf(data)
 
 	// 5. 更新最后修改时间，避免文件监听重复触发
 	if fileInfo, err := os.Stat(m.configFile); err == nil {
 		m.lastModTime = fileInfo.ModTime()
 	}
 
-	log.Printf("Configuration updated successfully via API")
-
 	// 6. 触发配置变更回调（在锁外执行）
 	callbacks := make([]func(*Config), len(m.callbacks))
 	copy(callbacks, m.callbacks)
+	transitions := make([]TransitionFunc, len(m.transitions))
+	copy(transitions, m.transitions)
+
+	go m.notifyTransition(transitions, oldConfig, newConfig, source)
 
 	go func() {
 		for _, callback := range callbacks {
 			func() {
 				defer func() {
 					if r := recover(); r != nil {
-						log.Printf("Config change callback panic: %v", r)
+						logger.Error("Config change callback panic", "panic", r)
 					}
 				}()
 				callback(newConfig)
@@ -283,109 +429,104 @@ func (m *Manager) UpdateConfig(newConfig *Config) error {
 	// 7. 记录配置变更
 	m.logConfigChanges(oldConfig, newConfig)
 
-	return nil
+	return rev, nil
 }
 
-// validateConfig 验证配置的有效性
-func (m *Manager) validateConfig(cfg *Config) error {
-	// 基本验证
-	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", cfg.Server.Port)
+// ListRevisions 列出配置修订（最新的在前）
+func (m *Manager) ListRevisions() []Revision {
+	if m.revisions == nil {
+		return []Revision{}
 	}
+	return m.revisions.List()
+}
 
-	if len(cfg.Buckets) == 0 {
-		return fmt.Errorf("at least one bucket is required")
+// GetRevision 获取指定修订及其解析后的配置
+func (m *Manager) GetRevision(id int) (*Revision, *Config, error) {
+	if m.revisions == nil {
+		return nil, nil, ErrRevisionNotFound
 	}
 
-	// 验证存储桶配置
-	for i, bucket := range cfg.Buckets {
-		if bucket.Name == "" {
-			return fmt.Errorf("bucket[%d]: name is required", i)
-		}
-
-		// 虚拟存储桶不需要端点和凭据
-		if !bucket.Virtual {
-			if bucket.Endpoint == "" {
-				return fmt.Errorf("bucket[%d] (%s): endpoint is required for non-virtual bucket", i, bucket.Name)
-			}
-			if bucket.AccessKeyID == "" {
-				return fmt.Errorf("bucket[%d] (%s): access_key_id is required for non-virtual bucket", i, bucket.Name)
-			}
-			if bucket.SecretAccessKey == "" {
-				return fmt.Errorf("bucket[%d] (%s): secret_access_key is required for non-virtual bucket", i, bucket.Name)
-			}
-		}
-
-		// 解析并验证容量大小
-		if err := cfg.Buckets[i].ParseMaxSize(); err != nil {
-			return fmt.Errorf("bucket[%d] (%s): invalid max_size: %w", i, bucket.Name, err)
-		}
+	rev, data, err := m.revisions.Get(id)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// 验证负载均衡策略
-	validStrategies := map[string]bool{
-		"round-robin": true,
-		"least-space": true,
-		"weighted":    true,
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("revision %d is not a valid config: %w", id, err)
 	}
-	if !validStrategies[cfg.Balancer.Strategy] {
-		return fmt.Errorf("invalid balancer strategy: %s (must be one of: round-robin, least-space, weighted)", cfg.Balancer.Strategy)
+	return rev, cfg, nil
+}
+
+// PreviousRevision 返回指定修订之前的修订ID，不存在时返回0
+func (m *Manager) PreviousRevision(id int) int {
+	if m.revisions == nil {
+		return 0
 	}
+	return m.revisions.Previous(id)
+}
 
-	// 验证数据库配置
-	if cfg.Database.Type == "" {
-		return fmt.Errorf("database type is required")
+// recordRevision 记录一个修订，失败时只打印日志
+func (m *Manager) recordRevision(data []byte, source string, rollbackFrom int) *Revision {
+	if m.revisions == nil {
+		return nil
 	}
-	validDBTypes := map[string]bool{
-		"sqlite":   true,
-		"mysql":    true,
-		"postgres": true,
+
+	rev, err := m.revisions.Record(data, source, rollbackFrom)
+	if err != nil {
+		logger.Error("Failed to record config revision", "source", source, "error", err)
+		return nil
 	}
-	if !validDBTypes[cfg.Database.Type] {
-		return fmt.Errorf("invalid database type: %s (must be one of: sqlite, mysql, postgres)", cfg.Database.Type)
+	if rev != nil {
+		logger.Info("Config revision recorded", "revision", rev.ID, "source", source)
 	}
-
-	return nil
+	return rev
 }
 
-// backupConfigFile 备份当前配置文件
-func (m *Manager) backupConfigFile() error {
-	backupPath := m.configFile + ".backup." + time.Now().Format("20060102-150405")
-
-	sourceData, err := os.ReadFile(m.configFile)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+// recordCurrentFileLocked 将磁盘上的当前配置文件记录为文件来源的修订（内容未变化时不记录）
+func (m *Manager) recordCurrentFileLocked() {
+	if m.revisions == nil {
+		return
 	}
 
-	if err := os.WriteFile(backupPath, sourceData, 0644); err != nil {
-		return fmt.Errorf("failed to write backup file: %w", err)
+	data, err := os.ReadFile(m.configFile)
+	if err != nil {
+		logger.Error("Failed to read config file for revision history", "path", m.configFile, "error", err)
+		return
 	}
+	m.recordRevision(data, ChangeSourceFile, 0)
+}
 
-	log.Printf("Config file backed up to: %s", backupPath)
-	return nil
+// validateConfig 验证配置的有效性
+func (m *Manager) validateConfig(cfg *Config) error {
+	return cfg.Validate()
 }
 
-// writeConfigFile 将配置写入 YAML 文件
-func (m *Manager) writeConfigFile(cfg *Config) error {
-	// 先编码到缓冲区，避免在写入过程中损坏原文件
+// encodeConfig 将配置编码为 YAML
+func encodeConfig(cfg *Config) ([]byte, error) {
 	var buf bytes.Buffer
 	encoder := yaml.NewEncoder(&buf)
 	encoder.SetIndent(2)
 
 	if err := encoder.Encode(cfg); err != nil {
-		return fmt.Errorf("failed to encode config: %w", err)
+		return nil, fmt.Errorf("failed to encode config: %w", err)
 	}
 
 	if err := encoder.Close(); err != nil {
-		return fmt.Errorf("failed to close encoder: %w", err)
+		return nil, fmt.Errorf("failed to close encoder: %w", err)
 	}
 
+	return buf.Bytes(), nil
+}
+
+// writeConfigFile 将已编码的配置写入 YAML 文件
+func (m *Manager) writeConfigFile(data []byte) error {
 	file, err := os.OpenFile(m.configFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open config file: %w", err)
 	}
 
-	if _, err := file.Write(buf.Bytes()); err != nil {
+	if _, err := file.Write(data); err != nil {
 		file.Close()
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
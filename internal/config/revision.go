@@ -0,0 +1,228 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 修订来源（文件与API来源见 ChangeSourceFile / ChangeSourceAPI）
+const (
+	ChangeSourceStartup  = "startup"  // 启动时加载的配置
+	ChangeSourceRollback = "rollback" // 回滚到历史修订
+)
+
+// DefaultMaxRevisions 默认保留的修订数量
+const DefaultMaxRevisions = 100
+
+// revisionIndexFile 修订索引文件名
+const revisionIndexFile = "index.json"
+
+// 修订快照包含完整配置（后端密钥与管理令牌），目录与文件只允许运行用户访问
+const (
+	revisionDirMode  os.FileMode = 0700
+	revisionFileMode os.FileMode = 0600
+)
+
+// ErrRevisionNotFound 修订不存在
+var ErrRevisionNotFound = errors.New("config revision not found")
+
+// Revision 配置修订元数据
+type Revision struct {
+	ID           int       `json:"id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Source       string    `json:"source"`
+	Checksum     string    `json:"checksum"`
+	RollbackFrom int       `json:"rollback_from,omitempty"` // 回滚修订对应的源修订ID
+}
+
+// RevisionStore 基于文件的配置修订存储
+// 每个修订保存为 <dir>/<id>.yaml，元数据保存在 <dir>/index.json
+type RevisionStore struct {
+	dir       string
+	maxKeep   int
+	mutex     sync.Mutex
+	revisions []Revision
+}
+
+// NewRevisionStore 打开（或创建）修订目录
+func NewRevisionStore(dir string, maxKeep int) (*RevisionStore, error) {
+	if maxKeep <= 0 {
+		maxKeep = DefaultMaxRevisions
+	}
+	if err := os.MkdirAll(dir, revisionDirMode); err != nil {
+		return nil, fmt.Errorf("failed to create revision directory: %w", err)
+	}
+	// 旧版本以 0755/0644 创建的目录与文件在打开时收紧权限
+	if err := os.Chmod(dir, revisionDirMode); err != nil {
+		return nil, fmt.Errorf("failed to restrict revision directory permissions: %w", err)
+	}
+
+	store := &RevisionStore{
+		dir:     dir,
+		maxKeep: maxKeep,
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, revisionIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read revision index: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.revisions); err != nil {
+			return nil, fmt.Errorf("failed to parse revision index: %w", err)
+		}
+		sort.Slice(store.revisions, func(i, j int) bool {
+			return store.revisions[i].ID < store.revisions[j].ID
+		})
+	}
+	for _, path := range append(store.revisionPaths(), filepath.Join(dir, revisionIndexFile)) {
+		if err := os.Chmod(path, revisionFileMode); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to restrict revision file permissions: %w", err)
+		}
+	}
+
+	return store, nil
+}
+
+// Record 保存一个新修订；内容与最新修订相同时不重复记录，返回 nil
+func (s *RevisionStore) Record(data []byte, source string, rollbackFrom int) (*Revision, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	checksum := checksumOf(data)
+	if n := len(s.revisions); n > 0 && s.revisions[n-1].Checksum == checksum && source != ChangeSourceRollback {
+		return nil, nil
+	}
+
+	nextID := 1
+	if n := len(s.revisions); n > 0 {
+		nextID = s.revisions[n-1].ID + 1
+	}
+
+	rev := Revision{
+		ID:           nextID,
+		Timestamp:    time.Now(),
+		Source:       source,
+		Checksum:     checksum,
+		RollbackFrom: rollbackFrom,
+	}
+
+	if err := writeFileAtomic(s.revisionPath(rev.ID), data); err != nil {
+		return nil, fmt.Errorf("failed to write revision %d: %w", rev.ID, err)
+	}
+
+	s.revisions = append(s.revisions, rev)
+	s.prune()
+
+	if err := s.saveIndex(); err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// List 返回所有修订（按ID倒序，最新的在前）
+func (s *RevisionStore) List() []Revision {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]Revision, len(s.revisions))
+	for i, rev := range s.revisions {
+		result[len(s.revisions)-1-i] = rev
+	}
+	return result
+}
+
+// Get 返回指定修订的元数据与原始内容
+func (s *RevisionStore) Get(id int) (*Revision, []byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, rev := range s.revisions {
+		if rev.ID == id {
+			data, err := os.ReadFile(s.revisionPath(id))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read revision %d: %w", id, err)
+			}
+			revCopy := rev
+			return &revCopy, data, nil
+		}
+	}
+	return nil, nil, ErrRevisionNotFound
+}
+
+// Previous 返回指定修订之前的一个修订ID，不存在时返回0
+func (s *RevisionStore) Previous(id int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	prev := 0
+	for _, rev := range s.revisions {
+		if rev.ID >= id {
+			break
+		}
+		prev = rev.ID
+	}
+	return prev
+}
+
+// prune 删除超出保留数量的最旧修订，调用方需持有锁
+func (s *RevisionStore) prune() {
+	for len(s.revisions) > s.maxKeep {
+		oldest := s.revisions[0]
+		if err := os.Remove(s.revisionPath(oldest.ID)); err != nil && !os.IsNotExist(err) {
+			// 删除失败不影响新修订，下次修剪时索引里已经没有它
+			logger.Warn("Failed to remove config revision", "revision", oldest.ID, "error", err)
+		}
+		s.revisions = s.revisions[1:]
+	}
+}
+
+// saveIndex 写入修订索引，调用方需持有锁
+func (s *RevisionStore) saveIndex() error {
+	data, err := json.MarshalIndent(s.revisions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode revision index: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, revisionIndexFile), data); err != nil {
+		return fmt.Errorf("failed to write revision index: %w", err)
+	}
+	return nil
+}
+
+func (s *RevisionStore) revisionPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d.yaml", id))
+}
+
+func (s *RevisionStore) revisionPaths() []string {
+	paths := make([]string, 0, len(s.revisions))
+	for _, rev := range s.revisions {
+		paths = append(paths, s.revisionPath(rev.ID))
+	}
+	return paths
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免中途失败留下半截文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	// 残留的临时文件可能是旧权限，WriteFile 不会修改已有文件的权限，先删除
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, revisionFileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
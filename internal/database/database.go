@@ -3,34 +3,56 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/DullJZ/s3-balance/internal/storage"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormlogger "gorm.io/gorm/logger"
 	_ "modernc.org/sqlite"
 )
 
+var logger = logging.Logger(logging.SubsystemStorage)
+
 // DB 全局数据库连接
 var DB *gorm.DB
 
 // Initialize 初始化数据库连接
 func Initialize(cfg *config.DatabaseConfig) error {
 	var err error
+	DB, err = Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	// 自动迁移
+	if cfg.AutoMigrate {
+		if err := AutoMigrate(); err != nil {
+			return fmt.Errorf("failed to auto migrate: %w", err)
+		}
+	}
+
+	logger.Info("Connected to database", "type", cfg.Type)
+	return nil
+}
+
+// Open 按配置打开一个新的数据库连接（不设置全局连接，不迁移）
+func Open(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	var db *gorm.DB
+	var err error
 
 	// 设置日志级别
 	logLevel := getLogLevel(cfg.LogLevel)
 
 	// GORM配置
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger: newGormLogger(logLevel),
 		NowFunc: func() time.Time {
 			return time.Now().Local()
 		},
@@ -40,23 +62,28 @@ func Initialize(cfg *config.DatabaseConfig) error {
 	// 根据数据库类型创建连接
 	switch cfg.Type {
 	case "sqlite":
-		DB, err = connectSQLite(cfg.DSN, gormConfig)
+		db, err = connectSQLite(cfg.DSN, gormConfig)
 	case "mysql":
-		DB, err = connectMySQL(cfg.DSN, gormConfig)
+		db, err = connectMySQL(cfg.DSN, gormConfig)
 	case "postgres", "postgresql":
-		DB, err = connectPostgreSQL(cfg.DSN, gormConfig)
+		db, err = connectPostgreSQL(cfg.DSN, gormConfig)
 	default:
-		return fmt.Errorf("unsupported database type: %s", cfg.Type)
+		return nil, fmt.Errorf("unsupported database type: %s", cfg.Type)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// 为每次数据库调用创建 span，挂在语句 Context 中的请求 span 下
+	if err := db.Use(&tracingPlugin{system: cfg.Type}); err != nil {
+		return nil, fmt.Errorf("failed to register database tracing: %w", err)
 	}
 
 	// 获取底层SQL数据库连接
-	sqlDB, err := DB.DB()
+	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to get sql.DB: %w", err)
+		return nil, fmt.Errorf("failed to get sql.DB: %w", err)
 	}
 
 	// 设置连接池参数
@@ -66,18 +93,10 @@ func Initialize(cfg *config.DatabaseConfig) error {
 
 	// 测试连接
 	if err := sqlDB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// 自动迁移
-	if cfg.AutoMigrate {
-		if err := AutoMigrate(); err != nil {
-			return fmt.Errorf("failed to auto migrate: %w", err)
-		}
-	}
-
-	log.Printf("Successfully connected to %s database", cfg.Type)
-	return nil
+	return db, nil
 }
 
 // connectSQLite 连接SQLite数据库（使用modernc.org/sqlite，支持非CGO）
@@ -161,39 +180,57 @@ func containsHelper(s, substr string) bool {
 }
 
 // getLogLevel 获取GORM日志级别
-func getLogLevel(level string) logger.LogLevel {
+func getLogLevel(level string) gormlogger.LogLevel {
 	switch level {
 	case "silent":
-		return logger.Silent
+		return gormlogger.Silent
 	case "error":
-		return logger.Error
+		return gormlogger.Error
 	case "warn", "warning":
-		return logger.Warn
+		return gormlogger.Warn
 	case "info":
-		return logger.Info
+		return gormlogger.Info
 	default:
-		return logger.Warn
+		return gormlogger.Warn
 	}
 }
 
-// AutoMigrate 自动迁移数据库表
-func AutoMigrate() error {
-	models := []interface{}{
+// Models 返回需要迁移的全部模型
+func Models() []interface{} {
+	return []interface{}{
 		&storage.Object{},
 		&storage.BucketStats{},
 		&storage.BucketMonthlyStats{},
 		&storage.UploadSession{},
 		&storage.AccessLog{},
+		&storage.AccessLogRollup{},
 		&storage.VirtualBucketMapping{},
+		&storage.APIToken{},
+		&storage.AuditLog{},
+		&storage.HealthEvent{},
+		&storage.UsageScanState{},
+		&storage.PendingDeletion{},
+		&storage.MetadataChange{},
 	}
+}
 
-	for _, model := range models {
-		if err := DB.AutoMigrate(model); err != nil {
+// AutoMigrate 自动迁移数据库表
+func AutoMigrate() error {
+	if err := Migrate(DB); err != nil {
+		return err
+	}
+
+	logger.Info("Database migration completed")
+	return nil
+}
+
+// Migrate 在指定连接上迁移全部表
+func Migrate(db *gorm.DB) error {
+	for _, model := range Models() {
+		if err := db.AutoMigrate(model); err != nil {
 			return fmt.Errorf("failed to migrate %T: %w", model, err)
 		}
 	}
-
-	log.Println("Database migration completed successfully")
 	return nil
 }
 
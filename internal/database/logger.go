@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold 超过该耗时的语句以 warn 级别记录
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger 把 GORM 的日志写入 storage 子系统的结构化日志，database.log_level 控制 GORM 自身输出哪些内容
+type gormLogger struct {
+	level gormlogger.LogLevel
+}
+
+func newGormLogger(level gormlogger.LogLevel) gormlogger.Interface {
+	return &gormLogger{level: level}
+}
+
+// LogMode 实现 gormlogger.Interface
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return &gormLogger{level: level}
+}
+
+// Info 实现 gormlogger.Interface
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		logger.InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Warn 实现 gormlogger.Interface
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		logger.WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Error 实现 gormlogger.Interface
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		logger.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Trace 记录失败与慢速的语句，log_level 为 info 时记录全部语句
+// 查询不到记录是正常结果，不记录为错误
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		logger.ErrorContext(ctx, "Database query failed", "sql", sql, "rows", rows, "elapsed_ms", elapsed.Milliseconds(), "error", err)
+	case elapsed > slowQueryThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		logger.WarnContext(ctx, "Slow database query", "sql", sql, "rows", rows, "elapsed_ms", elapsed.Milliseconds())
+	case l.level >= gormlogger.Info:
+		sql, rows := fc()
+		logger.InfoContext(ctx, "Database query", "sql", sql, "rows", rows, "elapsed_ms", elapsed.Milliseconds())
+	}
+}
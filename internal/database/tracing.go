@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/DullJZ/s3-balance/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanInstanceKey 当前语句的 span 在 gorm 实例中的存放键
+const spanInstanceKey = "tracing:span"
+
+// callbackRegister gorm 回调处理器的注册接口
+type callbackRegister interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// tracingPlugin 为每次数据库调用创建 span，记录 SQL 语句（不含参数值，避免泄露对象 key 与令牌等数据）与影响行数
+// 只在语句 Context 中已有 span 时创建，后台任务（变更轮询、批量写入等）没有上级 span，不单独产生链路
+type tracingPlugin struct {
+	system string // 数据库类型，写入 db.system 属性
+}
+
+// Name 实现 gorm.Plugin
+func (p *tracingPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize 在各类操作的回调前后注册 span 的开始与结束
+func (p *tracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		name      string
+		operation string
+		before    callbackRegister
+		after     callbackRegister
+	}{
+		{"create", "INSERT", cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")},
+		{"query", "SELECT", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")},
+		{"update", "UPDATE", cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")},
+		{"delete", "DELETE", cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")},
+		{"row", "ROW", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")},
+		{"raw", "RAW", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")},
+	}
+	for _, h := range hooks {
+		if err := h.before.Register("tracing:before_"+h.name, p.before(h.operation)); err != nil {
+			return fmt.Errorf("failed to register tracing callback for %s: %w", h.name, err)
+		}
+		if err := h.after.Register("tracing:after_"+h.name, p.after); err != nil {
+			return fmt.Errorf("failed to register tracing callback for %s: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+func (p *tracingPlugin) before(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		ctx, span := tracing.Tracer().Start(ctx, "db "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", p.system),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		if tx.Statement.Table != "" {
+			span.SetAttributes(attribute.String("db.collection.name", tx.Statement.Table))
+		}
+		tx.Statement.Context = ctx
+		tx.InstanceSet(spanInstanceKey, span)
+	}
+}
+
+func (p *tracingPlugin) after(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanInstanceKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	// 查询不到记录是正常结果，不标记为错误
+	err := tx.Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	tracing.End(span, err)
+}
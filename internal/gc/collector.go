@@ -0,0 +1,274 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"github.com/DullJZ/s3-balance/internal/metrics"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+var logger = logging.Logger(logging.SubsystemGC)
+
+// Collector 后端垃圾回收器
+// 重试待删除队列中的真实对象，直到后端确认删除；并中止没有进行中会话的过期分片上传
+type Collector struct {
+	manager   *bucket.Manager
+	storage   storage.MetadataStore
+	metrics   *metrics.Metrics
+	getConfig func() *config.Config
+	stopChan  chan struct{}
+}
+
+// NewCollector 创建垃圾回收器，getConfig 返回当前生效的配置（支持热更新）
+func NewCollector(manager *bucket.Manager, storageService storage.MetadataStore, metricsService *metrics.Metrics, getConfig func() *config.Config) *Collector {
+	return &Collector{
+		manager:   manager,
+		storage:   storageService,
+		metrics:   metricsService,
+		getConfig: getConfig,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start 启动后台回收任务
+func (c *Collector) Start(ctx context.Context) {
+	go func() {
+		var lastMultipartScan time.Time
+		for {
+			cfg := c.getConfig().GC
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.stopChan:
+				logger.Info("Garbage collector stopped")
+				return
+			case <-time.After(cfg.Interval):
+			}
+
+			cfg = c.getConfig().GC
+			if !cfg.IsEnabled() {
+				continue
+			}
+			c.ProcessPendingDeletions(ctx, cfg)
+			if time.Since(lastMultipartScan) >= cfg.MultipartInterval {
+				c.AbortStaleUploads(ctx, cfg.MultipartMaxAge)
+				c.ExpireUploadMappings(cfg.MultipartMaxAge)
+				lastMultipartScan = time.Now()
+			}
+		}
+	}()
+}
+
+// Stop 停止后台回收任务
+func (c *Collector) Stop() {
+	close(c.stopChan)
+}
+
+// ProcessPendingDeletions 处理一批已到期的待删除对象
+func (c *Collector) ProcessPendingDeletions(ctx context.Context, cfg config.GCConfig) {
+	items, err := c.storage.GetDuePendingDeletions(cfg.BatchSize)
+	if err != nil {
+		logger.Error("Failed to load pending deletions", "error", err)
+		return
+	}
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		c.processDeletion(ctx, item, cfg)
+	}
+
+	c.updatePendingMetrics()
+}
+
+// processDeletion 删除单个真实对象；失败时按指数退避安排重试
+func (c *Collector) processDeletion(ctx context.Context, item *storage.PendingDeletion, cfg config.GCConfig) {
+	// 入队后又被重新上传或复制引用的对象不能删除
+	referenced, err := c.storage.IsRealObjectReferenced(item.BucketName, item.Key)
+	if err != nil {
+		logger.Error("Failed to check references of pending deletion", "bucket", item.BucketName, "key", item.Key, "error", err)
+		return
+	}
+	if referenced {
+		logger.Info("Dropping pending deletion, object is referenced again", "bucket", item.BucketName, "key", item.Key)
+		c.complete(item)
+		return
+	}
+
+	b, ok := c.manager.GetBucket(item.BucketName)
+	if !ok || b.IsVirtual() {
+		// 存储桶已从配置中移除，保留记录等待其重新加入
+		c.deferDeletion(item, cfg, "bucket not configured")
+		return
+	}
+
+	_, err = b.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(item.BucketName),
+		Key:    aws.String(item.Key),
+	})
+	c.manager.RecordBackendOperation(item.BucketName, bucket.OperationTypeA)
+	b.ReportBackendResult(err)
+	if err != nil && !isNotFound(err) {
+		logger.Warn("Failed to delete real object", "bucket", item.BucketName, "key", item.Key, "attempt", item.Attempts+1, "error", err)
+		if c.metrics != nil {
+			c.metrics.RecordGCDeletion(item.BucketName, "failed")
+		}
+		c.deferDeletion(item, cfg, err.Error())
+		return
+	}
+
+	if c.metrics != nil {
+		c.metrics.RecordGCDeletion(item.BucketName, "deleted")
+	}
+	c.complete(item)
+}
+
+func (c *Collector) complete(item *storage.PendingDeletion) {
+	if err := c.storage.CompletePendingDeletion(item.ID); err != nil {
+		logger.Error("Failed to remove pending deletion", "id", item.ID, "error", err)
+	}
+}
+
+func (c *Collector) deferDeletion(item *storage.PendingDeletion, cfg config.GCConfig, reason string) {
+	next := time.Now().Add(RetryDelay(item.Attempts+1, cfg.RetryBaseDelay, cfg.RetryMaxDelay))
+	if err := c.storage.DeferPendingDeletion(item.ID, next, reason); err != nil {
+		logger.Error("Failed to reschedule pending deletion", "id", item.ID, "error", err)
+	}
+}
+
+// updatePendingMetrics 更新各存储桶待删除对象数量
+func (c *Collector) updatePendingMetrics() {
+	if c.metrics == nil {
+		return
+	}
+	counts, err := c.storage.CountPendingDeletions()
+	if err != nil {
+		logger.Error("Failed to count pending deletions", "error", err)
+		return
+	}
+	for _, b := range c.manager.GetRealBuckets() {
+		c.metrics.SetPendingDeletions(b.Config.Name, counts[b.Config.Name])
+	}
+}
+
+// AbortStaleUploads 列出每个真实存储桶的分片上传，中止早于 maxAge 且没有进行中会话的上传
+func (c *Collector) AbortStaleUploads(ctx context.Context, maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+	for _, b := range c.manager.GetRealBuckets() {
+		if ctx.Err() != nil {
+			return
+		}
+		if !b.IsAvailable() {
+			continue
+		}
+		aborted, err := c.abortStaleUploadsInBucket(ctx, b, cutoff)
+		if err != nil {
+			logger.Error("Failed to clean multipart uploads", "bucket", b.Config.Name, "error", err)
+		}
+		if aborted > 0 {
+			logger.Info("Aborted stale multipart uploads", "bucket", b.Config.Name, "aborted", aborted)
+		}
+	}
+}
+
+// ExpireUploadMappings 清理超过 maxAge 仍未提交的上传映射（失败的上传或崩溃遗留的 pending 映射）
+// 其真实对象加入待删除队列，由下一轮回收删除；与 AbortStaleUploads 一致，仍有进行中会话的分片上传映射保留
+func (c *Collector) ExpireUploadMappings(maxAge time.Duration) {
+	expired, err := c.storage.ExpireUploadMappings(time.Now().Add(-maxAge))
+	if err != nil {
+		logger.Error("Failed to expire uncommitted upload mappings", "error", err)
+	}
+	if expired > 0 {
+		logger.Info("Expired uncommitted upload mappings", "expired", expired)
+	}
+}
+
+func (c *Collector) abortStaleUploadsInBucket(ctx context.Context, b *bucket.BucketInfo, cutoff time.Time) (int, error) {
+	name := b.Config.Name
+	var keyMarker, uploadIDMarker *string
+	aborted := 0
+
+	for {
+		output, err := b.Client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:         aws.String(name),
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		})
+		c.manager.RecordBackendOperation(name, bucket.OperationTypeB)
+		b.ReportBackendResult(err)
+		if err != nil {
+			return aborted, err
+		}
+
+		for _, upload := range output.Uploads {
+			if upload.UploadId == nil || upload.Key == nil {
+				continue
+			}
+			if upload.Initiated == nil || upload.Initiated.After(cutoff) {
+				continue
+			}
+			active, err := c.storage.HasActiveUploadSession(*upload.UploadId)
+			if err != nil {
+				return aborted, err
+			}
+			if active {
+				continue
+			}
+
+			_, err = b.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(name),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			c.manager.RecordBackendOperation(name, bucket.OperationTypeA)
+			b.ReportBackendResult(err)
+			if err != nil && !isNotFound(err) {
+				logger.Warn("Failed to abort stale multipart upload", "bucket", name, "key", *upload.Key, "upload_id", *upload.UploadId, "error", err)
+				continue
+			}
+			aborted++
+			if c.metrics != nil {
+				c.metrics.RecordAbortedUpload(name)
+			}
+		}
+
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			return aborted, nil
+		}
+		keyMarker = output.NextKeyMarker
+		uploadIDMarker = output.NextUploadIdMarker
+	}
+}
+
+// RetryDelay 返回第 attempt 次失败后的重试延迟：base * 2^(attempt-1)，不超过 max
+func RetryDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// isNotFound 对象或上传已不存在，视为删除成功
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchUpload", "NotFound":
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,15 @@ package health
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/DullJZ/s3-balance/internal/logging"
 )
 
+var logger = logging.Logger(logging.SubsystemHealth)
+
 // Monitor 健康监控器
 type Monitor struct {
 	checker   Checker
@@ -36,6 +41,18 @@ func (m *Monitor) RegisterTarget(target Target) {
 	m.targets[target.GetID()] = target
 }
 
+// RestoreStatuses 恢复监控器重建前的健康状态（只恢复已注册的目标）
+// 恢复后的下一次检查不会被当作首次检查，状态切换仍受 rise/fall 阈值约束
+func (m *Monitor) RestoreStatuses(statuses map[string]Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, status := range statuses {
+		if _, ok := m.targets[id]; ok {
+			m.statuses[id] = status
+		}
+	}
+}
+
 // UnregisterTarget 注销监控目标
 func (m *Monitor) UnregisterTarget(targetID string) {
 	m.mu.Lock()
@@ -98,17 +115,93 @@ func (m *Monitor) checkAll(ctx context.Context) {
 
 // checkTarget 检查单个目标
 func (m *Monitor) checkTarget(ctx context.Context, target Target) {
-	status := m.checker.Check(ctx, target)
-	
-	// 更新状态
+	result := m.checker.Check(ctx, target)
+
+	rise, fall := 1, 1
+	if provider, ok := m.checker.(ThresholdProvider); ok {
+		rise, fall = provider.GetThresholds(target)
+	}
+
+	// 应用连续成功/失败阈值后更新状态
 	m.mu.Lock()
+	previous, hadPrevious := m.statuses[target.GetID()]
+	status := applyThresholds(previous, hadPrevious, result, rise, fall)
 	m.statuses[target.GetID()] = status
 	m.mu.Unlock()
-	
+
+	logger.DebugContext(ctx, "Health check completed", "target", target.GetID(), "state", status.State(),
+		"message", status.Message, "error", status.Error)
+
 	// 报告状态
 	if m.reporter != nil {
 		m.reporter.ReportHealth(target.GetID(), status)
 	}
+
+	// 报告状态变化
+	previousState := StateUnknown
+	if hadPrevious {
+		previousState = previous.State()
+	}
+	if previousState != status.State() {
+		if eventReporter, ok := m.reporter.(EventReporter); ok {
+			eventReporter.ReportHealthEvent(Event{
+				TargetID:      target.GetID(),
+				PreviousState: previousState,
+				State:         status.State(),
+				Time:          status.LastChecked,
+				Message:       status.Message,
+				Error:         status.Error,
+			})
+		}
+	}
+}
+
+// applyThresholds 根据连续成功/失败次数决定是否切换可用状态，避免状态来回抖动
+// 首次检查直接采用检查结果；降级标记不受阈值影响
+func applyThresholds(previous Status, hadPrevious bool, result Status, rise, fall int) Status {
+	if result.Healthy {
+		result.ConsecutiveSuccesses = previous.ConsecutiveSuccesses + 1
+		result.ConsecutiveFailures = 0
+	} else {
+		result.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		result.ConsecutiveSuccesses = 0
+	}
+
+	if !hadPrevious || previous.Healthy == result.Healthy {
+		return result
+	}
+
+	// 可用 -> 不可用：未达到失效阈值时保持可用
+	if previous.Healthy && result.ConsecutiveFailures < fall {
+		held := result
+		held.Healthy = true
+		held.Degraded = previous.Degraded
+		held.Message = fmt.Sprintf("%s (%d/%d consecutive failures)", result.Message, result.ConsecutiveFailures, fall)
+		return held
+	}
+
+	// 不可用 -> 可用：未达到恢复阈值时保持不可用
+	if !previous.Healthy && result.ConsecutiveSuccesses < rise {
+		held := result
+		held.Healthy = false
+		held.Degraded = false
+		held.Message = fmt.Sprintf("%s (%d/%d consecutive successes)", result.Message, result.ConsecutiveSuccesses, rise)
+		held.Error = previous.Error
+		return held
+	}
+
+	return result
+}
+
+// CheckNow 立即检查指定目标（用于运行时新增的目标，不必等待下一个周期）
+func (m *Monitor) CheckNow(ctx context.Context, targetID string) {
+	m.mu.RLock()
+	target, ok := m.targets[targetID]
+	m.mu.RUnlock()
+
+	if ok {
+		m.checkTarget(ctx, target)
+	}
 }
 
 // GetStatus 获取指定目标的健康状态
@@ -1,8 +1,10 @@
 package health
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -15,6 +17,7 @@ type S3Target struct {
 	Bucket   string
 	Endpoint string
 	Client   *s3.Client
+	Config   *Config // 目标级检查配置，nil 表示使用检查器默认值
 }
 
 // GetID 实现 Target 接口
@@ -49,6 +52,12 @@ func NewS3Checker(config Config) *S3Checker {
 	if config.Retries == 0 {
 		config.Retries = 1
 	}
+	if config.Rise == 0 {
+		config.Rise = 1
+	}
+	if config.Fall == 0 {
+		config.Fall = 1
+	}
 
 	return &S3Checker{
 		config: config,
@@ -72,12 +81,14 @@ func (c *S3Checker) Check(ctx context.Context, target Target) Status {
 		}
 	}
 
+	cfg := c.configFor(s3Target)
+
 	// 创建带超时的context
-	checkCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	checkCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 	defer cancel()
 
 	var lastErr error
-	for i := 0; i < c.config.Retries; i++ {
+	for i := 0; i < cfg.Retries; i++ {
 		if i > 0 {
 			// 重试前等待
 			select {
@@ -92,13 +103,20 @@ func (c *S3Checker) Check(ctx context.Context, target Target) Status {
 			}
 		}
 
-		err := c.performCheck(checkCtx, s3Target)
+		latencies := make(map[string]time.Duration)
+		err := c.performCheck(checkCtx, s3Target, cfg.Strategy, latencies)
 		if err == nil {
-			return Status{
+			status := Status{
 				Healthy:     true,
 				LastChecked: time.Now(),
 				Message:     fmt.Sprintf("S3 bucket %s is healthy", s3Target.Bucket),
+				Latencies:   latencies,
 			}
+			if step, latency, slow := exceedsSLO(latencies, cfg.LatencySLO); slow {
+				status.Degraded = true
+				status.Message = fmt.Sprintf("S3 bucket %s is degraded: %s took %s (SLO %s)", s3Target.Bucket, step, latency, cfg.LatencySLO)
+			}
+			return status
 		}
 		lastErr = err
 	}
@@ -106,52 +124,162 @@ func (c *S3Checker) Check(ctx context.Context, target Target) Status {
 	return Status{
 		Healthy:     false,
 		LastChecked: time.Now(),
-		Message:     fmt.Sprintf("S3 bucket %s is unhealthy after %d retries", s3Target.Bucket, c.config.Retries),
+		Message:     fmt.Sprintf("S3 bucket %s is unhealthy after %d retries", s3Target.Bucket, cfg.Retries),
 		Error:       lastErr,
 	}
 }
 
-func (c *S3Checker) performCheck(ctx context.Context, target *S3Target) error {
-	switch c.config.Strategy {
+// configFor 返回目标实际使用的检查配置（目标级配置覆盖检查器默认值）
+func (c *S3Checker) configFor(target *S3Target) Config {
+	cfg := c.config
+	if target.Config == nil {
+		return cfg
+	}
+	if target.Config.Strategy != "" {
+		cfg.Strategy = target.Config.Strategy
+	}
+	if target.Config.Timeout > 0 {
+		cfg.Timeout = target.Config.Timeout
+	}
+	if target.Config.Retries > 0 {
+		cfg.Retries = target.Config.Retries
+	}
+	if target.Config.LatencySLO > 0 {
+		cfg.LatencySLO = target.Config.LatencySLO
+	}
+	if target.Config.Rise > 0 {
+		cfg.Rise = target.Config.Rise
+	}
+	if target.Config.Fall > 0 {
+		cfg.Fall = target.Config.Fall
+	}
+	return cfg
+}
+
+// GetThresholds 实现 ThresholdProvider 接口
+func (c *S3Checker) GetThresholds(target Target) (rise, fall int) {
+	cfg := c.config
+	if s3Target, ok := target.(*S3Target); ok {
+		cfg = c.configFor(s3Target)
+	}
+	return cfg.Rise, cfg.Fall
+}
+
+func (c *S3Checker) performCheck(ctx context.Context, target *S3Target, strategy Strategy, latencies map[string]time.Duration) error {
+	switch strategy {
 	case StrategyDetailed:
-		return c.performDetailedCheck(ctx, target)
+		return c.performDetailedCheck(ctx, target, latencies)
 	default:
-		return c.performSimpleCheck(ctx, target)
+		return c.performSimpleCheck(ctx, target, latencies)
 	}
 }
 
 // performSimpleCheck 执行简单健康检查（轻量级）
-func (c *S3Checker) performSimpleCheck(ctx context.Context, target *S3Target) error {
+func (c *S3Checker) performSimpleCheck(ctx context.Context, target *S3Target, latencies map[string]time.Duration) error {
 	// 尝试列出1个对象，这是最轻量级的检查方式
+	start := time.Now()
 	_, err := target.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
 		Bucket:  aws.String(target.Bucket),
 		MaxKeys: aws.Int32(1),
 	})
+	latencies[StepList] = time.Since(start)
 
 	// 记录操作（ListObjectsV2 是 Class A 操作）
-	if c.opRecorder != nil {
-		c.opRecorder.RecordOperation(target.GetID(), OperationTypeA)
-	}
+	c.recordOperation(target, OperationTypeA)
 
 	return err
 }
 
-// performDetailedCheck 执行详细健康检查（包含更多验证）
-func (c *S3Checker) performDetailedCheck(ctx context.Context, target *S3Target) error {
+// performDetailedCheck 执行详细健康检查
+// 在保留前缀下写入一个探测对象，读回校验内容后删除，验证凭据具有读写权限并测量各步骤延迟
+func (c *S3Checker) performDetailedCheck(ctx context.Context, target *S3Target, latencies map[string]time.Duration) error {
 	// 先执行简单检查
-	if err := c.performSimpleCheck(ctx, target); err != nil {
+	if err := c.performSimpleCheck(ctx, target, latencies); err != nil {
 		return err
 	}
 
-	// 可以添加更多详细检查，比如：
-	// 1. 检查存储桶策略
-	// 2. 测试写入权限（创建并删除测试对象）
-	// 3. 检查存储桶版本控制状态
-	// 4. 测量响应时间等性能指标
+	key := fmt.Sprintf("%scanary-%d", CanaryPrefix, time.Now().UnixNano())
+	payload := []byte("s3-balance health check " + time.Now().UTC().Format(time.RFC3339Nano))
+
+	start := time.Now()
+	_, err := target.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(target.Bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(payload),
+		ContentLength: aws.Int64(int64(len(payload))),
+	})
+	latencies[StepPut] = time.Since(start)
+	c.recordOperation(target, OperationTypeA)
+	if err != nil {
+		return fmt.Errorf("write probe failed (credentials may lack write permission): %w", err)
+	}
+
+	// 无论读回是否成功都尝试删除探测对象
+	checkErr := c.readCanary(ctx, target, key, payload, latencies)
 
+	start = time.Now()
+	_, err = target.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(target.Bucket),
+		Key:    aws.String(key),
+	})
+	latencies[StepDelete] = time.Since(start)
+	c.recordOperation(target, OperationTypeA)
+
+	if checkErr != nil {
+		return checkErr
+	}
+	if err != nil {
+		return fmt.Errorf("delete probe failed (credentials may lack delete permission): %w", err)
+	}
+	return nil
+}
+
+// readCanary 读回探测对象并校验内容
+func (c *S3Checker) readCanary(ctx context.Context, target *S3Target, key string, expected []byte, latencies map[string]time.Duration) error {
+	start := time.Now()
+	defer func() {
+		latencies[StepGet] = time.Since(start)
+	}()
+
+	resp, err := target.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(target.Bucket),
+		Key:    aws.String(key),
+	})
+	c.recordOperation(target, OperationTypeB)
+	if err != nil {
+		return fmt.Errorf("read probe failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read probe failed: %w", err)
+	}
+	if !bytes.Equal(data, expected) {
+		return fmt.Errorf("read probe returned unexpected content (%d bytes, expected %d)", len(data), len(expected))
+	}
 	return nil
 }
 
+func (c *S3Checker) recordOperation(target *S3Target, category OperationCategory) {
+	if c.opRecorder != nil {
+		c.opRecorder.RecordOperation(target.GetID(), category)
+	}
+}
+
+// exceedsSLO 返回第一个超过延迟SLO的步骤
+func exceedsSLO(latencies map[string]time.Duration, slo time.Duration) (string, time.Duration, bool) {
+	if slo <= 0 {
+		return "", 0, false
+	}
+	for _, step := range []string{StepList, StepPut, StepGet, StepDelete} {
+		if latency, ok := latencies[step]; ok && latency > slo {
+			return step, latency, true
+		}
+	}
+	return "", 0, false
+}
+
 // GetInterval 获取检查间隔
 func (c *S3Checker) GetInterval() time.Duration {
 	return c.config.Interval
@@ -2,12 +2,8 @@ package health
 
 import (
 	"context"
-	"fmt"
 	"sync"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 // StatsCollector 统计信息收集器接口
@@ -24,77 +20,6 @@ type Stats struct {
 	LastUpdated time.Time // 最后更新时间
 }
 
-// S3StatsCollector S3统计信息收集器
-type S3StatsCollector struct {
-	timeout    time.Duration
-	opRecorder OperationRecorder
-}
-
-// NewS3StatsCollector 创建S3统计信息收集器
-func NewS3StatsCollector(timeout time.Duration) *S3StatsCollector {
-	if timeout == 0 {
-		timeout = 30 * time.Second
-	}
-	return &S3StatsCollector{
-		timeout: timeout,
-	}
-}
-
-// SetOperationRecorder 设置操作记录器
-func (c *S3StatsCollector) SetOperationRecorder(recorder OperationRecorder) {
-	c.opRecorder = recorder
-}
-
-// CollectStats 收集S3存储桶统计信息
-func (c *S3StatsCollector) CollectStats(ctx context.Context, target Target) (*Stats, error) {
-	s3Target, ok := target.(*S3Target)
-	if !ok {
-		return nil, fmt.Errorf("expected *S3Target, got %T", target)
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
-	defer cancel()
-
-	var totalSize int64
-	var objectCount int64
-	var continuationToken *string
-
-	for {
-		output, err := s3Target.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
-			Bucket:            aws.String(s3Target.Bucket),
-			ContinuationToken: continuationToken,
-		})
-
-		// 记录操作（每次 ListObjectsV2 调用都是 Class A 操作）
-		if c.opRecorder != nil {
-			c.opRecorder.RecordOperation(s3Target.GetID(), OperationTypeA)
-		}
-
-		if err != nil {
-			return nil, err
-		}
-
-		for _, obj := range output.Contents {
-			objectCount++
-			if obj.Size != nil {
-				totalSize += *obj.Size
-			}
-		}
-
-		if output.IsTruncated == nil || !*output.IsTruncated {
-			break
-		}
-		continuationToken = output.NextContinuationToken
-	}
-
-	return &Stats{
-		TargetID:    s3Target.GetID(),
-		UsedSize:    totalSize,
-		ObjectCount: objectCount,
-		LastUpdated: time.Now(),
-	}, nil
-}
-
 // StatsMonitor 统计信息监控器
 type StatsMonitor struct {
 	collector StatsCollector
@@ -213,6 +138,17 @@ func (m *StatsMonitor) collectTarget(ctx context.Context, target Target) {
 	}
 }
 
+// CollectNow 立即收集指定目标的统计信息（用于运行时新增的目标）
+func (m *StatsMonitor) CollectNow(ctx context.Context, targetID string) {
+	m.mu.RLock()
+	target, ok := m.targets[targetID]
+	m.mu.RUnlock()
+
+	if ok {
+		m.collectTarget(ctx, target)
+	}
+}
+
 // GetStats 获取指定目标的统计信息
 func (m *StatsMonitor) GetStats(targetID string) (*Stats, bool) {
 	m.mu.RLock()
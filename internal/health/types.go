@@ -7,10 +7,45 @@ import (
 
 // Status 健康检查状态
 type Status struct {
-	Healthy     bool      // 是否健康
-	LastChecked time.Time // 最后检查时间
-	Message     string    // 状态信息
-	Error       error     // 错误信息（如果有）
+	Healthy     bool                     // 是否健康
+	Degraded    bool                     // 可用但延迟超过SLO
+	LastChecked time.Time                // 最后检查时间
+	Message     string                   // 状态信息
+	Error       error                    // 错误信息（如果有）
+	Latencies   map[string]time.Duration // 各检查步骤的延迟（list、put、get、delete）
+
+	ConsecutiveSuccesses int // 连续成功次数
+	ConsecutiveFailures  int // 连续失败次数
+}
+
+// 健康状态名称（用于状态变化事件）
+const (
+	StateUnknown   = "unknown"
+	StateHealthy   = "healthy"
+	StateDegraded  = "degraded"
+	StateUnhealthy = "unhealthy"
+)
+
+// State 返回状态名称
+func (s Status) State() string {
+	switch {
+	case !s.Healthy:
+		return StateUnhealthy
+	case s.Degraded:
+		return StateDegraded
+	default:
+		return StateHealthy
+	}
+}
+
+// Event 健康状态变化事件
+type Event struct {
+	TargetID      string
+	PreviousState string
+	State         string
+	Time          time.Time
+	Message       string
+	Error         error
 }
 
 // Target 健康检查目标
@@ -39,16 +74,30 @@ type Strategy string
 const (
 	// StrategySimple 简单健康检查（快速探测）
 	StrategySimple Strategy = "simple"
-	// StrategyDetailed 详细健康检查（包含性能指标）
+	// StrategyDetailed 详细健康检查（写入、读回并删除探测对象，测量各步骤延迟）
 	StrategyDetailed Strategy = "detailed"
 )
 
+// CanaryPrefix 详细健康检查写入探测对象使用的保留前缀
+const CanaryPrefix = ".s3balance-health/"
+
+// 详细健康检查的步骤名称
+const (
+	StepList   = "list"
+	StepPut    = "put"
+	StepGet    = "get"
+	StepDelete = "delete"
+)
+
 // Config 健康检查配置
 type Config struct {
-	Strategy Strategy      `yaml:"strategy"`
-	Interval time.Duration `yaml:"interval"`
-	Timeout  time.Duration `yaml:"timeout"`
-	Retries  int           `yaml:"retries"`
+	Strategy   Strategy      `yaml:"strategy"`
+	Interval   time.Duration `yaml:"interval"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Retries    int           `yaml:"retries"`
+	LatencySLO time.Duration `yaml:"latency_slo"` // 任一步骤超过该延迟时标记为降级（0表示不检查）
+	Rise       int           `yaml:"rise"`        // 连续成功多少次后由不可用恢复为可用
+	Fall       int           `yaml:"fall"`        // 连续失败多少次后由可用变为不可用
 }
 
 // DefaultConfig 默认配置
@@ -67,6 +116,18 @@ type HealthReporter interface {
 	ReportHealth(targetID string, status Status)
 }
 
+// EventReporter 健康状态变化报告器接口（可选，由 HealthReporter 实现）
+type EventReporter interface {
+	// ReportHealthEvent 报告一次健康状态变化
+	ReportHealthEvent(event Event)
+}
+
+// ThresholdProvider 提供目标的状态切换阈值（可选，由 Checker 实现）
+type ThresholdProvider interface {
+	// GetThresholds 返回目标的恢复阈值与失效阈值
+	GetThresholds(target Target) (rise, fall int)
+}
+
 // OperationCategory 操作分类
 type OperationCategory string
 
@@ -0,0 +1,234 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 子系统名称，可在 logging.levels 中分别设置日志级别
+const (
+	SubsystemAPI       = "api"       // S3 与管理 API 请求处理
+	SubsystemBalancer  = "balancer"  // 存储桶选择
+	SubsystemHealth    = "health"    // 健康检查与后端客户端
+	SubsystemStorage   = "storage"   // 元数据存储、数据库与查询缓存
+	SubsystemConfig    = "config"    // 配置加载与热更新
+	SubsystemAccessLog = "accesslog" // 访问日志批量写入与导出
+	SubsystemCache     = "cache"     // 磁盘读缓存
+	SubsystemGC        = "gc"        // 待删除对象与过期分片上传回收
+	SubsystemReconcile = "reconcile" // 元数据与后端内容对账
+	SubsystemScheduler = "scheduler" // 月度归档、访问日志汇总等定时任务
+	SubsystemServer    = "server"    // 进程启动与关闭
+)
+
+// Subsystems 全部子系统名称
+var Subsystems = []string{
+	SubsystemAPI, SubsystemBalancer, SubsystemHealth, SubsystemStorage, SubsystemConfig,
+	SubsystemAccessLog, SubsystemCache, SubsystemGC, SubsystemReconcile, SubsystemScheduler, SubsystemServer,
+}
+
+// 输出格式
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Options 日志配置
+type Options struct {
+	Format string            // json（默认）或 text
+	Level  string            // 默认级别
+	Levels map[string]string // 按子系统覆盖的级别
+	Output io.Writer         // 输出位置，为空时写到标准错误
+}
+
+// state 当前生效的输出与级别，配置热更新时整体替换
+type state struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+func (s *state) levelFor(subsystem string) slog.Level {
+	if level, ok := s.levels[subsystem]; ok {
+		return level
+	}
+	return s.level
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	// 配置加载前（包括子命令）同样输出 JSON，级别为 info
+	current.Store(&state{
+		handler: newBaseHandler(FormatJSON, os.Stderr),
+		level:   slog.LevelInfo,
+	})
+}
+
+// Configure 按配置替换输出格式与各子系统级别，可在配置热更新时重复调用
+// 同时接管标准库 log 包的输出，尚未迁移的 log.Printf 以 info 级别输出
+func Configure(opts Options) error {
+	level, levels, err := parseLevels(opts)
+	if err != nil {
+		return err
+	}
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	current.Store(&state{
+		handler: newBaseHandler(opts.Format, output),
+		level:   level,
+		levels:  levels,
+	})
+	slog.SetDefault(slog.New(&handler{}))
+	return nil
+}
+
+// Validate 检查配置的格式、级别与子系统名称
+func Validate(opts Options) error {
+	_, _, err := parseLevels(opts)
+	return err
+}
+
+func parseLevels(opts Options) (slog.Level, map[string]slog.Level, error) {
+	switch opts.Format {
+	case "", FormatJSON, FormatText:
+	default:
+		return 0, nil, fmt.Errorf("invalid log format: %s (must be one of: json, text)", opts.Format)
+	}
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return 0, nil, err
+	}
+	levels := make(map[string]slog.Level, len(opts.Levels))
+	for subsystem, value := range opts.Levels {
+		if !IsSubsystem(subsystem) {
+			return 0, nil, fmt.Errorf("unknown log subsystem: %s", subsystem)
+		}
+		if levels[subsystem], err = ParseLevel(value); err != nil {
+			return 0, nil, fmt.Errorf("subsystem %s: %w", subsystem, err)
+		}
+	}
+	return level, levels, nil
+}
+
+// ParseLevel 解析 debug/info/warn/error（不区分大小写），空字符串为 info
+func ParseLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level: %s (must be one of: debug, info, warn, error)", value)
+}
+
+// IsSubsystem 判断是否为已知的子系统名称
+func IsSubsystem(name string) bool {
+	for _, subsystem := range Subsystems {
+		if subsystem == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Logger 返回指定子系统的日志记录器，每条日志带有 subsystem 字段
+// 可在包级变量中创建，级别与输出格式随 Configure 实时生效
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&handler{subsystem: subsystem})
+}
+
+func newBaseHandler(format string, output io.Writer) slog.Handler {
+	// 级别由 handler.Enabled 按子系统判断，底层输出不再过滤
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: replaceAttr}
+	if format == FormatText {
+		return slog.NewTextHandler(output, opts)
+	}
+	return slog.NewJSONHandler(output, opts)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 把请求 ID 写入上下文，之后以该上下文记录的日志都带有 request_id 字段
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID 返回上下文中的请求 ID
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// handler 按子系统过滤级别，并为日志补充请求 ID 与 trace ID
+// 实际输出委托给当前生效的底层 handler，WithAttrs/WithGroup 在底层 handler 替换后重新应用
+type handler struct {
+	subsystem string
+	ops       []func(slog.Handler) slog.Handler
+	resolved  atomic.Pointer[resolvedHandler]
+}
+
+type resolvedHandler struct {
+	state   *state
+	handler slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.Load().levelFor(h.subsystem)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		r.AddAttrs(slog.String("request_id", requestID))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.resolve().Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &handler{subsystem: h.subsystem, ops: append(ops, op)}
+}
+
+// resolve 返回应用了子系统字段与 WithAttrs/WithGroup 的底层 handler，底层 handler 未替换时复用上次结果
+func (h *handler) resolve() slog.Handler {
+	s := current.Load()
+	if cached := h.resolved.Load(); cached != nil && cached.state == s {
+		return cached.handler
+	}
+	base := s.handler
+	if h.subsystem != "" {
+		base = base.WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	}
+	for _, op := range h.ops {
+		base = op(base)
+	}
+	h.resolved.Store(&resolvedHandler{state: s, handler: base})
+	return base
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted 替换敏感内容的占位符
+const redacted = "REDACTED"
+
+var (
+	// signedParamPattern 预签名 URL 的查询参数与 SigV4/SigV2 Authorization 头中的签名、凭据
+	signedParamPattern = regexp.MustCompile(`(?i)\b((?:x-amz-)?(?:signature|credential|security-token)|awsaccesskeyid)=[^&\s,;"']+`)
+	// bearerPattern 管理 API 的 Bearer 令牌
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+[^\s,;"']+`)
+)
+
+// sensitiveKeys 值整体替换的字段名
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"secret_key":    true,
+	"token":         true,
+}
+
+// Redact 去掉字符串中的签名、凭据与令牌
+func Redact(s string) string {
+	if !strings.ContainsAny(s, "= ") {
+		return s
+	}
+	s = signedParamPattern.ReplaceAllString(s, "$1="+redacted)
+	return bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+}
+
+// replaceAttr 对所有字符串字段与错误信息（包括 msg）做脱敏
+func replaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(Redact(err.Error()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,257 @@
+// Package metadump 元数据导出/导入
+// 导出格式为 JSON Lines，与数据库驱动无关：
+//
+//	{"format":"s3-balance-metadata","version":1,"created_at":"...","source":"sql"}   第一行：文件头
+//	{"kind":"object","data":{...}}                                                 每行一条记录
+//	{"kind":"end","counts":{...}}                                                  最后一行：各类记录数，用于发现截断
+//
+// 记录顺序为对象、映射、上传会话、存储桶统计、月度统计；主键不参与导入，由目标存储重新分配
+package metadump
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+const (
+	// Format 文件头中的格式标识
+	Format = "s3-balance-metadata"
+	// Version 当前格式版本，导入时拒绝更高的版本
+	Version = 1
+)
+
+// 记录类型
+const (
+	KindObject        = "object"
+	KindMapping       = "mapping"
+	KindUploadSession = "upload_session"
+	KindBucketStats   = "bucket_stats"
+	KindMonthlyStats  = "bucket_monthly_stats"
+	kindEnd           = "end"
+)
+
+// 导入时每个事务写入的记录数
+const defaultBatchSize = 500
+
+// 单行最大长度（对象元数据可能较大）
+const maxLineSize = 16 * 1024 * 1024
+
+// Header 文件头
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source,omitempty"`
+}
+
+// Summary 导出/导入结果
+type Summary struct {
+	Header   Header                 `json:"header"`
+	Counts   storage.MetadataCounts `json:"counts"`
+	Duration time.Duration          `json:"duration"`
+}
+
+type line struct {
+	Kind   string                  `json:"kind"`
+	Data   json.RawMessage         `json:"data,omitempty"`
+	Counts *storage.MetadataCounts `json:"counts,omitempty"`
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	// Force 允许导入到已有数据的存储（同名记录被覆盖，其余记录保留）
+	Force bool
+	// BatchSize 每个事务写入的记录数，默认 500
+	BatchSize int
+}
+
+// ErrTargetNotEmpty 目标存储已有数据且未指定 Force
+var ErrTargetNotEmpty = errors.New("target metadata store is not empty")
+
+func kindOf(record interface{}) string {
+	switch record.(type) {
+	case *storage.Object:
+		return KindObject
+	case *storage.VirtualBucketMapping:
+		return KindMapping
+	case *storage.UploadSession:
+		return KindUploadSession
+	case *storage.BucketStats:
+		return KindBucketStats
+	case *storage.BucketMonthlyStats:
+		return KindMonthlyStats
+	}
+	return ""
+}
+
+func newRecord(kind string) interface{} {
+	switch kind {
+	case KindObject:
+		return &storage.Object{}
+	case KindMapping:
+		return &storage.VirtualBucketMapping{}
+	case KindUploadSession:
+		return &storage.UploadSession{}
+	case KindBucketStats:
+		return &storage.BucketStats{}
+	case KindMonthlyStats:
+		return &storage.BucketMonthlyStats{}
+	}
+	return nil
+}
+
+// Export 把 store 中的元数据以一致快照写入 w，source 记录在文件头中（如 sql、bolt）
+func Export(store storage.MetadataStore, w io.Writer, source string) (*Summary, error) {
+	start := time.Now()
+	summary := &Summary{Header: Header{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Source:    source,
+	}}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(summary.Header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	err := store.ExportMetadata(func(record interface{}) error {
+		kind := kindOf(record)
+		if kind == "" {
+			return fmt.Errorf("unsupported metadata record type %T", record)
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		summary.Counts.Add(record)
+		return enc.Encode(line{Kind: kind, Data: data})
+	})
+	if err != nil {
+		bw.Flush()
+		return nil, err
+	}
+
+	if err := enc.Encode(line{Kind: kindEnd, Counts: &summary.Counts}); err != nil {
+		return nil, fmt.Errorf("failed to write trailer: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	summary.Duration = time.Since(start)
+	return summary, nil
+}
+
+// Import 从 r 读取导出文件写入 store
+// 每批记录在一个事务中写入，导入是幂等的：中途失败后可以用 Force 重新导入同一文件
+func Import(store storage.MetadataStore, r io.Reader, opts ImportOptions) (*Summary, error) {
+	start := time.Now()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+
+	if !opts.Force {
+		existing, err := store.CountMetadata()
+		if err != nil {
+			return nil, err
+		}
+		if existing.Total() > 0 {
+			return nil, fmt.Errorf("%w: %d records (use force to merge)", ErrTargetNotEmpty, existing.Total())
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	summary := &Summary{}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty metadata dump")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &summary.Header); err != nil {
+		return nil, fmt.Errorf("invalid metadata dump header: %w", err)
+	}
+	if summary.Header.Format != Format {
+		return nil, fmt.Errorf("not a metadata dump (format %q)", summary.Header.Format)
+	}
+	if summary.Header.Version < 1 || summary.Header.Version > Version {
+		return nil, fmt.Errorf("unsupported metadata dump version %d (supported: 1-%d)", summary.Header.Version, Version)
+	}
+
+	batch := make([]interface{}, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.ImportMetadata(batch); err != nil {
+			return err
+		}
+		for _, record := range batch {
+			summary.Counts.Add(record)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	lineNo := 1
+	var trailer *storage.MetadataCounts
+	for scanner.Scan() {
+		lineNo++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if trailer != nil {
+			return summary, fmt.Errorf("line %d: data after end of dump", lineNo)
+		}
+
+		var l line
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return summary, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if l.Kind == kindEnd {
+			if l.Counts == nil {
+				return summary, fmt.Errorf("line %d: end marker without counts", lineNo)
+			}
+			trailer = l.Counts
+			continue
+		}
+
+		record := newRecord(l.Kind)
+		if record == nil {
+			return summary, fmt.Errorf("line %d: unknown record kind %q", lineNo, l.Kind)
+		}
+		if err := json.Unmarshal(l.Data, record); err != nil {
+			return summary, fmt.Errorf("line %d: invalid %s record: %w", lineNo, l.Kind, err)
+		}
+		batch = append(batch, record)
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return summary, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, err
+	}
+	if err := flush(); err != nil {
+		return summary, err
+	}
+
+	summary.Duration = time.Since(start)
+	if trailer == nil {
+		return summary, fmt.Errorf("metadata dump is truncated (no end marker)")
+	}
+	if *trailer != summary.Counts {
+		return summary, fmt.Errorf("record counts do not match end marker: imported %+v, expected %+v", summary.Counts, *trailer)
+	}
+	return summary, nil
+}
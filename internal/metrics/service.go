@@ -41,6 +41,76 @@ var (
 		Name: "s3_balance_backend_operations_total",
 		Help: "Total number of backend bucket operations by category",
 	}, []string{"bucket", "category"})
+
+	bucketDegraded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3_balance_bucket_degraded",
+		Help: "Whether S3 bucket health check latency exceeds its SLO (1 = degraded, 0 = normal)",
+	}, []string{"bucket"})
+
+	healthCheckLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3_balance_health_check_latency_seconds",
+		Help: "Latency of the last health check step (list, put, get, delete) in seconds",
+	}, []string{"bucket", "step"})
+
+	bucketUntrackedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3_balance_bucket_untracked_bytes",
+		Help: "Bytes found in S3 bucket by the last usage scan that are not recorded by the proxy",
+	}, []string{"bucket"})
+
+	bucketCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3_balance_bucket_circuit_state",
+		Help: "Circuit breaker state of S3 bucket (0 = closed, 1 = half-open, 2 = open)",
+	}, []string{"bucket"})
+
+	bucketCircuitTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_balance_bucket_circuit_transitions_total",
+		Help: "Total number of circuit breaker state transitions",
+	}, []string{"bucket", "from", "to"})
+
+	gcPendingDeletions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "s3_balance_gc_pending_deletions",
+		Help: "Number of real objects waiting to be deleted from S3 bucket",
+	}, []string{"bucket"})
+
+	gcDeletionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_balance_gc_deletions_total",
+		Help: "Total number of queued real object deletions attempted by the garbage collector",
+	}, []string{"bucket", "status"})
+
+	gcAbortedUploadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_balance_gc_aborted_uploads_total",
+		Help: "Total number of stale multipart uploads aborted by the garbage collector",
+	}, []string{"bucket"})
+
+	cacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_balance_cache_requests_total",
+		Help: "Total number of proxied GET requests served through the disk cache (result = hit, miss)",
+	}, []string{"bucket", "result"})
+
+	cacheServedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_balance_cache_served_bytes_total",
+		Help: "Total number of bytes served through the disk cache by source (cache, backend)",
+	}, []string{"bucket", "source"})
+
+	cacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "s3_balance_cache_evictions_total",
+		Help: "Total number of cached chunks evicted to stay within the disk cache size limit",
+	})
+
+	cacheSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "s3_balance_cache_size_bytes",
+		Help: "Current size of the disk cache in bytes",
+	})
+
+	accessLogDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_balance_access_log_dropped_total",
+		Help: "Total number of access log entries dropped by the background writer (reason = queue_full, write_error, closed)",
+	}, []string{"reason"})
+
+	accessLogQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "s3_balance_access_log_queue_length",
+		Help: "Number of access log entries waiting to be written",
+	})
 )
 
 type Metrics struct{}
@@ -57,6 +127,18 @@ func (m *Metrics) SetBucketHealthy(bucket, endpoint string, healthy bool) {
 	bucketHealthy.WithLabelValues(bucket, endpoint).Set(value)
 }
 
+func (m *Metrics) SetBucketDegraded(bucket string, degraded bool) {
+	value := 0.0
+	if degraded {
+		value = 1.0
+	}
+	bucketDegraded.WithLabelValues(bucket).Set(value)
+}
+
+func (m *Metrics) SetHealthCheckLatency(bucket, step string, seconds float64) {
+	healthCheckLatency.WithLabelValues(bucket, step).Set(seconds)
+}
+
 func (m *Metrics) SetBucketUsage(bucket string, usage, capacity int64) {
 	bucketUsage.WithLabelValues(bucket).Set(float64(usage))
 	bucketCapacity.WithLabelValues(bucket).Set(float64(capacity))
@@ -77,3 +159,51 @@ func (m *Metrics) RecordBalancerDecision(strategy, bucket string) {
 func (m *Metrics) RecordBackendOperation(bucket, category string) {
 	backendOperationsTotal.WithLabelValues(bucket, category).Inc()
 }
+
+func (m *Metrics) SetBucketUntrackedBytes(bucket string, bytes int64) {
+	bucketUntrackedBytes.WithLabelValues(bucket).Set(float64(bytes))
+}
+
+func (m *Metrics) SetCircuitState(bucket string, state int) {
+	bucketCircuitState.WithLabelValues(bucket).Set(float64(state))
+}
+
+func (m *Metrics) RecordCircuitTransition(bucket, from, to string) {
+	bucketCircuitTransitions.WithLabelValues(bucket, from, to).Inc()
+}
+
+func (m *Metrics) SetPendingDeletions(bucket string, count int64) {
+	gcPendingDeletions.WithLabelValues(bucket).Set(float64(count))
+}
+
+func (m *Metrics) RecordGCDeletion(bucket, status string) {
+	gcDeletionsTotal.WithLabelValues(bucket, status).Inc()
+}
+
+func (m *Metrics) RecordAbortedUpload(bucket string) {
+	gcAbortedUploadsTotal.WithLabelValues(bucket).Inc()
+}
+
+func (m *Metrics) RecordCacheRequest(bucket, result string) {
+	cacheRequestsTotal.WithLabelValues(bucket, result).Inc()
+}
+
+func (m *Metrics) RecordCacheServedBytes(bucket, source string, bytes int64) {
+	cacheServedBytes.WithLabelValues(bucket, source).Add(float64(bytes))
+}
+
+func (m *Metrics) RecordCacheEviction() {
+	cacheEvictionsTotal.Inc()
+}
+
+func (m *Metrics) SetCacheSize(bytes int64) {
+	cacheSizeBytes.Set(float64(bytes))
+}
+
+func (m *Metrics) RecordAccessLogDropped(reason string, count int) {
+	accessLogDroppedTotal.WithLabelValues(reason).Add(float64(count))
+}
+
+func (m *Metrics) SetAccessLogQueueLength(length int) {
+	accessLogQueueLength.Set(float64(length))
+}
@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/DullJZ/s3-balance/internal/tracing"
 	"github.com/DullJZ/s3-validate/pkg/s3validate"
 )
 
@@ -56,7 +58,9 @@ func S3Signature(cfg S3SignatureConfig) func(http.Handler) http.Handler {
 				}
 			}
 
+			_, span := tracing.Start(r.Context(), "auth.VerifySignature")
 			result, err := verifier.Verify(r.Context(), r)
+			tracing.End(span, err)
 			if err != nil {
 				invokeOnError(w, r, cfg, "SignatureDoesNotMatch", err.Error())
 				return
@@ -65,6 +69,18 @@ func S3Signature(cfg S3SignatureConfig) func(http.Handler) http.Handler {
 			// Store verification result in context for potential use by handlers
 			_ = result
 
+			// aws-chunked 签名载荷：保存签名上下文，供处理器解码请求体时逐块校验签名
+			switch r.Header.Get("X-Amz-Content-Sha256") {
+			case StreamingPayload, StreamingPayloadTrailer:
+				_, secretKey := cfg.Credentials()
+				signer, err := newChunkSigner(r, secretKey)
+				if err != nil {
+					invokeOnError(w, r, cfg, "SignatureDoesNotMatch", err.Error())
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), chunkSignerContextKey{}, signer))
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -78,8 +94,67 @@ func invokeOnError(w http.ResponseWriter, r *http.Request, cfg S3SignatureConfig
 	http.Error(w, message, http.StatusForbidden)
 }
 
+// Role 管理API角色，权限依次递增：viewer < operator < admin
+type Role string
+
+const (
+	// RoleViewer 只读角色，可查看存储桶、健康状态与统计数据
+	RoleViewer Role = "viewer"
+	// RoleOperator 运维角色，可执行不修改配置的运维操作
+	RoleOperator Role = "operator"
+	// RoleAdmin 管理员角色，可修改配置和管理令牌
+	RoleAdmin Role = "admin"
+)
+
+// level 返回角色的权限等级，未知角色返回0
+func (r Role) level() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Allows 判断当前角色是否满足所需角色
+func (r Role) Allows(required Role) bool {
+	return r.level() > 0 && r.level() >= required.level()
+}
+
+// ParseRole 解析角色名称
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	if role.level() == 0 {
+		return "", fmt.Errorf("invalid role: %s (must be one of: viewer, operator, admin)", s)
+	}
+	return role, nil
+}
+
+// Principal 通过认证的管理API调用方
+type Principal struct {
+	Name    string // 令牌名称
+	Role    Role   // 令牌角色
+	TokenID uint   // 令牌ID，0 表示配置文件中的引导令牌
+}
+
+// TokenLookup 根据明文令牌查找调用方，令牌无效时返回 nil, nil
+type TokenLookup func(token string) (*Principal, error)
+
+type principalContextKey struct{}
+
+// PrincipalFromContext 从请求上下文中获取已认证的调用方
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
 // TokenAuthMiddleware 创建Token认证中间件，用于管理API
-func TokenAuthMiddleware(validToken string) func(http.Handler) http.Handler {
+// staticToken 为配置文件中的令牌，拥有 admin 权限；lookup 用于校验数据库中的命名令牌
+func TokenAuthMiddleware(staticToken string, lookup TokenLookup) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 从Authorization头中提取token
@@ -98,14 +173,48 @@ func TokenAuthMiddleware(validToken string) func(http.Handler) http.Handler {
 				token = strings.TrimPrefix(authHeader, "Bearer ")
 			}
 
-			// 验证token
-			if token != validToken {
+			// 验证token：先匹配配置文件中的引导令牌，再查询命名令牌
+			var principal *Principal
+			if staticToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(staticToken)) == 1 {
+				principal = &Principal{Name: "config", Role: RoleAdmin}
+			} else if lookup != nil {
+				p, err := lookup(token)
+				if err != nil {
+					w.Header().Set("Content-Type", "application/json")
+					http.Error(w, `{"error": "failed to verify token"}`, http.StatusInternalServerError)
+					return
+				}
+				principal = p
+			}
+
+			if principal == nil {
 				w.Header().Set("Content-Type", "application/json")
 				http.Error(w, `{"error": "invalid token"}`, http.StatusUnauthorized)
 				return
 			}
 
 			// 继续处理请求
+			ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole 要求调用方至少具有指定角色，需在 TokenAuthMiddleware 之后使用
+func RequireRole(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				http.Error(w, `{"error": "unauthenticated"}`, http.StatusUnauthorized)
+				return
+			}
+			if !principal.Role.Allows(role) {
+				w.Header().Set("Content-Type", "application/json")
+				http.Error(w, fmt.Sprintf(`{"error": "role %s required"}`, role), http.StatusForbidden)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
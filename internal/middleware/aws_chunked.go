@@ -0,0 +1,421 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// x-amz-content-sha256 中表示 aws-chunked 流式载荷的取值
+const (
+	StreamingPayload              = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	StreamingPayloadTrailer       = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	StreamingUnsignedPayloadTrail = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+const (
+	// 单个块的最大长度；SDK 通常使用 64KB，块在校验签名前需要完整缓存
+	maxChunkSize = 16 * 1024 * 1024
+	// 块头与尾部头单行的最大长度
+	maxChunkLineSize = 4096
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// crc64NVME CRC-64/NVME 多项式（反转表示），用于 x-amz-checksum-crc64nvme
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// StreamingError aws-chunked 请求体解码或校验失败，Code 为返回给客户端的 S3 错误码
+type StreamingError struct {
+	Code    string
+	Message string
+}
+
+func (e *StreamingError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func streamingErrorf(code, format string, args ...interface{}) *StreamingError {
+	return &StreamingError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// chunkSigner 校验逐块签名所需的签名上下文，由 S3Signature 校验请求签名后放入请求上下文
+type chunkSigner struct {
+	key     []byte // 派生的签名密钥
+	amzDate string
+	scope   string
+	seed    string // 请求头中的签名，作为第一个块的上一个签名
+}
+
+type chunkSignerContextKey struct{}
+
+// newChunkSigner 为已通过签名校验的流式请求创建签名上下文
+func newChunkSigner(r *http.Request, secretKey string) (*chunkSigner, error) {
+	auth := r.Header.Get("Authorization")
+	var credential, signature string
+	if i := strings.Index(auth, " "); i >= 0 {
+		for _, part := range strings.Split(auth[i+1:], ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "Credential":
+				credential = kv[1]
+			case "Signature":
+				signature = kv[1]
+			}
+		}
+	}
+	scopeParts := strings.SplitN(credential, "/", 2)
+	if len(scopeParts) != 2 || signature == "" {
+		return nil, fmt.Errorf("streaming payload requires a header signature")
+	}
+	scope := scopeParts[1]
+	fields := strings.Split(scope, "/")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid credential scope %q", scope)
+	}
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), fields[0])
+	key = hmacSHA256(key, fields[1])
+	key = hmacSHA256(key, fields[2])
+	key = hmacSHA256(key, fields[3])
+
+	return &chunkSigner{
+		key:     key,
+		amzDate: r.Header.Get("X-Amz-Date"),
+		scope:   scope,
+		seed:    signature,
+	}, nil
+}
+
+// chunkSignature 计算一个数据块的签名
+func (s *chunkSigner) chunkSignature(previous string, data []byte) string {
+	sum := sha256.Sum256(data)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256-PAYLOAD",
+		s.amzDate,
+		s.scope,
+		previous,
+		emptySHA256,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.key, stringToSign))
+}
+
+// trailerSignature 计算尾部头的签名
+func (s *chunkSigner) trailerSignature(previous string, canonicalTrailers string) string {
+	sum := sha256.Sum256([]byte(canonicalTrailers))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256-TRAILER",
+		s.amzDate,
+		s.scope,
+		previous,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// IsStreamingPayload 判断请求体是否为 aws-chunked 编码
+func IsStreamingPayload(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return true
+	}
+	for _, enc := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		if strings.TrimSpace(enc) == "aws-chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodedContentLength 返回 aws-chunked 请求体解码后的长度，未声明时返回 -1
+func DecodedContentLength(r *http.Request) int64 {
+	v := r.Header.Get("X-Amz-Decoded-Content-Length")
+	if v == "" {
+		return -1
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// ChunkedReader 解码 aws-chunked 请求体
+// 请求经 S3Signature 校验过签名时同时校验逐块签名与尾部签名；声明了尾部校验和时校验解码后的内容
+// 最后一个数据块在结束块与尾部校验通过后才交给调用方，校验失败时下游收到的数据不完整，不会被后端提交
+type ChunkedReader struct {
+	src      *bufio.Reader
+	signer   *chunkSigner // nil 表示不校验签名
+	signed   bool         // 块头是否带 chunk-signature
+	trailer  string       // x-amz-trailer 声明的尾部校验和头
+	checksum hash.Hash
+	declared int64 // x-amz-decoded-content-length，-1 表示未声明
+	decoded  int64
+	prevSig  string
+	cur      []byte // 可以交给调用方的数据
+	next     []byte // 已校验、等待后续块确认后再交付的数据
+	done     bool
+	err      error
+}
+
+// NewChunkedReader 为 aws-chunked 请求创建解码器
+func NewChunkedReader(r *http.Request) (*ChunkedReader, error) {
+	mode := r.Header.Get("X-Amz-Content-Sha256")
+	c := &ChunkedReader{
+		src:      bufio.NewReaderSize(r.Body, 64*1024),
+		declared: DecodedContentLength(r),
+	}
+
+	switch mode {
+	case StreamingPayload, StreamingPayloadTrailer:
+		c.signed = true
+		if signer, ok := r.Context().Value(chunkSignerContextKey{}).(*chunkSigner); ok {
+			c.signer = signer
+			c.prevSig = signer.seed
+		}
+	case StreamingUnsignedPayloadTrail:
+	case "":
+		// 只有 Content-Encoding: aws-chunked，按块头是否带签名自动识别
+	default:
+		return nil, streamingErrorf("NotImplemented", "payload signing mode %s is not supported", mode)
+	}
+
+	if mode == StreamingPayloadTrailer || mode == StreamingUnsignedPayloadTrail {
+		c.trailer = strings.ToLower(strings.TrimSpace(r.Header.Get("X-Amz-Trailer")))
+		if c.trailer == "" {
+			return nil, streamingErrorf("InvalidRequest", "x-amz-trailer is required for %s", mode)
+		}
+		checksum, err := newChecksum(c.trailer)
+		if err != nil {
+			return nil, err
+		}
+		c.checksum = checksum
+	}
+	return c, nil
+}
+
+// newChecksum 创建尾部校验和对应的哈希
+func newChecksum(header string) (hash.Hash, error) {
+	switch header {
+	case "x-amz-checksum-crc32":
+		return crc32.NewIEEE(), nil
+	case "x-amz-checksum-crc32c":
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case "x-amz-checksum-crc64nvme":
+		return crc64.New(crc64NVMETable), nil
+	case "x-amz-checksum-sha1":
+		return sha1.New(), nil
+	case "x-amz-checksum-sha256":
+		return sha256.New(), nil
+	}
+	return nil, streamingErrorf("InvalidRequest", "unsupported trailer %s", header)
+}
+
+// Err 返回解码或校验失败的原因（*StreamingError），上传失败时据此返回准确的错误码
+func (c *ChunkedReader) Err() error {
+	if c.err == io.ErrUnexpectedEOF {
+		return streamingErrorf("IncompleteBody", "the request body terminated unexpectedly")
+	}
+	return c.err
+}
+
+// Read 实现 io.Reader
+func (c *ChunkedReader) Read(p []byte) (int, error) {
+	for len(c.cur) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.done {
+			if c.next == nil {
+				return 0, io.EOF
+			}
+			c.cur, c.next = c.next, nil
+			continue
+		}
+		data, err := c.readChunk()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			c.err = err
+			return 0, err
+		}
+		if !c.done {
+			c.cur, c.next = c.next, data
+		}
+	}
+	n := copy(p, c.cur)
+	c.cur = c.cur[n:]
+	return n, nil
+}
+
+// readChunk 读取并校验一个块，结束块返回 nil 并处理尾部头
+func (c *ChunkedReader) readChunk() ([]byte, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	sizeField, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+	if err != nil || size < 0 {
+		return nil, streamingErrorf("IncompleteBody", "invalid chunk header %q", line)
+	}
+	if size > maxChunkSize {
+		return nil, streamingErrorf("InvalidRequest", "chunk size %d exceeds the maximum of %d bytes", size, maxChunkSize)
+	}
+	var signature string
+	if ext != "" {
+		name, value, _ := strings.Cut(ext, "=")
+		if strings.TrimSpace(name) == "chunk-signature" {
+			signature = strings.TrimSpace(value)
+		}
+	}
+	if c.signed && signature == "" {
+		return nil, streamingErrorf("SignatureDoesNotMatch", "chunk signature is missing")
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.src, data); err != nil {
+		return nil, err
+	}
+
+	if c.signer != nil {
+		expected := c.signer.chunkSignature(c.prevSig, data)
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			return nil, streamingErrorf("SignatureDoesNotMatch", "chunk signature does not match")
+		}
+		c.prevSig = signature
+	}
+
+	c.decoded += size
+	if c.declared >= 0 && c.decoded > c.declared {
+		return nil, streamingErrorf("InvalidRequest", "decoded body exceeds x-amz-decoded-content-length %d", c.declared)
+	}
+	if c.checksum != nil {
+		c.checksum.Write(data)
+	}
+
+	if size > 0 {
+		if err := c.expectCRLF(); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	// 结束块
+	if c.trailer != "" {
+		if err := c.readTrailers(); err != nil {
+			return nil, err
+		}
+	} else if _, err := c.readLine(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if c.declared >= 0 && c.decoded != c.declared {
+		return nil, streamingErrorf("IncompleteBody", "decoded body has %d bytes, x-amz-decoded-content-length is %d", c.decoded, c.declared)
+	}
+	c.done = true
+	return nil, nil
+}
+
+// readTrailers 读取尾部头，校验尾部签名与校验和
+func (c *ChunkedReader) readTrailers() error {
+	var canonical bytes.Buffer
+	var checksumValue, trailerSignature string
+	for {
+		line, err := c.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			if checksumValue == "" && trailerSignature == "" {
+				continue
+			}
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return streamingErrorf("MalformedTrailerError", "malformed trailer %q", line)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "x-amz-trailer-signature" {
+			trailerSignature = value
+			continue
+		}
+		if name == c.trailer {
+			checksumValue = value
+		}
+		canonical.WriteString(name + ":" + value + "\n")
+	}
+
+	if checksumValue == "" {
+		return streamingErrorf("MalformedTrailerError", "trailer %s is missing", c.trailer)
+	}
+	if c.signed {
+		if trailerSignature == "" {
+			return streamingErrorf("SignatureDoesNotMatch", "trailer signature is missing")
+		}
+		if c.signer != nil {
+			expected := c.signer.trailerSignature(c.prevSig, canonical.String())
+			if !hmac.Equal([]byte(expected), []byte(trailerSignature)) {
+				return streamingErrorf("SignatureDoesNotMatch", "trailer signature does not match")
+			}
+		}
+	}
+	if actual := base64.StdEncoding.EncodeToString(c.checksum.Sum(nil)); actual != checksumValue {
+		return streamingErrorf("BadDigest", "the %s you specified did not match the calculated checksum", c.trailer)
+	}
+	return nil
+}
+
+// readLine 读取一行（去掉 CRLF）
+func (c *ChunkedReader) readLine() (string, error) {
+	line, err := c.src.ReadSlice('\n')
+	if err == bufio.ErrBufferFull || len(line) > maxChunkLineSize {
+		return "", streamingErrorf("IncompleteBody", "chunk header line too long")
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// expectCRLF 读取块数据后的 CRLF
+func (c *ChunkedReader) expectCRLF() error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(c.src, crlf[:]); err != nil {
+		return err
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return streamingErrorf("IncompleteBody", "chunk data is not terminated by CRLF")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientAddr 请求的客户端地址
+type ClientAddr struct {
+	IP           string // 客户端地址：直连对端地址，对端为可信代理时取转发头中的地址
+	ForwardedFor string // 原始 X-Forwarded-For（没有时为 X-Real-IP），仅供记录，不作为客户端地址依据
+}
+
+type clientAddrContextKey struct{}
+
+// ClientAddrFromContext 从请求上下文中获取 ClientIP 中间件解析的客户端地址
+func ClientAddrFromContext(ctx context.Context) (ClientAddr, bool) {
+	addr, ok := ctx.Value(clientAddrContextKey{}).(ClientAddr)
+	return addr, ok
+}
+
+// ClientIP 解析客户端地址并写入请求上下文
+// trustedProxies 返回可信代理列表（IP 或 CIDR），只有直连对端属于其中时才采用 X-Forwarded-For / X-Real-IP
+func ClientIP(trustedProxies func() []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var trusted []string
+			if trustedProxies != nil {
+				trusted = trustedProxies()
+			}
+			addr := ResolveClientAddr(r, ParseTrustedProxies(trusted))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientAddrContextKey{}, addr)))
+		})
+	}
+}
+
+// ResolveClientAddr 按可信代理列表解析客户端地址
+// X-Forwarded-For 从右向左跳过可信代理，第一个不可信的地址即客户端；全部可信时取最左侧地址
+func ResolveClientAddr(r *http.Request, trusted []netip.Prefix) ClientAddr {
+	addr := ClientAddr{IP: remoteHost(r.RemoteAddr)}
+	xff := r.Header.Get("X-Forwarded-For")
+	xrip := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	addr.ForwardedFor = xff
+	if addr.ForwardedFor == "" {
+		addr.ForwardedFor = xrip
+	}
+	if !isTrusted(addr.IP, trusted) {
+		return addr
+	}
+
+	if xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				// 无法解析的地址之前的内容不可信，停在最后一个已确认的地址
+				return addr
+			}
+			addr.IP = hop
+			if !isTrusted(hop, trusted) {
+				return addr
+			}
+		}
+		return addr
+	}
+	if _, err := netip.ParseAddr(xrip); err == nil {
+		addr.IP = xrip
+	}
+	return addr
+}
+
+// ParseTrustedProxies 解析可信代理列表，单个 IP 视为 /32（IPv6 为 /128），无效条目被忽略
+func ParseTrustedProxies(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := ParseTrustedProxy(entry); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// ParseTrustedProxy 解析单个可信代理条目（IP 或 CIDR）
+func ParseTrustedProxy(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
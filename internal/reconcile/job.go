@@ -0,0 +1,115 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/logging"
+)
+
+var logger = logging.Logger(logging.SubsystemReconcile)
+
+// ErrAlreadyRunning 已有对账任务在执行
+var ErrAlreadyRunning = errors.New("reconcile already running")
+
+// Job 定期执行对账的后台任务
+type Job struct {
+	reconciler *Reconciler
+	getConfig  func() *config.Config
+	stopChan   chan struct{}
+
+	mu         sync.Mutex
+	running    bool
+	lastReport *Report
+	lastError  string
+}
+
+// NewJob 创建对账任务，getConfig 返回当前生效的配置（支持热更新）
+func NewJob(reconciler *Reconciler, getConfig func() *config.Config) *Job {
+	return &Job{
+		reconciler: reconciler,
+		getConfig:  getConfig,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start 启动定期对账；未启用时只等待配置变更
+func (j *Job) Start(ctx context.Context) {
+	go func() {
+		for {
+			interval := j.getConfig().Reconcile.Interval
+			select {
+			case <-ctx.Done():
+				return
+			case <-j.stopChan:
+				logger.Info("Reconcile job stopped")
+				return
+			case <-time.After(interval):
+				cfg := j.getConfig().Reconcile
+				if !cfg.Enabled {
+					continue
+				}
+				if _, err := j.Run(ctx, OptionsFromConfig(cfg)); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+					logger.Error("Scheduled reconcile failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定期对账
+func (j *Job) Stop() {
+	close(j.stopChan)
+}
+
+// Run 立即执行一次对账并保存结果；同一时间只允许一个对账任务
+func (j *Job) Run(ctx context.Context, opts Options) (*Report, error) {
+	j.mu.Lock()
+	if j.running {
+		j.mu.Unlock()
+		return nil, ErrAlreadyRunning
+	}
+	j.running = true
+	j.mu.Unlock()
+
+	logger.Info("Reconcile started", "mode", opts.Mode)
+	report, err := j.reconciler.Run(ctx, opts)
+
+	j.mu.Lock()
+	j.running = false
+	if err != nil {
+		j.lastError = err.Error()
+	} else {
+		j.lastError = ""
+	}
+	if report != nil {
+		j.lastReport = report
+	}
+	j.mu.Unlock()
+
+	if report != nil {
+		logger.Info("Reconcile finished", "backend_objects", report.BackendObjects,
+			"findings", len(report.Findings), "counts", report.Counts, "errors", len(report.Errors))
+	}
+	return report, err
+}
+
+// Config 返回当前生效的对账配置
+func (j *Job) Config() config.ReconcileConfig {
+	return j.getConfig().Reconcile
+}
+
+// Validate 检查对账参数
+func (j *Job) Validate(opts Options) error {
+	return j.reconciler.Validate(opts)
+}
+
+// Status 返回是否正在执行、最近一次报告与错误
+func (j *Job) Status() (running bool, report *Report, lastError string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.running, j.lastReport, j.lastError
+}
@@ -0,0 +1,422 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/health"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// 差异类型
+const (
+	KindMissingOnBackend = "missing_on_backend" // 数据库中有记录，后端对象不存在
+	KindOrphan           = "orphan"             // 后端对象没有任何映射或对象记录
+	KindSizeMismatch     = "size_mismatch"      // 数据库记录的大小与后端不一致
+	KindETagMismatch     = "etag_mismatch"      // 数据库记录的ETag与后端不一致
+)
+
+// Options 一次对账的参数
+type Options struct {
+	Mode         string        // 修复模式，见 config.ReconcileMode*
+	AdoptInto    string        // adopt 模式下收编孤儿对象的虚拟存储桶
+	Buckets      []string      // 只对账这些真实存储桶，为空表示全部
+	MinAge       time.Duration // 只处理早于该时长的对象
+	PageInterval time.Duration // 两次列出请求之间的最小间隔
+}
+
+// OptionsFromConfig 根据配置生成对账参数
+func OptionsFromConfig(cfg config.ReconcileConfig) Options {
+	return Options{
+		Mode:         cfg.Mode,
+		AdoptInto:    cfg.AdoptInto,
+		MinAge:       cfg.MinAge,
+		PageInterval: cfg.PageInterval,
+	}
+}
+
+// Finding 一条差异记录
+type Finding struct {
+	Kind          string `json:"kind"`
+	Bucket        string `json:"bucket"`                   // 真实存储桶
+	Key           string `json:"key"`                      // 后端对象key
+	VirtualBucket string `json:"virtual_bucket,omitempty"` // 相关映射所在的虚拟存储桶
+	ObjectKey     string `json:"object_key,omitempty"`     // 映射或对象记录中的key（与后端key不同时）
+	DBSize        int64  `json:"db_size,omitempty"`
+	BackendSize   int64  `json:"backend_size,omitempty"`
+	DBETag        string `json:"db_etag,omitempty"`
+	BackendETag   string `json:"backend_etag,omitempty"`
+	Action        string `json:"action,omitempty"` // 已执行的修复动作
+	Error         string `json:"error,omitempty"`  // 修复失败的原因
+}
+
+// Report 对账结果
+type Report struct {
+	Mode           string         `json:"mode"`
+	AdoptInto      string         `json:"adopt_into,omitempty"`
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     time.Time      `json:"finished_at"`
+	Buckets        []string       `json:"buckets"`
+	BackendObjects int64          `json:"backend_objects"`
+	Counts         map[string]int `json:"counts"`
+	Findings       []Finding      `json:"findings"`
+	Errors         []string       `json:"errors"`
+}
+
+// Reconciler 比较元数据数据库与真实存储桶内容
+type Reconciler struct {
+	manager *bucket.Manager
+	storage storage.MetadataStore
+}
+
+// NewReconciler 创建对账器
+func NewReconciler(manager *bucket.Manager, storageService storage.MetadataStore) *Reconciler {
+	return &Reconciler{
+		manager: manager,
+		storage: storageService,
+	}
+}
+
+// backendObject 后端对象的大小与ETag
+type backendObject struct {
+	size         int64
+	etag         string
+	lastModified time.Time
+}
+
+// Run 执行一次对账，并按模式修复差异
+func (r *Reconciler) Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Mode == "" {
+		opts.Mode = config.ReconcileModeReport
+	}
+	if err := r.Validate(opts); err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Mode:      opts.Mode,
+		AdoptInto: opts.AdoptInto,
+		StartedAt: time.Now(),
+		Buckets:   []string{},
+		Counts:    make(map[string]int),
+		Findings:  []Finding{},
+		Errors:    []string{},
+	}
+
+	buckets, err := r.selectBuckets(opts.Buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range buckets {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Buckets = append(report.Buckets, b.Config.Name)
+		if err := r.reconcileBucket(ctx, b, opts, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("bucket %s: %v", b.Config.Name, err))
+		}
+	}
+
+	for _, f := range report.Findings {
+		report.Counts[f.Kind]++
+	}
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// Validate 检查对账参数：修复模式、收编目标与存储桶是否有效
+func (r *Reconciler) Validate(opts Options) error {
+	switch opts.Mode {
+	case "", config.ReconcileModeReport, config.ReconcileModeDeleteOrphans, config.ReconcileModePurgeDangling:
+	case config.ReconcileModeAdopt:
+		target, ok := r.manager.GetBucket(opts.AdoptInto)
+		if !ok || !target.IsVirtual() {
+			return fmt.Errorf("adopt target %s is not a virtual bucket", opts.AdoptInto)
+		}
+	default:
+		return fmt.Errorf("invalid reconcile mode: %s", opts.Mode)
+	}
+	if opts.MinAge < 0 || opts.PageInterval < 0 {
+		return fmt.Errorf("min_age and page_interval must not be negative")
+	}
+
+	_, err := r.selectBuckets(opts.Buckets)
+	return err
+}
+
+// selectBuckets 返回需要对账的真实存储桶
+func (r *Reconciler) selectBuckets(names []string) ([]*bucket.BucketInfo, error) {
+	if len(names) == 0 {
+		return r.manager.GetRealBuckets(), nil
+	}
+
+	var buckets []*bucket.BucketInfo
+	for _, name := range names {
+		b, ok := r.manager.GetBucket(name)
+		if !ok || b.IsVirtual() {
+			return nil, fmt.Errorf("%s is not a real bucket", name)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// reconcileBucket 对账单个真实存储桶
+func (r *Reconciler) reconcileBucket(ctx context.Context, b *bucket.BucketInfo, opts Options, report *Report) error {
+	name := b.Config.Name
+	listStart := time.Now()
+
+	backend, err := r.listBackend(ctx, b, opts.PageInterval)
+	if err != nil {
+		return err
+	}
+	report.BackendObjects += int64(len(backend))
+
+	mappings, err := r.storage.GetVirtualBucketMappingsForRealBucket(name)
+	if err != nil {
+		return err
+	}
+	objects, err := r.storage.GetBucketObjects(name)
+	if err != nil {
+		return err
+	}
+
+	// 被映射或对象记录引用的后端key
+	referenced := make(map[string]bool)
+	// 对象记录的 key -> 实际指向的后端key（复制产生的记录指向源对象）
+	realKeyOf := make(map[string]string)
+
+	for _, m := range mappings {
+		referenced[m.RealObjectKey] = true
+		realKeyOf[m.ObjectKey] = m.RealObjectKey
+
+		// 扫描开始后才创建的映射可能尚未写入后端
+		if m.CreatedAt.After(listStart) {
+			continue
+		}
+		if _, ok := backend[m.RealObjectKey]; !ok {
+			f := Finding{
+				Kind:          KindMissingOnBackend,
+				Bucket:        name,
+				Key:           m.RealObjectKey,
+				VirtualBucket: m.VirtualBucketName,
+			}
+			if m.ObjectKey != m.RealObjectKey {
+				f.ObjectKey = m.ObjectKey
+			}
+			if opts.Mode == config.ReconcileModePurgeDangling {
+				r.purgeMapping(m, &f)
+			}
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	for _, o := range objects {
+		realKey, ok := realKeyOf[o.Key]
+		if !ok {
+			realKey = o.Key
+		}
+		referenced[realKey] = true
+
+		obj, exists := backend[realKey]
+		if !exists {
+			// 有映射的记录已在上面按映射报告
+			if ok || o.UpdatedAt.After(listStart) {
+				continue
+			}
+			f := Finding{
+				Kind:   KindMissingOnBackend,
+				Bucket: name,
+				Key:    realKey,
+				DBSize: o.Size,
+			}
+			if opts.Mode == config.ReconcileModePurgeDangling {
+				r.purgeObject(o.Key, &f)
+			}
+			report.Findings = append(report.Findings, f)
+			continue
+		}
+
+		if o.Size != obj.size {
+			report.Findings = append(report.Findings, Finding{
+				Kind:        KindSizeMismatch,
+				Bucket:      name,
+				Key:         realKey,
+				ObjectKey:   objectKeyIfDifferent(o.Key, realKey),
+				DBSize:      o.Size,
+				BackendSize: obj.size,
+			})
+		}
+		if dbETag := normalizeETag(o.StoredETag()); dbETag != "" && obj.etag != "" && dbETag != obj.etag {
+			report.Findings = append(report.Findings, Finding{
+				Kind:        KindETagMismatch,
+				Bucket:      name,
+				Key:         realKey,
+				ObjectKey:   objectKeyIfDifferent(o.Key, realKey),
+				DBETag:      dbETag,
+				BackendETag: obj.etag,
+			})
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.MinAge)
+	for key, obj := range backend {
+		if referenced[key] {
+			continue
+		}
+		// 最近写入的对象可能还在等待数据库记录
+		if !obj.lastModified.IsZero() && obj.lastModified.After(cutoff) {
+			continue
+		}
+		f := Finding{
+			Kind:        KindOrphan,
+			Bucket:      name,
+			Key:         key,
+			BackendSize: obj.size,
+			BackendETag: obj.etag,
+		}
+		switch opts.Mode {
+		case config.ReconcileModeAdopt:
+			r.adoptOrphan(name, key, obj.size, opts.AdoptInto, &f)
+		case config.ReconcileModeDeleteOrphans:
+			r.deleteOrphan(name, key, &f)
+		}
+		report.Findings = append(report.Findings, f)
+	}
+
+	return nil
+}
+
+// listBackend 列出真实存储桶中的全部对象（跳过健康检查探测对象）
+func (r *Reconciler) listBackend(ctx context.Context, b *bucket.BucketInfo, pageInterval time.Duration) (map[string]backendObject, error) {
+	result := make(map[string]backendObject)
+	var continuationToken *string
+
+	for page := 0; ; page++ {
+		if page > 0 && pageInterval > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(pageInterval):
+			}
+		}
+
+		output, err := b.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(b.Config.Name),
+			ContinuationToken: continuationToken,
+		})
+		// 每次 ListObjectsV2 调用都是 Class A 操作
+		r.manager.RecordBackendOperation(b.Config.Name, bucket.OperationTypeA)
+		if err != nil {
+			return nil, fmt.Errorf("list objects: %w", err)
+		}
+
+		for _, obj := range output.Contents {
+			if obj.Key == nil || strings.HasPrefix(*obj.Key, health.CanaryPrefix) {
+				continue
+			}
+			entry := backendObject{
+				size: aws.ToInt64(obj.Size),
+				etag: normalizeETag(aws.ToString(obj.ETag)),
+			}
+			if obj.LastModified != nil {
+				entry.lastModified = *obj.LastModified
+			}
+			result[*obj.Key] = entry
+		}
+
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			break
+		}
+		continuationToken = output.NextContinuationToken
+	}
+
+	return result, nil
+}
+
+// adoptOrphan 为孤儿对象创建虚拟映射与对象记录
+func (r *Reconciler) adoptOrphan(bucketName, key string, size int64, virtualBucket string, f *Finding) {
+	if existing, err := r.storage.GetObjectInfo(key); err == nil && existing.BucketName != bucketName {
+		f.Error = fmt.Sprintf("key already recorded in bucket %s", existing.BucketName)
+		return
+	}
+	// 包括进行中的上传，避免与其抢占同一个键
+	if _, err := r.storage.GetUploadMapping(virtualBucket, key); err == nil {
+		f.Error = fmt.Sprintf("key already mapped in virtual bucket %s", virtualBucket)
+		return
+	}
+
+	// 映射、对象记录与统计在同一事务中提交
+	if _, err := r.storage.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: virtualBucket,
+		ObjectKey:         key,
+		RealBucketName:    bucketName,
+		RealObjectKey:     key,
+		Size:              size,
+	}); err != nil {
+		f.Error = err.Error()
+		return
+	}
+	f.Action = "adopted into " + virtualBucket
+}
+
+// deleteOrphan 将后端孤儿对象加入待删除队列，由回收器删除
+// 孤儿判断基于扫描前的映射快照，期间提交的上传会在回收器删除前的引用检查中被发现
+func (r *Reconciler) deleteOrphan(bucketName, key string, f *Finding) {
+	referenced, err := r.storage.IsRealObjectReferenced(bucketName, key)
+	if err != nil {
+		f.Error = err.Error()
+		return
+	}
+	if referenced {
+		f.Action = "skipped, referenced since scan"
+		return
+	}
+	if _, err := r.storage.EnqueuePendingDeletion(bucketName, key); err != nil {
+		f.Error = err.Error()
+		return
+	}
+	f.Action = "queued for deletion"
+}
+
+// purgeMapping 删除指向不存在对象的映射；没有其他映射引用真实对象时一并删除对象记录并加入待删除队列
+// （后端对象已不存在，回收器会把 NotFound 视为删除成功）
+func (r *Reconciler) purgeMapping(m *storage.VirtualBucketMapping, f *Finding) {
+	_, deleted, err := r.storage.DeleteMappingAndEnqueue(m.VirtualBucketName, m.ObjectKey, m.RealBucketName, m.RealObjectKey)
+	if err != nil {
+		f.Error = err.Error()
+		return
+	}
+	f.Action = "mapping purged"
+	if deleted != nil {
+		f.Action = "mapping and object record purged"
+	}
+}
+
+// purgeObject 删除指向不存在对象的对象记录
+func (r *Reconciler) purgeObject(key string, f *Finding) {
+	if err := r.storage.DeleteObject(key); err != nil {
+		f.Error = err.Error()
+		return
+	}
+	f.Action = "object record purged"
+}
+
+// normalizeETag 去掉ETag两侧的引号
+func normalizeETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+func objectKeyIfDifferent(objectKey, realKey string) string {
+	if objectKey == realKey {
+		return ""
+	}
+	return objectKey
+}
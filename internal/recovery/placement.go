@@ -0,0 +1,52 @@
+package recovery
+
+import (
+	"net/url"
+	"strings"
+)
+
+// 写入后端对象用户元数据的放置标记（SDK 的 Metadata 键，不含 x-amz-meta- 前缀）
+// 后端响应头中对应 x-amz-meta-s3balance-vbucket 与 x-amz-meta-s3balance-vkey
+const (
+	MetadataVirtualBucket = "s3balance-vbucket"
+	MetadataVirtualKey    = "s3balance-vkey"
+)
+
+// PlacementMetadata 返回上传时写入后端的放置标记
+// 虚拟key按路径转义，保证非 ASCII 字符在 HTTP 头中可以原样往返
+func PlacementMetadata(virtualBucket, virtualKey string) map[string]string {
+	return map[string]string{
+		MetadataVirtualBucket: virtualBucket,
+		MetadataVirtualKey:    url.PathEscape(virtualKey),
+	}
+}
+
+// ParsePlacement 从后端对象的用户元数据中解析放置标记（键不区分大小写）
+func ParsePlacement(metadata map[string]string) (virtualBucket, virtualKey string, ok bool) {
+	var rawKey string
+	for k, v := range metadata {
+		switch strings.ToLower(k) {
+		case MetadataVirtualBucket:
+			virtualBucket = v
+		case MetadataVirtualKey:
+			rawKey = v
+		}
+	}
+	if virtualBucket == "" || rawKey == "" {
+		return "", "", false
+	}
+	virtualKey, err := url.PathUnescape(rawKey)
+	if err != nil {
+		return "", "", false
+	}
+	return virtualBucket, virtualKey, true
+}
+
+// isPlacementKey 判断用户元数据键是否为放置标记
+func isPlacementKey(key string) bool {
+	switch strings.ToLower(key) {
+	case MetadataVirtualBucket, MetadataVirtualKey:
+		return true
+	}
+	return false
+}
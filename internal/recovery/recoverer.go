@@ -0,0 +1,459 @@
+// Package recovery 在元数据数据库丢失且没有备份时，根据后端对象上的放置标记重建对象记录与虚拟映射
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/health"
+	"github.com/DullJZ/s3-balance/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// 发现类型
+const (
+	KindUnmarked             = "unmarked"               // 后端对象没有放置标记（标记功能上线前写入，或不是经代理写入）
+	KindConflict             = "conflict"               // 多个后端对象声明同一个虚拟对象，保留较新的一个
+	KindKeyCollision         = "key_collision"          // 不同存储桶中存在同名对象，对象记录只能保留一个
+	KindUnknownVirtualBucket = "unknown_virtual_bucket" // 标记中的虚拟存储桶不在当前配置中（仍然恢复）
+	KindHeadFailed           = "head_failed"            // 读取对象元数据失败
+	KindWriteFailed          = "write_failed"           // 写入元数据存储失败
+)
+
+// 默认并发读取元数据的数量
+const defaultConcurrency = 8
+
+// Options 一次恢复的参数
+type Options struct {
+	Buckets       []string      // 只扫描这些真实存储桶，为空表示全部
+	DryRun        bool          // 只报告，不写入元数据存储
+	AdoptUnmarked string        // 没有标记的对象按原key收编到该虚拟存储桶，为空时只报告
+	Concurrency   int           // 并发 HeadObject 数量
+	PageInterval  time.Duration // 两次列出请求之间的最小间隔
+	StatePath     string        // 进度文件，为空时不可续扫
+}
+
+// Finding 一条发现
+type Finding struct {
+	Kind          string `json:"kind"`
+	Bucket        string `json:"bucket"`                   // 真实存储桶
+	Key           string `json:"key"`                      // 后端对象key
+	VirtualBucket string `json:"virtual_bucket,omitempty"` // 标记中的虚拟存储桶
+	VirtualKey    string `json:"virtual_key,omitempty"`    // 标记中的虚拟key（与后端key不同时）
+	Existing      string `json:"existing,omitempty"`       // 冲突的另一方（bucket/key）
+	Action        string `json:"action,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Report 恢复结果
+type Report struct {
+	DryRun     bool           `json:"dry_run"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Buckets    []string       `json:"buckets"`
+	Skipped    []string       `json:"skipped,omitempty"` // 进度文件中已完成的存储桶
+	Scanned    int64          `json:"scanned"`
+	Restored   int64          `json:"restored"`
+	Counts     map[string]int `json:"counts"`
+	Findings   []Finding      `json:"findings"`
+	Errors     []string       `json:"errors"`
+}
+
+// BucketProgress 单个存储桶的扫描进度
+type BucketProgress struct {
+	ContinuationToken string    `json:"continuation_token,omitempty"`
+	Done              bool      `json:"done"`
+	Scanned           int64     `json:"scanned"`
+	Restored          int64     `json:"restored"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// State 进度文件内容，每扫描完一页保存一次，中断后从下一页继续
+type State struct {
+	Buckets map[string]*BucketProgress `json:"buckets"`
+}
+
+// LoadState 读取进度文件，不存在时返回空进度
+func LoadState(path string) (*State, error) {
+	state := &State{Buckets: make(map[string]*BucketProgress)}
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recovery state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid recovery state %s: %w", path, err)
+	}
+	if state.Buckets == nil {
+		state.Buckets = make(map[string]*BucketProgress)
+	}
+	return state, nil
+}
+
+// save 原子地写入进度文件
+func (s *State) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Recoverer 扫描真实存储桶，按放置标记重建元数据
+type Recoverer struct {
+	manager *bucket.Manager
+	storage storage.MetadataStore
+}
+
+// NewRecoverer 创建恢复器
+func NewRecoverer(manager *bucket.Manager, store storage.MetadataStore) *Recoverer {
+	return &Recoverer{
+		manager: manager,
+		storage: store,
+	}
+}
+
+// placement 一个虚拟对象在本次扫描中选定的后端位置（dry-run 时代替元数据存储检测冲突）
+type placement struct {
+	bucket       string
+	key          string
+	lastModified time.Time
+}
+
+// headResult 一个后端对象的元数据
+type headResult struct {
+	key          string
+	size         int64
+	etag         string
+	contentType  string
+	lastModified time.Time
+	metadata     map[string]string
+	err          error
+}
+
+// Run 扫描真实存储桶并恢复元数据；ctx 取消时保存进度后返回
+func (r *Recoverer) Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.AdoptUnmarked != "" {
+		target, ok := r.manager.GetBucket(opts.AdoptUnmarked)
+		if !ok || !target.IsVirtual() {
+			return nil, fmt.Errorf("adopt target %s is not a virtual bucket", opts.AdoptUnmarked)
+		}
+	}
+
+	buckets, err := r.selectBuckets(opts.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	state, err := LoadState(opts.StatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		DryRun:    opts.DryRun,
+		StartedAt: time.Now(),
+		Buckets:   []string{},
+		Counts:    make(map[string]int),
+		Findings:  []Finding{},
+		Errors:    []string{},
+	}
+	seen := make(map[string]placement)
+
+	for _, b := range buckets {
+		name := b.Config.Name
+		progress := state.Buckets[name]
+		if progress == nil {
+			progress = &BucketProgress{}
+			state.Buckets[name] = progress
+		}
+		if progress.Done {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+
+		report.Buckets = append(report.Buckets, name)
+		if err := r.recoverBucket(ctx, b, opts, progress, state, seen, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("bucket %s: %v", name, err))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	for _, f := range report.Findings {
+		report.Counts[f.Kind]++
+	}
+	report.FinishedAt = time.Now()
+	return report, ctx.Err()
+}
+
+// selectBuckets 返回需要扫描的真实存储桶
+func (r *Recoverer) selectBuckets(names []string) ([]*bucket.BucketInfo, error) {
+	if len(names) == 0 {
+		return r.manager.GetRealBuckets(), nil
+	}
+
+	var buckets []*bucket.BucketInfo
+	for _, name := range names {
+		b, ok := r.manager.GetBucket(name)
+		if !ok || b.IsVirtual() {
+			return nil, fmt.Errorf("%s is not a real bucket", name)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// recoverBucket 从进度中的续扫标记开始逐页扫描一个真实存储桶
+func (r *Recoverer) recoverBucket(ctx context.Context, b *bucket.BucketInfo, opts Options, progress *BucketProgress, state *State, seen map[string]placement, report *Report) error {
+	name := b.Config.Name
+	var continuationToken *string
+	if progress.ContinuationToken != "" {
+		continuationToken = aws.String(progress.ContinuationToken)
+	}
+
+	for page := 0; ; page++ {
+		if page > 0 && opts.PageInterval > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(opts.PageInterval):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		output, err := b.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(name),
+			ContinuationToken: continuationToken,
+		})
+		r.manager.RecordBackendOperation(name, bucket.OperationTypeA)
+		if err != nil {
+			return fmt.Errorf("list objects: %w", err)
+		}
+
+		var keys []string
+		for _, obj := range output.Contents {
+			if obj.Key == nil || strings.HasPrefix(*obj.Key, health.CanaryPrefix) {
+				continue
+			}
+			keys = append(keys, *obj.Key)
+		}
+
+		for _, h := range r.headObjects(ctx, b, keys, opts.Concurrency) {
+			if ctx.Err() != nil {
+				// 本页未处理完，不推进进度，下次从本页重新开始（恢复是幂等的）
+				return ctx.Err()
+			}
+			report.Scanned++
+			progress.Scanned++
+			if r.recoverObject(name, h, opts, seen, report) {
+				report.Restored++
+				progress.Restored++
+			}
+		}
+
+		truncated := output.IsTruncated != nil && *output.IsTruncated
+		progress.ContinuationToken = aws.ToString(output.NextContinuationToken)
+		progress.Done = !truncated
+		progress.UpdatedAt = time.Now()
+		if !opts.DryRun {
+			if err := state.save(opts.StatePath); err != nil {
+				return fmt.Errorf("failed to save recovery state: %w", err)
+			}
+		}
+		if !truncated {
+			return nil
+		}
+		continuationToken = output.NextContinuationToken
+	}
+}
+
+// headObjects 并发读取一页对象的元数据，结果顺序与 keys 相同
+func (r *Recoverer) headObjects(ctx context.Context, b *bucket.BucketInfo, keys []string, concurrency int) []headResult {
+	results := make([]headResult, len(keys))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := headResult{key: key}
+			output, err := b.Client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(b.Config.Name),
+				Key:    aws.String(key),
+			})
+			// HeadObject 是 Class B 操作
+			r.manager.RecordBackendOperation(b.Config.Name, bucket.OperationTypeB)
+			if err != nil {
+				result.err = err
+			} else {
+				result.size = aws.ToInt64(output.ContentLength)
+				result.etag = aws.ToString(output.ETag)
+				result.contentType = aws.ToString(output.ContentType)
+				result.metadata = output.Metadata
+				if output.LastModified != nil {
+					result.lastModified = *output.LastModified
+				}
+			}
+			results[i] = result
+		}(i, key)
+	}
+	wg.Wait()
+	return results
+}
+
+// recoverObject 根据一个后端对象的放置标记恢复映射与对象记录，返回是否写入（dry-run 时为是否会写入）
+func (r *Recoverer) recoverObject(bucketName string, h headResult, opts Options, seen map[string]placement, report *Report) bool {
+	if h.err != nil {
+		report.Findings = append(report.Findings, Finding{Kind: KindHeadFailed, Bucket: bucketName, Key: h.key, Error: h.err.Error()})
+		return false
+	}
+
+	virtualBucket, virtualKey, marked := ParsePlacement(h.metadata)
+	if !marked {
+		f := Finding{Kind: KindUnmarked, Bucket: bucketName, Key: h.key}
+		if opts.AdoptUnmarked == "" {
+			report.Findings = append(report.Findings, f)
+			return false
+		}
+		virtualBucket, virtualKey = opts.AdoptUnmarked, h.key
+		f.Action = "adopted into " + virtualBucket
+		report.Findings = append(report.Findings, f)
+	}
+
+	base := Finding{Bucket: bucketName, Key: h.key, VirtualBucket: virtualBucket}
+	if virtualKey != h.key {
+		base.VirtualKey = virtualKey
+	}
+	if target, ok := r.manager.GetBucket(virtualBucket); !ok || !target.IsVirtual() {
+		f := base
+		f.Kind = KindUnknownVirtualBucket
+		f.Action = "restored anyway"
+		report.Findings = append(report.Findings, f)
+	}
+
+	// 同一个虚拟对象被多个后端对象声明时，保留最后写入的一个
+	var replaced placement
+	if other, ok := r.currentPlacement(virtualBucket, virtualKey, seen, opts.DryRun); ok && (other.bucket != bucketName || other.key != h.key) {
+		f := base
+		f.Kind = KindConflict
+		f.Existing = other.bucket + "/" + other.key
+		if !h.lastModified.After(other.lastModified) {
+			f.Action = "kept existing (newer)"
+			report.Findings = append(report.Findings, f)
+			return false
+		}
+		f.Action = "replaced existing (older); run reconcile to clean up the older copy"
+		report.Findings = append(report.Findings, f)
+		replaced = other
+	}
+
+	obj := &storage.Object{
+		Key:         h.key,
+		BucketName:  bucketName,
+		Size:        h.size,
+		ContentType: h.contentType,
+		ETag:        h.etag,
+		Metadata:    make(storage.JSON),
+		CreatedAt:   h.lastModified,
+		UpdatedAt:   h.lastModified,
+	}
+	for k, v := range h.metadata {
+		if !isPlacementKey(k) {
+			obj.Metadata[k] = v
+		}
+	}
+	mapping := &storage.VirtualBucketMapping{
+		VirtualBucketName: virtualBucket,
+		ObjectKey:         virtualKey,
+		RealBucketName:    bucketName,
+		RealObjectKey:     h.key,
+		Status:            storage.UploadStatusCommitted,
+		CreatedAt:         h.lastModified,
+		UpdatedAt:         h.lastModified,
+	}
+	records := []interface{}{obj, mapping}
+
+	// 对象记录只按key区分，不同存储桶中的同名对象只能保留较新的一个
+	// 被上面的冲突替换掉的旧副本不再重复报告
+	if existing, err := r.storage.GetObjectInfo(h.key); err == nil && existing.BucketName != bucketName &&
+		(existing.BucketName != replaced.bucket || existing.Key != replaced.key) {
+		f := base
+		f.Kind = KindKeyCollision
+		f.Existing = existing.BucketName + "/" + existing.Key
+		if !h.lastModified.After(existing.UpdatedAt) {
+			f.Action = "mapping restored, kept existing object record (newer)"
+			records = records[1:]
+		} else {
+			f.Action = "mapping restored, replaced object record (older)"
+		}
+		report.Findings = append(report.Findings, f)
+	}
+
+	if opts.DryRun {
+		seen[virtualBucket+"\x00"+virtualKey] = placement{bucket: bucketName, key: h.key, lastModified: h.lastModified}
+		return true
+	}
+	if err := r.storage.ImportMetadata(records); err != nil {
+		f := base
+		f.Kind = KindWriteFailed
+		f.Error = err.Error()
+		report.Findings = append(report.Findings, f)
+		return false
+	}
+	return true
+}
+
+// currentPlacement 返回虚拟对象当前的后端位置：先看元数据存储（包括此前运行恢复的结果），dry-run 时看本次扫描的记录
+func (r *Recoverer) currentPlacement(virtualBucket, virtualKey string, seen map[string]placement, dryRun bool) (placement, bool) {
+	if dryRun {
+		p, ok := seen[virtualBucket+"\x00"+virtualKey]
+		if ok {
+			return p, true
+		}
+	}
+
+	mapping, err := r.storage.GetUploadMapping(virtualBucket, virtualKey)
+	if err != nil {
+		return placement{}, false
+	}
+	p := placement{bucket: mapping.RealBucketName, key: mapping.RealObjectKey, lastModified: mapping.UpdatedAt}
+	if obj, err := r.storage.GetObjectInfo(mapping.RealObjectKey); err == nil && obj.BucketName == mapping.RealBucketName {
+		p.lastModified = obj.UpdatedAt
+	}
+	return p, true
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// defaultRollupBackfill 原始日志永久保留时，首次汇总向前回溯的时间
+const defaultRollupBackfill = 30 * 24 * time.Hour
+
+// AccessLogMaintainer 访问日志维护任务：生成小时与天汇总，并按保留天数清理过期数据
+type AccessLogMaintainer struct {
+	storage  storage.MetadataStore
+	config   config.AccessLogConfig
+	ticker   *time.Ticker
+	stopChan chan struct{}
+}
+
+// NewAccessLogMaintainer 创建访问日志维护任务
+func NewAccessLogMaintainer(storage storage.MetadataStore, cfg config.AccessLogConfig, checkInterval time.Duration) *AccessLogMaintainer {
+	return &AccessLogMaintainer{
+		storage:  storage,
+		config:   cfg,
+		ticker:   time.NewTicker(checkInterval),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动访问日志维护定期任务
+func (m *AccessLogMaintainer) Start() {
+	logger.Info("Starting access log maintainer")
+
+	go func() {
+		// 启动时立即执行一次，补齐停机期间的汇总
+		m.runOnce(time.Now())
+		for {
+			select {
+			case <-m.ticker.C:
+				m.runOnce(time.Now())
+			case <-m.stopChan:
+				logger.Info("Access log maintainer stopped")
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止维护任务
+func (m *AccessLogMaintainer) Stop() {
+	close(m.stopChan)
+	m.ticker.Stop()
+}
+
+// runOnce 先汇总再清理，保证原始日志在删除前已计入汇总
+func (m *AccessLogMaintainer) runOnce(now time.Time) {
+	if m.config.RollupEnabled() {
+		m.rollup(now)
+	}
+
+	if cutoff, ok := retentionCutoff(now, m.config.RetentionDays); ok {
+		if deleted, err := m.storage.PruneAccessLogs(cutoff); err != nil {
+			logger.Error("Failed to prune access logs", "error", err)
+		} else if deleted > 0 {
+			logger.Info("Pruned access logs", "deleted", deleted, "before", cutoff)
+		}
+	}
+	m.pruneRollups(storage.RollupHour, now, m.config.HourlyRetentionDays)
+	m.pruneRollups(storage.RollupDay, now, m.config.DailyRetentionDays)
+}
+
+// rollup 从最新的汇总周期重新计算到当前时间（最新周期可能在上次计算后还有新日志）
+// 没有汇总时从数据源的保留起点开始，已被清理的周期不会重新计算
+func (m *AccessLogMaintainer) rollup(now time.Time) {
+	hourlyFrom := now.Add(-defaultRollupBackfill)
+	if cutoff, ok := retentionCutoff(now, m.config.RetentionDays); ok {
+		hourlyFrom = cutoff
+	}
+	m.rollupFrom(storage.RollupHour, hourlyFrom, now)
+
+	dailyFrom := now.Add(-defaultRollupBackfill)
+	if cutoff, ok := retentionCutoff(now, m.config.HourlyRetentionDays); ok {
+		dailyFrom = cutoff
+	}
+	m.rollupFrom(storage.RollupDay, dailyFrom, now)
+}
+
+// rollupFrom 汇总 [start, now) 内的周期，start 为最新汇总周期与数据源保留起点中较晚的一个
+// 数据源保留起点所在的周期可能已被部分清理，从下一个完整周期开始
+func (m *AccessLogMaintainer) rollupFrom(granularity string, sourceFrom, now time.Time) {
+	start := storage.RollupPeriodStart(granularity, sourceFrom).Add(storage.RollupDuration(granularity))
+	latest, err := m.storage.LatestAccessLogRollup(granularity)
+	if err != nil {
+		logger.Error("Failed to get latest access log rollup", "granularity", granularity, "error", err)
+		return
+	}
+	if !latest.IsZero() && latest.After(start) {
+		start = latest
+	}
+
+	if err := m.storage.RollupAccessLogs(granularity, start, now); err != nil {
+		logger.Error("Failed to roll up access logs", "granularity", granularity, "error", err)
+	}
+}
+
+func (m *AccessLogMaintainer) pruneRollups(granularity string, now time.Time, days int) {
+	cutoff, ok := retentionCutoff(now, days)
+	if !ok {
+		return
+	}
+	deleted, err := m.storage.PruneAccessLogRollups(granularity, cutoff)
+	if err != nil {
+		logger.Error("Failed to prune access log rollups", "granularity", granularity, "error", err)
+		return
+	}
+	if deleted > 0 {
+		logger.Info("Pruned access log rollups", "granularity", granularity, "deleted", deleted, "before", cutoff)
+	}
+}
+
+// retentionCutoff 返回保留天数对应的清理时间点，0 表示永久保留
+func retentionCutoff(now time.Time, days int) (time.Time, bool) {
+	if days <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -days), true
+}
@@ -1,22 +1,24 @@
 package scheduler
 
 import (
-	"log"
 	"time"
 
+	"github.com/DullJZ/s3-balance/internal/logging"
 	"github.com/DullJZ/s3-balance/internal/storage"
 )
 
+var logger = logging.Logger(logging.SubsystemScheduler)
+
 // MonthlyArchiver 月度统计归档器
 type MonthlyArchiver struct {
-	storage          *storage.Service
+	storage          storage.MetadataStore
 	ticker           *time.Ticker
 	stopChan         chan struct{}
 	lastArchivedDate string // 格式: "2025-01" - 记录上次归档的月份
 }
 
 // NewMonthlyArchiver 创建月度归档器
-func NewMonthlyArchiver(storage *storage.Service, checkInterval time.Duration) *MonthlyArchiver {
+func NewMonthlyArchiver(storage storage.MetadataStore, checkInterval time.Duration) *MonthlyArchiver {
 	return &MonthlyArchiver{
 		storage:  storage,
 		ticker:   time.NewTicker(checkInterval),
@@ -26,7 +28,7 @@ func NewMonthlyArchiver(storage *storage.Service, checkInterval time.Duration) *
 
 // Start 启动月度归档定期任务
 func (m *MonthlyArchiver) Start() {
-	log.Println("Starting monthly statistics archiver...")
+	logger.Info("Starting monthly statistics archiver")
 
 	// 启动时立即归档上个月的数据（如果还没有归档）
 	m.archiveLastMonth()
@@ -37,7 +39,7 @@ func (m *MonthlyArchiver) Start() {
 			case <-m.ticker.C:
 				m.checkAndArchive()
 			case <-m.stopChan:
-				log.Println("Monthly statistics archiver stopped")
+				logger.Info("Monthly statistics archiver stopped")
 				return
 			}
 		}
@@ -72,14 +74,14 @@ func (m *MonthlyArchiver) archiveLastMonth() {
 	lastMonth := now.AddDate(0, -1, 0)
 	year, month := lastMonth.Year(), int(lastMonth.Month())
 
-	log.Printf("Archiving monthly stats for %d-%02d...", year, month)
+	logger.Info("Archiving monthly stats", "year", year, "month", month)
 
 	if err := m.storage.ArchiveMonthlyStats(year, month); err != nil {
-		log.Printf("Failed to archive monthly stats for %d-%02d: %v", year, month, err)
+		logger.Error("Failed to archive monthly stats", "year", year, "month", month, "error", err)
 		return
 	}
 
-	log.Printf("Successfully archived monthly stats for %d-%02d", year, month)
+	logger.Info("Archived monthly stats", "year", year, "month", month)
 }
 
 // archiveCurrentMonth 归档当前月份（实时更新）
@@ -88,9 +90,9 @@ func (m *MonthlyArchiver) archiveCurrentMonth() {
 	year, month := now.Year(), int(now.Month())
 
 	if err := m.storage.ArchiveMonthlyStats(year, month); err != nil {
-		log.Printf("Failed to update current month stats for %d-%02d: %v", year, month, err)
+		logger.Error("Failed to update current month stats", "year", year, "month", month, "error", err)
 		return
 	}
 
-	log.Printf("Updated current month stats for %d-%02d", year, month)
+	logger.Debug("Updated current month stats", "year", year, "month", month)
 }
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 访问日志汇总粒度
+const (
+	RollupHour = "hour"
+	RollupDay  = "day"
+)
+
+// RollupDuration 返回汇总粒度对应的周期长度，未知粒度返回 0
+func RollupDuration(granularity string) time.Duration {
+	switch granularity {
+	case RollupHour:
+		return time.Hour
+	case RollupDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// RollupPeriodStart 返回 t 所在汇总周期的开始时间（UTC）
+func RollupPeriodStart(granularity string, t time.Time) time.Time {
+	return t.UTC().Truncate(RollupDuration(granularity))
+}
+
+// rollupPeriods 返回 [start, end) 内各汇总周期的开始时间
+func rollupPeriods(granularity string, start, end time.Time) ([]time.Time, error) {
+	step := RollupDuration(granularity)
+	if step == 0 {
+		return nil, fmt.Errorf("unknown rollup granularity: %s", granularity)
+	}
+	var periods []time.Time
+	for period := RollupPeriodStart(granularity, start); period.Before(end); period = period.Add(step) {
+		periods = append(periods, period)
+	}
+	return periods, nil
+}
+
+// filterAccessLogs 应用访问日志过滤条件（不含分页）
+func (s *Service) filterAccessLogs(query *gorm.DB, filter *AccessLogFilter) *gorm.DB {
+	if filter == nil {
+		return query
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Key != "" {
+		query = query.Where(s.keyColumn()+" = ?", filter.Key)
+	}
+	if filter.BucketName != "" {
+		query = query.Where("bucket_name = ?", filter.BucketName)
+	}
+	if filter.ClientIP != "" {
+		query = query.Where("client_ip = ?", filter.ClientIP)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	// 访问日志的时间按本地时区写入，过滤时转换为相同时区
+	if !filter.StartTime.IsZero() {
+		query = query.Where("created_at >= ?", filter.StartTime.Local())
+	}
+	if !filter.EndTime.IsZero() {
+		query = query.Where("created_at <= ?", filter.EndTime.Local())
+	}
+	return query
+}
+
+// CountAccessLogs 返回满足过滤条件的访问日志数量（忽略 Limit 与 Offset）
+func (s *Service) CountAccessLogs(filter *AccessLogFilter) (int64, error) {
+	var total int64
+	if err := s.filterAccessLogs(s.db.Model(&AccessLog{}), filter).Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to count access logs: %w", err)
+	}
+	return total, nil
+}
+
+// PruneAccessLogs 删除早于 before 的访问日志，返回删除的数量
+func (s *Service) PruneAccessLogs(before time.Time) (int64, error) {
+	result := s.db.Where("created_at < ?", before).Delete(&AccessLog{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune access logs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RollupAccessLogs 重新计算 [start, end) 内各周期的汇总并替换已有结果，可重复执行
+// 小时汇总由访问日志计算，天汇总由小时汇总计算
+func (s *Service) RollupAccessLogs(granularity string, start, end time.Time) error {
+	periods, err := rollupPeriods(granularity, start, end)
+	if err != nil {
+		return err
+	}
+
+	for _, period := range periods {
+		next := period.Add(RollupDuration(granularity))
+		var rows []*AccessLogRollup
+		var query *gorm.DB
+		if granularity == RollupHour {
+			// 访问日志的时间按本地时区写入，SQLite 以字符串比较时间，需使用相同时区
+			query = s.db.Model(&AccessLog{}).
+				Select("bucket_name, action, COUNT(*) AS requests, COALESCE(SUM(size), 0) AS bytes, "+
+					"SUM(CASE WHEN success THEN 0 ELSE 1 END) AS errors").
+				Where("created_at >= ? AND created_at < ?", period.Local(), next.Local())
+		} else {
+			query = s.db.Model(&AccessLogRollup{}).
+				Select("bucket_name, action, SUM(requests) AS requests, SUM(bytes) AS bytes, SUM(errors) AS errors").
+				Where("granularity = ? AND period_start >= ? AND period_start < ?", RollupHour, period, next)
+		}
+		if err := query.Group("bucket_name, action").Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed to aggregate access logs for %s %s: %w", granularity, period.Format(time.RFC3339), err)
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("granularity = ? AND period_start = ?", granularity, period).
+				Delete(&AccessLogRollup{}).Error; err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			for _, row := range rows {
+				row.Granularity = granularity
+				row.PeriodStart = period
+			}
+			return tx.Create(rows).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save access log rollup for %s %s: %w", granularity, period.Format(time.RFC3339), err)
+		}
+	}
+	return nil
+}
+
+// GetAccessLogRollups 查询访问日志汇总，按周期、存储桶、操作排序
+func (s *Service) GetAccessLogRollups(filter *AccessLogRollupFilter) ([]*AccessLogRollup, error) {
+	query := s.db.Model(&AccessLogRollup{})
+	if filter != nil {
+		if filter.Granularity != "" {
+			query = query.Where("granularity = ?", filter.Granularity)
+		}
+		if filter.BucketName != "" {
+			query = query.Where("bucket_name = ?", filter.BucketName)
+		}
+		if filter.Action != "" {
+			query = query.Where("action = ?", filter.Action)
+		}
+		if !filter.StartTime.IsZero() {
+			query = query.Where("period_start >= ?", filter.StartTime.UTC())
+		}
+		if !filter.EndTime.IsZero() {
+			query = query.Where("period_start < ?", filter.EndTime.UTC())
+		}
+	}
+
+	rollups := make([]*AccessLogRollup, 0)
+	if err := query.Order("period_start ASC, bucket_name ASC, action ASC").Find(&rollups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get access log rollups: %w", err)
+	}
+	return rollups, nil
+}
+
+// LatestAccessLogRollup 返回指定粒度最新汇总周期的开始时间，没有汇总时返回零值
+func (s *Service) LatestAccessLogRollup(granularity string) (time.Time, error) {
+	var latest AccessLogRollup
+	result := s.db.Where("granularity = ?", granularity).Order("period_start DESC").Limit(1).Find(&latest)
+	if result.Error != nil {
+		return time.Time{}, fmt.Errorf("failed to get latest access log rollup: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return time.Time{}, nil
+	}
+	return latest.PeriodStart.UTC(), nil
+}
+
+// PruneAccessLogRollups 删除指定粒度中周期早于 before 的汇总，返回删除的数量
+func (s *Service) PruneAccessLogRollups(granularity string, before time.Time) (int64, error) {
+	result := s.db.Where("granularity = ? AND period_start < ?", granularity, before.UTC()).Delete(&AccessLogRollup{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune access log rollups: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// apiTokenPrefix 生成的令牌统一前缀，方便在日志和密钥扫描中识别
+	apiTokenPrefix = "s3b_"
+	// apiTokenTouchInterval 最后使用时间的最小更新间隔，避免每个请求都写库
+	apiTokenTouchInterval = time.Minute
+)
+
+// HashAPIToken 计算令牌的SHA-256哈希
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken 创建命名令牌，返回仅此一次可见的明文令牌
+func (s *Service) CreateAPIToken(name, role string, expiresAt *time.Time) (string, *APIToken, error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("token name cannot be empty")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	plaintext := apiTokenPrefix + hex.EncodeToString(raw)
+
+	token := &APIToken{
+		Name:      name,
+		TokenHash: HashAPIToken(plaintext),
+		Prefix:    plaintext[:len(apiTokenPrefix)+6],
+		Role:      role,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.db.Create(token).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return plaintext, token, nil
+}
+
+// ListAPITokens 列出所有令牌（包括已吊销的）
+func (s *Service) ListAPITokens() ([]*APIToken, error) {
+	var tokens []*APIToken
+	if err := s.db.Order("id ASC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// GetAPIToken 获取指定ID的令牌
+func (s *Service) GetAPIToken(id uint) (*APIToken, error) {
+	var token APIToken
+	if err := s.db.First(&token, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("api token not found: %d", id)
+		}
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+	return &token, nil
+}
+
+// RevokeAPIToken 吊销令牌（保留记录用于审计）
+func (s *Service) RevokeAPIToken(id uint) error {
+	result := s.db.Model(&APIToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke api token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("api token not found or already revoked: %d", id)
+	}
+	return nil
+}
+
+// AuthenticateAPIToken 校验明文令牌，令牌不存在、已吊销或已过期时返回 nil, nil
+func (s *Service) AuthenticateAPIToken(plaintext string) (*APIToken, error) {
+	var token APIToken
+	if err := s.db.Where("token_hash = ?", HashAPIToken(plaintext)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up api token: %w", err)
+	}
+
+	if !token.IsActive() {
+		return nil, nil
+	}
+
+	// 节流更新最后使用时间
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+		if err := s.db.Model(&APIToken{}).Where("id = ?", token.ID).
+			UpdateColumn("last_used_at", now).Error; err == nil {
+			token.LastUsedAt = &now
+		}
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 审计结果
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// ErrAuditLogImmutable 审计记录只能追加
+var ErrAuditLogImmutable = errors.New("audit logs are append-only")
+
+// RecordAuditLog 追加一条审计记录
+func (s *Service) RecordAuditLog(entry *AuditLog) error {
+	if entry.Actor == "" || entry.Action == "" {
+		return fmt.Errorf("audit log requires actor and action")
+	}
+	if entry.Result == "" {
+		entry.Result = AuditResultSuccess
+	}
+
+	if err := s.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLogs 查询审计记录，返回当前页与满足条件的总数
+func (s *Service) GetAuditLogs(filter *AuditLogFilter) ([]*AuditLog, int64, error) {
+	query := s.db.Model(&AuditLog{})
+
+	if filter != nil {
+		if filter.Actor != "" {
+			query = query.Where("actor = ?", filter.Actor)
+		}
+		if filter.Action != "" {
+			query = query.Where("action = ?", filter.Action)
+		}
+		if filter.Resource != "" {
+			query = query.Where("resource = ?", filter.Resource)
+		}
+		if filter.Result != "" {
+			query = query.Where("result = ?", filter.Result)
+		}
+		if !filter.StartTime.IsZero() {
+			query = query.Where("created_at >= ?", filter.StartTime)
+		}
+		if !filter.EndTime.IsZero() {
+			query = query.Where("created_at <= ?", filter.EndTime)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+
+	if filter != nil {
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+		if filter.Offset > 0 {
+			query = query.Offset(filter.Offset)
+		}
+	}
+
+	var logs []*AuditLog
+	if err := query.Order("id DESC").Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get audit logs: %w", err)
+	}
+
+	return logs, total, nil
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ---- 访问日志查询、清理与汇总 ----
+
+// rollupKeyPrefix 返回汇总周期的键前缀：granularity\x00period（unix 秒，大端）
+func rollupKeyPrefix(granularity string, period time.Time) []byte {
+	key := make([]byte, 0, len(granularity)+9)
+	key = append(key, granularity...)
+	key = append(key, 0)
+	return binary.BigEndian.AppendUint64(key, uint64(period.Unix()))
+}
+
+// rollupKey 返回汇总记录的键
+func rollupKey(r *AccessLogRollup) []byte {
+	key := rollupKeyPrefix(r.Granularity, r.PeriodStart)
+	return append(key, compositeKey(r.BucketName, r.Action)...)
+}
+
+// rollupKeyPeriod 从汇总记录的键中解析周期开始时间，offset 为粒度前缀的长度
+func rollupKeyPeriod(key []byte, offset int) time.Time {
+	if len(key) < offset+8 {
+		return time.Time{}
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(key[offset:offset+8])), 0).UTC()
+}
+
+// CountAccessLogs 返回满足过滤条件的访问日志数量（忽略 Limit 与 Offset）
+func (b *BoltStore) CountAccessLogs(filter *AccessLogFilter) (int64, error) {
+	if filter == nil {
+		filter = &AccessLogFilter{}
+	}
+	var total int64
+	err := b.view(func(t *boltTx) error {
+		return t.bucket(boltAccessLogs).ForEach(func(_, v []byte) error {
+			var entry AccessLog
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if matchAccessLog(&entry, filter) {
+				total++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count access logs: %w", err)
+	}
+	return total, nil
+}
+
+// PruneAccessLogs 删除早于 before 的访问日志，返回删除的数量
+// 批量写入的日志时间不严格随 ID 递增，需要扫描全部日志
+func (b *BoltStore) PruneAccessLogs(before time.Time) (int64, error) {
+	var deleted int64
+	err := b.update(func(t *boltTx) error {
+		bkt := t.bucket(boltAccessLogs)
+		var keys [][]byte
+		if err := bkt.ForEach(func(k, v []byte) error {
+			var entry AccessLog
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if entry.CreatedAt.Before(before) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = int64(len(keys))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune access logs: %w", err)
+	}
+	return deleted, nil
+}
+
+// RollupAccessLogs 重新计算 [start, end) 内各周期的汇总并替换已有结果，可重复执行
+// 小时汇总由访问日志计算，天汇总由小时汇总计算
+func (b *BoltStore) RollupAccessLogs(granularity string, start, end time.Time) error {
+	periods, err := rollupPeriods(granularity, start, end)
+	if err != nil {
+		return err
+	}
+	if len(periods) == 0 {
+		return nil
+	}
+	step := RollupDuration(granularity)
+	first, last := periods[0], periods[len(periods)-1].Add(step)
+
+	err = b.update(func(t *boltTx) error {
+		// 周期开始时间 -> 存储桶\x00操作 -> 汇总
+		rows := make(map[int64]map[string]*AccessLogRollup, len(periods))
+		add := func(period time.Time, bucketName, action string, requests, size, failed int64) {
+			byKey := rows[period.Unix()]
+			if byKey == nil {
+				byKey = make(map[string]*AccessLogRollup)
+				rows[period.Unix()] = byKey
+			}
+			key := string(compositeKey(bucketName, action))
+			row := byKey[key]
+			if row == nil {
+				row = &AccessLogRollup{Granularity: granularity, PeriodStart: period, BucketName: bucketName, Action: action}
+				byKey[key] = row
+			}
+			row.Requests += requests
+			row.Bytes += size
+			row.Errors += failed
+		}
+
+		if granularity == RollupHour {
+			if err := t.bucket(boltAccessLogs).ForEach(func(_, v []byte) error {
+				var entry AccessLog
+				if err := json.Unmarshal(v, &entry); err != nil {
+					return err
+				}
+				if entry.CreatedAt.Before(first) || !entry.CreatedAt.Before(last) {
+					return nil
+				}
+				var failed int64
+				if !entry.Success {
+					failed = 1
+				}
+				add(RollupPeriodStart(granularity, entry.CreatedAt), entry.BucketName, entry.Action, 1, entry.Size, failed)
+				return nil
+			}); err != nil {
+				return err
+			}
+		} else {
+			c := t.bucket(boltAccessLogRollups).Cursor()
+			from, to := rollupKeyPrefix(RollupHour, first), rollupKeyPrefix(RollupHour, last)
+			for k, v := c.Seek(from); k != nil && bytes.Compare(k, to) < 0; k, v = c.Next() {
+				var hourly AccessLogRollup
+				if err := json.Unmarshal(v, &hourly); err != nil {
+					return err
+				}
+				add(RollupPeriodStart(granularity, hourly.PeriodStart), hourly.BucketName, hourly.Action,
+					hourly.Requests, hourly.Bytes, hourly.Errors)
+			}
+		}
+
+		bkt := t.bucket(boltAccessLogRollups)
+		now := time.Now()
+		for _, period := range periods {
+			prefix := rollupKeyPrefix(granularity, period)
+			var stale [][]byte
+			c := bkt.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			for _, k := range stale {
+				if err := bkt.Delete(k); err != nil {
+					return err
+				}
+			}
+			for _, row := range rows[period.Unix()] {
+				row.UpdatedAt = now
+				if err := putJSON(bkt, rollupKey(row), row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll up access logs: %w", err)
+	}
+	return nil
+}
+
+// GetAccessLogRollups 查询访问日志汇总，按周期、存储桶、操作排序
+func (b *BoltStore) GetAccessLogRollups(filter *AccessLogRollupFilter) ([]*AccessLogRollup, error) {
+	if filter == nil {
+		filter = &AccessLogRollupFilter{}
+	}
+
+	rollups := make([]*AccessLogRollup, 0)
+	err := b.view(func(t *boltTx) error {
+		return t.bucket(boltAccessLogRollups).ForEach(func(_, v []byte) error {
+			var row AccessLogRollup
+			if err := json.Unmarshal(v, &row); err != nil {
+				return err
+			}
+			if filter.Granularity != "" && row.Granularity != filter.Granularity {
+				return nil
+			}
+			if filter.BucketName != "" && row.BucketName != filter.BucketName {
+				return nil
+			}
+			if filter.Action != "" && row.Action != filter.Action {
+				return nil
+			}
+			if !filter.StartTime.IsZero() && row.PeriodStart.Before(filter.StartTime) {
+				return nil
+			}
+			if !filter.EndTime.IsZero() && !row.PeriodStart.Before(filter.EndTime) {
+				return nil
+			}
+			rollups = append(rollups, &row)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access log rollups: %w", err)
+	}
+
+	sort.Slice(rollups, func(i, j int) bool {
+		a, c := rollups[i], rollups[j]
+		if !a.PeriodStart.Equal(c.PeriodStart) {
+			return a.PeriodStart.Before(c.PeriodStart)
+		}
+		if a.BucketName != c.BucketName {
+			return a.BucketName < c.BucketName
+		}
+		return a.Action < c.Action
+	})
+	return rollups, nil
+}
+
+// LatestAccessLogRollup 返回指定粒度最新汇总周期的开始时间，没有汇总时返回零值
+func (b *BoltStore) LatestAccessLogRollup(granularity string) (time.Time, error) {
+	var latest time.Time
+	err := b.view(func(t *boltTx) error {
+		prefix := append([]byte(granularity), 0)
+		c := t.bucket(boltAccessLogRollups).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			latest = rollupKeyPeriod(k, len(prefix))
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get latest access log rollup: %w", err)
+	}
+	return latest, nil
+}
+
+// PruneAccessLogRollups 删除指定粒度中周期早于 before 的汇总，返回删除的数量
+func (b *BoltStore) PruneAccessLogRollups(granularity string, before time.Time) (int64, error) {
+	var deleted int64
+	err := b.update(func(t *boltTx) error {
+		bkt := t.bucket(boltAccessLogRollups)
+		prefix := append([]byte(granularity), 0)
+		var keys [][]byte
+		c := bkt.Cursor()
+		// 键按周期有序，遇到不早于 before 的周期即可停止
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if !rollupKeyPeriod(k, len(prefix)).Before(before) {
+				break
+			}
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = int64(len(keys))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune access log rollups: %w", err)
+	}
+	return deleted, nil
+}
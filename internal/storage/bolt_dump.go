@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ExportMetadata 在一个只读事务（一致快照）中导出元数据，顺序与 Service.ExportMetadata 相同
+func (b *BoltStore) ExportMetadata(fn func(record interface{}) error) error {
+	return b.view(func(t *boltTx) error {
+		exports := []struct {
+			bucket []byte
+			decode func(v []byte) (interface{}, error)
+		}{
+			{boltObjects, func(v []byte) (interface{}, error) {
+				var obj Object
+				return &obj, json.Unmarshal(v, &obj)
+			}},
+			{boltMappings, func(v []byte) (interface{}, error) {
+				var m VirtualBucketMapping
+				return &m, json.Unmarshal(v, &m)
+			}},
+			{boltSessions, func(v []byte) (interface{}, error) {
+				var session UploadSession
+				return &session, json.Unmarshal(v, &session)
+			}},
+			{boltBucketStats, func(v []byte) (interface{}, error) {
+				var stats BucketStats
+				return &stats, json.Unmarshal(v, &stats)
+			}},
+			{boltMonthlyStats, func(v []byte) (interface{}, error) {
+				var stats BucketMonthlyStats
+				return &stats, json.Unmarshal(v, &stats)
+			}},
+		}
+
+		for _, e := range exports {
+			if err := scanPrefix(t.bucket(e.bucket), nil, func(k, v []byte) (bool, error) {
+				record, err := e.decode(v)
+				if err != nil {
+					return false, err
+				}
+				return true, fn(record)
+			}); err != nil {
+				return fmt.Errorf("failed to export %s: %w", e.bucket, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ImportMetadata 在一个事务中写入一批导出的记录，按自然键覆盖已有记录并保留时间戳
+func (b *BoltStore) ImportMetadata(records []interface{}) error {
+	return b.update(func(t *boltTx) error {
+		for _, record := range records {
+			if err := t.importRecord(record); err != nil {
+				return fmt.Errorf("failed to import %T: %w", record, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (t *boltTx) importRecord(record interface{}) error {
+	switch r := record.(type) {
+	case *Object:
+		// 经 putObject 写入以维护存储桶索引和统计；统计记录随后由导入的 BucketStats 覆盖
+		old, err := t.getObject(r.Key)
+		if err != nil {
+			return err
+		}
+		r.ID = 0
+		if old != nil {
+			r.ID = old.ID
+		}
+		return t.putObject(r, old)
+
+	case *VirtualBucketMapping:
+		old, err := t.getMapping(r.VirtualBucketName, r.ObjectKey)
+		if err != nil {
+			return err
+		}
+		var existing uint
+		if old != nil {
+			existing = old.ID
+		}
+		if r.ID, err = keepOrNextID(t.bucket(boltMappings), existing); err != nil {
+			return err
+		}
+		if err := putJSON(t.bucket(boltMappings), compositeKey(r.VirtualBucketName, r.ObjectKey), r); err != nil {
+			return err
+		}
+		if old != nil {
+			if err := t.bucket(boltMappingsByReal).Delete(mappingRealKey(old)); err != nil {
+				return err
+			}
+		}
+		return t.bucket(boltMappingsByReal).Put(mappingRealKey(r), nil)
+
+	case *UploadSession:
+		old, err := t.getSession(r.UploadID)
+		if err != nil {
+			return err
+		}
+		var existing uint
+		if old != nil {
+			existing = old.ID
+		}
+		if r.ID, err = keepOrNextID(t.bucket(boltSessions), existing); err != nil {
+			return err
+		}
+		return putJSON(t.bucket(boltSessions), []byte(r.UploadID), r)
+
+	case *BucketStats:
+		var old BucketStats
+		if _, err := getJSON(t.bucket(boltBucketStats), []byte(r.BucketName), &old); err != nil {
+			return err
+		}
+		var err error
+		if r.ID, err = keepOrNextID(t.bucket(boltBucketStats), old.ID); err != nil {
+			return err
+		}
+		return putJSON(t.bucket(boltBucketStats), []byte(r.BucketName), r)
+
+	case *BucketMonthlyStats:
+		key := monthlyStatsKey(r.BucketName, r.Year, r.Month)
+		var old BucketMonthlyStats
+		if _, err := getJSON(t.bucket(boltMonthlyStats), key, &old); err != nil {
+			return err
+		}
+		var err error
+		if r.ID, err = keepOrNextID(t.bucket(boltMonthlyStats), old.ID); err != nil {
+			return err
+		}
+		return putJSON(t.bucket(boltMonthlyStats), key, r)
+	}
+	return fmt.Errorf("unsupported metadata record type %T", record)
+}
+
+// keepOrNextID 覆盖已有记录时沿用其主键（existing 非 0），否则分配新主键
+func keepOrNextID(bkt *bolt.Bucket, existing uint) (uint, error) {
+	if existing != 0 {
+		return existing, nil
+	}
+	return nextID(bkt)
+}
+
+// CountMetadata 统计各类可导出元数据的记录数
+func (b *BoltStore) CountMetadata() (*MetadataCounts, error) {
+	counts := &MetadataCounts{}
+	err := b.view(func(t *boltTx) error {
+		counts.Objects = int64(t.bucket(boltObjects).Stats().KeyN)
+		counts.Mappings = int64(t.bucket(boltMappings).Stats().KeyN)
+		counts.UploadSessions = int64(t.bucket(boltSessions).Stats().KeyN)
+		counts.BucketStats = int64(t.bucket(boltBucketStats).Stats().KeyN)
+		counts.MonthlyStats = int64(t.bucket(boltMonthlyStats).Stats().KeyN)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count metadata: %w", err)
+	}
+	return counts, nil
+}
@@ -0,0 +1,538 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ---- 存储桶统计 ----
+
+func (t *boltTx) getBucketStats(bucketName string) (*BucketStats, error) {
+	var stats BucketStats
+	found, err := getJSON(t.bucket(boltBucketStats), []byte(bucketName), &stats)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &BucketStats{BucketName: bucketName}, nil
+	}
+	return &stats, nil
+}
+
+func (t *boltTx) putBucketStats(stats *BucketStats) error {
+	now := time.Now()
+	if stats.ID == 0 {
+		id, err := nextID(t.bucket(boltBucketStats))
+		if err != nil {
+			return err
+		}
+		stats.ID = id
+		stats.CreatedAt = now
+	}
+	stats.UpdatedAt = now
+	if err := putJSON(t.bucket(boltBucketStats), []byte(stats.BucketName), stats); err != nil {
+		return fmt.Errorf("failed to update bucket stats: %w", err)
+	}
+	return nil
+}
+
+// adjustBucketStats 增量更新存储桶的对象数与总大小
+func (t *boltTx) adjustBucketStats(bucketName string, countDelta, sizeDelta int64) error {
+	stats, err := t.getBucketStats(bucketName)
+	if err != nil {
+		return err
+	}
+	stats.ObjectCount += countDelta
+	stats.TotalSize += sizeDelta
+	stats.LastCheckedAt = time.Now()
+	return t.putBucketStats(stats)
+}
+
+// allBucketStats 列出全部存储桶统计
+func (t *boltTx) allBucketStats() ([]BucketStats, error) {
+	var result []BucketStats
+	err := scanPrefix(t.bucket(boltBucketStats), nil, func(k, v []byte) (bool, error) {
+		var stats BucketStats
+		if err := json.Unmarshal(v, &stats); err != nil {
+			return false, err
+		}
+		result = append(result, stats)
+		return true, nil
+	})
+	return result, err
+}
+
+func (b *BoltStore) getBucketStats(bucketName string) (*BucketStats, error) {
+	var stats *BucketStats
+	err := b.view(func(t *boltTx) error {
+		var err error
+		stats, err = t.getBucketStats(bucketName)
+		return err
+	})
+	return stats, err
+}
+
+// IncrementBucketOperation 增加指定存储桶的操作计数
+func (b *BoltStore) IncrementBucketOperation(bucketName, category string) (int64, error) {
+	if bucketName == "" {
+		return 0, fmt.Errorf("bucket name cannot be empty")
+	}
+	if category != "A" && category != "B" {
+		return 0, fmt.Errorf("unknown operation category: %s", category)
+	}
+
+	var count int64
+	err := b.update(func(t *boltTx) error {
+		stats, err := t.getBucketStats(bucketName)
+		if err != nil {
+			return err
+		}
+		if stats.ID == 0 {
+			stats.LastCheckedAt = time.Now()
+		}
+		if category == "A" {
+			stats.OperationCountA++
+			count = stats.OperationCountA
+		} else {
+			stats.OperationCountB++
+			count = stats.OperationCountB
+		}
+		return t.putBucketStats(stats)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment operation count for bucket %s: %w", bucketName, err)
+	}
+	return count, nil
+}
+
+// AddBucketOperations 在一个事务中累加多个存储桶的操作计数，返回累加后的计数
+func (b *BoltStore) AddBucketOperations(deltas map[string]OperationCounts) (map[string]OperationCounts, error) {
+	result := make(map[string]OperationCounts, len(deltas))
+	if len(deltas) == 0 {
+		return result, nil
+	}
+	err := b.update(func(t *boltTx) error {
+		for name, delta := range deltas {
+			if name == "" {
+				return fmt.Errorf("bucket name cannot be empty")
+			}
+			stats, err := t.getBucketStats(name)
+			if err != nil {
+				return err
+			}
+			if stats.ID == 0 {
+				stats.LastCheckedAt = time.Now()
+			}
+			stats.OperationCountA += delta.CountA
+			stats.OperationCountB += delta.CountB
+			if err := t.putBucketStats(stats); err != nil {
+				return err
+			}
+			result[name] = OperationCounts{CountA: stats.OperationCountA, CountB: stats.OperationCountB}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add operation counts: %w", err)
+	}
+	return result, nil
+}
+
+// GetBucketOperationCounts 获取所有存储桶的操作计数
+func (b *BoltStore) GetBucketOperationCounts() (map[string]OperationCounts, error) {
+	var stats []BucketStats
+	err := b.view(func(t *boltTx) error {
+		var err error
+		stats, err = t.allBucketStats()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bucket stats: %w", err)
+	}
+
+	result := make(map[string]OperationCounts, len(stats))
+	for _, st := range stats {
+		result[st.BucketName] = OperationCounts{
+			CountA: st.OperationCountA,
+			CountB: st.OperationCountB,
+		}
+	}
+	return result, nil
+}
+
+// ---- 月度统计 ----
+
+func monthlyStatsKey(bucketName string, year, month int) []byte {
+	return compositeKey(bucketName, fmt.Sprintf("%04d%02d", year, month))
+}
+
+// allMonthlyStats 列出全部月度归档（按存储桶、年月排序）
+func (t *boltTx) allMonthlyStats() ([]BucketMonthlyStats, error) {
+	var result []BucketMonthlyStats
+	err := scanPrefix(t.bucket(boltMonthlyStats), nil, func(k, v []byte) (bool, error) {
+		var stats BucketMonthlyStats
+		if err := json.Unmarshal(v, &stats); err != nil {
+			return false, err
+		}
+		result = append(result, stats)
+		return true, nil
+	})
+	return result, err
+}
+
+// cumulativeBefore 累加 year/month（含）之前的所有月度增量，得到当时的累计值
+func cumulativeBefore(archived []BucketMonthlyStats, year, month int) (map[string]int64, map[string]int64) {
+	cumulativeA := make(map[string]int64)
+	cumulativeB := make(map[string]int64)
+	for _, s := range archived {
+		if s.Year < year || (s.Year == year && s.Month <= month) {
+			cumulativeA[s.BucketName] += s.OperationCountA
+			cumulativeB[s.BucketName] += s.OperationCountB
+		}
+	}
+	return cumulativeA, cumulativeB
+}
+
+// monthIncrement 计算本月增量，数据不一致出现负值时取0
+func monthIncrement(current, lastCumulative int64) int64 {
+	if current < lastCumulative {
+		return 0
+	}
+	return current - lastCumulative
+}
+
+func previousMonth(year, month int) (int, int) {
+	if month == 1 {
+		return year - 1, 12
+	}
+	return year, month - 1
+}
+
+// ArchiveMonthlyStats 归档指定月份的统计数据（存储增量值，非累计值）
+func (b *BoltStore) ArchiveMonthlyStats(year, month int) error {
+	return b.update(func(t *boltTx) error {
+		currentStats, err := t.allBucketStats()
+		if err != nil {
+			return fmt.Errorf("failed to fetch bucket stats: %w", err)
+		}
+		archived, err := t.allMonthlyStats()
+		if err != nil {
+			return fmt.Errorf("failed to fetch monthly stats: %w", err)
+		}
+		lastYear, lastMonth := previousMonth(year, month)
+		lastA, lastB := cumulativeBefore(archived, lastYear, lastMonth)
+
+		bkt := t.bucket(boltMonthlyStats)
+		now := time.Now()
+		for _, stat := range currentStats {
+			key := monthlyStatsKey(stat.BucketName, year, month)
+			monthly := BucketMonthlyStats{BucketName: stat.BucketName, Year: year, Month: month, CreatedAt: now}
+			if _, err := getJSON(bkt, key, &monthly); err != nil {
+				return err
+			}
+			if monthly.ID == 0 {
+				if monthly.ID, err = nextID(bkt); err != nil {
+					return err
+				}
+			}
+			monthly.OperationCountA = monthIncrement(stat.OperationCountA, lastA[stat.BucketName])
+			monthly.OperationCountB = monthIncrement(stat.OperationCountB, lastB[stat.BucketName])
+			monthly.UpdatedAt = now
+			if err := putJSON(bkt, key, &monthly); err != nil {
+				return fmt.Errorf("failed to archive monthly stats for bucket %s: %w", stat.BucketName, err)
+			}
+		}
+		return nil
+	})
+}
+
+// filterMonthlyStats 按条件筛选月度归档
+func (b *BoltStore) filterMonthlyStats(keep func(s *BucketMonthlyStats) bool) ([]BucketMonthlyStats, error) {
+	var all []BucketMonthlyStats
+	if err := b.view(func(t *boltTx) error {
+		var err error
+		all, err = t.allMonthlyStats()
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	result := make([]BucketMonthlyStats, 0)
+	for i := range all {
+		if keep(&all[i]) {
+			result = append(result, all[i])
+		}
+	}
+	return result, nil
+}
+
+// GetMonthlyStats 获取指定月份的统计数据
+func (b *BoltStore) GetMonthlyStats(year, month int) ([]BucketMonthlyStats, error) {
+	stats, err := b.filterMonthlyStats(func(s *BucketMonthlyStats) bool {
+		return s.Year == year && s.Month == month
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monthly stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetMonthlyStatsRange 获取指定时间范围的统计数据（按年、月、存储桶排序）
+func (b *BoltStore) GetMonthlyStatsRange(startYear, startMonth, endYear, endMonth int) ([]BucketMonthlyStats, error) {
+	start, end := startYear*100+startMonth, endYear*100+endMonth
+	stats, err := b.filterMonthlyStats(func(s *BucketMonthlyStats) bool {
+		ym := s.Year*100 + s.Month
+		return ym >= start && ym <= end
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monthly stats range: %w", err)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Year != stats[j].Year {
+			return stats[i].Year < stats[j].Year
+		}
+		if stats[i].Month != stats[j].Month {
+			return stats[i].Month < stats[j].Month
+		}
+		return stats[i].BucketName < stats[j].BucketName
+	})
+	return stats, nil
+}
+
+// GetCurrentMonthStats 获取当前月份的实时统计（从累计操作数计算增量）
+func (b *BoltStore) GetCurrentMonthStats() ([]BucketMonthlyStats, error) {
+	now := time.Now()
+	year, month := now.Year(), int(now.Month())
+
+	var currentStats []BucketStats
+	var archived []BucketMonthlyStats
+	if err := b.view(func(t *boltTx) error {
+		var err error
+		if currentStats, err = t.allBucketStats(); err != nil {
+			return err
+		}
+		archived, err = t.allMonthlyStats()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to fetch current bucket stats: %w", err)
+	}
+
+	lastYear, lastMonth := previousMonth(year, month)
+	lastA, lastB := cumulativeBefore(archived, lastYear, lastMonth)
+
+	result := make([]BucketMonthlyStats, 0, len(currentStats))
+	for _, current := range currentStats {
+		result = append(result, BucketMonthlyStats{
+			BucketName:      current.BucketName,
+			Year:            year,
+			Month:           month,
+			OperationCountA: monthIncrement(current.OperationCountA, lastA[current.BucketName]),
+			OperationCountB: monthIncrement(current.OperationCountB, lastB[current.BucketName]),
+			UpdatedAt:       now,
+		})
+	}
+	return result, nil
+}
+
+// GetBucketMonthlyHistory 获取指定存储桶的月度历史统计（最近的在前）
+func (b *BoltStore) GetBucketMonthlyHistory(bucketName string, months int) ([]BucketMonthlyStats, error) {
+	result := make([]BucketMonthlyStats, 0)
+	err := b.view(func(t *boltTx) error {
+		prefix := prefixKey(bucketName)
+		c := t.bucket(boltMonthlyStats).Cursor()
+		// 定位到该存储桶最后一条记录后逆序遍历
+		k, v := c.Seek(append(prefix, 0xff))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+			if months > 0 && len(result) >= months {
+				break
+			}
+			var stats BucketMonthlyStats
+			if err := json.Unmarshal(v, &stats); err != nil {
+				return err
+			}
+			result = append(result, stats)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bucket monthly history: %w", err)
+	}
+	return result, nil
+}
+
+// ---- 对账扫描进度 ----
+
+// GetUsageScanState 获取存储桶的对账扫描进度，不存在时返回未保存的初始状态
+func (b *BoltStore) GetUsageScanState(bucketName string) (*UsageScanState, error) {
+	state := &UsageScanState{BucketName: bucketName}
+	if err := b.view(func(t *boltTx) error {
+		_, err := getJSON(t.bucket(boltUsageScanStates), []byte(bucketName), state)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get usage scan state: %w", err)
+	}
+	return state, nil
+}
+
+// SaveUsageScanState 保存存储桶的对账扫描进度
+func (b *BoltStore) SaveUsageScanState(state *UsageScanState) error {
+	if state.BucketName == "" {
+		return fmt.Errorf("bucket name cannot be empty")
+	}
+	if err := b.update(func(t *boltTx) error {
+		bkt := t.bucket(boltUsageScanStates)
+		if state.ID == 0 {
+			var existing UsageScanState
+			found, err := getJSON(bkt, []byte(state.BucketName), &existing)
+			if err != nil {
+				return err
+			}
+			if found {
+				state.ID = existing.ID
+			} else if state.ID, err = nextID(bkt); err != nil {
+				return err
+			}
+		}
+		state.UpdatedAt = time.Now()
+		return putJSON(bkt, []byte(state.BucketName), state)
+	}); err != nil {
+		return fmt.Errorf("failed to save usage scan state: %w", err)
+	}
+	return nil
+}
+
+// GetUntrackedSize 返回最近一次对账扫描发现的、代理未记录的数据大小
+func (b *BoltStore) GetUntrackedSize(bucketName string) (int64, error) {
+	state, err := b.GetUsageScanState(bucketName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get untracked size: %w", err)
+	}
+	return state.UntrackedSize, nil
+}
+
+// ---- 访问日志 ----
+
+// RecordAccessLog 记录访问日志
+func (b *BoltStore) RecordAccessLog(action, key, bucketName, clientIP, userAgent, host string, size int64, success bool, errorMsg string, responseTime int64) error {
+	entry := &AccessLog{
+		Action:       action,
+		Key:          key,
+		BucketName:   bucketName,
+		ClientIP:     clientIP,
+		UserAgent:    userAgent,
+		Host:         host,
+		Size:         size,
+		Success:      success,
+		ErrorMsg:     errorMsg,
+		ResponseTime: responseTime,
+		CreatedAt:    time.Now(),
+	}
+	if err := b.update(func(t *boltTx) error {
+		bkt := t.bucket(boltAccessLogs)
+		var err error
+		if entry.ID, err = nextID(bkt); err != nil {
+			return err
+		}
+		return putJSON(bkt, idKey(entry.ID), entry)
+	}); err != nil {
+		return fmt.Errorf("failed to record access log: %w", err)
+	}
+	return nil
+}
+
+// RecordAccessLogs 在一个事务中批量记录访问日志，CreatedAt 为空的条目使用当前时间
+func (b *BoltStore) RecordAccessLogs(logs []*AccessLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	if err := b.update(func(t *boltTx) error {
+		bkt := t.bucket(boltAccessLogs)
+		for _, entry := range logs {
+			if entry.CreatedAt.IsZero() {
+				entry.CreatedAt = now
+			}
+			var err error
+			if entry.ID, err = nextID(bkt); err != nil {
+				return err
+			}
+			if err := putJSON(bkt, idKey(entry.ID), entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to record access logs: %w", err)
+	}
+	return nil
+}
+
+// GetAccessLogs 获取访问日志（最新的在前）
+func (b *BoltStore) GetAccessLogs(filter *AccessLogFilter) ([]*AccessLog, error) {
+	if filter == nil {
+		filter = &AccessLogFilter{}
+	}
+
+	logs := make([]*AccessLog, 0)
+	err := b.view(func(t *boltTx) error {
+		skipped := 0
+		c := t.bucket(boltAccessLogs).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var entry AccessLog
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !matchAccessLog(&entry, filter) {
+				continue
+			}
+			if skipped < filter.Offset {
+				skipped++
+				continue
+			}
+			logs = append(logs, &entry)
+			if filter.Limit > 0 && len(logs) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access logs: %w", err)
+	}
+	return logs, nil
+}
+
+// matchAccessLog 判断访问日志是否满足过滤条件
+func matchAccessLog(entry *AccessLog, filter *AccessLogFilter) bool {
+	if filter.Action != "" && entry.Action != filter.Action {
+		return false
+	}
+	if filter.Key != "" && entry.Key != filter.Key {
+		return false
+	}
+	if filter.BucketName != "" && entry.BucketName != filter.BucketName {
+		return false
+	}
+	if filter.ClientIP != "" && entry.ClientIP != filter.ClientIP {
+		return false
+	}
+	if filter.Success != nil && entry.Success != *filter.Success {
+		return false
+	}
+	if !filter.StartTime.IsZero() && entry.CreatedAt.Before(filter.StartTime) {
+		return false
+	}
+	if !filter.EndTime.IsZero() && entry.CreatedAt.After(filter.EndTime) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,627 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt 中的桶（相当于表），复合键的各部分以 \x00 分隔，便于按前缀有序扫描
+var (
+	boltObjects          = []byte("objects")              // key -> Object
+	boltObjectsByBucket  = []byte("objects_by_bucket")    // bucket\x00key -> 空（按存储桶索引）
+	boltMappings         = []byte("mappings")             // vbucket\x00key -> VirtualBucketMapping
+	boltMappingsByReal   = []byte("mappings_by_real")     // rbucket\x00rkey\x00vbucket\x00key -> 空（按真实对象索引）
+	boltSessions         = []byte("upload_sessions")      // uploadID -> UploadSession
+	boltBucketStats      = []byte("bucket_stats")         // bucket -> BucketStats
+	boltMonthlyStats     = []byte("bucket_monthly_stats") // bucket\x00yyyymm -> BucketMonthlyStats
+	boltUsageScanStates  = []byte("usage_scan_states")    // bucket -> UsageScanState
+	boltPendingDeletions = []byte("pending_deletions")    // id -> PendingDeletion
+	boltAccessLogs       = []byte("access_logs")          // id -> AccessLog
+	boltAccessLogRollups = []byte("access_log_rollups")   // granularity\x00period(unix 秒，大端)bucket\x00action -> AccessLogRollup
+
+	boltBuckets = [][]byte{
+		boltObjects, boltObjectsByBucket, boltMappings, boltMappingsByReal, boltSessions,
+		boltBucketStats, boltMonthlyStats, boltUsageScanStates, boltPendingDeletions, boltAccessLogs,
+		boltAccessLogRollups,
+	}
+)
+
+// BoltStore 基于 bbolt 的内嵌元数据存储，适合单节点部署
+// 对象与映射按键有序存放，前缀列举不需要全表扫描；存储桶统计随写入增量维护
+// 每个方法在一个 bbolt 事务中完成，与 Service 的事务语义一致
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var _ MetadataStore = (*BoltStore)(nil)
+
+// OpenBoltStore 打开（不存在时创建）bbolt 元数据文件
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt metadata store: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt metadata store: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Close 关闭元数据文件
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// WithContext 实现 MetadataStore；bbolt 是进程内存储，没有需要追踪的外部调用，直接返回自身
+func (b *BoltStore) WithContext(ctx context.Context) MetadataStore {
+	return b
+}
+
+// boltTx 封装一次 bbolt 事务内的读写，方法之间共享同一事务
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (b *BoltStore) view(fn func(t *boltTx) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (b *BoltStore) update(fn func(t *boltTx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (t *boltTx) bucket(name []byte) *bolt.Bucket {
+	return t.tx.Bucket(name)
+}
+
+// compositeKey 拼接复合键
+func compositeKey(parts ...string) []byte {
+	return []byte(strings.Join(parts, "\x00"))
+}
+
+// prefixKey 返回复合键前缀（以分隔符结尾，避免 a 匹配到 ab）
+func prefixKey(parts ...string) []byte {
+	return append(compositeKey(parts...), 0)
+}
+
+// idKey 将自增ID编码为大端字节，保证按ID有序
+func idKey(id uint) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// nextID 分配桶内自增ID
+func nextID(bkt *bolt.Bucket) (uint, error) {
+	seq, err := bkt.NextSequence()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate id: %w", err)
+	}
+	return uint(seq), nil
+}
+
+// getJSON 读取并解码一条记录，不存在时返回 false
+func getJSON(bkt *bolt.Bucket, key []byte, v interface{}) (bool, error) {
+	data := bkt.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode %s record: %w", key, err)
+	}
+	return true, nil
+}
+
+// putJSON 编码并写入一条记录
+func putJSON(bkt *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	return bkt.Put(key, data)
+}
+
+// scanPrefix 按键顺序遍历指定前缀的记录，fn 返回 false 时停止
+func scanPrefix(bkt *bolt.Bucket, prefix []byte, fn func(k, v []byte) (bool, error)) error {
+	return scanPrefixFrom(bkt, prefix, nil, fn)
+}
+
+// scanPrefixFrom 与 scanPrefix 相同，但从不小于 start 的第一个键开始
+func scanPrefixFrom(bkt *bolt.Bucket, prefix, start []byte, fn func(k, v []byte) (bool, error)) error {
+	seek := prefix
+	if bytes.Compare(start, prefix) > 0 {
+		seek = start
+	}
+	c := bkt.Cursor()
+	for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		more, err := fn(k, v)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// countPrefix 统计指定前缀的记录数
+func countPrefix(bkt *bolt.Bucket, prefix []byte) int64 {
+	var count int64
+	scanPrefix(bkt, prefix, func(k, v []byte) (bool, error) {
+		count++
+		return true, nil
+	})
+	return count
+}
+
+// ---- 对象记录 ----
+
+func (t *boltTx) getObject(key string) (*Object, error) {
+	var obj Object
+	found, err := getJSON(t.bucket(boltObjects), []byte(key), &obj)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// putObject 写入对象记录，维护存储桶索引与统计（old 为写入前的记录）
+func (t *boltTx) putObject(obj, old *Object) error {
+	if obj.ID == 0 {
+		id, err := nextID(t.bucket(boltObjects))
+		if err != nil {
+			return err
+		}
+		obj.ID = id
+	}
+	if err := putJSON(t.bucket(boltObjects), []byte(obj.Key), obj); err != nil {
+		return fmt.Errorf("failed to record object: %w", err)
+	}
+
+	if old != nil {
+		if err := t.bucket(boltObjectsByBucket).Delete(compositeKey(old.BucketName, old.Key)); err != nil {
+			return err
+		}
+		if err := t.adjustBucketStats(old.BucketName, -1, -old.Size); err != nil {
+			return err
+		}
+	}
+	if err := t.bucket(boltObjectsByBucket).Put(compositeKey(obj.BucketName, obj.Key), nil); err != nil {
+		return err
+	}
+	return t.adjustBucketStats(obj.BucketName, 1, obj.Size)
+}
+
+// deleteObject 删除对象记录，维护存储桶索引与统计
+func (t *boltTx) deleteObject(obj *Object) error {
+	if err := t.bucket(boltObjects).Delete([]byte(obj.Key)); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	if err := t.bucket(boltObjectsByBucket).Delete(compositeKey(obj.BucketName, obj.Key)); err != nil {
+		return err
+	}
+	return t.adjustBucketStats(obj.BucketName, -1, -obj.Size)
+}
+
+// recordObject 新建或覆盖对象记录（与 Service.RecordObject 相同：保留ID、创建时间、类型与ETag）
+func (t *boltTx) recordObject(key, bucketName string, size int64, metadata map[string]string) (*Object, error) {
+	old, err := t.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	obj := &Object{Key: key, CreatedAt: now}
+	if old != nil {
+		copied := *old
+		obj = &copied
+	}
+	obj.BucketName = bucketName
+	obj.Size = size
+	obj.UpdatedAt = now
+	obj.Metadata = make(JSON)
+	for k, v := range metadata {
+		obj.Metadata[k] = v
+	}
+
+	if err := t.putObject(obj, old); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// RecordObject 记录对象信息
+func (b *BoltStore) RecordObject(key, bucketName string, size int64, metadata map[string]string) error {
+	return b.update(func(t *boltTx) error {
+		_, err := t.recordObject(key, bucketName, size, metadata)
+		return err
+	})
+}
+
+// GetObjectInfo 获取对象信息
+func (b *BoltStore) GetObjectInfo(key string) (*Object, error) {
+	var obj *Object
+	err := b.view(func(t *boltTx) error {
+		var err error
+		obj, err = t.getObject(key)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object info: %w", err)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return obj, nil
+}
+
+// DeleteObject 删除对象记录
+func (b *BoltStore) DeleteObject(key string) error {
+	return b.update(func(t *boltTx) error {
+		obj, err := t.getObject(key)
+		if err != nil {
+			return fmt.Errorf("failed to find object: %w", err)
+		}
+		if obj == nil {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return t.deleteObject(obj)
+	})
+}
+
+// ListObjects 列出对象（按 key 排序，支持存储桶、前缀、marker 与数量限制）
+func (b *BoltStore) ListObjects(bucketName, prefix, marker string, maxKeys int) ([]*Object, error) {
+	objects := make([]*Object, 0)
+	err := b.view(func(t *boltTx) error {
+		collect := func(key string) (bool, error) {
+			if marker != "" && key <= marker {
+				return true, nil
+			}
+			obj, err := t.getObject(key)
+			if err != nil {
+				return false, err
+			}
+			if obj != nil {
+				objects = append(objects, obj)
+			}
+			return maxKeys <= 0 || len(objects) < maxKeys, nil
+		}
+
+		// 直接定位到 marker 之后的第一个键
+		var start []byte
+		if marker != "" {
+			start = append([]byte(marker), 0)
+		}
+
+		if bucketName != "" {
+			scope := prefixKey(bucketName)
+			from := append(append([]byte{}, scope...), start...)
+			return scanPrefixFrom(t.bucket(boltObjectsByBucket), append(scope, prefix...), from, func(k, v []byte) (bool, error) {
+				return collect(string(k[len(scope):]))
+			})
+		}
+		return scanPrefixFrom(t.bucket(boltObjects), []byte(prefix), start, func(k, v []byte) (bool, error) {
+			return collect(string(k))
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
+
+// GetBucketObjects 获取特定存储桶的所有对象
+func (b *BoltStore) GetBucketObjects(bucketName string) ([]*Object, error) {
+	objects, err := b.ListObjects(bucketName, "", "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket objects: %w", err)
+	}
+	return objects, nil
+}
+
+// GetBucketSize 获取特定存储桶的总大小
+func (b *BoltStore) GetBucketSize(bucketName string) (int64, error) {
+	stats, err := b.getBucketStats(bucketName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get bucket size: %w", err)
+	}
+	return stats.TotalSize, nil
+}
+
+// GetBucketObjectCount 获取特定存储桶的对象数
+func (b *BoltStore) GetBucketObjectCount(bucketName string) (int64, error) {
+	stats, err := b.getBucketStats(bucketName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get bucket object count: %w", err)
+	}
+	return stats.ObjectCount, nil
+}
+
+// ---- 虚拟映射 ----
+
+func (t *boltTx) getMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error) {
+	var mapping VirtualBucketMapping
+	found, err := getJSON(t.bucket(boltMappings), compositeKey(virtualBucketName, objectKey), &mapping)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+func mappingRealKey(m *VirtualBucketMapping) []byte {
+	return compositeKey(m.RealBucketName, m.RealObjectKey, m.VirtualBucketName, m.ObjectKey)
+}
+
+// putMapping 写入映射并维护真实对象索引（old 为写入前的记录）
+func (t *boltTx) putMapping(m, old *VirtualBucketMapping) error {
+	now := time.Now()
+	if m.ID == 0 {
+		id, err := nextID(t.bucket(boltMappings))
+		if err != nil {
+			return err
+		}
+		m.ID = id
+		m.CreatedAt = now
+	}
+	if m.Status == "" {
+		m.Status = UploadStatusCommitted
+	}
+	m.UpdatedAt = now
+
+	if err := putJSON(t.bucket(boltMappings), compositeKey(m.VirtualBucketName, m.ObjectKey), m); err != nil {
+		return fmt.Errorf("failed to write virtual bucket mapping: %w", err)
+	}
+	if old != nil {
+		if err := t.bucket(boltMappingsByReal).Delete(mappingRealKey(old)); err != nil {
+			return err
+		}
+	}
+	return t.bucket(boltMappingsByReal).Put(mappingRealKey(m), nil)
+}
+
+// deleteMapping 删除映射及其索引
+func (t *boltTx) deleteMapping(m *VirtualBucketMapping) error {
+	if err := t.bucket(boltMappings).Delete(compositeKey(m.VirtualBucketName, m.ObjectKey)); err != nil {
+		return fmt.Errorf("failed to delete virtual bucket mapping: %w", err)
+	}
+	return t.bucket(boltMappingsByReal).Delete(mappingRealKey(m))
+}
+
+// mappingsWithPrefix 按映射键前缀列出映射
+func (t *boltTx) mappingsWithPrefix(prefix []byte, committedOnly bool) ([]*VirtualBucketMapping, error) {
+	mappings := make([]*VirtualBucketMapping, 0)
+	err := scanPrefix(t.bucket(boltMappings), prefix, func(k, v []byte) (bool, error) {
+		var m VirtualBucketMapping
+		if err := json.Unmarshal(v, &m); err != nil {
+			return false, fmt.Errorf("failed to decode mapping %q: %w", k, err)
+		}
+		if !committedOnly || m.Status == UploadStatusCommitted {
+			mappings = append(mappings, &m)
+		}
+		return true, nil
+	})
+	return mappings, err
+}
+
+// mappingsForReal 通过真实对象索引列出映射
+func (t *boltTx) mappingsForReal(prefix []byte) ([]*VirtualBucketMapping, error) {
+	mappings := make([]*VirtualBucketMapping, 0)
+	err := scanPrefix(t.bucket(boltMappingsByReal), prefix, func(k, v []byte) (bool, error) {
+		parts := bytes.SplitN(k, []byte{0}, 4)
+		if len(parts) != 4 {
+			return true, nil
+		}
+		m, err := t.getMapping(string(parts[2]), string(parts[3]))
+		if err != nil {
+			return false, err
+		}
+		if m != nil {
+			mappings = append(mappings, m)
+		}
+		return true, nil
+	})
+	return mappings, err
+}
+
+func (t *boltTx) countMappingsToRealObject(realBucketName, realObjectKey string) int64 {
+	return countPrefix(t.bucket(boltMappingsByReal), prefixKey(realBucketName, realObjectKey))
+}
+
+// CreateVirtualBucketMapping 创建虚拟存储桶文件级映射（已存在时覆盖）
+func (b *BoltStore) CreateVirtualBucketMapping(virtualBucketName, objectKey, realBucketName, realObjectKey string) error {
+	return b.update(func(t *boltTx) error {
+		old, err := t.getMapping(virtualBucketName, objectKey)
+		if err != nil {
+			return err
+		}
+		m := &VirtualBucketMapping{}
+		if old != nil {
+			copied := *old
+			m = &copied
+		}
+		m.VirtualBucketName = virtualBucketName
+		m.ObjectKey = objectKey
+		m.RealBucketName = realBucketName
+		m.RealObjectKey = realObjectKey
+		m.Status = UploadStatusCommitted
+		return t.putMapping(m, old)
+	})
+}
+
+// GetVirtualBucketMapping 获取虚拟存储桶文件级映射（只返回已提交的映射）
+func (b *BoltStore) GetVirtualBucketMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error) {
+	mapping, err := b.GetUploadMapping(virtualBucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Status != UploadStatusCommitted {
+		return nil, fmt.Errorf("%w: %s/%s", ErrMappingNotFound, virtualBucketName, objectKey)
+	}
+	return mapping, nil
+}
+
+// GetUploadMapping 获取虚拟映射，不区分状态
+func (b *BoltStore) GetUploadMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error) {
+	var mapping *VirtualBucketMapping
+	err := b.view(func(t *boltTx) error {
+		var err error
+		mapping, err = t.getMapping(virtualBucketName, objectKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get virtual bucket mapping: %w", err)
+	}
+	if mapping == nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrMappingNotFound, virtualBucketName, objectKey)
+	}
+	return mapping, nil
+}
+
+// GetVirtualBucketMappingsForBucket 获取指定虚拟存储桶的所有已提交映射
+func (b *BoltStore) GetVirtualBucketMappingsForBucket(virtualBucketName string) ([]*VirtualBucketMapping, error) {
+	var mappings []*VirtualBucketMapping
+	err := b.view(func(t *boltTx) error {
+		var err error
+		mappings, err = t.mappingsWithPrefix(prefixKey(virtualBucketName), true)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get virtual bucket mappings for bucket %s: %w", virtualBucketName, err)
+	}
+	return mappings, nil
+}
+
+// GetVirtualBucketMappingsForRealBucket 获取指向指定真实存储桶的所有已提交映射
+func (b *BoltStore) GetVirtualBucketMappingsForRealBucket(realBucketName string) ([]*VirtualBucketMapping, error) {
+	var mappings []*VirtualBucketMapping
+	err := b.view(func(t *boltTx) error {
+		all, err := t.mappingsForReal(prefixKey(realBucketName))
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if m.Status == UploadStatusCommitted {
+				mappings = append(mappings, m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get virtual bucket mappings for real bucket %s: %w", realBucketName, err)
+	}
+	if mappings == nil {
+		mappings = []*VirtualBucketMapping{}
+	}
+	return mappings, nil
+}
+
+// GetVirtualBucketObjects 获取虚拟存储桶中的所有对象（使用虚拟key，其他信息来自真实对象）
+func (b *BoltStore) GetVirtualBucketObjects(virtualBucketName string) ([]*Object, error) {
+	objects := make([]*Object, 0)
+	err := b.view(func(t *boltTx) error {
+		mappings, err := t.mappingsWithPrefix(prefixKey(virtualBucketName), true)
+		if err != nil {
+			return err
+		}
+		for _, m := range mappings {
+			realObj, err := t.getObject(m.RealObjectKey)
+			if err != nil {
+				return err
+			}
+			if realObj == nil {
+				continue
+			}
+			virtualObj := *realObj
+			virtualObj.Key = m.ObjectKey
+			objects = append(objects, &virtualObj)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get objects for virtual bucket: %w", err)
+	}
+	return objects, nil
+}
+
+// DeleteVirtualBucketMapping 删除虚拟存储桶的所有映射
+func (b *BoltStore) DeleteVirtualBucketMapping(virtualBucketName string) error {
+	return b.update(func(t *boltTx) error {
+		mappings, err := t.mappingsWithPrefix(prefixKey(virtualBucketName), false)
+		if err != nil {
+			return err
+		}
+		for _, m := range mappings {
+			if err := t.deleteMapping(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteVirtualBucketObjectMapping 删除虚拟存储桶中特定对象的映射
+func (b *BoltStore) DeleteVirtualBucketObjectMapping(virtualBucketName, objectKey string) error {
+	return b.update(func(t *boltTx) error {
+		return t.deleteObjectMapping(virtualBucketName, objectKey)
+	})
+}
+
+func (t *boltTx) deleteObjectMapping(virtualBucketName, objectKey string) error {
+	m, err := t.getMapping(virtualBucketName, objectKey)
+	if err != nil || m == nil {
+		return err
+	}
+	return t.deleteMapping(m)
+}
+
+// CountMappingsToRealObject 统计指向同一真实对象的映射数量（包括未提交的）
+func (b *BoltStore) CountMappingsToRealObject(realBucketName, realObjectKey string) (int64, error) {
+	var count int64
+	err := b.view(func(t *boltTx) error {
+		count = t.countMappingsToRealObject(realBucketName, realObjectKey)
+		return nil
+	})
+	return count, err
+}
+
+// CountMappingsForBucket 统计引用指定存储桶的映射数量
+// 分别返回作为真实存储桶被引用的数量和作为虚拟存储桶被引用的数量
+func (b *BoltStore) CountMappingsForBucket(bucketName string) (int64, int64, error) {
+	var realCount, virtualCount int64
+	err := b.view(func(t *boltTx) error {
+		realCount = countPrefix(t.bucket(boltMappingsByReal), prefixKey(bucketName))
+		virtualCount = countPrefix(t.bucket(boltMappings), prefixKey(bucketName))
+		return nil
+	})
+	return realCount, virtualCount, err
+}
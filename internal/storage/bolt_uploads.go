@@ -0,0 +1,596 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- 上传状态机 ----
+
+// BeginUpload 开始一次上传：映射不存在时以 pending 状态创建并返回；已存在的映射原样返回，failed 的映射重新进入 pending
+func (b *BoltStore) BeginUpload(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*VirtualBucketMapping, error) {
+	var result *VirtualBucketMapping
+	err := b.update(func(t *boltTx) error {
+		existing, err := t.getMapping(virtualBucketName, objectKey)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if existing.Status == UploadStatusFailed {
+				old := *existing
+				existing.Status = UploadStatusPending
+				if err := t.putMapping(existing, &old); err != nil {
+					return fmt.Errorf("failed to restart upload: %w", err)
+				}
+			}
+			result = existing
+			return nil
+		}
+
+		mapping := &VirtualBucketMapping{
+			VirtualBucketName: virtualBucketName,
+			ObjectKey:         objectKey,
+			RealBucketName:    realBucketName,
+			RealObjectKey:     realObjectKey,
+			Status:            UploadStatusPending,
+		}
+		if err := t.putMapping(mapping, nil); err != nil {
+			return err
+		}
+		result = mapping
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CommitUpload 后端确认写入后，在同一事务中提交映射、对象记录、存储桶统计和上传会话
+func (b *BoltStore) CommitUpload(c *UploadCommit) (*Object, error) {
+	var previous *Object
+	err := b.update(func(t *boltTx) error {
+		var err error
+		if previous, err = t.getObject(c.RealObjectKey); err != nil {
+			return err
+		}
+
+		current, err := t.getMapping(c.VirtualBucketName, c.ObjectKey)
+		if err != nil {
+			return err
+		}
+		mapping := &VirtualBucketMapping{VirtualBucketName: c.VirtualBucketName, ObjectKey: c.ObjectKey}
+		if current != nil {
+			copied := *current
+			mapping = &copied
+		}
+		mapping.RealBucketName = c.RealBucketName
+		mapping.RealObjectKey = c.RealObjectKey
+		mapping.Status = UploadStatusCommitted
+		if err := t.putMapping(mapping, current); err != nil {
+			return fmt.Errorf("failed to commit virtual bucket mapping: %w", err)
+		}
+
+		obj, err := t.recordObject(c.RealObjectKey, c.RealBucketName, c.Size, c.Metadata)
+		if err != nil {
+			return err
+		}
+		if obj.ETag != c.ETag || obj.BackendETag != c.BackendETag {
+			updated := *obj
+			updated.ETag = c.ETag
+			updated.BackendETag = c.BackendETag
+			if err := t.putObject(&updated, obj); err != nil {
+				return err
+			}
+		}
+		if current != nil && (current.RealBucketName != c.RealBucketName || current.RealObjectKey != c.RealObjectKey) {
+			if _, _, err := t.releaseRealObject(current.RealBucketName, current.RealObjectKey); err != nil {
+				return err
+			}
+		}
+
+		if c.UploadID != "" {
+			return t.updateSession(c.UploadID, func(s *UploadSession) {
+				s.CompletedParts = c.CompletedParts
+				s.Status = "completed"
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// FailUpload 将未提交的映射标记为 failed，并将上传会话（如有）标记为已中止
+func (b *BoltStore) FailUpload(virtualBucketName, objectKey, uploadID string) error {
+	return b.update(func(t *boltTx) error {
+		m, err := t.getMapping(virtualBucketName, objectKey)
+		if err != nil {
+			return err
+		}
+		if m != nil && m.Status == UploadStatusPending {
+			old := *m
+			m.Status = UploadStatusFailed
+			if err := t.putMapping(m, &old); err != nil {
+				return fmt.Errorf("failed to mark upload as failed: %w", err)
+			}
+		}
+
+		if uploadID != "" {
+			return t.updateSession(uploadID, func(s *UploadSession) {
+				s.CompletedParts = 0
+				s.Status = "aborted"
+			})
+		}
+		return nil
+	})
+}
+
+// CopyMapping 在同一事务中让目标虚拟对象指向源对象的真实对象（零拷贝）
+func (b *BoltStore) CopyMapping(sourceBucket, sourceKey, destBucket, destKey string) (*Object, *Object, error) {
+	var source, freed *Object
+	err := b.update(func(t *boltTx) error {
+		src, err := t.getMapping(sourceBucket, sourceKey)
+		if err != nil {
+			return err
+		}
+		if src == nil || src.Status != UploadStatusCommitted {
+			return fmt.Errorf("%w: %s/%s", ErrMappingNotFound, sourceBucket, sourceKey)
+		}
+		if source, err = t.getObject(src.RealObjectKey); err != nil {
+			return err
+		}
+
+		dest, err := t.getMapping(destBucket, destKey)
+		if err != nil {
+			return err
+		}
+		mapping := &VirtualBucketMapping{VirtualBucketName: destBucket, ObjectKey: destKey}
+		if dest != nil {
+			copied := *dest
+			mapping = &copied
+		}
+		mapping.RealBucketName = src.RealBucketName
+		mapping.RealObjectKey = src.RealObjectKey
+		mapping.Status = UploadStatusCommitted
+		if err := t.putMapping(mapping, dest); err != nil {
+			return err
+		}
+
+		if dest == nil || (dest.RealBucketName == src.RealBucketName && dest.RealObjectKey == src.RealObjectKey) {
+			return nil
+		}
+		_, freed, err = t.releaseRealObject(dest.RealBucketName, dest.RealObjectKey)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, freed, nil
+}
+
+// DeleteMappingAndEnqueue 在同一事务中删除虚拟映射，并在没有其他映射引用真实对象时删除对象记录、加入待删除队列
+func (b *BoltStore) DeleteMappingAndEnqueue(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*PendingDeletion, *Object, error) {
+	var pending *PendingDeletion
+	var deleted *Object
+	err := b.update(func(t *boltTx) error {
+		if err := t.deleteObjectMapping(virtualBucketName, objectKey); err != nil {
+			return err
+		}
+		var err error
+		pending, deleted, err = t.releaseRealObject(realBucketName, realObjectKey)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, deleted, nil
+}
+
+// ExpireUploadMappings 清理早于 cutoff 仍未提交的映射，真实对象不再被引用时加入待删除队列
+// 仍有进行中分片上传会话的 pending 映射不清理
+func (b *BoltStore) ExpireUploadMappings(cutoff time.Time) (int, error) {
+	expired := 0
+	err := b.update(func(t *boltTx) error {
+		all, err := t.mappingsWithPrefix(nil, false)
+		if err != nil {
+			return err
+		}
+		active, err := t.activeUploadTargets()
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if m.Status == UploadStatusCommitted || !m.UpdatedAt.Before(cutoff) {
+				continue
+			}
+			if m.Status == UploadStatusPending && active[realObjectRef{m.RealBucketName, m.RealObjectKey}] {
+				continue
+			}
+			if err := t.deleteMapping(m); err != nil {
+				return err
+			}
+			if _, _, err := t.releaseRealObject(m.RealBucketName, m.RealObjectKey); err != nil {
+				return err
+			}
+			expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire upload mappings: %w", err)
+	}
+	return expired, nil
+}
+
+// realObjectRef 真实存储桶中的对象
+type realObjectRef struct {
+	bucket string
+	key    string
+}
+
+// activeUploadTargets 返回有进行中（未完成、未中止、未过期）分片上传会话的真实对象
+func (t *boltTx) activeUploadTargets() (map[realObjectRef]bool, error) {
+	now := time.Now()
+	active := make(map[realObjectRef]bool)
+	err := t.allSessions(func(s *UploadSession) error {
+		if s.Status == "pending" && now.Before(s.ExpiresAt) {
+			active[realObjectRef{s.BucketName, s.Key}] = true
+		}
+		return nil
+	})
+	return active, err
+}
+
+// releaseRealObject 释放不再被任何映射引用的真实对象：删除对象记录并加入待删除队列
+func (t *boltTx) releaseRealObject(realBucketName, realObjectKey string) (*PendingDeletion, *Object, error) {
+	if t.countMappingsToRealObject(realBucketName, realObjectKey) > 0 {
+		return nil, nil, nil
+	}
+
+	var deleted *Object
+	obj, err := t.getObject(realObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if obj != nil && obj.BucketName == realBucketName {
+		if err := t.deleteObject(obj); err != nil {
+			return nil, nil, err
+		}
+		deleted = obj
+	}
+
+	pending, err := t.enqueuePendingDeletion(realBucketName, realObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, deleted, nil
+}
+
+func (t *boltTx) enqueuePendingDeletion(realBucketName, realObjectKey string) (*PendingDeletion, error) {
+	now := time.Now()
+	pending := &PendingDeletion{
+		BucketName:    realBucketName,
+		Key:           realObjectKey,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	bkt := t.bucket(boltPendingDeletions)
+	var err error
+	if pending.ID, err = nextID(bkt); err != nil {
+		return nil, err
+	}
+	if err := putJSON(bkt, idKey(pending.ID), pending); err != nil {
+		return nil, fmt.Errorf("failed to enqueue pending deletion: %w", err)
+	}
+	return pending, nil
+}
+
+// ---- 待删除队列 ----
+
+// EnqueuePendingDeletion 将后端对象加入待删除队列（不修改映射与对象记录）
+// 回收器删除前会再次确认对象没有被引用
+func (b *BoltStore) EnqueuePendingDeletion(realBucketName, realObjectKey string) (*PendingDeletion, error) {
+	var pending *PendingDeletion
+	err := b.update(func(t *boltTx) error {
+		var err error
+		pending, err = t.enqueuePendingDeletion(realBucketName, realObjectKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// GetDuePendingDeletions 获取已到重试时间的待删除对象，按到期时间排序
+func (b *BoltStore) GetDuePendingDeletions(limit int) ([]*PendingDeletion, error) {
+	now := time.Now()
+	items := make([]*PendingDeletion, 0)
+	err := b.view(func(t *boltTx) error {
+		return scanPrefix(t.bucket(boltPendingDeletions), nil, func(k, v []byte) (bool, error) {
+			var item PendingDeletion
+			if err := json.Unmarshal(v, &item); err != nil {
+				return false, err
+			}
+			if !item.NextAttemptAt.After(now) {
+				items = append(items, &item)
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending deletions: %w", err)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].NextAttemptAt.Before(items[j].NextAttemptAt)
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// IsRealObjectReferenced 判断真实对象是否仍被映射或对象记录引用
+func (b *BoltStore) IsRealObjectReferenced(realBucketName, realObjectKey string) (bool, error) {
+	referenced := false
+	err := b.view(func(t *boltTx) error {
+		if t.countMappingsToRealObject(realBucketName, realObjectKey) > 0 {
+			referenced = true
+			return nil
+		}
+		referenced = t.bucket(boltObjectsByBucket).Get(compositeKey(realBucketName, realObjectKey)) != nil
+		return nil
+	})
+	return referenced, err
+}
+
+// CompletePendingDeletion 后端确认删除后移除待删除记录
+func (b *BoltStore) CompletePendingDeletion(id uint) error {
+	if err := b.update(func(t *boltTx) error {
+		return t.bucket(boltPendingDeletions).Delete(idKey(id))
+	}); err != nil {
+		return fmt.Errorf("failed to complete pending deletion: %w", err)
+	}
+	return nil
+}
+
+// DeferPendingDeletion 记录一次失败的删除，并设置下次重试时间
+func (b *BoltStore) DeferPendingDeletion(id uint, nextAttemptAt time.Time, lastError string) error {
+	if err := b.update(func(t *boltTx) error {
+		bkt := t.bucket(boltPendingDeletions)
+		var item PendingDeletion
+		found, err := getJSON(bkt, idKey(id), &item)
+		if err != nil || !found {
+			return err
+		}
+		item.Attempts++
+		item.NextAttemptAt = nextAttemptAt
+		item.LastError = lastError
+		item.UpdatedAt = time.Now()
+		return putJSON(bkt, idKey(id), &item)
+	}); err != nil {
+		return fmt.Errorf("failed to defer pending deletion: %w", err)
+	}
+	return nil
+}
+
+// CountPendingDeletions 按真实存储桶统计待删除对象数量
+func (b *BoltStore) CountPendingDeletions() (map[string]int64, error) {
+	result := make(map[string]int64)
+	err := b.view(func(t *boltTx) error {
+		return scanPrefix(t.bucket(boltPendingDeletions), nil, func(k, v []byte) (bool, error) {
+			var item PendingDeletion
+			if err := json.Unmarshal(v, &item); err != nil {
+				return false, err
+			}
+			result[item.BucketName]++
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending deletions: %w", err)
+	}
+	return result, nil
+}
+
+// ---- 上传会话 ----
+
+func (t *boltTx) getSession(uploadID string) (*UploadSession, error) {
+	var session UploadSession
+	found, err := getJSON(t.bucket(boltSessions), []byte(uploadID), &session)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// updateSession 修改上传会话，会话不存在时什么也不做
+func (t *boltTx) updateSession(uploadID string, fn func(s *UploadSession)) error {
+	session, err := t.getSession(uploadID)
+	if err != nil || session == nil {
+		return err
+	}
+	fn(session)
+	session.UpdatedAt = time.Now()
+	if err := putJSON(t.bucket(boltSessions), []byte(uploadID), session); err != nil {
+		return fmt.Errorf("failed to update upload session: %w", err)
+	}
+	return nil
+}
+
+// allSessions 遍历全部上传会话
+func (t *boltTx) allSessions(fn func(s *UploadSession) error) error {
+	return scanPrefix(t.bucket(boltSessions), nil, func(k, v []byte) (bool, error) {
+		var session UploadSession
+		if err := json.Unmarshal(v, &session); err != nil {
+			return false, err
+		}
+		return true, fn(&session)
+	})
+}
+
+// RecordUploadSession 记录上传会话
+func (b *BoltStore) RecordUploadSession(uploadID, key, bucketName string, size int64) error {
+	err := b.update(func(t *boltTx) error {
+		existing, err := t.getSession(uploadID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("upload session already exists: %s", uploadID)
+		}
+
+		now := time.Now()
+		session := &UploadSession{
+			UploadID:   uploadID,
+			Key:        key,
+			BucketName: bucketName,
+			Size:       size,
+			Status:     "pending",
+			ExpiresAt:  now.Add(24 * time.Hour), // 默认24小时过期
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if session.ID, err = nextID(t.bucket(boltSessions)); err != nil {
+			return err
+		}
+		return putJSON(t.bucket(boltSessions), []byte(uploadID), session)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record upload session: %w", err)
+	}
+	return nil
+}
+
+// GetUploadSession 获取上传会话
+func (b *BoltStore) GetUploadSession(uploadID string) (*UploadSession, error) {
+	var session *UploadSession
+	err := b.view(func(t *boltTx) error {
+		var err error
+		session, err = t.getSession(uploadID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+	if session == nil {
+		return nil, fmt.Errorf("upload session not found: %s", uploadID)
+	}
+	return session, nil
+}
+
+// UpdateUploadSession 更新上传会话
+func (b *BoltStore) UpdateUploadSession(uploadID string, completedParts int, status string) error {
+	return b.update(func(t *boltTx) error {
+		return t.updateSession(uploadID, func(s *UploadSession) {
+			s.CompletedParts = completedParts
+			s.Status = status
+		})
+	})
+}
+
+// IncrementUploadSessionSize 增加上传会话的大小（用于累加分片大小）
+func (b *BoltStore) IncrementUploadSessionSize(uploadID string, partSize int64) error {
+	if err := b.update(func(t *boltTx) error {
+		return t.updateSession(uploadID, func(s *UploadSession) {
+			s.Size += partSize
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to increment upload session size: %w", err)
+	}
+	return nil
+}
+
+// GetUploadSessionSize 获取上传会话当前累积的大小
+func (b *BoltStore) GetUploadSessionSize(uploadID string) (int64, error) {
+	session, err := b.GetUploadSession(uploadID)
+	if err != nil {
+		return 0, err
+	}
+	return session.Size, nil
+}
+
+// GetPendingUploadSessions 获取正在进行中的上传会话（按 key、uploadID 排序，多返回一个用于判断截断）
+func (b *BoltStore) GetPendingUploadSessions(prefix string, keyMarker string, uploadIdMarker string, maxUploads int) ([]*UploadSession, error) {
+	sessions := make([]*UploadSession, 0)
+	err := b.view(func(t *boltTx) error {
+		return t.allSessions(func(s *UploadSession) error {
+			if s.Status != "pending" || !strings.HasPrefix(s.Key, prefix) {
+				return nil
+			}
+			if keyMarker != "" {
+				if uploadIdMarker != "" {
+					if s.Key < keyMarker || (s.Key == keyMarker && s.UploadID <= uploadIdMarker) {
+						return nil
+					}
+				} else if s.Key <= keyMarker {
+					return nil
+				}
+			}
+			sessions = append(sessions, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending upload sessions: %w", err)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Key != sessions[j].Key {
+			return sessions[i].Key < sessions[j].Key
+		}
+		return sessions[i].UploadID < sessions[j].UploadID
+	})
+	if maxUploads > 0 && len(sessions) > maxUploads+1 {
+		sessions = sessions[:maxUploads+1]
+	}
+	return sessions, nil
+}
+
+// HasActiveUploadSession 判断分片上传是否仍有未过期的进行中会话
+func (b *BoltStore) HasActiveUploadSession(uploadID string) (bool, error) {
+	var session *UploadSession
+	err := b.view(func(t *boltTx) error {
+		var err error
+		session, err = t.getSession(uploadID)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to count upload sessions: %w", err)
+	}
+	return session != nil && session.Status == "pending" && time.Now().Before(session.ExpiresAt), nil
+}
+
+// CleanExpiredSessions 清理过期的上传会话
+func (b *BoltStore) CleanExpiredSessions() error {
+	now := time.Now()
+	err := b.update(func(t *boltTx) error {
+		var expired []string
+		if err := t.allSessions(func(s *UploadSession) error {
+			if s.Status == "pending" && s.ExpiresAt.Before(now) {
+				expired = append(expired, s.UploadID)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, id := range expired {
+			if err := t.bucket(boltSessions).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clean expired sessions: %w", err)
+	}
+	return nil
+}
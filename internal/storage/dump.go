@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// dumpBatchSize 导出时每次从数据库读取的行数
+const dumpBatchSize = 500
+
+// MetadataCounts 各类可导出元数据的记录数
+type MetadataCounts struct {
+	Objects        int64 `json:"objects"`
+	Mappings       int64 `json:"mappings"`
+	UploadSessions int64 `json:"upload_sessions"`
+	BucketStats    int64 `json:"bucket_stats"`
+	MonthlyStats   int64 `json:"bucket_monthly_stats"`
+}
+
+// Total 记录总数
+func (c *MetadataCounts) Total() int64 {
+	return c.Objects + c.Mappings + c.UploadSessions + c.BucketStats + c.MonthlyStats
+}
+
+// Add 按记录类型计数，record 不是可导出的类型时返回 false
+func (c *MetadataCounts) Add(record interface{}) bool {
+	switch record.(type) {
+	case *Object:
+		c.Objects++
+	case *VirtualBucketMapping:
+		c.Mappings++
+	case *UploadSession:
+		c.UploadSessions++
+	case *BucketStats:
+		c.BucketStats++
+	case *BucketMonthlyStats:
+		c.MonthlyStats++
+	default:
+		return false
+	}
+	return true
+}
+
+// ExportMetadata 在一个一致的快照中依次导出对象、映射（含未提交的）、上传会话、存储桶统计与月度统计
+// fn 收到的记录类型为 *Object、*VirtualBucketMapping、*UploadSession、*BucketStats 或 *BucketMonthlyStats
+func (s *Service) ExportMetadata(fn func(record interface{}) error) error {
+	var opts []*sql.TxOptions
+	if s.db.Dialector.Name() != "sqlite" {
+		// SQLite 的读事务本身就是快照；其他数据库需要可重复读才能得到一致的导出
+		opts = append(opts, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var objects []*Object
+		if err := exportTable(tx, &objects, func() error {
+			for _, obj := range objects {
+				if err := fn(obj); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to export objects: %w", err)
+		}
+
+		var mappings []*VirtualBucketMapping
+		if err := exportTable(tx, &mappings, func() error {
+			for _, m := range mappings {
+				if err := fn(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to export virtual bucket mappings: %w", err)
+		}
+
+		var sessions []*UploadSession
+		if err := exportTable(tx, &sessions, func() error {
+			for _, session := range sessions {
+				if err := fn(session); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to export upload sessions: %w", err)
+		}
+
+		var stats []*BucketStats
+		if err := exportTable(tx, &stats, func() error {
+			for _, st := range stats {
+				if err := fn(st); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to export bucket stats: %w", err)
+		}
+
+		var monthly []*BucketMonthlyStats
+		if err := exportTable(tx, &monthly, func() error {
+			for _, st := range monthly {
+				if err := fn(st); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to export monthly stats: %w", err)
+		}
+		return nil
+	}, opts...)
+}
+
+// exportTable 按主键顺序分批读取一张表，每批读入 dest 后调用 fn
+func exportTable(tx *gorm.DB, dest interface{}, fn func() error) error {
+	return tx.Order("id ASC").FindInBatches(dest, dumpBatchSize, func(*gorm.DB, int) error {
+		return fn()
+	}).Error
+}
+
+// ImportMetadata 在一个事务中写入一批导出的记录
+// 按自然键（对象 key、虚拟存储桶+key、uploadID、存储桶名、存储桶+年月）覆盖已有记录，保留时间戳，主键由数据库重新分配
+func (s *Service) ImportMetadata(records []interface{}) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		keyColumn := s.keyColumn()
+		for _, record := range records {
+			var err error
+			switch r := record.(type) {
+			case *Object:
+				err = tx.Unscoped().Where(keyColumn+" = ?", r.Key).Delete(&Object{}).Error
+			case *VirtualBucketMapping:
+				err = tx.Where("virtual_bucket_name = ? AND object_key = ?", r.VirtualBucketName, r.ObjectKey).
+					Delete(&VirtualBucketMapping{}).Error
+			case *UploadSession:
+				err = tx.Unscoped().Where("upload_id = ?", r.UploadID).Delete(&UploadSession{}).Error
+			case *BucketStats:
+				err = tx.Where("bucket_name = ?", r.BucketName).Delete(&BucketStats{}).Error
+			case *BucketMonthlyStats:
+				err = tx.Where("bucket_name = ? AND year = ? AND month = ?", r.BucketName, r.Year, r.Month).
+					Delete(&BucketMonthlyStats{}).Error
+			default:
+				return fmt.Errorf("unsupported metadata record type %T", record)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to replace %T: %w", record, err)
+			}
+
+			if err := resetID(record); err != nil {
+				return err
+			}
+			if err := tx.Create(record).Error; err != nil {
+				return fmt.Errorf("failed to import %T: %w", record, err)
+			}
+		}
+		return nil
+	})
+}
+
+// resetID 清空导入记录的主键，由目标存储重新分配
+func resetID(record interface{}) error {
+	switch r := record.(type) {
+	case *Object:
+		r.ID = 0
+	case *VirtualBucketMapping:
+		r.ID = 0
+	case *UploadSession:
+		r.ID = 0
+	case *BucketStats:
+		r.ID = 0
+	case *BucketMonthlyStats:
+		r.ID = 0
+	default:
+		return fmt.Errorf("unsupported metadata record type %T", record)
+	}
+	return nil
+}
+
+// CountMetadata 统计各类可导出元数据的记录数
+func (s *Service) CountMetadata() (*MetadataCounts, error) {
+	counts := &MetadataCounts{}
+	for _, c := range []struct {
+		model interface{}
+		dest  *int64
+	}{
+		{&Object{}, &counts.Objects},
+		{&VirtualBucketMapping{}, &counts.Mappings},
+		{&UploadSession{}, &counts.UploadSessions},
+		{&BucketStats{}, &counts.BucketStats},
+		{&BucketMonthlyStats{}, &counts.MonthlyStats},
+	} {
+		if err := s.db.Model(c.model).Count(c.dest).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %T: %w", c.model, err)
+		}
+	}
+	return counts, nil
+}
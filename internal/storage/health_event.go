@@ -0,0 +1,39 @@
+package storage
+
+import "fmt"
+
+// RecordHealthEvent 记录一次存储桶健康状态变化
+func (s *Service) RecordHealthEvent(event *HealthEvent) error {
+	if event.BucketName == "" || event.State == "" {
+		return fmt.Errorf("health event requires bucket name and state")
+	}
+
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record health event: %w", err)
+	}
+	return nil
+}
+
+// GetHealthEvents 查询存储桶的健康状态变化历史（按时间倒序），返回当前页与总数
+func (s *Service) GetHealthEvents(bucketName string, limit, offset int) ([]*HealthEvent, int64, error) {
+	query := s.db.Model(&HealthEvent{}).Where("bucket_name = ?", bucketName)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count health events: %w", err)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	var events []*HealthEvent
+	if err := query.Order("id DESC").Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get health events: %w", err)
+	}
+
+	return events, total, nil
+}
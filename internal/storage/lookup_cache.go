@@ -0,0 +1,430 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/logging"
+)
+
+var logger = logging.Logger(logging.SubsystemStorage)
+
+const (
+	// 变更通知的保留时间与清理间隔
+	changeRetention     = 10 * time.Minute
+	changePruneInterval = time.Minute
+	// 单次轮询读取的通知数
+	changePollBatch = 1000
+	// ID 不连续时等待缺失通知（并发事务晚提交）的时间，以及一次最多记录的缺失 ID 数
+	changeGapGrace = 10 * time.Second
+	changeMaxGaps  = 1000
+)
+
+// LookupCacheOptions 查询缓存参数
+type LookupCacheOptions struct {
+	MaxEntries   int           // 缓存条目上限
+	TTL          time.Duration // 查询结果的缓存时间
+	NegativeTTL  time.Duration // 不存在结果的缓存时间，0 表示不缓存
+	PollInterval time.Duration // 轮询变更通知的间隔
+
+	// Changes 多个实例共享数据库时用于写入与轮询变更通知，nil 表示只在本进程内失效
+	Changes *Service
+}
+
+// lookupEntry 一条缓存的查询结果，mapping/object 与 err 只有一个有效
+type lookupEntry struct {
+	key     string
+	mapping *VirtualBucketMapping
+	object  *Object
+	err     error
+	expires time.Time
+}
+
+// CachedStore 为虚拟映射与对象记录查询加上进程内缓存的 MetadataStore
+// 缓存 GetVirtualBucketMapping 与 GetObjectInfo 的结果（包括不存在的结果），经由本存储的写操作返回后立即失效；
+// 其他实例的写入通过变更通知表（metadata_changes）传播，在下一次轮询时失效，TTL 兜底
+type CachedStore struct {
+	MetadataStore
+	opts LookupCacheOptions
+	*lookupState
+}
+
+// lookupState 缓存内容，WithContext 返回的视图与原存储共享
+type lookupState struct {
+	mu      sync.Mutex
+	lru     *list.List               // 前端为最近使用
+	entries map[string]*list.Element // 缓存 key -> LRU 元素
+	// generation 每次失效时递增；查询开始后发生过失效的结果不写入缓存，避免把失效前读到的旧值放回缓存
+	generation uint64
+
+	stopChan chan struct{}
+}
+
+var _ MetadataStore = (*CachedStore)(nil)
+
+// NewCachedStore 创建带查询缓存的元数据存储
+func NewCachedStore(inner MetadataStore, opts LookupCacheOptions) *CachedStore {
+	return &CachedStore{
+		MetadataStore: inner,
+		opts:          opts,
+		lookupState: &lookupState{
+			lru:      list.New(),
+			entries:  make(map[string]*list.Element),
+			stopChan: make(chan struct{}),
+		},
+	}
+}
+
+// WithContext 返回在 ctx 下执行的视图，与原存储共享缓存内容
+func (c *CachedStore) WithContext(ctx context.Context) MetadataStore {
+	return &CachedStore{
+		MetadataStore: c.MetadataStore.WithContext(ctx),
+		opts:          c.opts,
+		lookupState:   c.lookupState,
+	}
+}
+
+func mappingCacheKey(virtualBucketName, objectKey string) string {
+	return "m\x00" + virtualBucketName + "\x00" + objectKey
+}
+
+func objectCacheKey(key string) string {
+	return "o\x00" + key
+}
+
+// GetVirtualBucketMapping 获取已提交的虚拟映射，优先使用缓存
+func (c *CachedStore) GetVirtualBucketMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error) {
+	key := mappingCacheKey(virtualBucketName, objectKey)
+	if e, ok := c.get(key); ok {
+		if e.err != nil {
+			return nil, e.err
+		}
+		mapping := *e.mapping
+		return &mapping, nil
+	}
+
+	generation := c.currentGeneration()
+	mapping, err := c.MetadataStore.GetVirtualBucketMapping(virtualBucketName, objectKey)
+	switch {
+	case err == nil:
+		cached := *mapping
+		c.put(generation, &lookupEntry{key: key, mapping: &cached}, c.opts.TTL)
+	case errors.Is(err, ErrMappingNotFound):
+		c.put(generation, &lookupEntry{key: key, err: err}, c.opts.NegativeTTL)
+	}
+	return mapping, err
+}
+
+// GetObjectInfo 获取对象记录，优先使用缓存
+func (c *CachedStore) GetObjectInfo(objectKey string) (*Object, error) {
+	key := objectCacheKey(objectKey)
+	if e, ok := c.get(key); ok {
+		if e.err != nil {
+			return nil, e.err
+		}
+		obj := *e.object
+		return &obj, nil
+	}
+
+	generation := c.currentGeneration()
+	obj, err := c.MetadataStore.GetObjectInfo(objectKey)
+	switch {
+	case err == nil:
+		cached := *obj
+		c.put(generation, &lookupEntry{key: key, object: &cached}, c.opts.TTL)
+	case errors.Is(err, ErrObjectNotFound):
+		c.put(generation, &lookupEntry{key: key, err: err}, c.opts.NegativeTTL)
+	}
+	return obj, err
+}
+
+// 以下写操作无论成功与否都在返回后失效相关缓存（失败的事务已回滚，多失效一次没有影响）
+// BeginUpload 与 FailUpload 只改变未提交的映射，查询看不到，不需要失效
+
+// RecordObject 记录对象信息
+func (c *CachedStore) RecordObject(key, bucketName string, size int64, metadata map[string]string) error {
+	err := c.MetadataStore.RecordObject(key, bucketName, size, metadata)
+	c.publish(objectChange(key))
+	return err
+}
+
+// DeleteObject 删除对象记录
+func (c *CachedStore) DeleteObject(key string) error {
+	err := c.MetadataStore.DeleteObject(key)
+	c.publish(objectChange(key))
+	return err
+}
+
+// CreateVirtualBucketMapping 创建虚拟映射
+func (c *CachedStore) CreateVirtualBucketMapping(virtualBucketName, objectKey, realBucketName, realObjectKey string) error {
+	err := c.MetadataStore.CreateVirtualBucketMapping(virtualBucketName, objectKey, realBucketName, realObjectKey)
+	c.publish(mappingChange(virtualBucketName, objectKey))
+	return err
+}
+
+// DeleteVirtualBucketMapping 删除虚拟存储桶的全部映射
+func (c *CachedStore) DeleteVirtualBucketMapping(virtualBucketName string) error {
+	err := c.MetadataStore.DeleteVirtualBucketMapping(virtualBucketName)
+	c.publish(&MetadataChange{Kind: ChangeKindBucket, BucketName: virtualBucketName})
+	return err
+}
+
+// DeleteVirtualBucketObjectMapping 删除单个虚拟映射
+func (c *CachedStore) DeleteVirtualBucketObjectMapping(virtualBucketName, objectKey string) error {
+	err := c.MetadataStore.DeleteVirtualBucketObjectMapping(virtualBucketName, objectKey)
+	c.publish(mappingChange(virtualBucketName, objectKey))
+	return err
+}
+
+// CommitUpload 提交上传；映射原来指向的真实对象可能在同一事务中被释放，提交前先读出
+func (c *CachedStore) CommitUpload(commit *UploadCommit) (*Object, error) {
+	current, currentErr := c.MetadataStore.GetUploadMapping(commit.VirtualBucketName, commit.ObjectKey)
+	previous, err := c.MetadataStore.CommitUpload(commit)
+
+	changes := []*MetadataChange{
+		mappingChange(commit.VirtualBucketName, commit.ObjectKey),
+		objectChange(commit.RealObjectKey),
+	}
+	if currentErr == nil && current.RealObjectKey != commit.RealObjectKey {
+		changes = append(changes, objectChange(current.RealObjectKey))
+	}
+	c.publish(changes...)
+	return previous, err
+}
+
+// CopyMapping 复制映射，目标原来的真实对象可能被释放
+func (c *CachedStore) CopyMapping(sourceBucket, sourceKey, destBucket, destKey string) (*Object, *Object, error) {
+	source, freed, err := c.MetadataStore.CopyMapping(sourceBucket, sourceKey, destBucket, destKey)
+	changes := []*MetadataChange{mappingChange(destBucket, destKey)}
+	if freed != nil {
+		changes = append(changes, objectChange(freed.Key))
+	}
+	c.publish(changes...)
+	return source, freed, err
+}
+
+// DeleteMappingAndEnqueue 删除映射并释放不再被引用的真实对象
+func (c *CachedStore) DeleteMappingAndEnqueue(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*PendingDeletion, *Object, error) {
+	pending, deleted, err := c.MetadataStore.DeleteMappingAndEnqueue(virtualBucketName, objectKey, realBucketName, realObjectKey)
+	c.publish(mappingChange(virtualBucketName, objectKey), objectChange(realObjectKey))
+	return pending, deleted, err
+}
+
+// ExpireUploadMappings 清理过期的上传映射；被释放的对象记录无法逐个得知，清空全部缓存
+func (c *CachedStore) ExpireUploadMappings(cutoff time.Time) (int, error) {
+	expired, err := c.MetadataStore.ExpireUploadMappings(cutoff)
+	if expired > 0 {
+		c.publish(&MetadataChange{Kind: ChangeKindAll})
+	}
+	return expired, err
+}
+
+// ImportMetadata 导入元数据后清空全部缓存
+func (c *CachedStore) ImportMetadata(records []interface{}) error {
+	err := c.MetadataStore.ImportMetadata(records)
+	c.publish(&MetadataChange{Kind: ChangeKindAll})
+	return err
+}
+
+func mappingChange(virtualBucketName, objectKey string) *MetadataChange {
+	return &MetadataChange{Kind: ChangeKindMapping, BucketName: virtualBucketName, ObjectKey: objectKey}
+}
+
+func objectChange(key string) *MetadataChange {
+	return &MetadataChange{Kind: ChangeKindObject, ObjectKey: key}
+}
+
+// publish 失效本进程的缓存，并写入变更通知供其他实例失效
+func (c *CachedStore) publish(changes ...*MetadataChange) {
+	c.apply(changes)
+	if c.opts.Changes == nil {
+		return
+	}
+	if err := c.opts.Changes.PublishMetadataChanges(changes); err != nil {
+		// 其他实例最迟在 TTL 后读到新值
+		logger.Warn("Failed to publish metadata changes", "changes", len(changes), "error", err)
+	}
+}
+
+// apply 按变更通知失效缓存
+func (c *CachedStore) apply(changes []*MetadataChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, change := range changes {
+		switch change.Kind {
+		case ChangeKindMapping:
+			c.removeLocked(mappingCacheKey(change.BucketName, change.ObjectKey))
+		case ChangeKindObject:
+			c.removeLocked(objectCacheKey(change.ObjectKey))
+		case ChangeKindBucket:
+			prefix := mappingCacheKey(change.BucketName, "")
+			for key := range c.entries {
+				if strings.HasPrefix(key, prefix) {
+					c.removeLocked(key)
+				}
+			}
+		default:
+			c.lru.Init()
+			c.entries = make(map[string]*list.Element)
+		}
+	}
+}
+
+// Purge 清空全部缓存
+func (c *CachedStore) Purge() {
+	c.apply([]*MetadataChange{{Kind: ChangeKindAll}})
+}
+
+func (c *CachedStore) get(key string) (*lookupEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*lookupEntry)
+	if time.Now().After(e.expires) {
+		c.removeLocked(key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e, true
+}
+
+func (c *CachedStore) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put 写入查询结果；查询开始后发生过失效时放弃写入
+func (c *CachedStore) put(generation uint64, e *lookupEntry, ttl time.Duration) {
+	if ttl <= 0 || c.opts.MaxEntries <= 0 {
+		return
+	}
+	e.expires = time.Now().Add(ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[e.key]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.opts.MaxEntries {
+		c.removeLocked(c.lru.Back().Value.(*lookupEntry).key)
+	}
+}
+
+func (c *CachedStore) removeLocked(key string) {
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Start 启动变更通知轮询（未配置 Changes 时什么也不做）
+// 只处理启动之后的通知；每次轮询读取新通知，并补读 ID 不连续处可能晚提交的通知；同时定期清理过期通知
+func (c *CachedStore) Start(ctx context.Context) {
+	changes := c.opts.Changes
+	if changes == nil {
+		return
+	}
+	lastID, err := changes.LatestMetadataChangeID()
+	if err != nil {
+		logger.Warn("Failed to read metadata change feed position", "error", err)
+	}
+
+	go func() {
+		gaps := make(map[uint]time.Time)
+		lastPrune := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.stopChan:
+				return
+			case <-time.After(c.opts.PollInterval):
+			}
+
+			next, err := c.poll(lastID, gaps)
+			if err != nil {
+				// 无法确认期间是否有变更，清空缓存
+				logger.Warn("Failed to poll metadata changes, purging lookup cache", "error", err)
+				c.Purge()
+				continue
+			}
+			lastID = next
+
+			if time.Since(lastPrune) >= changePruneInterval {
+				if _, err := changes.PruneMetadataChanges(time.Now().Add(-changeRetention)); err != nil {
+					logger.Warn("Failed to prune metadata changes", "error", err)
+				}
+				lastPrune = time.Now()
+			}
+		}
+	}()
+}
+
+// Stop 停止变更通知轮询
+func (c *CachedStore) Stop() {
+	close(c.stopChan)
+}
+
+// poll 读取并应用 lastID 之后的通知以及仍在等待的缺失 ID，返回新的位置
+func (c *CachedStore) poll(lastID uint, gaps map[uint]time.Time) (uint, error) {
+	changes := c.opts.Changes
+	now := time.Now()
+
+	if len(gaps) > 0 {
+		ids := make([]uint, 0, len(gaps))
+		for id, seen := range gaps {
+			if now.Sub(seen) > changeGapGrace {
+				delete(gaps, id)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		late, err := changes.GetMetadataChangesByID(ids)
+		if err != nil {
+			return lastID, err
+		}
+		for _, change := range late {
+			delete(gaps, change.ID)
+		}
+		if len(late) > 0 {
+			c.apply(late)
+		}
+	}
+
+	for {
+		batch, err := changes.GetMetadataChangesSince(lastID, changePollBatch)
+		if err != nil {
+			return lastID, err
+		}
+		for _, change := range batch {
+			// 较小 ID 的事务可能还未提交，记录下来在之后的轮询中补读
+			if change.ID-lastID <= changeMaxGaps {
+				for id := lastID + 1; id < change.ID; id++ {
+					gaps[id] = now
+				}
+			}
+			lastID = change.ID
+		}
+		if len(batch) > 0 {
+			c.apply(batch)
+		}
+		if len(batch) < changePollBatch {
+			return lastID, nil
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// 元数据变更类型
+const (
+	ChangeKindMapping = "mapping" // 单个虚拟映射（BucketName、ObjectKey）
+	ChangeKindBucket  = "bucket"  // 虚拟存储桶的全部映射（BucketName）
+	ChangeKindObject  = "object"  // 单个对象记录（ObjectKey）
+	ChangeKindAll     = "all"     // 全部缓存
+)
+
+// PublishMetadataChanges 写入一批元数据变更通知
+func (s *Service) PublishMetadataChanges(changes []*MetadataChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := s.db.Create(changes).Error; err != nil {
+		return fmt.Errorf("failed to publish metadata changes: %w", err)
+	}
+	return nil
+}
+
+// GetMetadataChangesSince 按 ID 顺序返回 ID 大于 afterID 的变更通知
+func (s *Service) GetMetadataChangesSince(afterID uint, limit int) ([]*MetadataChange, error) {
+	var changes []*MetadataChange
+	query := s.db.Where("id > ?", afterID).Order("id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get metadata changes: %w", err)
+	}
+	return changes, nil
+}
+
+// LatestMetadataChangeID 返回最新的变更通知 ID，没有通知时返回 0
+func (s *Service) LatestMetadataChangeID() (uint, error) {
+	var latest MetadataChange
+	result := s.db.Order("id DESC").Limit(1).Find(&latest)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to get latest metadata change: %w", result.Error)
+	}
+	return latest.ID, nil
+}
+
+// PruneMetadataChanges 删除早于 before 的变更通知，返回删除的数量
+func (s *Service) PruneMetadataChanges(before time.Time) (int64, error) {
+	result := s.db.Where("created_at < ?", before).Delete(&MetadataChange{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune metadata changes: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// GetMetadataChangesByID 返回指定 ID 的变更通知（用于补读并发事务晚提交的通知）
+func (s *Service) GetMetadataChangesByID(ids []uint) ([]*MetadataChange, error) {
+	var changes []*MetadataChange
+	if len(ids) == 0 {
+		return changes, nil
+	}
+	if err := s.db.Where("id IN ?", ids).Order("id ASC").Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get metadata changes: %w", err)
+	}
+	return changes, nil
+}
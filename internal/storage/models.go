@@ -16,12 +16,21 @@ type Object struct {
 	Size        int64          `gorm:"not null;default:0" json:"size"`
 	Metadata    JSON           `gorm:"type:json" json:"metadata,omitempty"`
 	ContentType string         `gorm:"size:128" json:"content_type,omitempty"`
-	ETag        string         `gorm:"size:128" json:"etag,omitempty"`
+	ETag        string         `gorm:"size:128" json:"etag,omitempty"`         // 返回给客户端的 ETag
+	BackendETag string         `gorm:"size:128" json:"backend_etag,omitempty"` // 后端对象的 ETag，仅在与 ETag 不同时记录（自动分片上传）
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// StoredETag 返回后端对象的 ETag，用于 If-Match 条件读取与对账比较
+func (o *Object) StoredETag() string {
+	if o.BackendETag != "" {
+		return o.BackendETag
+	}
+	return o.ETag
+}
+
 // TableName 指定表名
 func (Object) TableName() string {
 	return "objects"
@@ -69,6 +78,7 @@ type VirtualBucketMapping struct {
 	ObjectKey         string    `gorm:"index;size:512;not null" json:"object_key"`        // 虚拟对象key
 	RealBucketName    string    `gorm:"index;size:255;not null" json:"real_bucket_name"`
 	RealObjectKey     string    `gorm:"size:512;not null" json:"real_object_key"`          // 真实对象key
+	Status            string    `gorm:"index;size:16;not null;default:'committed'" json:"status"` // 上传状态: pending, committed, failed
 	CreatedAt         time.Time `gorm:"not null" json:"created_at"`
 	UpdatedAt         time.Time `gorm:"not null" json:"updated_at"`
 }
@@ -109,6 +119,7 @@ type AccessLog struct {
 	UserAgent    string    `gorm:"size:512" json:"user_agent"`
 	Host         string    `gorm:"size:255" json:"host"`
 	Success      bool      `gorm:"not null" json:"success"`
+	StatusCode   int       `gorm:"default:0" json:"status_code"` // HTTP 状态码
 	ErrorMsg     string    `gorm:"type:text" json:"error_msg,omitempty"`
 	ResponseTime int64     `gorm:"default:0" json:"response_time"` // 响应时间（毫秒）
 	CreatedAt    time.Time `gorm:"index" json:"created_at"`
@@ -119,6 +130,25 @@ func (AccessLog) TableName() string {
 	return "access_logs"
 }
 
+// AccessLogRollup 访问日志按小时或按天（UTC）汇总，每个周期、存储桶与操作一行
+// 小时汇总由访问日志计算，天汇总由小时汇总计算，原始日志被清理后汇总仍然保留
+type AccessLogRollup struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	Granularity string    `gorm:"uniqueIndex:idx_access_log_rollup;size:8;not null" json:"granularity"` // hour, day
+	PeriodStart time.Time `gorm:"uniqueIndex:idx_access_log_rollup;not null" json:"period_start"`
+	BucketName  string    `gorm:"uniqueIndex:idx_access_log_rollup;size:255" json:"bucket_name"`
+	Action      string    `gorm:"uniqueIndex:idx_access_log_rollup;size:32" json:"action"`
+	Requests    int64     `gorm:"default:0" json:"requests"`
+	Bytes       int64     `gorm:"default:0" json:"bytes"`
+	Errors      int64     `gorm:"default:0" json:"errors"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AccessLogRollup) TableName() string {
+	return "access_log_rollups"
+}
+
 // JSON 自定义JSON类型，用于存储元数据
 type JSON map[string]interface{}
 
@@ -196,3 +226,151 @@ type AccessLogFilter struct {
 	Limit      int
 	Offset     int
 }
+
+// AccessLogRollupFilter 访问日志汇总查询过滤器（StartTime 含、EndTime 不含）
+type AccessLogRollupFilter struct {
+	Granularity string
+	BucketName  string
+	Action      string
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// APIToken 管理API令牌模型（只保存令牌的哈希值）
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"index;size:128;not null" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Prefix     string     `gorm:"size:16" json:"prefix"` // 令牌前几位，便于识别
+	Role       string     `gorm:"size:32;not null" json:"role"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// IsActive 检查令牌是否仍然有效（未吊销且未过期）
+func (t *APIToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+// AuditLog 管理操作审计记录，写入后不可修改或删除
+type AuditLog struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Actor        string    `gorm:"index;size:128;not null" json:"actor"`    // 令牌名称，配置文件令牌为 config，文件热加载为 config-file
+	TokenID      uint      `gorm:"default:0" json:"token_id,omitempty"`     // 命名令牌ID，非命名令牌为0
+	ClientIP     string    `gorm:"size:64" json:"client_ip,omitempty"`      // 直连对端地址，对端为可信代理时取转发头中的客户端地址
+	ForwardedFor string    `gorm:"size:255" json:"forwarded_for,omitempty"` // 请求携带的原始 X-Forwarded-For / X-Real-IP，可被伪造，仅供参考
+	Action       string    `gorm:"index;size:64;not null" json:"action"`    // config.update, token.create, token.revoke ...
+	Resource     string    `gorm:"index;size:255" json:"resource,omitempty"`
+	Result       string    `gorm:"index;size:16;not null" json:"result"` // success, failure
+	ErrorMsg     string    `gorm:"type:text" json:"error_msg,omitempty"`
+	Changes      string    `gorm:"type:text" json:"changes,omitempty"` // JSON 格式的变更列表（敏感字段已脱敏）
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// BeforeUpdate 审计记录不允许修改
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete 审计记录不允许删除
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// AuditLogFilter 审计日志查询过滤器
+type AuditLogFilter struct {
+	Actor     string
+	Action    string
+	Resource  string
+	Result    string
+	StartTime time.Time
+	EndTime   time.Time
+	Limit     int
+	Offset    int
+}
+
+// HealthEvent 存储桶健康状态变化记录
+type HealthEvent struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	BucketName    string    `gorm:"index;size:255;not null" json:"bucket_name"`
+	PreviousState string    `gorm:"size:16" json:"previous_state"` // unknown, healthy, degraded, unhealthy
+	State         string    `gorm:"size:16;not null" json:"state"`
+	Message       string    `gorm:"type:text" json:"message,omitempty"`
+	ErrorMsg      string    `gorm:"type:text" json:"error_msg,omitempty"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (HealthEvent) TableName() string {
+	return "health_events"
+}
+
+// UsageScanState 存储桶对账扫描进度，扫描可跨多轮从保存的续传令牌继续
+type UsageScanState struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	BucketName        string     `gorm:"uniqueIndex;size:255;not null" json:"bucket_name"`
+	ContinuationToken string     `gorm:"type:text" json:"continuation_token,omitempty"` // 为空表示下一轮从头开始
+	PartialSize       int64      `gorm:"not null;default:0" json:"partial_size"`        // 本次扫描已累计的大小
+	PartialObjects    int64      `gorm:"not null;default:0" json:"partial_objects"`     // 本次扫描已累计的对象数
+	Pages             int64      `gorm:"not null;default:0" json:"pages"`               // 本次扫描已列出的页数
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+	ScannedSize       int64      `gorm:"not null;default:0" json:"scanned_size"`    // 最近一次完整扫描得到的后端大小
+	ScannedObjects    int64      `gorm:"not null;default:0" json:"scanned_objects"` // 最近一次完整扫描得到的对象数
+	AccountedSize     int64      `gorm:"not null;default:0" json:"accounted_size"`  // 扫描完成时代理记录的大小
+	UntrackedSize     int64      `gorm:"not null;default:0" json:"untracked_size"`  // 后端存在但代理未记录的大小
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UsageScanState) TableName() string {
+	return "usage_scan_states"
+}
+
+// PendingDeletion 等待从真实存储桶删除的对象
+// 删除映射时在同一事务中写入，后端确认删除后移除；失败的删除按退避时间重试
+type PendingDeletion struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	BucketName    string    `gorm:"index:idx_pending_deletion_object;size:255;not null" json:"bucket_name"` // 真实存储桶
+	Key           string    `gorm:"index:idx_pending_deletion_object;size:512;not null" json:"key"`         // 真实对象key
+	Attempts      int       `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time `gorm:"index" json:"next_attempt_at"`
+	LastError     string    `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PendingDeletion) TableName() string {
+	return "pending_deletions"
+}
+
+// MetadataChange 元数据变更通知，多个实例共享数据库时用于失效其他实例的查询缓存
+// 只保留一段时间，由各实例定期清理
+type MetadataChange struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Kind       string    `gorm:"size:16;not null" json:"kind"` // mapping, bucket, object, all
+	BucketName string    `gorm:"size:255" json:"bucket_name,omitempty"`
+	ObjectKey  string    `gorm:"size:512" json:"object_key,omitempty"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (MetadataChange) TableName() string {
+	return "metadata_changes"
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeleteMappingAndEnqueue 在同一事务中删除虚拟映射，并在没有其他映射引用真实对象时
+// 删除对象记录、把真实对象加入待删除队列
+// 返回新加入的待删除记录（仍被引用时为 nil）以及被删除的对象记录（不存在时为 nil）
+func (s *Service) DeleteMappingAndEnqueue(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*PendingDeletion, *Object, error) {
+	var pending *PendingDeletion
+	var deleted *Object
+
+	err := s.Transaction(func(tx *Service) error {
+		if err := tx.DeleteVirtualBucketObjectMapping(virtualBucketName, objectKey); err != nil {
+			return err
+		}
+
+		var err error
+		pending, deleted, err = tx.releaseRealObject(realBucketName, realObjectKey)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, deleted, nil
+}
+
+// EnqueuePendingDeletion 将后端对象加入待删除队列（不修改映射与对象记录）
+// 回收器删除前会再次确认对象没有被引用
+func (s *Service) EnqueuePendingDeletion(realBucketName, realObjectKey string) (*PendingDeletion, error) {
+	pending := &PendingDeletion{
+		BucketName:    realBucketName,
+		Key:           realObjectKey,
+		NextAttemptAt: time.Now(),
+	}
+	if err := s.db.Create(pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue pending deletion: %w", err)
+	}
+	return pending, nil
+}
+
+// GetDuePendingDeletions 获取已到重试时间的待删除对象，按到期时间排序
+func (s *Service) GetDuePendingDeletions(limit int) ([]*PendingDeletion, error) {
+	var items []*PendingDeletion
+	query := s.db.Where("next_attempt_at <= ?", time.Now()).Order("next_attempt_at ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to get pending deletions: %w", err)
+	}
+	return items, nil
+}
+
+// IsRealObjectReferenced 判断真实对象是否仍被映射或对象记录引用（例如删除后又被重新上传）
+func (s *Service) IsRealObjectReferenced(realBucketName, realObjectKey string) (bool, error) {
+	count, err := s.CountMappingsToRealObject(realBucketName, realObjectKey)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	if err := s.db.Model(&Object{}).
+		Where(s.keyColumn()+" = ? AND bucket_name = ?", realObjectKey, realBucketName).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to count objects: %w", err)
+	}
+	return count > 0, nil
+}
+
+// CompletePendingDeletion 后端确认删除后移除待删除记录
+func (s *Service) CompletePendingDeletion(id uint) error {
+	if err := s.db.Delete(&PendingDeletion{}, id).Error; err != nil {
+		return fmt.Errorf("failed to complete pending deletion: %w", err)
+	}
+	return nil
+}
+
+// DeferPendingDeletion 记录一次失败的删除，并设置下次重试时间
+func (s *Service) DeferPendingDeletion(id uint, nextAttemptAt time.Time, lastError string) error {
+	if err := s.db.Model(&PendingDeletion{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + ?", 1),
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to defer pending deletion: %w", err)
+	}
+	return nil
+}
+
+// CountPendingDeletions 按真实存储桶统计待删除对象数量
+func (s *Service) CountPendingDeletions() (map[string]int64, error) {
+	var rows []struct {
+		BucketName string
+		Count      int64
+	}
+	if err := s.db.Model(&PendingDeletion{}).
+		Select("bucket_name, COUNT(*) AS count").
+		Group("bucket_name").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count pending deletions: %w", err)
+	}
+
+	result := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		result[row.BucketName] = row.Count
+	}
+	return result, nil
+}
+
+// HasActiveUploadSession 判断分片上传是否仍有未过期的进行中会话
+func (s *Service) HasActiveUploadSession(uploadID string) (bool, error) {
+	var count int64
+	if err := s.db.Model(&UploadSession{}).
+		Where("upload_id = ? AND status = ? AND expires_at > ?", uploadID, "pending", time.Now()).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to count upload sessions: %w", err)
+	}
+	return count > 0, nil
+}
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"gorm.io/gorm"
@@ -26,11 +28,23 @@ func NewService(db *gorm.DB) *Service {
 	}
 }
 
+// WithContext 返回在 ctx 下执行数据库调用的存储服务，追踪插件据此把 SQL 调用挂到请求的 span 下
+func (s *Service) WithContext(ctx context.Context) MetadataStore {
+	return &Service{
+		db: s.db.WithContext(ctx),
+	}
+}
+
+// keyColumn 返回按数据库方言转义的 key 列名（key 是 MySQL 保留字，PostgreSQL 又不接受反引号）
+func (s *Service) keyColumn() string {
+	return s.db.Statement.Quote("key")
+}
+
 // RecordObject 记录对象信息
 func (s *Service) RecordObject(key, bucketName string, size int64, metadata map[string]string) error {
 	// 首先检查是否存在已删除的同名对象
 	var deletedObj Object
-	if err := s.db.Unscoped().Where("`key` = ?", key).Where("`deleted_at` IS NOT NULL").First(&deletedObj).Error; err == nil {
+	if err := s.db.Unscoped().Where(s.keyColumn()+" = ?", key).Where("deleted_at IS NOT NULL").First(&deletedObj).Error; err == nil {
 		// 存在已删除的同名对象，永久删除它
 		if err := s.db.Unscoped().Delete(&deletedObj).Error; err != nil {
 			return fmt.Errorf("failed to permanently delete soft-deleted object: %w", err)
@@ -53,7 +67,7 @@ func (s *Service) RecordObject(key, bucketName string, size int64, metadata map[
 	}
 
 	// 使用 Upsert（更新或插入）
-	result := s.db.Where("`key` = ?", key).Where("`deleted_at` IS NULL").FirstOrCreate(&obj)
+	result := s.db.Where(s.keyColumn()+" = ?", key).Where("deleted_at IS NULL").FirstOrCreate(&obj)
 	if result.Error != nil {
 		return fmt.Errorf("failed to record object: %w", result.Error)
 	}
@@ -66,23 +80,21 @@ func (s *Service) RecordObject(key, bucketName string, size int64, metadata map[
 			"metadata":    obj.Metadata,
 			"updated_at":  time.Now(),
 		}
-		if err := s.db.Model(&Object{}).Where("`key` = ?", key).Updates(updates).Error; err != nil {
+		if err := s.db.Model(&Object{}).Where(s.keyColumn()+" = ?", key).Updates(updates).Error; err != nil {
 			return fmt.Errorf("failed to update object: %w", err)
 		}
 	}
 
 	// 更新存储桶统计
-	s.updateBucketStats(bucketName)
-
-	return nil
+	return s.updateBucketStats(bucketName)
 }
 
 // FindObjectBucket 查找对象所在的存储桶
 func (s *Service) FindObjectBucket(key string) (string, error) {
 	var obj Object
-	if err := s.db.Where("`key` = ?", key).First(&obj).Error; err != nil {
+	if err := s.db.Where(s.keyColumn()+" = ?", key).First(&obj).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return "", fmt.Errorf("object not found: %s", key)
+			return "", fmt.Errorf("%w: %s", ErrObjectNotFound, key)
 		}
 		return "", fmt.Errorf("failed to find object: %w", err)
 	}
@@ -92,9 +104,9 @@ func (s *Service) FindObjectBucket(key string) (string, error) {
 // GetObjectInfo 获取对象信息
 func (s *Service) GetObjectInfo(key string) (*Object, error) {
 	var obj Object
-	if err := s.db.Where("`key` = ?", key).First(&obj).Error; err != nil {
+	if err := s.db.Where(s.keyColumn()+" = ?", key).First(&obj).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("object not found: %s", key)
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
 		}
 		return nil, fmt.Errorf("failed to get object info: %w", err)
 	}
@@ -111,7 +123,7 @@ func (s *Service) CopyObject(sourceKey, destKey string, metadata map[string]stri
 
 	// 检查目标对象是否已存在
 	var existingObj Object
-	if err := s.db.Where("`key` = ?", destKey).Where("`deleted_at` IS NULL").First(&existingObj).Error; err == nil {
+	if err := s.db.Where(s.keyColumn()+" = ?", destKey).Where("deleted_at IS NULL").First(&existingObj).Error; err == nil {
 		// 目标对象已存在，删除旧的
 		if err := s.DeleteObject(destKey); err != nil {
 			return fmt.Errorf("failed to delete existing destination object: %w", err)
@@ -120,7 +132,7 @@ func (s *Service) CopyObject(sourceKey, destKey string, metadata map[string]stri
 
 	// 清理已软删除的同名对象
 	var deletedObj Object
-	if err := s.db.Unscoped().Where("`key` = ?", destKey).Where("`deleted_at` IS NOT NULL").First(&deletedObj).Error; err == nil {
+	if err := s.db.Unscoped().Where(s.keyColumn()+" = ?", destKey).Where("deleted_at IS NOT NULL").First(&deletedObj).Error; err == nil {
 		if err := s.db.Unscoped().Delete(&deletedObj).Error; err != nil {
 			return fmt.Errorf("failed to permanently delete soft-deleted object: %w", err)
 		}
@@ -161,9 +173,9 @@ func (s *Service) CopyObject(sourceKey, destKey string, metadata map[string]stri
 // DeleteObject 删除对象记录（软删除）
 func (s *Service) DeleteObject(key string) error {
 	var obj Object
-	if err := s.db.Where("`key` = ?", key).First(&obj).Error; err != nil {
+	if err := s.db.Where(s.keyColumn()+" = ?", key).First(&obj).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("object not found: %s", key)
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
 		}
 		return fmt.Errorf("failed to find object: %w", err)
 	}
@@ -193,12 +205,12 @@ func (s *Service) ListObjects(bucketName, prefix, marker string, maxKeys int) ([
 
 	// 前缀过滤
 	if prefix != "" {
-		query = query.Where("`key` LIKE ?", prefix+"%")
+		query = query.Where(s.keyColumn()+" LIKE ?", prefix+"%")
 	}
 
 	// Marker分页
 	if marker != "" {
-		query = query.Where("`key` > ?", marker)
+		query = query.Where(s.keyColumn()+" > ?", marker)
 	}
 
 	// 限制返回数量
@@ -207,7 +219,7 @@ func (s *Service) ListObjects(bucketName, prefix, marker string, maxKeys int) ([
 	}
 
 	// 按key字母顺序排序（S3标准）
-	if err := query.Order("`key` ASC").Find(&objects).Error; err != nil {
+	if err := query.Order(s.keyColumn()+" ASC").Find(&objects).Error; err != nil {
 		return nil, fmt.Errorf("failed to list objects: %w", err)
 	}
 
@@ -389,6 +401,50 @@ func (s *Service) IncrementBucketOperation(bucketName, category string) (int64,
 	return count, nil
 }
 
+// AddBucketOperations 在一个事务中累加多个存储桶的操作计数，返回累加后的计数
+func (s *Service) AddBucketOperations(deltas map[string]OperationCounts) (map[string]OperationCounts, error) {
+	result := make(map[string]OperationCounts, len(deltas))
+	if len(deltas) == 0 {
+		return result, nil
+	}
+
+	names := make([]string, 0, len(deltas))
+	for name := range deltas {
+		// 统计行在事务外创建，并发创建的重复键不会中止事务
+		if _, err := s.ensureBucketStats(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	// 固定更新顺序，避免多个实例并发批量更新时死锁
+	sort.Strings(names)
+
+	err := s.Transaction(func(tx *Service) error {
+		for _, name := range names {
+			delta := deltas[name]
+			if err := tx.db.Model(&BucketStats{}).
+				Where("bucket_name = ?", name).
+				UpdateColumns(map[string]interface{}{
+					"operation_count_a": gorm.Expr("operation_count_a + ?", delta.CountA),
+					"operation_count_b": gorm.Expr("operation_count_b + ?", delta.CountB),
+				}).Error; err != nil {
+				return fmt.Errorf("failed to add operation counts for bucket %s: %w", name, err)
+			}
+
+			var stats BucketStats
+			if err := tx.db.Where("bucket_name = ?", name).First(&stats).Error; err != nil {
+				return fmt.Errorf("failed to fetch updated operation counts for bucket %s: %w", name, err)
+			}
+			result[name] = OperationCounts{CountA: stats.OperationCountA, CountB: stats.OperationCountB}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // GetBucketOperationCounts 获取所有存储桶的操作计数
 func (s *Service) GetBucketOperationCounts() (map[string]OperationCounts, error) {
 	var stats []BucketStats
@@ -481,16 +537,16 @@ func (s *Service) GetPendingUploadSessions(prefix string, keyMarker string, uplo
 
 	// 根据前缀过滤
 	if prefix != "" {
-		query = query.Where("`key` LIKE ?", prefix+"%")
+		query = query.Where(s.keyColumn()+" LIKE ?", prefix+"%")
 	}
 
 	// 分页标记处理
 	if keyMarker != "" {
 		if uploadIdMarker != "" {
 			// 如果同时指定了key和uploadId标记
-			query = query.Where("(`key` > ? OR (`key` = ? AND upload_id > ?))", keyMarker, keyMarker, uploadIdMarker)
+			query = query.Where(fmt.Sprintf("(%[1]s > ? OR (%[1]s = ? AND upload_id > ?))", s.keyColumn()), keyMarker, keyMarker, uploadIdMarker)
 		} else {
-			query = query.Where("`key` > ?", keyMarker)
+			query = query.Where(s.keyColumn()+" > ?", keyMarker)
 		}
 	}
 
@@ -500,7 +556,7 @@ func (s *Service) GetPendingUploadSessions(prefix string, keyMarker string, uplo
 	}
 
 	// 按key和uploadID排序
-	query = query.Order("`key` ASC, upload_id ASC")
+	query = query.Order(s.keyColumn()+" ASC, upload_id ASC")
 
 	var sessions []*UploadSession
 	if err := query.Find(&sessions).Error; err != nil {
@@ -541,32 +597,24 @@ func (s *Service) RecordAccessLog(action, key, bucketName, clientIP, userAgent,
 	return nil
 }
 
+// accessLogInsertBatch 批量写入访问日志时单条 INSERT 的最大行数（受 SQLite 绑定变量数限制）
+const accessLogInsertBatch = 50
+
+// RecordAccessLogs 批量记录访问日志，CreatedAt 为空的条目使用当前时间
+func (s *Service) RecordAccessLogs(logs []*AccessLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := s.db.CreateInBatches(logs, accessLogInsertBatch).Error; err != nil {
+		return fmt.Errorf("failed to record access logs: %w", err)
+	}
+	return nil
+}
+
 // GetAccessLogs 获取访问日志
 func (s *Service) GetAccessLogs(filter *AccessLogFilter) ([]*AccessLog, error) {
-	query := s.db.Model(&AccessLog{})
-
+	query := s.filterAccessLogs(s.db.Model(&AccessLog{}), filter)
 	if filter != nil {
-		if filter.Action != "" {
-			query = query.Where("action = ?", filter.Action)
-		}
-		if filter.Key != "" {
-			query = query.Where("`key` = ?", filter.Key)
-		}
-		if filter.BucketName != "" {
-			query = query.Where("bucket_name = ?", filter.BucketName)
-		}
-		if filter.ClientIP != "" {
-			query = query.Where("client_ip = ?", filter.ClientIP)
-		}
-		if filter.Success != nil {
-			query = query.Where("success = ?", *filter.Success)
-		}
-		if !filter.StartTime.IsZero() {
-			query = query.Where("created_at >= ?", filter.StartTime)
-		}
-		if !filter.EndTime.IsZero() {
-			query = query.Where("created_at <= ?", filter.EndTime)
-		}
 		if filter.Limit > 0 {
 			query = query.Limit(filter.Limit)
 		}
@@ -599,12 +647,12 @@ func (s *Service) CreateVirtualBucketMapping(virtualBucketName, objectKey, realB
 	return nil
 }
 
-// GetVirtualBucketMapping 获取虚拟存储桶文件级映射
+// GetVirtualBucketMapping 获取虚拟存储桶文件级映射（只返回已提交的映射）
 func (s *Service) GetVirtualBucketMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error) {
 	var mapping VirtualBucketMapping
-	if err := s.db.Where("virtual_bucket_name = ? AND object_key = ?", virtualBucketName, objectKey).First(&mapping).Error; err != nil {
+	if err := s.db.Where("virtual_bucket_name = ? AND object_key = ? AND status = ?", virtualBucketName, objectKey, UploadStatusCommitted).First(&mapping).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("virtual bucket mapping not found: %s/%s", virtualBucketName, objectKey)
+			return nil, fmt.Errorf("%w: %s/%s", ErrMappingNotFound, virtualBucketName, objectKey)
 		}
 		return nil, fmt.Errorf("failed to get virtual bucket mapping: %w", err)
 	}
@@ -622,6 +670,23 @@ func (s *Service) CountMappingsToRealObject(realBucketName, realObjectKey string
 	return count, nil
 }
 
+// CountMappingsForBucket 统计引用指定存储桶的映射数量
+// 分别返回作为真实存储桶被引用的数量和作为虚拟存储桶被引用的数量
+func (s *Service) CountMappingsForBucket(bucketName string) (int64, int64, error) {
+	var realCount, virtualCount int64
+	if err := s.db.Model(&VirtualBucketMapping{}).
+		Where("real_bucket_name = ?", bucketName).
+		Count(&realCount).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to count mappings for real bucket %s: %w", bucketName, err)
+	}
+	if err := s.db.Model(&VirtualBucketMapping{}).
+		Where("virtual_bucket_name = ?", bucketName).
+		Count(&virtualCount).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to count mappings for virtual bucket %s: %w", bucketName, err)
+	}
+	return realCount, virtualCount, nil
+}
+
 // GetVirtualBucketMappings 获取所有虚拟存储桶映射
 func (s *Service) GetVirtualBucketMappings() ([]*VirtualBucketMapping, error) {
 	var mappings []*VirtualBucketMapping
@@ -631,15 +696,24 @@ func (s *Service) GetVirtualBucketMappings() ([]*VirtualBucketMapping, error) {
 	return mappings, nil
 }
 
-// GetVirtualBucketMappingsForBucket 获取指定虚拟存储桶的所有映射
+// GetVirtualBucketMappingsForBucket 获取指定虚拟存储桶的所有已提交映射
 func (s *Service) GetVirtualBucketMappingsForBucket(virtualBucketName string) ([]*VirtualBucketMapping, error) {
 	var mappings []*VirtualBucketMapping
-	if err := s.db.Where("virtual_bucket_name = ?", virtualBucketName).Find(&mappings).Error; err != nil {
+	if err := s.db.Where("virtual_bucket_name = ? AND status = ?", virtualBucketName, UploadStatusCommitted).Find(&mappings).Error; err != nil {
 		return nil, fmt.Errorf("failed to get virtual bucket mappings for bucket %s: %w", virtualBucketName, err)
 	}
 	return mappings, nil
 }
 
+// GetVirtualBucketMappingsForRealBucket 获取指向指定真实存储桶的所有映射
+func (s *Service) GetVirtualBucketMappingsForRealBucket(realBucketName string) ([]*VirtualBucketMapping, error) {
+	var mappings []*VirtualBucketMapping
+	if err := s.db.Where("real_bucket_name = ? AND status = ?", realBucketName, UploadStatusCommitted).Find(&mappings).Error; err != nil {
+		return nil, fmt.Errorf("failed to get virtual bucket mappings for real bucket %s: %w", realBucketName, err)
+	}
+	return mappings, nil
+}
+
 // UpdateVirtualBucketMapping 更新虚拟存储桶映射
 func (s *Service) UpdateVirtualBucketMapping(virtualBucketName, objectKey, realBucketName string) error {
 	updates := map[string]interface{}{
@@ -695,7 +769,7 @@ func (s *Service) GetVirtualBucketObjects(virtualBucketName string) ([]*Object,
 
 	// 从对象表中查询这些真实对象
 	var realObjects []*Object
-	if err := s.db.Where("`key` IN ?", realObjectKeys).Find(&realObjects).Error; err != nil {
+	if err := s.db.Where(s.keyColumn()+" IN ?", realObjectKeys).Find(&realObjects).Error; err != nil {
 		return nil, fmt.Errorf("failed to get objects for virtual bucket: %w", err)
 	}
 
@@ -718,6 +792,7 @@ func (s *Service) GetVirtualBucketObjects(virtualBucketName string) ([]*Object,
 				Metadata:    realObj.Metadata,
 				ContentType: realObj.ContentType,
 				ETag:        realObj.ETag,
+				BackendETag: realObj.BackendETag,
 				CreatedAt:   realObj.CreatedAt,
 				UpdatedAt:   realObj.UpdatedAt,
 			}
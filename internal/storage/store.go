@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// 查询不到记录时返回的错误（使用 errors.Is 判断），查询缓存据此缓存不存在的结果
+var (
+	ErrObjectNotFound  = errors.New("object not found")
+	ErrMappingNotFound = errors.New("virtual bucket mapping not found")
+)
+
+// MetadataStore 元数据存储接口
+// 覆盖数据路径上的全部元数据：对象记录、虚拟映射及上传状态机、待删除队列、上传会话、存储桶统计与访问日志
+// 令牌、审计日志与健康事件等管理数据始终保存在 SQL 数据库中（Service）
+// 实现：Service（GORM，sqlite/mysql/postgres）、BoltStore（内嵌 bbolt 键值存储）
+// 所有实现必须通过 storetest 一致性测试
+type MetadataStore interface {
+	// 对象记录
+	RecordObject(key, bucketName string, size int64, metadata map[string]string) error
+	GetObjectInfo(key string) (*Object, error)
+	DeleteObject(key string) error
+	ListObjects(bucketName, prefix, marker string, maxKeys int) ([]*Object, error)
+	GetBucketObjects(bucketName string) ([]*Object, error)
+	GetBucketSize(bucketName string) (int64, error)
+	GetBucketObjectCount(bucketName string) (int64, error)
+
+	// 虚拟映射
+	CreateVirtualBucketMapping(virtualBucketName, objectKey, realBucketName, realObjectKey string) error
+	GetVirtualBucketMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error)
+	GetUploadMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error)
+	GetVirtualBucketMappingsForBucket(virtualBucketName string) ([]*VirtualBucketMapping, error)
+	GetVirtualBucketMappingsForRealBucket(realBucketName string) ([]*VirtualBucketMapping, error)
+	GetVirtualBucketObjects(virtualBucketName string) ([]*Object, error)
+	DeleteVirtualBucketMapping(virtualBucketName string) error
+	DeleteVirtualBucketObjectMapping(virtualBucketName, objectKey string) error
+	CountMappingsToRealObject(realBucketName, realObjectKey string) (int64, error)
+	CountMappingsForBucket(bucketName string) (int64, int64, error)
+
+	// 上传状态机（每个方法是一个原子操作）
+	BeginUpload(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*VirtualBucketMapping, error)
+	CommitUpload(c *UploadCommit) (*Object, error)
+	FailUpload(virtualBucketName, objectKey, uploadID string) error
+	CopyMapping(sourceBucket, sourceKey, destBucket, destKey string) (*Object, *Object, error)
+	DeleteMappingAndEnqueue(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*PendingDeletion, *Object, error)
+	ExpireUploadMappings(cutoff time.Time) (int, error)
+
+	// 待删除队列
+	EnqueuePendingDeletion(realBucketName, realObjectKey string) (*PendingDeletion, error)
+	GetDuePendingDeletions(limit int) ([]*PendingDeletion, error)
+	IsRealObjectReferenced(realBucketName, realObjectKey string) (bool, error)
+	CompletePendingDeletion(id uint) error
+	DeferPendingDeletion(id uint, nextAttemptAt time.Time, lastError string) error
+	CountPendingDeletions() (map[string]int64, error)
+
+	// 上传会话
+	RecordUploadSession(uploadID, key, bucketName string, size int64) error
+	GetUploadSession(uploadID string) (*UploadSession, error)
+	UpdateUploadSession(uploadID string, completedParts int, status string) error
+	IncrementUploadSessionSize(uploadID string, partSize int64) error
+	GetUploadSessionSize(uploadID string) (int64, error)
+	GetPendingUploadSessions(prefix string, keyMarker string, uploadIdMarker string, maxUploads int) ([]*UploadSession, error)
+	HasActiveUploadSession(uploadID string) (bool, error)
+	CleanExpiredSessions() error
+
+	// 存储桶统计
+	IncrementBucketOperation(bucketName, category string) (int64, error)
+	AddBucketOperations(deltas map[string]OperationCounts) (map[string]OperationCounts, error)
+	GetBucketOperationCounts() (map[string]OperationCounts, error)
+	ArchiveMonthlyStats(year, month int) error
+	GetMonthlyStats(year, month int) ([]BucketMonthlyStats, error)
+	GetMonthlyStatsRange(startYear, startMonth, endYear, endMonth int) ([]BucketMonthlyStats, error)
+	GetCurrentMonthStats() ([]BucketMonthlyStats, error)
+	GetBucketMonthlyHistory(bucketName string, months int) ([]BucketMonthlyStats, error)
+	GetUsageScanState(bucketName string) (*UsageScanState, error)
+	SaveUsageScanState(state *UsageScanState) error
+	GetUntrackedSize(bucketName string) (int64, error)
+
+	// 访问日志
+	RecordAccessLog(action, key, bucketName, clientIP, userAgent, host string, size int64, success bool, errorMsg string, responseTime int64) error
+	RecordAccessLogs(logs []*AccessLog) error
+	GetAccessLogs(filter *AccessLogFilter) ([]*AccessLog, error)
+	CountAccessLogs(filter *AccessLogFilter) (int64, error)
+	PruneAccessLogs(before time.Time) (int64, error)
+	RollupAccessLogs(granularity string, start, end time.Time) error
+	GetAccessLogRollups(filter *AccessLogRollupFilter) ([]*AccessLogRollup, error)
+	LatestAccessLogRollup(granularity string) (time.Time, error)
+	PruneAccessLogRollups(granularity string, before time.Time) (int64, error)
+
+	// 导出/导入（metadump 使用的驱动无关格式）
+	ExportMetadata(fn func(record interface{}) error) error
+	ImportMetadata(records []interface{}) error
+	CountMetadata() (*MetadataCounts, error)
+
+	// WithContext 返回在 ctx 下执行的存储视图（共享连接与缓存），数据库调用据此挂到请求的追踪 span 下
+	WithContext(ctx context.Context) MetadataStore
+}
+
+var _ MetadataStore = (*Service)(nil)
@@ -0,0 +1,118 @@
+package storetest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/database"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// NewSQLFactory 返回基于 GORM 的存储工厂
+// sqlite 时每个用例使用独立的临时数据库文件（忽略 DSN）；
+// mysql/postgres 时每个用例开始前清空并重建 DSN 指向的数据库中的数据路径表，切勿指向生产库
+func NewSQLFactory(cfg config.DatabaseConfig) Factory {
+	return newSQLFactory(cfg, "")
+}
+
+// NewSQLiteFactory 返回基于 sqlite 的存储工厂，每个用例在 dir 下使用独立的临时数据库文件（dir 为空时使用系统临时目录）
+func NewSQLiteFactory(dir string) Factory {
+	return newSQLFactory(config.DatabaseConfig{
+		Type:         "sqlite",
+		MaxOpenConns: 1,
+		MaxIdleConns: 1,
+	}, dir)
+}
+
+func newSQLFactory(cfg config.DatabaseConfig, sqliteDir string) Factory {
+	return func() (storage.MetadataStore, func(), error) {
+		dbCfg := cfg
+		dbCfg.LogLevel = "silent"
+		cleanupFile := func() {}
+
+		if dbCfg.Type == "" || dbCfg.Type == "sqlite" {
+			dir, err := os.MkdirTemp(sqliteDir, "s3b-storetest-sql-")
+			if err != nil {
+				return nil, nil, err
+			}
+			dbCfg.Type = "sqlite"
+			dbCfg.DSN = filepath.Join(dir, "metadata.db")
+			cleanupFile = func() { os.RemoveAll(dir) }
+		}
+
+		db, err := database.Open(&dbCfg)
+		if err != nil {
+			cleanupFile()
+			return nil, nil, err
+		}
+		cleanup := func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+			cleanupFile()
+		}
+
+		if err := db.Migrator().DropTable(metadataModels()...); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to drop tables: %w", err)
+		}
+		if err := database.Migrate(db); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return storage.NewService(db), cleanup, nil
+	}
+}
+
+// NewBoltFactory 返回基于 bbolt 的存储工厂，每个用例在 dir 下使用独立的临时文件（dir 为空时使用系统临时目录）
+func NewBoltFactory(dir string) Factory {
+	return func() (storage.MetadataStore, func(), error) {
+		tmp, err := os.MkdirTemp(dir, "s3b-storetest-bolt-")
+		if err != nil {
+			return nil, nil, err
+		}
+		store, err := storage.OpenBoltStore(filepath.Join(tmp, "metadata.bolt"))
+		if err != nil {
+			os.RemoveAll(tmp)
+			return nil, nil, err
+		}
+		return store, func() {
+			store.Close()
+			os.RemoveAll(tmp)
+		}, nil
+	}
+}
+
+// WithLookupCache 把 factory 创建的存储包装为带查询缓存的存储（只在进程内失效）
+func WithLookupCache(factory Factory) Factory {
+	return func() (storage.MetadataStore, func(), error) {
+		store, cleanup, err := factory()
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage.NewCachedStore(store, storage.LookupCacheOptions{
+			MaxEntries:  1000,
+			TTL:         time.Minute,
+			NegativeTTL: time.Minute,
+		}), cleanup, nil
+	}
+}
+
+// metadataModels MetadataStore 覆盖的数据路径表（令牌、审计、健康事件表不清空）
+func metadataModels() []interface{} {
+	return []interface{}{
+		&storage.Object{},
+		&storage.BucketStats{},
+		&storage.BucketMonthlyStats{},
+		&storage.UploadSession{},
+		&storage.AccessLog{},
+		&storage.AccessLogRollup{},
+		&storage.VirtualBucketMapping{},
+		&storage.UsageScanState{},
+		&storage.PendingDeletion{},
+		&storage.MetadataChange{},
+	}
+}
@@ -0,0 +1,1378 @@
+// Package storetest 元数据存储一致性测试
+// 每个 storage.MetadataStore 实现都必须通过这里的全部用例；由 check-store 子命令运行
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/metadump"
+	"github.com/DullJZ/s3-balance/internal/storage"
+)
+
+// Factory 创建一个空的元数据存储，cleanup 用于释放资源（关闭连接、删除临时文件）
+type Factory func() (store storage.MetadataStore, cleanup func(), err error)
+
+// Result 单个用例的结果
+type Result struct {
+	Name     string        `json:"name"`
+	Err      error         `json:"-"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Passed 用例是否通过
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+type testCase struct {
+	name string
+	run  func(s storage.MetadataStore) error
+	// runPair 需要两个独立存储的用例（例如导出后导入）
+	runPair func(src, dst storage.MetadataStore) error
+}
+
+var cases = []testCase{
+	{name: "objects", run: testObjects},
+	{name: "object_listing", run: testObjectListing},
+	{name: "mappings", run: testMappings},
+	{name: "upload_state_machine", run: testUploadStateMachine},
+	{name: "copy_and_release", run: testCopyAndRelease},
+	{name: "pending_deletions", run: testPendingDeletions},
+	{name: "upload_sessions", run: testUploadSessions},
+	{name: "operation_stats", run: testOperationStats},
+	{name: "monthly_stats", run: testMonthlyStats},
+	{name: "usage_scan_state", run: testUsageScanState},
+	{name: "access_logs", run: testAccessLogs},
+	{name: "access_log_rollups", run: testAccessLogRollups},
+	{name: "read_after_write", run: testReadAfterWrite},
+	{name: "with_context", run: testWithContext},
+	{name: "export_import", runPair: testExportImport},
+}
+
+// Run 对 factory 创建的存储逐个运行用例，每个用例使用一个新的空存储
+func Run(factory Factory) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		results = append(results, runCase(factory, c))
+	}
+	return results
+}
+
+func runCase(factory Factory, c testCase) (result Result) {
+	result.Name = c.name
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("panic: %v", r)
+		}
+		if result.Err != nil {
+			result.Error = result.Err.Error()
+		}
+		result.Duration = time.Since(start)
+	}()
+
+	store, cleanup, err := factory()
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create store: %w", err)
+		return result
+	}
+	defer cleanup()
+
+	if c.runPair == nil {
+		result.Err = c.run(store)
+		return result
+	}
+
+	other, cleanupOther, err := factory()
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create second store: %w", err)
+		return result
+	}
+	defer cleanupOther()
+	result.Err = c.runPair(store, other)
+	return result
+}
+
+// check 条件不成立时返回带描述的错误
+func check(ok bool, format string, args ...interface{}) error {
+	if ok {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// must 依次返回第一个错误
+func must(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func objectKeys(objects []*storage.Object) []string {
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testObjects(s storage.MetadataStore) error {
+	if err := s.RecordObject("docs/a.txt", "r1", 10, map[string]string{"owner": "alice"}); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	obj, err := s.GetObjectInfo("docs/a.txt")
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if err := must(
+		check(obj.Key == "docs/a.txt" && obj.BucketName == "r1" && obj.Size == 10, "unexpected object %+v", obj),
+		check(obj.Metadata["owner"] == "alice", "metadata not stored: %v", obj.Metadata),
+		check(obj.ID != 0, "object id not assigned"),
+	); err != nil {
+		return err
+	}
+
+	// 覆盖写：大小与所在存储桶更新，统计随之变化
+	if err := s.RecordObject("docs/a.txt", "r2", 25, nil); err != nil {
+		return fmt.Errorf("overwrite: %w", err)
+	}
+	obj, err = s.GetObjectInfo("docs/a.txt")
+	if err != nil {
+		return fmt.Errorf("get after overwrite: %w", err)
+	}
+	if err := check(obj.BucketName == "r2" && obj.Size == 25, "overwrite not applied: %+v", obj); err != nil {
+		return err
+	}
+	size, err := s.GetBucketSize("r2")
+	if err != nil {
+		return err
+	}
+	count, err := s.GetBucketObjectCount("r2")
+	if err != nil {
+		return err
+	}
+	if err := check(size == 25 && count == 1, "r2 stats: size=%d count=%d", size, count); err != nil {
+		return err
+	}
+	size, _ = s.GetBucketSize("r1")
+	count, _ = s.GetBucketObjectCount("r1")
+	if err := check(size == 0 && count == 0, "r1 still accounts moved object: size=%d count=%d", size, count); err != nil {
+		return err
+	}
+
+	if err := s.DeleteObject("docs/a.txt"); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if _, err := s.GetObjectInfo("docs/a.txt"); err == nil {
+		return fmt.Errorf("deleted object still readable")
+	}
+	if err := s.DeleteObject("docs/a.txt"); err == nil {
+		return fmt.Errorf("deleting a missing object should fail")
+	}
+	size, _ = s.GetBucketSize("r2")
+	if err := check(size == 0, "r2 size after delete: %d", size); err != nil {
+		return err
+	}
+
+	// 删除后以相同 key 重新写入
+	if err := s.RecordObject("docs/a.txt", "r1", 7, nil); err != nil {
+		return fmt.Errorf("re-record after delete: %w", err)
+	}
+	obj, err = s.GetObjectInfo("docs/a.txt")
+	if err != nil {
+		return err
+	}
+	return check(obj.Size == 7 && obj.BucketName == "r1", "re-recorded object: %+v", obj)
+}
+
+func testObjectListing(s storage.MetadataStore) error {
+	for _, o := range []struct {
+		key    string
+		bucket string
+		size   int64
+	}{
+		{"b/2", "r1", 2}, {"a/1", "r1", 1}, {"b/1", "r1", 3}, {"b/3", "r2", 4}, {"c", "r1", 5},
+	} {
+		if err := s.RecordObject(o.key, o.bucket, o.size, nil); err != nil {
+			return err
+		}
+	}
+
+	steps := []struct {
+		bucket, prefix, marker string
+		max                    int
+		want                   []string
+	}{
+		{"", "", "", 0, []string{"a/1", "b/1", "b/2", "b/3", "c"}},
+		{"r1", "", "", 0, []string{"a/1", "b/1", "b/2", "c"}},
+		{"r1", "b/", "", 0, []string{"b/1", "b/2"}},
+		{"", "b/", "b/1", 0, []string{"b/2", "b/3"}},
+		{"r1", "", "a/1", 2, []string{"b/1", "b/2"}},
+		{"", "", "", 2, []string{"a/1", "b/1"}},
+		{"r2", "a", "", 0, []string{}},
+	}
+	for _, step := range steps {
+		objects, err := s.ListObjects(step.bucket, step.prefix, step.marker, step.max)
+		if err != nil {
+			return err
+		}
+		if got := objectKeys(objects); !equalStrings(got, step.want) {
+			return fmt.Errorf("ListObjects(%q, %q, %q, %d) = %v, want %v", step.bucket, step.prefix, step.marker, step.max, got, step.want)
+		}
+	}
+
+	objects, err := s.GetBucketObjects("r2")
+	if err != nil {
+		return err
+	}
+	if err := check(len(objects) == 1 && objects[0].Key == "b/3", "GetBucketObjects(r2) = %v", objectKeys(objects)); err != nil {
+		return err
+	}
+	size, _ := s.GetBucketSize("r1")
+	count, _ := s.GetBucketObjectCount("r1")
+	return check(size == 11 && count == 4, "r1 stats: size=%d count=%d", size, count)
+}
+
+func testMappings(s storage.MetadataStore) error {
+	if err := must(
+		s.RecordObject("k1", "r1", 10, nil),
+		s.RecordObject("k2", "r2", 20, nil),
+		s.CreateVirtualBucketMapping("v1", "k1", "r1", "k1"),
+		s.CreateVirtualBucketMapping("v1", "k2", "r2", "k2"),
+		s.CreateVirtualBucketMapping("v2", "alias", "r1", "k1"),
+	); err != nil {
+		return err
+	}
+
+	m, err := s.GetVirtualBucketMapping("v1", "k1")
+	if err != nil {
+		return fmt.Errorf("get mapping: %w", err)
+	}
+	if err := check(m.RealBucketName == "r1" && m.RealObjectKey == "k1" && m.Status == storage.UploadStatusCommitted,
+		"unexpected mapping %+v", m); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v1", "missing"); err == nil {
+		return fmt.Errorf("missing mapping returned")
+	}
+
+	forBucket, err := s.GetVirtualBucketMappingsForBucket("v1")
+	if err != nil {
+		return err
+	}
+	forReal, err := s.GetVirtualBucketMappingsForRealBucket("r1")
+	if err != nil {
+		return err
+	}
+	refs, err := s.CountMappingsToRealObject("r1", "k1")
+	if err != nil {
+		return err
+	}
+	asReal, asVirtual, err := s.CountMappingsForBucket("r1")
+	if err != nil {
+		return err
+	}
+	_, v1Count, err := s.CountMappingsForBucket("v1")
+	if err != nil {
+		return err
+	}
+	if err := must(
+		check(len(forBucket) == 2, "mappings for v1: %d", len(forBucket)),
+		check(len(forReal) == 2, "mappings for real r1: %d", len(forReal)),
+		check(refs == 2, "references to r1/k1: %d", refs),
+		check(asReal == 2 && asVirtual == 0, "CountMappingsForBucket(r1) = %d, %d", asReal, asVirtual),
+		check(v1Count == 2, "CountMappingsForBucket(v1) virtual = %d", v1Count),
+	); err != nil {
+		return err
+	}
+
+	objects, err := s.GetVirtualBucketObjects("v2")
+	if err != nil {
+		return err
+	}
+	if err := check(len(objects) == 1 && objects[0].Key == "alias" && objects[0].Size == 10 && objects[0].BucketName == "r1",
+		"virtual objects of v2: %+v", objects); err != nil {
+		return err
+	}
+
+	if err := s.DeleteVirtualBucketObjectMapping("v1", "k1"); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v1", "k1"); err == nil {
+		return fmt.Errorf("deleted mapping still readable")
+	}
+	if err := s.DeleteVirtualBucketObjectMapping("v1", "k1"); err != nil {
+		return fmt.Errorf("deleting a missing mapping should succeed: %w", err)
+	}
+	if refs, _ = s.CountMappingsToRealObject("r1", "k1"); refs != 1 {
+		return fmt.Errorf("references to r1/k1 after delete: %d", refs)
+	}
+
+	if err := s.DeleteVirtualBucketMapping("v1"); err != nil {
+		return err
+	}
+	forBucket, _ = s.GetVirtualBucketMappingsForBucket("v1")
+	_, v1Count, _ = s.CountMappingsForBucket("v1")
+	if err := check(len(forBucket) == 0 && v1Count == 0, "v1 still has %d mappings", v1Count); err != nil {
+		return err
+	}
+	_, err = s.GetVirtualBucketMapping("v2", "alias")
+	return err
+}
+
+func testUploadStateMachine(s storage.MetadataStore) error {
+	m, err := s.BeginUpload("v", "obj", "r1", "obj")
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	if err := check(m.Status == storage.UploadStatusPending, "new upload status %q", m.Status); err != nil {
+		return err
+	}
+
+	// 未提交的上传对读取方不可见
+	if _, err := s.GetVirtualBucketMapping("v", "obj"); err == nil {
+		return fmt.Errorf("pending mapping visible to readers")
+	}
+	if list, _ := s.GetVirtualBucketMappingsForBucket("v"); len(list) != 0 {
+		return fmt.Errorf("pending mapping listed")
+	}
+	if objs, _ := s.GetVirtualBucketObjects("v"); len(objs) != 0 {
+		return fmt.Errorf("pending object listed")
+	}
+	if _, err := s.GetUploadMapping("v", "obj"); err != nil {
+		return fmt.Errorf("writer cannot see pending mapping: %w", err)
+	}
+
+	// 并发的第二次开始返回已有映射
+	again, err := s.BeginUpload("v", "obj", "r2", "obj")
+	if err != nil {
+		return err
+	}
+	if err := check(again.RealBucketName == "r1", "second begin switched bucket to %s", again.RealBucketName); err != nil {
+		return err
+	}
+
+	previous, err := s.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: "v", ObjectKey: "obj", RealBucketName: "r1", RealObjectKey: "obj", Size: 100, ETag: `"e1"`, BackendETag: `"b1-2"`,
+	})
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	if err := check(previous == nil, "first commit returned previous object %+v", previous); err != nil {
+		return err
+	}
+	committed, err := s.GetVirtualBucketMapping("v", "obj")
+	if err != nil {
+		return fmt.Errorf("committed mapping not visible: %w", err)
+	}
+	obj, err := s.GetObjectInfo("obj")
+	if err != nil {
+		return fmt.Errorf("committed object not recorded: %w", err)
+	}
+	size, _ := s.GetBucketSize("r1")
+	if err := must(
+		check(committed.Status == storage.UploadStatusCommitted, "status after commit %q", committed.Status),
+		check(obj.Size == 100, "object size %d", obj.Size),
+		check(obj.ETag == `"e1"` && obj.StoredETag() == `"b1-2"`, "object etag %s/%s", obj.ETag, obj.BackendETag),
+		check(size == 100, "r1 size after commit %d", size),
+	); err != nil {
+		return err
+	}
+
+	// 覆盖写失败不影响已提交的对象
+	if _, err := s.BeginUpload("v", "obj", "r1", "obj"); err != nil {
+		return err
+	}
+	if err := s.FailUpload("v", "obj", ""); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v", "obj"); err != nil {
+		return fmt.Errorf("failed overwrite hid committed object: %w", err)
+	}
+
+	// 覆盖写成功返回旧对象
+	previous, err = s.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: "v", ObjectKey: "obj", RealBucketName: "r1", RealObjectKey: "obj", Size: 40, ETag: `"e2"`,
+	})
+	if err != nil {
+		return err
+	}
+	size, _ = s.GetBucketSize("r1")
+	obj, err = s.GetObjectInfo("obj")
+	if err != nil {
+		return err
+	}
+	if err := must(
+		check(previous != nil && previous.Size == 100, "overwrite previous %+v", previous),
+		check(obj.ETag == `"e2"` && obj.StoredETag() == `"e2"`, "object etag after overwrite %s/%s", obj.ETag, obj.BackendETag),
+		check(size == 40, "r1 size after overwrite %d", size),
+	); err != nil {
+		return err
+	}
+
+	// 新上传失败后重新开始
+	if _, err := s.BeginUpload("v", "new", "r2", "new"); err != nil {
+		return err
+	}
+	if err := s.FailUpload("v", "new", ""); err != nil {
+		return err
+	}
+	failed, err := s.GetUploadMapping("v", "new")
+	if err != nil {
+		return err
+	}
+	if err := check(failed.Status == storage.UploadStatusFailed, "status after fail %q", failed.Status); err != nil {
+		return err
+	}
+	restarted, err := s.BeginUpload("v", "new", "r1", "new")
+	if err != nil {
+		return err
+	}
+	if err := check(restarted.Status == storage.UploadStatusPending && restarted.RealBucketName == "r2",
+		"restarted upload %+v", restarted); err != nil {
+		return err
+	}
+	if err := s.FailUpload("v", "new", ""); err != nil {
+		return err
+	}
+
+	// 有进行中分片上传会话的 pending 映射不过期
+	if _, err := s.BeginUpload("v", "mp", "r1", "mp"); err != nil {
+		return err
+	}
+	if err := s.RecordUploadSession("upload-mp", "mp", "r1", 0); err != nil {
+		return err
+	}
+
+	// 过期清理只移除未提交的映射
+	expired, err := s.ExpireUploadMappings(time.Now().Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if err := check(expired == 1, "expired %d mappings, want 1", expired); err != nil {
+		return err
+	}
+	if _, err := s.GetUploadMapping("v", "new"); err == nil {
+		return fmt.Errorf("expired mapping still present")
+	}
+	if _, err := s.GetVirtualBucketMapping("v", "obj"); err != nil {
+		return fmt.Errorf("expiry removed committed mapping: %w", err)
+	}
+	if _, err := s.GetUploadMapping("v", "mp"); err != nil {
+		return fmt.Errorf("expiry removed mapping of active multipart upload: %w", err)
+	}
+	due, err := s.GetDuePendingDeletions(0)
+	if err != nil {
+		return err
+	}
+	if err := check(len(due) == 1 && due[0].BucketName == "r2" && due[0].Key == "new", "pending deletions after expiry: %+v", due); err != nil {
+		return err
+	}
+
+	// 会话中止后映射随之过期
+	if err := s.UpdateUploadSession("upload-mp", 0, "aborted"); err != nil {
+		return err
+	}
+	expired, err = s.ExpireUploadMappings(time.Now().Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if err := check(expired == 1, "expired %d mappings after abort, want 1", expired); err != nil {
+		return err
+	}
+	if _, err := s.GetUploadMapping("v", "mp"); err == nil {
+		return fmt.Errorf("mapping of aborted multipart upload still present")
+	}
+	return nil
+}
+
+func testCopyAndRelease(s storage.MetadataStore) error {
+	for _, key := range []string{"a", "d"} {
+		if _, err := s.BeginUpload("v", key, "r1", key); err != nil {
+			return err
+		}
+		if _, err := s.CommitUpload(&storage.UploadCommit{
+			VirtualBucketName: "v", ObjectKey: key, RealBucketName: "r1", RealObjectKey: key, Size: 10,
+		}); err != nil {
+			return err
+		}
+	}
+
+	source, freed, err := s.CopyMapping("v", "a", "v", "c")
+	if err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err := check(source != nil && source.Key == "a" && freed == nil, "copy a->c: source=%+v freed=%+v", source, freed); err != nil {
+		return err
+	}
+	c, err := s.GetVirtualBucketMapping("v", "c")
+	if err != nil {
+		return err
+	}
+	if err := check(c.RealObjectKey == "a", "c points to %s", c.RealObjectKey); err != nil {
+		return err
+	}
+
+	// a 仍被 c 引用，覆盖 a 不释放真实对象
+	if _, freed, err = s.CopyMapping("v", "d", "v", "a"); err != nil {
+		return err
+	}
+	if err := check(freed == nil, "real object a freed while still referenced"); err != nil {
+		return err
+	}
+	// c 是最后一个引用，覆盖后真实对象 a 被释放
+	if _, freed, err = s.CopyMapping("v", "d", "v", "c"); err != nil {
+		return err
+	}
+	if err := check(freed != nil && freed.Key == "a" && freed.Size == 10, "freed object %+v", freed); err != nil {
+		return err
+	}
+	if _, err := s.GetObjectInfo("a"); err == nil {
+		return fmt.Errorf("freed object record still present")
+	}
+	if _, _, err := s.CopyMapping("v", "missing", "v", "x"); err == nil {
+		return fmt.Errorf("copy from missing source succeeded")
+	}
+
+	// 删除：真实对象 d 此时被 a、c、d 引用，删除最后一个引用时对象记录一并删除并入队
+	pending, deleted, err := s.DeleteMappingAndEnqueue("v", "a", "r1", "d")
+	if err != nil {
+		return err
+	}
+	if err := check(pending == nil && deleted == nil, "real object d released while referenced by c"); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v", "a"); err == nil {
+		return fmt.Errorf("deleted mapping still readable")
+	}
+	if pending, deleted, err = s.DeleteMappingAndEnqueue("v", "c", "r1", "d"); err != nil {
+		return err
+	}
+	if err := check(pending == nil && deleted == nil, "real object d released while referenced by d"); err != nil {
+		return err
+	}
+	pending, deleted, err = s.DeleteMappingAndEnqueue("v", "d", "r1", "d")
+	if err != nil {
+		return err
+	}
+	if err := check(pending != nil && deleted != nil && deleted.Key == "d", "last reference delete: pending=%+v deleted=%+v", pending, deleted); err != nil {
+		return err
+	}
+
+	size, _ := s.GetBucketSize("r1")
+	count, _ := s.GetBucketObjectCount("r1")
+	if err := check(size == 0 && count == 0, "r1 stats after releasing all: size=%d count=%d", size, count); err != nil {
+		return err
+	}
+	counts, err := s.CountPendingDeletions()
+	if err != nil {
+		return err
+	}
+	return check(counts["r1"] == 2, "pending deletions for r1: %d", counts["r1"])
+}
+
+func testPendingDeletions(s storage.MetadataStore) error {
+	if err := s.CreateVirtualBucketMapping("v", "x", "r1", "x"); err != nil {
+		return err
+	}
+	for _, key := range []string{"x", "y"} {
+		if _, _, err := s.DeleteMappingAndEnqueue("v", key, "r1", key); err != nil {
+			return err
+		}
+	}
+
+	due, err := s.GetDuePendingDeletions(10)
+	if err != nil {
+		return err
+	}
+	if err := check(len(due) == 2, "due deletions %d", len(due)); err != nil {
+		return err
+	}
+	limited, err := s.GetDuePendingDeletions(1)
+	if err != nil {
+		return err
+	}
+	if err := check(len(limited) == 1, "limit ignored: %d", len(limited)); err != nil {
+		return err
+	}
+
+	first := due[0]
+	if err := s.DeferPendingDeletion(first.ID, time.Now().Add(time.Hour), "boom"); err != nil {
+		return err
+	}
+	due, _ = s.GetDuePendingDeletions(10)
+	if err := check(len(due) == 1 && due[0].ID != first.ID, "deferred deletion still due"); err != nil {
+		return err
+	}
+	if err := s.DeferPendingDeletion(due[0].ID, time.Now().Add(-time.Second), "again"); err != nil {
+		return err
+	}
+	due, _ = s.GetDuePendingDeletions(10)
+	if err := check(len(due) == 1 && due[0].Attempts == 1 && due[0].LastError == "again", "deferred entry %+v", due); err != nil {
+		return err
+	}
+
+	if err := s.CompletePendingDeletion(due[0].ID); err != nil {
+		return err
+	}
+	counts, err := s.CountPendingDeletions()
+	if err != nil {
+		return err
+	}
+	if err := check(counts["r1"] == 1, "pending after complete: %v", counts); err != nil {
+		return err
+	}
+
+	referenced, err := s.IsRealObjectReferenced("r1", "x")
+	if err != nil {
+		return err
+	}
+	if err := check(!referenced, "released object reported as referenced"); err != nil {
+		return err
+	}
+	if err := s.RecordObject("x", "r1", 1, nil); err != nil {
+		return err
+	}
+	referenced, _ = s.IsRealObjectReferenced("r1", "x")
+	if err := check(referenced, "re-uploaded object not reported as referenced"); err != nil {
+		return err
+	}
+	if err := s.CreateVirtualBucketMapping("v", "z", "r1", "y"); err != nil {
+		return err
+	}
+	referenced, _ = s.IsRealObjectReferenced("r1", "y")
+	if err := check(referenced, "mapped object not reported as referenced"); err != nil {
+		return err
+	}
+
+	// 直接入队不修改映射与对象记录
+	pending, err := s.EnqueuePendingDeletion("r1", "y")
+	if err != nil {
+		return err
+	}
+	if err := check(pending != nil && pending.ID != 0 && pending.Key == "y", "enqueued entry %+v", pending); err != nil {
+		return err
+	}
+	if counts, err = s.CountPendingDeletions(); err != nil {
+		return err
+	}
+	if err := check(counts["r1"] == 2, "pending after enqueue: %v", counts); err != nil {
+		return err
+	}
+	referenced, _ = s.IsRealObjectReferenced("r1", "y")
+	return check(referenced, "enqueue removed the mapping of a referenced object")
+}
+
+func testUploadSessions(s storage.MetadataStore) error {
+	if err := must(
+		s.RecordUploadSession("u2", "b/key", "r1", 0),
+		s.RecordUploadSession("u1", "b/key", "r1", 0),
+		s.RecordUploadSession("u3", "a/key", "r2", 0),
+		s.RecordUploadSession("u4", "c/key", "r1", 0),
+	); err != nil {
+		return err
+	}
+	if err := s.RecordUploadSession("u1", "b/key", "r1", 0); err == nil {
+		return fmt.Errorf("duplicate upload id accepted")
+	}
+
+	session, err := s.GetUploadSession("u1")
+	if err != nil {
+		return err
+	}
+	if err := check(session.Key == "b/key" && session.BucketName == "r1" && session.Status == "pending" && session.ExpiresAt.After(time.Now()),
+		"unexpected session %+v", session); err != nil {
+		return err
+	}
+	if _, err := s.GetUploadSession("missing"); err == nil {
+		return fmt.Errorf("missing session returned")
+	}
+
+	if err := must(
+		s.IncrementUploadSessionSize("u1", 5),
+		s.IncrementUploadSessionSize("u1", 7),
+		s.UpdateUploadSession("u1", 2, "pending"),
+	); err != nil {
+		return err
+	}
+	size, err := s.GetUploadSessionSize("u1")
+	if err != nil {
+		return err
+	}
+	session, _ = s.GetUploadSession("u1")
+	if err := check(size == 12 && session.CompletedParts == 2, "session size=%d parts=%d", size, session.CompletedParts); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		prefix, keyMarker, idMarker string
+		max                         int
+		want                        []string
+	}{
+		{"", "", "", 0, []string{"u3", "u1", "u2", "u4"}},
+		{"b/", "", "", 0, []string{"u1", "u2"}},
+		{"", "b/key", "u1", 0, []string{"u2", "u4"}},
+		{"", "b/key", "", 0, []string{"u4"}},
+		{"", "", "", 1, []string{"u3", "u1"}},
+	}
+	for _, step := range steps {
+		sessions, err := s.GetPendingUploadSessions(step.prefix, step.keyMarker, step.idMarker, step.max)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(sessions))
+		for _, sess := range sessions {
+			ids = append(ids, sess.UploadID)
+		}
+		if !equalStrings(ids, step.want) {
+			return fmt.Errorf("GetPendingUploadSessions(%q, %q, %q, %d) = %v, want %v", step.prefix, step.keyMarker, step.idMarker, step.max, ids, step.want)
+		}
+	}
+
+	active, err := s.HasActiveUploadSession("u4")
+	if err != nil {
+		return err
+	}
+	if err := check(active, "pending session not active"); err != nil {
+		return err
+	}
+	if err := s.UpdateUploadSession("u4", 1, "completed"); err != nil {
+		return err
+	}
+	active, _ = s.HasActiveUploadSession("u4")
+	if err := check(!active, "completed session still active"); err != nil {
+		return err
+	}
+	if active, _ = s.HasActiveUploadSession("missing"); active {
+		return fmt.Errorf("missing session reported active")
+	}
+
+	// 上传会话随提交/失败同步更新
+	if _, err := s.BeginUpload("v", "b/key", "r1", "b/key"); err != nil {
+		return err
+	}
+	if _, err := s.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: "v", ObjectKey: "b/key", RealBucketName: "r1", RealObjectKey: "b/key",
+		Size: 12, UploadID: "u1", CompletedParts: 2,
+	}); err != nil {
+		return err
+	}
+	if err := s.FailUpload("v", "a/key", "u3"); err != nil {
+		return err
+	}
+	committed, _ := s.GetUploadSession("u1")
+	aborted, _ := s.GetUploadSession("u3")
+	if err := check(committed.Status == "completed" && aborted.Status == "aborted",
+		"session statuses after commit/fail: %s, %s", committed.Status, aborted.Status); err != nil {
+		return err
+	}
+
+	// 未过期的会话不会被清理
+	if err := s.CleanExpiredSessions(); err != nil {
+		return err
+	}
+	_, err = s.GetUploadSession("u2")
+	return err
+}
+
+func testOperationStats(s storage.MetadataStore) error {
+	for i := 0; i < 3; i++ {
+		if _, err := s.IncrementBucketOperation("r1", "A"); err != nil {
+			return err
+		}
+	}
+	count, err := s.IncrementBucketOperation("r1", "B")
+	if err != nil {
+		return err
+	}
+	if err := check(count == 1, "B count %d", count); err != nil {
+		return err
+	}
+	count, err = s.IncrementBucketOperation("r1", "A")
+	if err != nil {
+		return err
+	}
+	if err := check(count == 4, "A count %d", count); err != nil {
+		return err
+	}
+	if _, err := s.IncrementBucketOperation("r1", "C"); err == nil {
+		return fmt.Errorf("unknown category accepted")
+	}
+	if _, err := s.IncrementBucketOperation("r2", "B"); err != nil {
+		return err
+	}
+
+	counts, err := s.GetBucketOperationCounts()
+	if err != nil {
+		return err
+	}
+	if err := check(counts["r1"].CountA == 4 && counts["r1"].CountB == 1 && counts["r2"].CountB == 1,
+		"operation counts %+v", counts); err != nil {
+		return err
+	}
+
+	// 批量累加返回累加后的计数，并为新存储桶创建统计
+	totals, err := s.AddBucketOperations(map[string]storage.OperationCounts{
+		"r1": {CountA: 10},
+		"r3": {CountA: 2, CountB: 5},
+	})
+	if err != nil {
+		return err
+	}
+	if err := check(len(totals) == 2 && totals["r1"].CountA == 14 && totals["r1"].CountB == 1 &&
+		totals["r3"].CountA == 2 && totals["r3"].CountB == 5, "batch totals %+v", totals); err != nil {
+		return err
+	}
+	if totals, err = s.AddBucketOperations(nil); err != nil || len(totals) != 0 {
+		return fmt.Errorf("empty batch returned %+v, %v", totals, err)
+	}
+
+	// 操作计数与对象统计互不覆盖
+	if err := s.RecordObject("k", "r1", 9, nil); err != nil {
+		return err
+	}
+	counts, _ = s.GetBucketOperationCounts()
+	size, _ := s.GetBucketSize("r1")
+	return check(counts["r1"].CountA == 14 && counts["r3"].CountB == 5 && size == 9,
+		"counts %+v size %d after recording object", counts, size)
+}
+
+func testMonthlyStats(s storage.MetadataStore) error {
+	now := time.Now()
+	year, month := now.Year(), int(now.Month())
+	lastYear, lastMonth := year, month-1
+	if lastMonth == 0 {
+		lastYear, lastMonth = year-1, 12
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.IncrementBucketOperation("r1", "A"); err != nil {
+			return err
+		}
+	}
+	if _, err := s.IncrementBucketOperation("r1", "B"); err != nil {
+		return err
+	}
+	if err := s.ArchiveMonthlyStats(lastYear, lastMonth); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	// 重复归档同一月份是幂等的
+	if err := s.ArchiveMonthlyStats(lastYear, lastMonth); err != nil {
+		return fmt.Errorf("re-archive: %w", err)
+	}
+
+	archived, err := s.GetMonthlyStats(lastYear, lastMonth)
+	if err != nil {
+		return err
+	}
+	if err := check(len(archived) == 1 && archived[0].OperationCountA == 5 && archived[0].OperationCountB == 1,
+		"archived stats %+v", archived); err != nil {
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.IncrementBucketOperation("r1", "A"); err != nil {
+			return err
+		}
+	}
+	current, err := s.GetCurrentMonthStats()
+	if err != nil {
+		return err
+	}
+	if err := check(len(current) == 1 && current[0].OperationCountA == 2 && current[0].OperationCountB == 0 &&
+		current[0].Year == year && current[0].Month == month, "current month stats %+v", current); err != nil {
+		return err
+	}
+
+	if err := s.ArchiveMonthlyStats(year, month); err != nil {
+		return err
+	}
+	rangeStats, err := s.GetMonthlyStatsRange(lastYear, lastMonth, year, month)
+	if err != nil {
+		return err
+	}
+	if err := check(len(rangeStats) == 2 && rangeStats[0].Month == lastMonth && rangeStats[1].OperationCountA == 2,
+		"range stats %+v", rangeStats); err != nil {
+		return err
+	}
+
+	history, err := s.GetBucketMonthlyHistory("r1", 1)
+	if err != nil {
+		return err
+	}
+	if err := check(len(history) == 1 && history[0].Year == year && history[0].Month == month,
+		"history %+v", history); err != nil {
+		return err
+	}
+	history, _ = s.GetBucketMonthlyHistory("r1", 12)
+	return check(len(history) == 2, "full history length %d", len(history))
+}
+
+func testUsageScanState(s storage.MetadataStore) error {
+	state, err := s.GetUsageScanState("r1")
+	if err != nil {
+		return err
+	}
+	if err := check(state.BucketName == "r1" && state.ContinuationToken == "" && state.UntrackedSize == 0,
+		"initial state %+v", state); err != nil {
+		return err
+	}
+
+	state.ContinuationToken = "token-1"
+	state.PartialSize = 100
+	state.UntrackedSize = 42
+	if err := s.SaveUsageScanState(state); err != nil {
+		return err
+	}
+	loaded, err := s.GetUsageScanState("r1")
+	if err != nil {
+		return err
+	}
+	if err := check(loaded.ContinuationToken == "token-1" && loaded.PartialSize == 100, "loaded state %+v", loaded); err != nil {
+		return err
+	}
+
+	loaded.ContinuationToken = ""
+	if err := s.SaveUsageScanState(loaded); err != nil {
+		return err
+	}
+	again, _ := s.GetUsageScanState("r1")
+	untracked, err := s.GetUntrackedSize("r1")
+	if err != nil {
+		return err
+	}
+	other, _ := s.GetUntrackedSize("r2")
+	if err := check(again.ContinuationToken == "" && untracked == 42 && other == 0,
+		"state after update %+v untracked=%d other=%d", again, untracked, other); err != nil {
+		return err
+	}
+	if err := s.SaveUsageScanState(&storage.UsageScanState{}); err == nil {
+		return fmt.Errorf("state without bucket name accepted")
+	}
+	return nil
+}
+
+func testAccessLogs(s storage.MetadataStore) error {
+	if err := must(
+		s.RecordAccessLog("upload", "a", "v1", "10.0.0.1", "ua", "host", 10, true, "", 5),
+		s.RecordAccessLog("download", "a", "v1", "10.0.0.2", "ua", "host", 10, true, "", 3),
+		s.RecordAccessLog("download", "b", "v2", "10.0.0.1", "ua", "host", 0, false, "NoSuchKey", 1),
+	); err != nil {
+		return err
+	}
+	// 批量写入保留调用方给出的时间
+	earlier := time.Now().Add(-2 * time.Hour)
+	if err := s.RecordAccessLogs([]*storage.AccessLog{
+		{Action: "delete", Key: "c", BucketName: "v1", ClientIP: "10.0.0.3", Success: true, CreatedAt: earlier},
+		{Action: "delete", Key: "d", BucketName: "v1", ClientIP: "10.0.0.3", Success: true, CreatedAt: earlier},
+	}); err != nil {
+		return err
+	}
+
+	failed := false
+	steps := []struct {
+		filter *storage.AccessLogFilter
+		want   int
+	}{
+		{nil, 5},
+		{&storage.AccessLogFilter{Action: "download"}, 2},
+		{&storage.AccessLogFilter{Key: "a"}, 2},
+		{&storage.AccessLogFilter{BucketName: "v2"}, 1},
+		{&storage.AccessLogFilter{ClientIP: "10.0.0.1"}, 2},
+		{&storage.AccessLogFilter{Success: &failed}, 1},
+		{&storage.AccessLogFilter{StartTime: time.Now().Add(time.Hour)}, 0},
+		{&storage.AccessLogFilter{StartTime: time.Now().Add(-time.Hour)}, 3},
+		{&storage.AccessLogFilter{EndTime: time.Now().Add(-time.Hour)}, 2},
+		{&storage.AccessLogFilter{EndTime: time.Now().Add(time.Hour)}, 5},
+		{&storage.AccessLogFilter{Limit: 2}, 2},
+		{&storage.AccessLogFilter{Limit: 2, Offset: 4}, 1},
+	}
+	for i, step := range steps {
+		logs, err := s.GetAccessLogs(step.filter)
+		if err != nil {
+			return err
+		}
+		if len(logs) != step.want {
+			return fmt.Errorf("filter #%d returned %d logs, want %d", i, len(logs), step.want)
+		}
+	}
+
+	logs, err := s.GetAccessLogs(&storage.AccessLogFilter{Success: &failed})
+	if err != nil {
+		return err
+	}
+	return check(logs[0].ErrorMsg == "NoSuchKey" && logs[0].Key == "b" && logs[0].ResponseTime == 1, "failed log %+v", logs[0])
+}
+
+func testAccessLogRollups(s storage.MetadataStore) error {
+	// 两天前的 UTC 零点，日志按本地时区写入（与访问日志写入器一致）
+	base := storage.RollupPeriodStart(storage.RollupDay, time.Now()).Add(-48 * time.Hour)
+	at := func(d time.Duration) time.Time { return base.Add(d).Local() }
+	if err := s.RecordAccessLogs([]*storage.AccessLog{
+		{Action: "download", Key: "a", BucketName: "v1", Size: 10, Success: true, CreatedAt: at(10 * time.Minute)},
+		{Action: "download", Key: "b", BucketName: "v1", Size: 5, Success: false, CreatedAt: at(20 * time.Minute)},
+		{Action: "upload", Key: "c", BucketName: "v1", Size: 7, Success: true, CreatedAt: at(65 * time.Minute)},
+		{Action: "download", Key: "d", BucketName: "v2", Size: 3, Success: true, CreatedAt: at(70 * time.Minute)},
+		{Action: "download", Key: "a", BucketName: "v1", Size: 1, Success: true, CreatedAt: at(25 * time.Hour)},
+	}); err != nil {
+		return err
+	}
+
+	count, err := s.CountAccessLogs(&storage.AccessLogFilter{BucketName: "v1", Limit: 1})
+	if err != nil {
+		return err
+	}
+	if err := check(count == 4, "count of v1 logs %d", count); err != nil {
+		return err
+	}
+
+	// 重复汇总结果不变
+	for i := 0; i < 2; i++ {
+		if err := s.RollupAccessLogs(storage.RollupHour, base, base.Add(48*time.Hour)); err != nil {
+			return err
+		}
+	}
+	hourly, err := s.GetAccessLogRollups(&storage.AccessLogRollupFilter{Granularity: storage.RollupHour})
+	if err != nil {
+		return err
+	}
+	if err := check(len(hourly) == 4, "hourly rollups %d", len(hourly)); err != nil {
+		return err
+	}
+	first := hourly[0]
+	if err := check(first.PeriodStart.Equal(base) && first.BucketName == "v1" && first.Action == "download" &&
+		first.Requests == 2 && first.Bytes == 15 && first.Errors == 1, "first hourly rollup %+v", first); err != nil {
+		return err
+	}
+
+	if err := s.RollupAccessLogs(storage.RollupDay, base, base.Add(48*time.Hour)); err != nil {
+		return err
+	}
+	daily, err := s.GetAccessLogRollups(&storage.AccessLogRollupFilter{Granularity: storage.RollupDay, BucketName: "v1"})
+	if err != nil {
+		return err
+	}
+	if err := check(len(daily) == 3 && daily[0].Action == "download" && daily[0].Requests == 2 && daily[0].Bytes == 15 &&
+		daily[1].Action == "upload" && daily[2].PeriodStart.Equal(base.Add(24*time.Hour)) && daily[2].Requests == 1,
+		"daily rollups %+v", daily); err != nil {
+		return err
+	}
+	ranged, err := s.GetAccessLogRollups(&storage.AccessLogRollupFilter{
+		Granularity: storage.RollupDay, StartTime: base, EndTime: base.Add(24 * time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	if err := check(len(ranged) == 3, "daily rollups of first day %d", len(ranged)); err != nil {
+		return err
+	}
+
+	latestHour, err := s.LatestAccessLogRollup(storage.RollupHour)
+	if err != nil {
+		return err
+	}
+	latestDay, err := s.LatestAccessLogRollup(storage.RollupDay)
+	if err != nil {
+		return err
+	}
+	if err := check(latestHour.Equal(base.Add(25*time.Hour)) && latestDay.Equal(base.Add(24*time.Hour)),
+		"latest rollups hour=%v day=%v", latestHour, latestDay); err != nil {
+		return err
+	}
+
+	// 清理原始日志后汇总仍然保留
+	pruned, err := s.PruneAccessLogs(at(24 * time.Hour))
+	if err != nil {
+		return err
+	}
+	total, _ := s.CountAccessLogs(nil)
+	if err := check(pruned == 4 && total == 1, "pruned %d logs, %d left", pruned, total); err != nil {
+		return err
+	}
+	pruned, err = s.PruneAccessLogRollups(storage.RollupHour, base.Add(2*time.Hour))
+	if err != nil {
+		return err
+	}
+	hourly, _ = s.GetAccessLogRollups(&storage.AccessLogRollupFilter{Granularity: storage.RollupHour})
+	daily, _ = s.GetAccessLogRollups(&storage.AccessLogRollupFilter{Granularity: storage.RollupDay})
+	if err := check(pruned == 3 && len(hourly) == 1 && len(daily) == 4,
+		"pruned %d hourly rollups, %d hourly and %d daily left", pruned, len(hourly), len(daily)); err != nil {
+		return err
+	}
+
+	if err := s.RollupAccessLogs("week", base, base.Add(time.Hour)); err == nil {
+		return fmt.Errorf("unknown granularity accepted")
+	}
+	return nil
+}
+
+func testExportImport(src, dst storage.MetadataStore) error {
+	now := time.Now()
+	lastYear, lastMonth := now.Year(), int(now.Month())-1
+	if lastMonth == 0 {
+		lastYear, lastMonth = lastYear-1, 12
+	}
+
+	if err := must(
+		s3Put(src, "v", "a", "r1", 10),
+		s3Put(src, "v", "b", "r2", 20),
+		src.CreateVirtualBucketMapping("v", "alias", "r1", "a"),
+		src.RecordUploadSession("u1", "big", "r1", 0),
+		src.IncrementUploadSessionSize("u1", 5),
+	); err != nil {
+		return err
+	}
+	if _, err := src.BeginUpload("v", "inflight", "r2", "inflight"); err != nil {
+		return err
+	}
+	if _, err := src.IncrementBucketOperation("r1", "A"); err != nil {
+		return err
+	}
+	if err := src.ArchiveMonthlyStats(lastYear, lastMonth); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	exported, err := metadump.Export(src, &buf, "test")
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := check(exported.Counts.Objects == 2 && exported.Counts.Mappings == 4 && exported.Counts.UploadSessions == 1,
+		"export counts %+v", exported.Counts); err != nil {
+		return err
+	}
+	dump := buf.Bytes()
+
+	imported, err := metadump.Import(dst, bytes.NewReader(dump), metadump.ImportOptions{BatchSize: 3})
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if err := check(imported.Counts == exported.Counts, "imported %+v, exported %+v", imported.Counts, exported.Counts); err != nil {
+		return err
+	}
+
+	srcObj, _ := src.GetObjectInfo("a")
+	dstObj, err := dst.GetObjectInfo("a")
+	if err != nil {
+		return fmt.Errorf("imported object: %w", err)
+	}
+	alias, err := dst.GetVirtualBucketMapping("v", "alias")
+	if err != nil {
+		return fmt.Errorf("imported mapping: %w", err)
+	}
+	inflight, err := dst.GetUploadMapping("v", "inflight")
+	if err != nil {
+		return fmt.Errorf("imported pending mapping: %w", err)
+	}
+	sessionSize, _ := dst.GetUploadSessionSize("u1")
+	size, _ := dst.GetBucketSize("r1")
+	refs, _ := dst.CountMappingsToRealObject("r1", "a")
+	counts, _ := dst.GetBucketOperationCounts()
+	monthly, _ := dst.GetMonthlyStats(lastYear, lastMonth)
+	if err := must(
+		check(dstObj.Size == 10 && dstObj.BucketName == "r1", "imported object %+v", dstObj),
+		check(dstObj.CreatedAt.Unix() == srcObj.CreatedAt.Unix(), "created_at not preserved: %v vs %v", dstObj.CreatedAt, srcObj.CreatedAt),
+		check(alias.RealObjectKey == "a", "imported alias %+v", alias),
+		check(inflight.Status == storage.UploadStatusPending, "pending mapping imported as %q", inflight.Status),
+		check(sessionSize == 5, "imported session size %d", sessionSize),
+		check(size == 10, "imported r1 size %d", size),
+		check(refs == 2, "imported references to r1/a: %d", refs),
+		check(counts["r1"].CountA == 1, "imported operation counts %+v", counts["r1"]),
+		check(len(monthly) == 2, "imported monthly stats %+v", monthly),
+	); err != nil {
+		return err
+	}
+
+	// 目标已有数据时必须显式合并；合并同一文件是幂等的
+	if _, err := metadump.Import(dst, bytes.NewReader(dump), metadump.ImportOptions{}); err == nil {
+		return fmt.Errorf("import into a non-empty store succeeded without force")
+	}
+	if _, err := metadump.Import(dst, bytes.NewReader(dump), metadump.ImportOptions{Force: true}); err != nil {
+		return fmt.Errorf("re-import: %w", err)
+	}
+	after, err := dst.CountMetadata()
+	if err != nil {
+		return err
+	}
+	if err := check(*after == exported.Counts, "counts after re-import %+v", *after); err != nil {
+		return err
+	}
+	size, _ = dst.GetBucketSize("r1")
+	if err := check(size == 10, "r1 size after re-import %d", size); err != nil {
+		return err
+	}
+
+	// 截断的文件导入报错
+	truncated := dump[:bytes.LastIndexByte(dump[:len(dump)-1], '\n')+1]
+	_, err = metadump.Import(dst, bytes.NewReader(truncated), metadump.ImportOptions{Force: true})
+	return check(err != nil, "truncated dump imported without error")
+}
+
+// s3Put 模拟一次完整的上传：开始、提交
+func s3Put(s storage.MetadataStore, virtualBucket, key, realBucket string, size int64) error {
+	if _, err := s.BeginUpload(virtualBucket, key, realBucket, key); err != nil {
+		return err
+	}
+	_, err := s.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: virtualBucket, ObjectKey: key, RealBucketName: realBucket, RealObjectKey: key, Size: size,
+	})
+	return err
+}
+
+// testReadAfterWrite 查询不到时返回 ErrMappingNotFound/ErrObjectNotFound，且每次写入后立即读到新结果
+// （带查询缓存的存储需要在写入时失效缓存，包括缓存的不存在结果）
+// testWithContext WithContext 返回的视图与原存储读写同一份数据，并共享查询缓存的失效
+func testWithContext(s storage.MetadataStore) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	view := s.WithContext(ctx)
+
+	// 先经由原存储缓存不存在的结果，再经由视图写入
+	if _, err := s.GetObjectInfo("k"); !errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("missing object error %v is not ErrObjectNotFound", err)
+	}
+	if _, err := view.BeginUpload("v", "k", "r1", "k"); err != nil {
+		return err
+	}
+	if _, err := view.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: "v", ObjectKey: "k", RealBucketName: "r1", RealObjectKey: "k", Size: 10, ETag: `"e1"`,
+	}); err != nil {
+		return err
+	}
+	obj, err := s.GetObjectInfo("k")
+	if err != nil {
+		return fmt.Errorf("object written through view not visible: %w", err)
+	}
+	if err := check(obj.Size == 10, "object through view %+v", obj); err != nil {
+		return err
+	}
+
+	// 经由原存储删除后，视图读不到
+	if _, _, err := s.DeleteMappingAndEnqueue("v", "k", "r1", "k"); err != nil {
+		return err
+	}
+	if _, err := view.GetVirtualBucketMapping("v", "k"); !errors.Is(err, storage.ErrMappingNotFound) {
+		return fmt.Errorf("deleted mapping still visible through view: %v", err)
+	}
+	return nil
+}
+
+func testReadAfterWrite(s storage.MetadataStore) error {
+	if _, err := s.GetVirtualBucketMapping("v", "k"); !errors.Is(err, storage.ErrMappingNotFound) {
+		return fmt.Errorf("missing mapping error %v is not ErrMappingNotFound", err)
+	}
+	if _, err := s.GetObjectInfo("k"); !errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("missing object error %v is not ErrObjectNotFound", err)
+	}
+
+	if _, err := s.BeginUpload("v", "k", "r1", "k"); err != nil {
+		return err
+	}
+	if _, err := s.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: "v", ObjectKey: "k", RealBucketName: "r1", RealObjectKey: "k", Size: 10, ETag: `"e1"`,
+	}); err != nil {
+		return err
+	}
+	m, err := s.GetVirtualBucketMapping("v", "k")
+	if err != nil {
+		return fmt.Errorf("mapping not visible after commit: %w", err)
+	}
+	obj, err := s.GetObjectInfo("k")
+	if err != nil {
+		return fmt.Errorf("object not visible after commit: %w", err)
+	}
+	if err := must(
+		check(m.RealBucketName == "r1", "mapping points to %s", m.RealBucketName),
+		check(obj.ETag == `"e1"` && obj.Size == 10, "object after commit %+v", obj),
+	); err != nil {
+		return err
+	}
+
+	// 覆盖写
+	if _, err := s.CommitUpload(&storage.UploadCommit{
+		VirtualBucketName: "v", ObjectKey: "k", RealBucketName: "r1", RealObjectKey: "k", Size: 20, ETag: `"e2"`,
+	}); err != nil {
+		return err
+	}
+	if obj, err = s.GetObjectInfo("k"); err != nil {
+		return err
+	}
+	if err := check(obj.ETag == `"e2"` && obj.Size == 20, "object after overwrite %+v", obj); err != nil {
+		return err
+	}
+
+	// 复制到已存在的目标，目标原来的真实对象被释放
+	if err := must(
+		s.RecordObject("other", "r2", 5, nil),
+		s.CreateVirtualBucketMapping("v", "dst", "r2", "other"),
+	); err != nil {
+		return err
+	}
+	if _, err := s.GetObjectInfo("other"); err != nil {
+		return err
+	}
+	if _, _, err := s.CopyMapping("v", "k", "v", "dst"); err != nil {
+		return err
+	}
+	if m, err = s.GetVirtualBucketMapping("v", "dst"); err != nil {
+		return err
+	}
+	if err := check(m.RealObjectKey == "k", "copied mapping points to %s", m.RealObjectKey); err != nil {
+		return err
+	}
+	if _, err := s.GetObjectInfo("other"); !errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("freed object still visible: %v", err)
+	}
+
+	// 删除：第一个映射删除后真实对象仍被引用，第二个删除后对象记录被释放
+	if _, _, err := s.DeleteMappingAndEnqueue("v", "k", "r1", "k"); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v", "k"); !errors.Is(err, storage.ErrMappingNotFound) {
+		return fmt.Errorf("deleted mapping still visible: %v", err)
+	}
+	if _, err := s.GetObjectInfo("k"); err != nil {
+		return fmt.Errorf("referenced object released: %w", err)
+	}
+	if _, _, err := s.DeleteMappingAndEnqueue("v", "dst", "r1", "k"); err != nil {
+		return err
+	}
+	if _, err := s.GetObjectInfo("k"); !errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("released object still visible: %v", err)
+	}
+
+	// 删除整个虚拟存储桶的映射
+	if err := s.CreateVirtualBucketMapping("v2", "a", "r1", "a"); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v2", "a"); err != nil {
+		return err
+	}
+	if err := s.DeleteVirtualBucketMapping("v2"); err != nil {
+		return err
+	}
+	if _, err := s.GetVirtualBucketMapping("v2", "a"); !errors.Is(err, storage.ErrMappingNotFound) {
+		return fmt.Errorf("mapping of deleted bucket still visible: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package storetest_test
+
+import (
+	"testing"
+
+	"github.com/DullJZ/s3-balance/internal/storage/storetest"
+)
+
+// runStore 把 storetest 的每个用例作为子测试运行
+func runStore(t *testing.T, factory storetest.Factory) {
+	for _, r := range storetest.Run(factory) {
+		t.Run(r.Name, func(t *testing.T) {
+			if !r.Passed() {
+				t.Fatal(r.Error)
+			}
+		})
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStore(t, storetest.NewSQLiteFactory(t.TempDir()))
+}
+
+func TestBoltStore(t *testing.T) {
+	runStore(t, storetest.NewBoltFactory(t.TempDir()))
+}
+
+func TestCachedSQLiteStore(t *testing.T) {
+	runStore(t, storetest.WithLookupCache(storetest.NewSQLiteFactory(t.TempDir())))
+}
+
+func TestCachedBoltStore(t *testing.T) {
+	runStore(t, storetest.WithLookupCache(storetest.NewBoltFactory(t.TempDir())))
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 上传状态（虚拟映射的状态机）
+// 映射在上传开始时以 pending 写入；后端确认后与对象记录、存储桶统计在同一事务中变为 committed；
+// 上传失败或中止时变为 failed。读取路径只能看到 committed 的映射
+const (
+	UploadStatusPending   = "pending"
+	UploadStatusCommitted = "committed"
+	UploadStatusFailed    = "failed"
+)
+
+// Transaction 在一个数据库事务中执行 fn，fn 收到绑定到该事务的 Service
+// fn 返回错误或 panic 时整个事务回滚，所有通过 tx 执行的写入（映射、对象记录、统计）要么全部生效，要么全部不生效
+// 与 database.Transaction 使用同一连接；storage 不能依赖 database 包（database 迁移时引用 storage 模型）
+func (s *Service) Transaction(fn func(tx *Service) error) error {
+	return s.db.Transaction(func(db *gorm.DB) error {
+		return fn(&Service{db: db})
+	})
+}
+
+// GetUploadMapping 获取虚拟映射，不区分状态（供上传、分片上传等写入路径使用）
+func (s *Service) GetUploadMapping(virtualBucketName, objectKey string) (*VirtualBucketMapping, error) {
+	var mapping VirtualBucketMapping
+	if err := s.db.Where("virtual_bucket_name = ? AND object_key = ?", virtualBucketName, objectKey).First(&mapping).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %s/%s", ErrMappingNotFound, virtualBucketName, objectKey)
+		}
+		return nil, fmt.Errorf("failed to get virtual bucket mapping: %w", err)
+	}
+	return &mapping, nil
+}
+
+// BeginUpload 开始一次上传：映射不存在时以 pending 状态创建并返回
+// 已存在的映射（包括并发创建的）原样返回，调用方应写入其中记录的真实存储桶；failed 的映射重新进入 pending
+func (s *Service) BeginUpload(virtualBucketName, objectKey, realBucketName, realObjectKey string) (*VirtualBucketMapping, error) {
+	var result *VirtualBucketMapping
+	err := s.Transaction(func(tx *Service) error {
+		existing, err := tx.GetUploadMapping(virtualBucketName, objectKey)
+		if err == nil {
+			if existing.Status == UploadStatusFailed {
+				existing.Status = UploadStatusPending
+				if err := tx.db.Model(existing).Update("status", UploadStatusPending).Error; err != nil {
+					return fmt.Errorf("failed to restart upload: %w", err)
+				}
+			}
+			result = existing
+			return nil
+		}
+
+		mapping := &VirtualBucketMapping{
+			VirtualBucketName: virtualBucketName,
+			ObjectKey:         objectKey,
+			RealBucketName:    realBucketName,
+			RealObjectKey:     realObjectKey,
+			Status:            UploadStatusPending,
+		}
+		if err := tx.db.Create(mapping).Error; err != nil {
+			return fmt.Errorf("failed to create virtual bucket mapping: %w", err)
+		}
+		result = mapping
+		return nil
+	})
+	return result, err
+}
+
+// UploadCommit 提交上传所需的信息
+type UploadCommit struct {
+	VirtualBucketName string
+	ObjectKey         string
+	RealBucketName    string
+	RealObjectKey     string
+	Size              int64
+	ETag              string // 返回给客户端的 ETag
+	BackendETag       string // 后端返回的 ETag，与 ETag 相同时留空
+	Metadata          map[string]string
+	UploadID          string // 分片上传ID，非空时同时将上传会话标记为已完成
+	CompletedParts    int
+}
+
+// CommitUpload 后端确认写入后，在同一事务中提交映射、对象记录、存储桶统计和上传会话
+// 返回被覆盖的旧对象记录（不存在时为 nil），调用方据此调整已用容量
+func (s *Service) CommitUpload(c *UploadCommit) (*Object, error) {
+	var previous *Object
+	err := s.Transaction(func(tx *Service) error {
+		var old Object
+		err := tx.db.Where(tx.keyColumn()+" = ?", c.RealObjectKey).First(&old).Error
+		switch {
+		case err == nil:
+			previous = &old
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return fmt.Errorf("failed to get object info: %w", err)
+		}
+
+		// 覆盖由复制产生的映射时，映射改为指向本次写入的真实对象
+		current, mappingErr := tx.GetUploadMapping(c.VirtualBucketName, c.ObjectKey)
+
+		result := tx.db.Model(&VirtualBucketMapping{}).
+			Where("virtual_bucket_name = ? AND object_key = ?", c.VirtualBucketName, c.ObjectKey).
+			Updates(map[string]interface{}{
+				"real_bucket_name": c.RealBucketName,
+				"real_object_key":  c.RealObjectKey,
+				"status":           UploadStatusCommitted,
+				"updated_at":       time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to commit virtual bucket mapping: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// 上传期间映射被删除，以本次上传为准重新创建
+			if err := tx.db.Create(&VirtualBucketMapping{
+				VirtualBucketName: c.VirtualBucketName,
+				ObjectKey:         c.ObjectKey,
+				RealBucketName:    c.RealBucketName,
+				RealObjectKey:     c.RealObjectKey,
+				Status:            UploadStatusCommitted,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to create virtual bucket mapping: %w", err)
+			}
+		}
+
+		if err := tx.RecordObject(c.RealObjectKey, c.RealBucketName, c.Size, c.Metadata); err != nil {
+			return err
+		}
+		if err := tx.db.Model(&Object{}).Where(tx.keyColumn()+" = ?", c.RealObjectKey).Updates(map[string]interface{}{
+			"ETag":        c.ETag,
+			"BackendETag": c.BackendETag,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record object etag: %w", err)
+		}
+		if mappingErr == nil && (current.RealBucketName != c.RealBucketName || current.RealObjectKey != c.RealObjectKey) {
+			if _, _, err := tx.releaseRealObject(current.RealBucketName, current.RealObjectKey); err != nil {
+				return err
+			}
+		}
+		if previous != nil && previous.BucketName != c.RealBucketName {
+			if err := tx.updateBucketStats(previous.BucketName); err != nil {
+				return err
+			}
+		}
+
+		if c.UploadID != "" {
+			return tx.UpdateUploadSession(c.UploadID, c.CompletedParts, "completed")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// FailUpload 将未提交的映射标记为 failed，并将上传会话（如有）标记为已中止
+// 已提交的映射（覆盖写失败）保持不变，旧对象仍然可读
+func (s *Service) FailUpload(virtualBucketName, objectKey, uploadID string) error {
+	return s.Transaction(func(tx *Service) error {
+		if err := tx.db.Model(&VirtualBucketMapping{}).
+			Where("virtual_bucket_name = ? AND object_key = ? AND status = ?", virtualBucketName, objectKey, UploadStatusPending).
+			Updates(map[string]interface{}{
+				"status":     UploadStatusFailed,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("failed to mark upload as failed: %w", err)
+		}
+
+		if uploadID != "" {
+			return tx.UpdateUploadSession(uploadID, 0, "aborted")
+		}
+		return nil
+	})
+}
+
+// CopyMapping 在同一事务中让目标虚拟对象指向源对象的真实对象（零拷贝）
+// 目标原来指向的真实对象不再被引用时，删除其对象记录并加入待删除队列
+// 返回源对象记录（可能为 nil）和被释放的对象记录（没有时为 nil）
+func (s *Service) CopyMapping(sourceBucket, sourceKey, destBucket, destKey string) (*Object, *Object, error) {
+	var source, freed *Object
+	err := s.Transaction(func(tx *Service) error {
+		src, err := tx.GetVirtualBucketMapping(sourceBucket, sourceKey)
+		if err != nil {
+			return err
+		}
+		if obj, err := tx.GetObjectInfo(src.RealObjectKey); err == nil {
+			source = obj
+		}
+
+		dest, err := tx.GetUploadMapping(destBucket, destKey)
+		if err != nil {
+			return tx.db.Create(&VirtualBucketMapping{
+				VirtualBucketName: destBucket,
+				ObjectKey:         destKey,
+				RealBucketName:    src.RealBucketName,
+				RealObjectKey:     src.RealObjectKey,
+				Status:            UploadStatusCommitted,
+			}).Error
+		}
+
+		// Updates 会回写到 dest，先记下原来指向的真实对象
+		oldBucket, oldKey := dest.RealBucketName, dest.RealObjectKey
+		if err := tx.db.Model(dest).Updates(map[string]interface{}{
+			"real_bucket_name": src.RealBucketName,
+			"real_object_key":  src.RealObjectKey,
+			"status":           UploadStatusCommitted,
+			"updated_at":       time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update virtual bucket mapping: %w", err)
+		}
+		if oldBucket == src.RealBucketName && oldKey == src.RealObjectKey {
+			return nil
+		}
+		_, freed, err = tx.releaseRealObject(oldBucket, oldKey)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, freed, nil
+}
+
+// ExpireUploadMappings 清理早于 cutoff 仍未提交的映射（failed，或进程崩溃遗留的 pending）
+// 与删除相同，真实对象不再被引用时加入待删除队列（后端可能已写入成功但未来得及提交）
+// 仍有进行中分片上传会话的 pending 映射不清理，待会话完成、中止或过期后再处理
+func (s *Service) ExpireUploadMappings(cutoff time.Time) (int, error) {
+	var stale []*VirtualBucketMapping
+	if err := s.db.Where("status <> ? AND updated_at < ?", UploadStatusCommitted, cutoff).Find(&stale).Error; err != nil {
+		return 0, fmt.Errorf("failed to get stale upload mappings: %w", err)
+	}
+
+	expired := 0
+	for _, m := range stale {
+		err := s.Transaction(func(tx *Service) error {
+			if m.Status == UploadStatusPending {
+				active, err := tx.hasActiveUploadSessionFor(m.RealBucketName, m.RealObjectKey)
+				if err != nil || active {
+					return err
+				}
+			}
+			// 重新检查状态，避免与刚开始或刚提交的上传竞争
+			result := tx.db.Where("id = ? AND status <> ? AND updated_at < ?", m.ID, UploadStatusCommitted, cutoff).
+				Delete(&VirtualBucketMapping{})
+			if result.Error != nil {
+				return fmt.Errorf("failed to delete stale upload mapping: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			expired++
+			_, _, err := tx.releaseRealObject(m.RealBucketName, m.RealObjectKey)
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// hasActiveUploadSessionFor 判断真实对象是否有进行中（未完成、未中止、未过期）的分片上传会话
+func (s *Service) hasActiveUploadSessionFor(realBucketName, realObjectKey string) (bool, error) {
+	var count int64
+	if err := s.db.Model(&UploadSession{}).
+		Where("bucket_name = ? AND "+s.keyColumn()+" = ? AND status = ? AND expires_at > ?", realBucketName, realObjectKey, "pending", time.Now()).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to count upload sessions: %w", err)
+	}
+	return count > 0, nil
+}
+
+// releaseRealObject 在事务中释放不再被任何映射引用的真实对象：删除对象记录并加入待删除队列
+// 仍被引用时什么也不做，返回 nil
+func (s *Service) releaseRealObject(realBucketName, realObjectKey string) (*PendingDeletion, *Object, error) {
+	count, err := s.CountMappingsToRealObject(realBucketName, realObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > 0 {
+		return nil, nil, nil
+	}
+
+	var deleted *Object
+	var obj Object
+	err = s.db.Where(s.keyColumn()+" = ? AND bucket_name = ?", realObjectKey, realBucketName).First(&obj).Error
+	switch {
+	case err == nil:
+		if err := s.db.Delete(&obj).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to delete object: %w", err)
+		}
+		if err := s.updateBucketStats(realBucketName); err != nil {
+			return nil, nil, err
+		}
+		deleted = &obj
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, nil, fmt.Errorf("failed to find object: %w", err)
+	}
+
+	pending := &PendingDeletion{
+		BucketName:    realBucketName,
+		Key:           realObjectKey,
+		NextAttemptAt: time.Now(),
+	}
+	if err := s.db.Create(pending).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to enqueue pending deletion: %w", err)
+	}
+	return pending, deleted, nil
+}
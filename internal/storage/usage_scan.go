@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// GetUsageScanState 获取存储桶的对账扫描进度，不存在时返回未保存的初始状态
+func (s *Service) GetUsageScanState(bucketName string) (*UsageScanState, error) {
+	var state UsageScanState
+	err := s.db.Where("bucket_name = ?", bucketName).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &UsageScanState{BucketName: bucketName}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage scan state: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveUsageScanState 保存存储桶的对账扫描进度
+func (s *Service) SaveUsageScanState(state *UsageScanState) error {
+	if state.BucketName == "" {
+		return fmt.Errorf("bucket name cannot be empty")
+	}
+	if err := s.db.Save(state).Error; err != nil {
+		return fmt.Errorf("failed to save usage scan state: %w", err)
+	}
+	return nil
+}
+
+// GetUntrackedSize 返回最近一次对账扫描发现的、代理未记录的数据大小
+func (s *Service) GetUntrackedSize(bucketName string) (int64, error) {
+	var size int64
+	if err := s.db.Model(&UsageScanState{}).
+		Where("bucket_name = ?", bucketName).
+		Select("COALESCE(SUM(untracked_size), 0)").
+		Scan(&size).Error; err != nil {
+		return 0, fmt.Errorf("failed to get untracked size: %w", err)
+	}
+	return size, nil
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/DullJZ/s3-balance/internal/config"
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 本服务创建的 span 使用的 Tracer 名称
+const instrumentationName = "github.com/DullJZ/s3-balance"
+
+// RequestIDHeader S3 响应中的请求 ID 头，启用追踪时取值为 trace ID，便于从客户端报错定位链路
+const RequestIDHeader = "X-Amz-Request-Id"
+
+// Setup 按配置初始化全局 TracerProvider 与传播器，返回用于退出时写出剩余 span 的关闭函数
+// 未启用时保持 OpenTelemetry 默认的空实现，各处埋点几乎没有开销
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg config.TracingConfig) (sdktrace.SpanExporter, error) {
+	if cfg.Exporter == config.TracingExporterStdout {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+
+	if cfg.Protocol == config.TracingProtocolHTTP {
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		return otlptrace.New(ctx, otlptracehttp.NewClient(opts...))
+	}
+
+	var opts []otlptracegrpc.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(cfg.Headers))
+	}
+	return otlptrace.New(ctx, otlptracegrpc.NewClient(opts...))
+}
+
+// Tracer 返回本服务使用的 Tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start 在 ctx 下创建子 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span，err 不为 nil 时记录错误并把状态置为 Error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware 为每个请求创建服务端 span（沿用上游传入的 traceparent），
+// 并在响应头中写入请求 ID，S3 错误响应的 RequestId 从该响应头读取，请求期间的日志从上下文读取
+// 路径以 skipPrefixes 之一开头的请求（指标抓取、Web 界面静态资源）不创建 span
+func Middleware(next http.Handler, skipPrefixes ...string) http.Handler {
+	withRequestID := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := newRequestID(r.Context())
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
+	})
+	return otelhttp.NewHandler(withRequestID, "s3-balance",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "HTTP " + r.Method
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			for _, prefix := range skipPrefixes {
+				if prefix != "" && strings.HasPrefix(r.URL.Path, prefix) {
+					return false
+				}
+			}
+			return true
+		}),
+	)
+}
+
+// newRequestID 请求被采样或携带上游追踪上下文时使用 trace ID，否则生成 16 位随机十六进制串
+func newRequestID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return strings.ToUpper(sc.TraceID().String())
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return strings.ToUpper(hex.EncodeToString(id))
+}
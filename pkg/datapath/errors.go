@@ -0,0 +1,154 @@
+package datapath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// Error 后端数据请求失败的分类结果
+// Code 为 S3 错误码（后端返回的错误码，或根据状态码/网络错误推断），StatusCode 为对应的 HTTP 状态码
+type Error struct {
+	Op         string // SDK 操作名，如 PutObject
+	Bucket     string // 真实存储桶
+	Key        string // 真实对象key
+	Code       string
+	Message    string
+	StatusCode int
+	RequestID  string // 后端返回的请求ID，便于在后端排查
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s/%s: %s (status %d", e.Op, e.Bucket, e.Key, e.Code, e.StatusCode)
+	if e.RequestID != "" {
+		msg += ", request id " + e.RequestID
+	}
+	msg += ")"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap 返回 SDK 原始错误，熔断器据此判断是否为后端故障
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NotFound 对象或分片上传在后端不存在
+func (e *Error) NotFound() bool {
+	switch e.Code {
+	case "NoSuchKey", "NoSuchUpload", "NotFound":
+		return true
+	}
+	return false
+}
+
+// AsError 从错误链中取出 *Error
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// Classify 把 SDK 错误转换为 *Error，供直接调用 SDK 的操作（如完成分片上传）使用
+func Classify(op, bucketName, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{Op: op, Bucket: bucketName, Key: key, Err: err}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		e.StatusCode = respErr.HTTPStatusCode()
+		e.RequestID = respErr.ServiceRequestID()
+	}
+
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() != "" && e.StatusCode != 0:
+		e.Code = apiErr.ErrorCode()
+		e.Message = apiErr.ErrorMessage()
+	case e.StatusCode != 0:
+		// HEAD 等没有响应体的错误只有状态码
+		e.Code = codeForStatus(e.StatusCode)
+	case errors.Is(err, context.Canceled):
+		e.Code = "RequestCanceled"
+		e.StatusCode = 499
+		e.Message = "Request canceled by client"
+	case errors.Is(err, bucket.ErrClientBody):
+		e.Code = "IncompleteBody"
+		e.StatusCode = http.StatusBadRequest
+		e.Message = "Failed to read request body"
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Code = "ServiceUnavailable"
+		e.StatusCode = http.StatusServiceUnavailable
+		e.Message = "Backend request timed out"
+	default:
+		// 网络错误、DNS 失败等，后端没有返回响应
+		e.Code = "ServiceUnavailable"
+		e.StatusCode = http.StatusServiceUnavailable
+		e.Message = "Backend is unreachable"
+	}
+	return e
+}
+
+// codeForStatus 根据状态码推断 S3 错误码
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "NoSuchKey"
+	case http.StatusForbidden:
+		return "AccessDenied"
+	case http.StatusPreconditionFailed:
+		return "PreconditionFailed"
+	case http.StatusNotModified:
+		return "NotModified"
+	case http.StatusRequestedRangeNotSatisfiable:
+		return "InvalidRange"
+	case http.StatusServiceUnavailable:
+		return "ServiceUnavailable"
+	}
+	if status >= http.StatusInternalServerError {
+		return "InternalError"
+	}
+	return "InvalidRequest"
+}
+
+// clientBody 标记客户端请求体的读取错误，使其不被当作后端网络错误计入熔断
+type clientBody struct {
+	r io.Reader
+}
+
+func (c clientBody) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = markClientBody(err)
+	}
+	return n, err
+}
+
+// markClientBody 把错误标记为客户端请求体错误
+func markClientBody(err error) error {
+	if errors.Is(err, bucket.ErrClientBody) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", bucket.ErrClientBody, err)
+}
+
+// wrapClientBody 包装只能读一次的客户端请求体；可重读的请求体（暂存文件、内存缓冲）原样返回，保留 SDK 的重试与签名能力
+func wrapClientBody(body io.Reader) io.Reader {
+	if _, seekable := body.(io.ReadSeeker); seekable || body == nil {
+		return body
+	}
+	return clientBody{r: body}
+}
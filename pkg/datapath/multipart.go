@@ -0,0 +1,310 @@
+package datapath
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var logger = logging.Logger(logging.SubsystemAPI)
+
+const (
+	// S3 分片数量与分片大小限制
+	maxParts    = 10000
+	minPartSize = 5 * 1024 * 1024
+
+	// 中止分片上传的超时，请求已被取消时仍需完成清理
+	abortTimeout = 30 * time.Second
+)
+
+// MultipartOptions 把单次 PUT 拆分为后端分片上传的参数
+type MultipartOptions struct {
+	PartSize    int64         // 分片大小，对象过大时自动放大以满足 10000 个分片的上限
+	Concurrency int           // 并行上传的分片数
+	PartRetries int           // 单个分片失败后的重试次数
+	PartTimeout time.Duration // 单个分片上传的超时，0 表示不限制
+
+	// OnRequest 每发出一个后端请求（初始化、分片、完成、中止）调用一次，用于操作计数
+	OnRequest func()
+}
+
+// part 一个待上传的分片，buf 上传完成后归还缓冲池
+type part struct {
+	number int32
+	buf    []byte
+	size   int
+}
+
+// PutObjectMultipart 把长度已知的 in.Body 拆分为分片并行上传到真实存储桶
+// 请求体只顺序读取一次，内存占用不超过 (Concurrency+1) 个分片；每个分片缓存在内存中，
+// 因此可以单独重试。提供了 Content-MD5 时在完成上传前校验整个对象，不匹配则中止上传
+// 返回的 ETag 是整个请求体的 MD5（与单次 PUT 相同），后端的分片形式 ETag（"<md5>-N"）放在 BackendETag
+func PutObjectMultipart(ctx context.Context, b *bucket.BucketInfo, in *PutInput, opts MultipartOptions) (*PutOutput, error) {
+	partSize := effectivePartSize(in.ContentLength, opts.PartSize)
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	onRequest := opts.OnRequest
+	if onRequest == nil {
+		onRequest = func() {}
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.Config.Name),
+		Key:    aws.String(in.Key),
+	}
+	if in.ContentType != "" {
+		createInput.ContentType = aws.String(in.ContentType)
+	}
+	if len(in.Metadata) > 0 {
+		createInput.Metadata = in.Metadata
+	}
+	onRequest()
+	created, err := b.Client.CreateMultipartUpload(ctx, createInput)
+	if err != nil {
+		return nil, Classify("CreateMultipartUpload", b.Config.Name, in.Key, err)
+	}
+	uploadID := aws.ToString(created.UploadId)
+
+	completed, sum, err := uploadParts(ctx, b, in, uploadID, partSize, concurrency, opts, onRequest)
+	if err != nil {
+		abortMultipart(b, in.Key, uploadID, onRequest)
+		return nil, err
+	}
+
+	onRequest()
+	out, err := b.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.Config.Name),
+		Key:             aws.String(in.Key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		abortMultipart(b, in.Key, uploadID, onRequest)
+		return nil, Classify("CompleteMultipartUpload", b.Config.Name, in.Key, err)
+	}
+	return &PutOutput{
+		ETag:        fmt.Sprintf("\"%x\"", sum),
+		BackendETag: aws.ToString(out.ETag),
+		VersionID:   aws.ToString(out.VersionId),
+	}, nil
+}
+
+// uploadParts 顺序读取请求体并由 concurrency 个协程并行上传分片，返回按分片号排序的完成列表与请求体的 MD5
+func uploadParts(ctx context.Context, b *bucket.BucketInfo, in *PutInput, uploadID string, partSize int64, concurrency int, opts MultipartOptions, onRequest func()) ([]types.CompletedPart, []byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 缓冲池限制同时驻留内存的分片数：并行上传中的分片加上正在读取的一个
+	pool := make(chan []byte, concurrency+1)
+	for i := 0; i < concurrency+1; i++ {
+		pool <- nil
+	}
+	jobs := make(chan part)
+
+	var (
+		mu        sync.Mutex
+		firstErr  error
+		completed []types.CompletedPart
+		wg        sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				etag, err := uploadPartWithRetry(ctx, b, in.Key, uploadID, p, opts, onRequest)
+				pool <- p.buf
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				completed = append(completed, types.CompletedPart{
+					ETag:       aws.String(etag),
+					PartNumber: aws.Int32(p.number),
+				})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	digest := md5.New()
+	readErr := readParts(ctx, in, partSize, pool, jobs, digest)
+	close(jobs)
+	wg.Wait()
+
+	if readErr != nil {
+		if ctx.Err() != nil {
+			readErr = Classify("PutObject", b.Config.Name, in.Key, ctx.Err())
+		} else {
+			readErr = &Error{
+				Op:         "PutObject",
+				Bucket:     b.Config.Name,
+				Key:        in.Key,
+				Code:       "IncompleteBody",
+				Message:    "You did not provide the number of bytes specified by the Content-Length HTTP header.",
+				StatusCode: 400,
+				Err:        markClientBody(readErr),
+			}
+		}
+		fail(readErr)
+	}
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	sum := digest.Sum(nil)
+	if in.ContentMD5 != "" && base64.StdEncoding.EncodeToString(sum) != in.ContentMD5 {
+		return nil, nil, &Error{
+			Op:         "PutObject",
+			Bucket:     b.Config.Name,
+			Key:        in.Key,
+			Code:       "BadDigest",
+			Message:    "The Content-MD5 you specified did not match what we received.",
+			StatusCode: 400,
+			Err:        bucket.ErrClientBody,
+		}
+	}
+
+	sort.Slice(completed, func(i, j int) bool {
+		return aws.ToInt32(completed[i].PartNumber) < aws.ToInt32(completed[j].PartNumber)
+	})
+	return completed, sum, nil
+}
+
+// readParts 把请求体按分片大小读入缓冲区并分发给上传协程，读取失败或上传出错时停止并返回错误
+func readParts(ctx context.Context, in *PutInput, partSize int64, pool chan []byte, jobs chan<- part, digest hash.Hash) error {
+	remaining := in.ContentLength
+	for number := int32(1); remaining > 0; number++ {
+		var buf []byte
+		select {
+		case buf = <-pool:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if buf == nil {
+			buf = make([]byte, partSize)
+		}
+
+		size := partSize
+		if remaining < size {
+			size = remaining
+		}
+		n, err := io.ReadFull(in.Body, buf[:size])
+		if err != nil {
+			pool <- buf
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("failed to read part %d from request body: %w", number, err)
+		}
+		digest.Write(buf[:n])
+		remaining -= int64(n)
+
+		select {
+		case jobs <- part{number: number, buf: buf, size: n}:
+		case <-ctx.Done():
+			pool <- buf
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// uploadPartWithRetry 上传一个分片，后端暂时性错误时按指数退避单独重试该分片
+func uploadPartWithRetry(ctx context.Context, b *bucket.BucketInfo, key, uploadID string, p part, opts MultipartOptions, onRequest func()) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= opts.PartRetries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(1<<uint(attempt-1)) * time.Second
+			logger.WarnContext(ctx, "Retrying multipart part upload", "bucket", b.Config.Name, "key", key, "part_number", p.number, "attempt", attempt, "delay", delay.String(), "error", lastErr)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return "", lastErr
+			}
+		}
+
+		partCtx, cancel := ctx, context.CancelFunc(func() {})
+		if opts.PartTimeout > 0 {
+			partCtx, cancel = context.WithTimeout(ctx, opts.PartTimeout)
+		}
+		onRequest()
+		etag, err := UploadPart(partCtx, b, &PartInput{
+			Key:           key,
+			UploadID:      uploadID,
+			PartNumber:    p.number,
+			Body:          bytes.NewReader(p.buf[:p.size]),
+			ContentLength: int64(p.size),
+		})
+		cancel()
+		if err == nil {
+			return etag, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !retryable(err) {
+			break
+		}
+	}
+	return "", lastErr
+}
+
+// retryable 后端限流、5xx 与网络错误可以重试，其余错误（如 4xx）重试也不会成功
+func retryable(err error) bool {
+	e, ok := AsError(err)
+	if !ok {
+		return false
+	}
+	return e.StatusCode >= 500 || e.Code == "RequestTimeout" || e.Code == "SlowDown"
+}
+
+// abortMultipart 中止分片上传，释放后端已上传的分片
+func abortMultipart(b *bucket.BucketInfo, key, uploadID string, onRequest func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+	onRequest()
+	if _, err := b.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.Config.Name),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}); err != nil {
+		logger.ErrorContext(ctx, "Failed to abort multipart upload", "bucket", b.Config.Name, "key", key, "upload_id", uploadID, "error", err)
+	}
+}
+
+// effectivePartSize 保证分片不小于 5MB 且分片数不超过 10000
+func effectivePartSize(contentLength, partSize int64) int64 {
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if contentLength > partSize*maxParts {
+		partSize = (contentLength + maxParts - 1) / maxParts
+		// 向上取整到 MB
+		const mb = 1024 * 1024
+		partSize = (partSize + mb - 1) / mb * mb
+	}
+	return partSize
+}
@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/DullJZ/s3-balance/internal/bucket"
+	"github.com/DullJZ/s3-balance/internal/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Presigner 预签名URL生成器
@@ -43,7 +45,10 @@ type UploadURL struct {
 }
 
 // GenerateUploadURL 生成上传预签名URL
-func (p *Presigner) GenerateUploadURL(ctx context.Context, bucket *bucket.BucketInfo, key string, contentType string, metadata map[string]string) (*UploadURL, error) {
+func (p *Presigner) GenerateUploadURL(ctx context.Context, bucket *bucket.BucketInfo, key string, contentType string, metadata map[string]string) (result *UploadURL, err error) {
+	ctx, span := tracing.Start(ctx, "presigner.GenerateUploadURL", attribute.String("bucket.name", bucket.Config.Name))
+	defer func() { tracing.End(span, err) }()
+
 	presignClient := s3.NewPresignClient(bucket.Client)
 
 	// 构建PutObject请求
@@ -98,7 +103,10 @@ type DownloadURL struct {
 }
 
 // GenerateDownloadURL 生成下载预签名URL
-func (p *Presigner) GenerateDownloadURL(ctx context.Context, bucket *bucket.BucketInfo, key string) (*DownloadURL, error) {
+func (p *Presigner) GenerateDownloadURL(ctx context.Context, bucket *bucket.BucketInfo, key string) (result *DownloadURL, err error) {
+	ctx, span := tracing.Start(ctx, "presigner.GenerateDownloadURL", attribute.String("bucket.name", bucket.Config.Name))
+	defer func() { tracing.End(span, err) }()
+
 	presignClient := s3.NewPresignClient(bucket.Client)
 
 	// 构建GetObject请求
@@ -134,7 +142,10 @@ type DeleteURL struct {
 }
 
 // GenerateDeleteURL 生成删除预签名URL
-func (p *Presigner) GenerateDeleteURL(ctx context.Context, bucket *bucket.BucketInfo, key string) (*DeleteURL, error) {
+func (p *Presigner) GenerateDeleteURL(ctx context.Context, bucket *bucket.BucketInfo, key string) (result *DeleteURL, err error) {
+	ctx, span := tracing.Start(ctx, "presigner.GenerateDeleteURL", attribute.String("bucket.name", bucket.Config.Name))
+	defer func() { tracing.End(span, err) }()
+
 	presignClient := s3.NewPresignClient(bucket.Client)
 
 	// 构建DeleteObject请求
@@ -170,7 +181,10 @@ type MultipartUploadURLs struct {
 }
 
 // GenerateMultipartUploadURLs 生成分片上传预签名URLs
-func (p *Presigner) GenerateMultipartUploadURLs(ctx context.Context, bucket *bucket.BucketInfo, key string, partCount int) (*MultipartUploadURLs, error) {
+func (p *Presigner) GenerateMultipartUploadURLs(ctx context.Context, bucket *bucket.BucketInfo, key string, partCount int) (result *MultipartUploadURLs, err error) {
+	ctx, span := tracing.Start(ctx, "presigner.GenerateMultipartUploadURLs", attribute.String("bucket.name", bucket.Config.Name))
+	defer func() { tracing.End(span, err) }()
+
 	// 初始化分片上传
 	createResp, err := bucket.Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
 		Bucket: aws.String(bucket.Config.Name),